@@ -26,6 +26,26 @@ func KeyDir(path string) (fpath string, err error) {
 	return
 }
 
+// ReceiptDir: the directory holding the receipts for entries signed by the user,
+// which is receipts/ inside KeyDir(path).
+func ReceiptDir(path string) (string, error) {
+	dir, err := KeyDir(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "receipts"), nil
+}
+
+// QueueDir: the directory holding the signed entries that wait for the server, see custody watch-dir,
+// which is queue/ inside KeyDir(path).
+func QueueDir(path string) (string, error) {
+	dir, err := KeyDir(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "queue"), nil
+}
+
 // LoadPublicKey: parse the public key from the base directory at dir,
 // returns an error if we fail to read the x509 formatted file, or
 // fail to parse the cert itself.
@@ -0,0 +1,154 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var backupDir string
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Take a verified online snapshot of the custody database.",
+	Long: `custody backup copies the database at --dsn into --out with VACUUM INTO,
+which gives a consistent snapshot while the server keeps running.
+Next to the snapshot it writes a manifest of row counts, the ledger tip, the Merkle root
+and the latest checkpoint, signed with the server key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := custody.Dial(dsn)
+		Fatal(err, "could not open database: %s")
+		key, err := custody.LoadServerKey(serverKeyPath)
+		Fatal(err, "could not load server key: %s")
+		m, err := db.Backup(key, backupDir)
+		Fatal(err, "backup failed: %s")
+		if config.json {
+			Output(m)
+			return
+		}
+		fmt.Printf("wrote backup to %s\n", backupDir)
+		printSnapshotManifest(m)
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore backupdir",
+	Short: "Verify a backup and restore it as the custody database.",
+	Long: `custody restore checks the manifest signature and the snapshot digest, compares the snapshot
+with the manifest, and verifies every entry signature, checkpoint, timestamp and cosignature in it.
+Only if everything verifies is the snapshot copied to the database file named by --dsn,
+which must not exist yet. Use --serverkey to pin the server public key.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		target := dsnPath(dsn)
+		if target == "" {
+			log.Fatal("you must provide the database to restore to with --dsn")
+		}
+		var pinned *ecdsa.PublicKey
+		if pinnedKeyPath != "" {
+			keybytes, err := ioutil.ReadFile(pinnedKeyPath)
+			Fatal(err, "could not read server key: %s")
+			pinned, err = crypto.ParseECDSAPublicKey(keybytes)
+			Fatal(err, "could not parse server key: %s")
+		}
+		r, err := custody.Restore(args[0], target, pinned)
+		if r != nil {
+			if config.json {
+				Output(r)
+			} else {
+				printBackupReport(r)
+			}
+		}
+		if err != nil {
+			log.Printf("restore failed: %s", err)
+			os.Exit(1)
+		}
+		fmt.Printf("restored %s to %s\n", args[0], target)
+	},
+}
+
+// dsnPath: the file named by a sqlite connection string such as file:custody.sqlite?cache=shared.
+func dsnPath(dsn string) string {
+	path := strings.TrimPrefix(dsn, "file:")
+	path = strings.TrimPrefix(path, "//")
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+// printSnapshotManifest: a human readable summary of a backup manifest.
+func printSnapshotManifest(m *custody.SnapshotManifest) {
+	fmt.Printf("Created: %s\n", m.CreatedAt)
+	fmt.Printf("Snapshot SHA-256: %s\n", m.Digest)
+	for _, table := range []string{"identities", "ledger", "items", "checkpoints", "timestamps", "cosignatures"} {
+		fmt.Printf("  %s: %d rows\n", table, m.Rows[table])
+	}
+	if m.Tip != nil {
+		fmt.Printf("Ledger tip: entry %d leaf %s\n", m.Tip.Entry, crypto.EncodeBinary(m.Tip.Leaf))
+	}
+	fmt.Printf("Merkle root: %s\n", crypto.EncodeBinary(m.Root))
+	if m.Checkpoint != nil {
+		fmt.Printf("Checkpoint: size=%d root=%s\n", m.Checkpoint.Size, crypto.EncodeBinary(m.Checkpoint.Root))
+	}
+}
+
+// printBackupReport: a human readable summary of a verified backup.
+func printBackupReport(r *custody.BackupReport) {
+	printSnapshotManifest(&r.Manifest)
+	if r.Pinned {
+		fmt.Printf("Server key: %s (pinned)\n", r.ServerKey)
+	} else {
+		fmt.Printf("Server key: %s (NOT pinned, compare this fingerprint with the server operator)\n", r.ServerKey)
+	}
+	if a := r.Audit; a != nil {
+		fmt.Printf("Signatures verified: %d/%d\n", a.Signatures, a.Entries)
+		fmt.Printf("Checkpoints verified: %d/%d\n", a.Checkpoints, r.Manifest.Rows["checkpoints"])
+		fmt.Printf("Timestamps verified: %d/%d\n", a.Timestamps, r.Manifest.Rows["timestamps"])
+		fmt.Printf("Cosignatures verified: %d/%d\n", a.Cosignatures, r.Manifest.Rows["cosignatures"])
+	}
+	for _, f := range r.Failures {
+		fmt.Printf("FAILED: %s\n", f)
+	}
+	if r.OK() {
+		fmt.Println("Backup OK")
+	} else {
+		fmt.Println("Backup FAILED verification")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(backupCmd)
+	RootCmd.AddCommand(restoreCmd)
+	backupCmd.Flags().StringVar(&backupDir, "out", "custody-backup", "directory to write the snapshot and manifest to")
+	backupCmd.Flags().StringVar(&serverKeyPath, "serverkey", "custody_server_ecdsa", "path to the server signing key")
+	restoreCmd.Flags().StringVar(&pinnedKeyPath, "serverkey", "", "path to the trusted server public key (custody_server_ecdsa.pub)")
+}
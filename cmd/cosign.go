@@ -0,0 +1,120 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+// cosignCmd represents the cosign command
+var cosignCmd = &cobra.Command{
+	Use:   "cosign proposal",
+	Short: "Approve an entry that needs the approval of other users.",
+	Long: `custody cosign 3 prints proposed entry 3 and signs your approval of it, which is a ledger entry of its own.
+The approval that meets the requirement of the entry appends it to the ledger.
+custody list shows the entries waiting for your approval.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		Fatal(err, "a proposed entry is named by its number: %s")
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		var prs []*custody.Proposal
+		req := custody.RecordRequest{}
+		authorize("Clerk.Proposals", &req)
+		err = client.Call("Clerk.Proposals", &req, &prs)
+		Fatal(err, "could not list proposed entries: %s")
+		var pr *custody.Proposal
+		for _, p := range prs {
+			if p.Entry.ID == id {
+				pr = p
+			}
+		}
+		if pr == nil {
+			log.Fatalf("proposed entry %d is not waiting for your approval", id)
+		}
+		fmt.Printf("approving entry proposed by %s:\n%s\n", pr.Proposer, pr.Entry.Message)
+		data, hash := signMessage(custody.ApprovalMessage(id, pr.Entry.Message), pr.Entry.CaseID, pr.Entry.Item)
+		req = custody.RecordRequest{Name: username, Data: data, Hash: hash, Entry: id}
+		var reply custody.Proposal
+		err = client.Call("Clerk.Approve", &req, &reply)
+		Fatal(err, "could not approve: %s")
+		if reply.Status == custody.ProposalAppended {
+			fmt.Printf("approved, the entry is appended as entry %d\n", reply.Entry.Ledger)
+		} else {
+			fmt.Printf("approved, %d of %d approvals\n", len(reply.Approvals), reply.Entry.Threshold)
+		}
+		Output(reply)
+	},
+}
+
+// propose: sign message with the approval requirement of the sign flags and send it for approval.
+func propose(message string) {
+	r := custody.Requirement{Threshold: signRequire, Approvers: signApprovers, Roles: signApproverRoles,
+		Deadline: time.Now().Add(signDeadline).Truncate(time.Second)}
+	data, hash := signMessage(custody.ProposalMessage(message, r), caseID, itemTag)
+	client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+	Fatal(err, "dialing: %s")
+	req := custody.RecordRequest{Name: username, Data: data, Hash: hash, Case: caseID, Item: itemTag, Requirement: &r}
+	var reply custody.Proposal
+	err = client.Call("Clerk.Propose", &req, &reply)
+	Fatal(err, "could not propose the entry: %s")
+	fmt.Printf("proposed entry %d, it needs %s: custody cosign %d\n", reply.Entry.ID, r, reply.Entry.ID)
+	Output(reply)
+}
+
+// printProposals: the pending entries proposed by the user and those waiting for their approval.
+func printProposals(prs []*custody.Proposal) {
+	header := false
+	for _, pr := range prs {
+		if pr.Status != custody.ProposalPending {
+			continue
+		}
+		if !header {
+			fmt.Println("Pending approvals:")
+			header = true
+		}
+		p := pr.Entry
+		approved := "no approvals"
+		if len(pr.Approvals) > 0 {
+			approved = "approved by " + strings.Join(pr.Approvals, ", ")
+		}
+		status := "waiting for approvers"
+		if pr.Proposer != username {
+			status = "waiting for you"
+		}
+		message := strings.SplitN(p.Message, "\n", 2)[0]
+		fmt.Printf("  Proposal:%d, Proposer:%s, Deadline:%s, %d of %d, %s, %s, Message:%s\n",
+			p.ID, pr.Proposer, p.Deadline.Format(time.RFC3339), len(pr.Approvals), p.Threshold, approved, status, message)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(cosignCmd)
+}
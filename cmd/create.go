@@ -35,8 +35,11 @@ import (
 	"github.gatech.edu/NIJ-Grant/custody/models"
 )
 
+var rotateKey bool
+
 // SubmitIdentity: user the API connection to create a user based on the username and the public key.
-func SubmitIdentity(user string, key *ecdsa.PublicKey) (i models.Identity, err error) {
+// If current is not nil the key replaces it, signed by current.
+func SubmitIdentity(user string, key *ecdsa.PublicKey, current *ecdsa.PrivateKey) (i models.Identity, err error) {
 	rpcclient, err := rpc.DialHTTP("tcp", serverAddress+":4911")
 	Fatal(err, "dialing: %s")
 	keybytes, err := x509.MarshalPKIXPublicKey(key)
@@ -47,6 +50,11 @@ func SubmitIdentity(user string, key *ecdsa.PublicKey) (i models.Identity, err e
 
 	var reply models.Identity
 	req := &custody.RecordRequest{Name: user, PublicKey: keybytes}
+	if current != nil {
+		req.Data = []byte(custody.KeyRotationMessage(user, keybytes))
+		req.Hash, err = cryptopasta.Sign(req.Data, current)
+		Fatal(err, "could not sign the rotation: %s")
+	}
 	log.Printf("Requesting Creation: %v", req)
 
 	// Synchronous call
@@ -61,7 +69,9 @@ func SubmitIdentity(user string, key *ecdsa.PublicKey) (i models.Identity, err e
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new user for the custody system",
-	Long:  `Enrolls a new user in the system by generating their x509 cert.`,
+	Long: `Enrolls a new user in the system by generating their x509 cert.
+With --rotate it replaces the key of an enrolled user, the current key signs the new one
+and the old key is kept only to verify the entries it signed.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		var pubkeypath string
@@ -72,16 +82,23 @@ var createCmd = &cobra.Command{
 		log.Printf("creating user: %s", username)
 		key, err := cryptopasta.NewSigningKey()
 		Fatal(err, "could not generate key: %s")
+		var current *ecdsa.PrivateKey
+		if rotateKey {
+			current, err = client.LoadPrivateKey("")
+			Fatal(err, "could not load the current key: %s")
+		}
+		// the keys are stored once the server accepts them, so that a refused request keeps the current key
+		id, err := SubmitIdentity(username, &key.PublicKey, current)
+		Fatal(err, "could not submit user: %v")
 		err = client.StoreKeys(key, "")
 		Fatal(err, "could not store keys: %s")
-		id, err := SubmitIdentity(username, &key.PublicKey)
-		Fatal(err, "could not submit user: %v")
 		Output(id)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(createCmd)
+	createCmd.Flags().BoolVar(&rotateKey, "rotate", false, "replace the key of an enrolled user, signed by the current key")
 
 	// Here you will define your flags and configuration settings.
 
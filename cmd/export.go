@@ -0,0 +1,66 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var bundlePath string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export an offline-verifiable evidence bundle for a case.",
+	Long: `custody export writes a zip archive holding every ledger entry of a case,
+the public keys of everyone who signed them, Merkle inclusion proofs and a checkpoint signed by the server.
+The bundle can be checked without access to the server using custody verify-bundle.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var reply []byte
+		if caseID == "" {
+			log.Fatal("you must provide a case with --case")
+		}
+		log.Printf("exporting case: %s", caseID)
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+
+		req := custody.RecordRequest{Case: caseID}
+		authorize("Clerk.Export", &req)
+		err = client.Call("Clerk.Export", &req, &reply)
+		Fatal(err, "could not export case: %s")
+
+		err = ioutil.WriteFile(bundlePath, reply, 0644)
+		Fatal(err, "could not write bundle: %s")
+		fmt.Printf("wrote bundle for case %s to %s\n", caseID, bundlePath)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVar(&caseID, "case", "", "the case to export")
+	exportCmd.Flags().StringVar(&bundlePath, "out", "bundle.zip", "path to write the bundle to")
+}
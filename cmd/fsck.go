@@ -0,0 +1,118 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+var fsckStore string
+
+// fsckCmd represents the fsck command
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check the integrity of the custody database and the evidence store.",
+	Long: `custody fsck reads the database at --dsn and checks
+  the signature of every ledger entry against the key of its identity,
+  the Merkle root of every checkpoint against the ledger, and its signature with --serverkey,
+  every timestamp token and witness cosignature,
+  that entries and checkpoints follow each other in time,
+  that no row refers to an entry, item or identity that does not exist,
+  and with --store that every blob still matches its digest and belongs to an item.
+Signatures and blobs are checked in parallel. It exits with status 1 if anything is found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dsn == "" {
+			log.Fatal("you must provide the database to check with --dsn")
+		}
+		db, err := custody.Dial(dsn)
+		Fatal(err, "could not open database: %s")
+		var pinned *ecdsa.PublicKey
+		if pinnedKeyPath != "" {
+			keybytes, err := ioutil.ReadFile(pinnedKeyPath)
+			Fatal(err, "could not read server key: %s")
+			pinned, err = crypto.ParseECDSAPublicKey(keybytes)
+			Fatal(err, "could not parse server key: %s")
+		}
+		var evidence *store.Store
+		if fsckStore != "" {
+			if _, err = os.Stat(fsckStore); err != nil {
+				log.Fatalf("no evidence store: %s", err)
+			}
+			evidence, err = store.Open(fsckStore)
+			Fatal(err, "could not open the evidence store: %s")
+			evidence.Keys, err = store.LoadKeyring(storeKeyFile)
+			Fatal(err, "could not load the master keys: %s")
+		}
+		r, err := db.Fsck(pinned, evidence)
+		Fatal(err, "fsck failed: %s")
+		if config.json {
+			Output(r)
+		} else {
+			printFsckReport(r, pinned != nil, evidence != nil)
+		}
+		if !r.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+// printFsckReport: a human readable summary of an fsck.
+func printFsckReport(r *custody.FsckReport, pinned, blobs bool) {
+	a := r.Audit
+	fmt.Printf("Signatures verified: %d/%d\n", a.Signatures, a.Entries)
+	if pinned {
+		fmt.Printf("Checkpoints verified: %d\n", a.Checkpoints)
+	} else {
+		fmt.Printf("Checkpoints verified: %d (roots only, give --serverkey to check signatures)\n", a.Checkpoints)
+	}
+	fmt.Printf("Timestamps verified: %d\n", a.Timestamps)
+	fmt.Printf("Cosignatures verified: %d\n", a.Cosignatures)
+	fmt.Printf("Merkle root: %s\n", crypto.EncodeBinary(a.Root))
+	if blobs {
+		fmt.Printf("Blobs verified: %d/%d\n", r.Verified, r.Blobs)
+	}
+	for _, f := range a.Failures {
+		fmt.Printf("FAILED: %s\n", f)
+	}
+	for _, f := range r.Findings {
+		fmt.Printf("FAILED: %s\n", f)
+	}
+	if r.OK() {
+		fmt.Println("fsck OK")
+	} else {
+		fmt.Printf("fsck found %d problems\n", len(a.Failures)+len(r.Findings))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(fsckCmd)
+	fsckCmd.Flags().StringVar(&pinnedKeyPath, "serverkey", "", "path to the trusted server public key (custody_server_ecdsa.pub)")
+	fsckCmd.Flags().StringVar(&fsckStore, "store", "", "the evidence store to check")
+	fsckCmd.Flags().StringVar(&storeKeyFile, "store-key-file", "", "file with the master keys of the evidence store (default $"+store.EnvKey+")")
+}
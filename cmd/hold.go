@@ -0,0 +1,146 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/rpc"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var holdItem, holdReason string
+
+// holdCmd represents the hold command
+var holdCmd = &cobra.Command{
+	Use:   "hold",
+	Short: "Place and release legal holds.",
+	Long: `A legal hold on a case or an item keeps it from being disposed of, whatever its retention period.
+Placing and releasing a hold are ledger entries signed by the user. Custodians, prosecutors and admins can do both.`,
+}
+
+// holdPlaceCmd represents the hold place command
+var holdPlaceCmd = &cobra.Command{
+	Use:   "place",
+	Short: "Place a legal hold on a case or an item.",
+	Long: `custody hold place --case C --reason "..." holds every item of case C,
+custody hold place --item E-9 --reason "..." holds a single item.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (caseID == "") == (holdItem == "") {
+			log.Fatal("name either a case with --case or an item with --item")
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		scope, item := itemScope(client, caseID, holdItem)
+		b := make([]byte, 8)
+		_, err = rand.Read(b)
+		Fatal(err, "could not choose a nonce: %s")
+		nonce := hex.EncodeToString(b)
+		data, hash := signMessage(custody.HoldMessage(caseID, holdItem, holdReason, nonce), scope, item)
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash, Case: caseID, Item: holdItem, Description: holdReason, Nonce: nonce}
+		var reply models.Hold
+		err = client.Call("Clerk.PlaceHold", &req, &reply)
+		Fatal(err, "could not place legal hold: %s")
+		fmt.Printf("placed legal hold %d by entry %d\n", reply.ID, reply.Ledger)
+		Output(reply)
+	},
+}
+
+// holdReleaseCmd represents the hold release command
+var holdReleaseCmd = &cobra.Command{
+	Use:   "release id",
+	Short: "Release a legal hold.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		Fatal(err, "a legal hold is named by its number: %s")
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		// the release is an entry in the case or about the item of the hold, so look the hold up first
+		req := custody.RecordRequest{}
+		authorize("Clerk.Holds", &req)
+		var holds []*models.Hold
+		err = client.Call("Clerk.Holds", &req, &holds)
+		Fatal(err, "could not list legal holds: %s")
+		var hold *models.Hold
+		for _, h := range holds {
+			if h.ID == id {
+				hold = h
+			}
+		}
+		if hold == nil {
+			log.Fatalf("no legal hold %d", id)
+		}
+		scope, item := itemScope(client, hold.CaseID, hold.Item)
+		data, hash := signMessage(custody.ReleaseMessage(id, holdReason), scope, item)
+		req = custody.RecordRequest{Name: username, Data: data, Hash: hash, Hold: id, Description: holdReason}
+		var reply models.Hold
+		err = client.Call("Clerk.ReleaseHold", &req, &reply)
+		Fatal(err, "could not release legal hold: %s")
+		fmt.Printf("released legal hold %d by entry %d\n", reply.ID, reply.Released)
+		Output(reply)
+	},
+}
+
+// holdListCmd represents the hold list command
+var holdListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the legal holds on a case or an item, or every hold.",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Case: caseID, Item: holdItem}
+		authorize("Clerk.Holds", &req)
+		var reply []*models.Hold
+		err = client.Call("Clerk.Holds", &req, &reply)
+		Fatal(err, "could not list legal holds: %s")
+		for _, h := range reply {
+			status := "active"
+			if h.Released != 0 {
+				status = fmt.Sprintf("released by entry %d", h.Released)
+			}
+			where := "case " + h.CaseID
+			if h.Item != "" {
+				where = "item " + h.Item
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", h.ID, h.CreatedAt.Format("2006-01-02 15:04:05"), where, status, h.Reason)
+		}
+		Output(reply)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(holdCmd)
+	holdCmd.AddCommand(holdPlaceCmd)
+	holdCmd.AddCommand(holdReleaseCmd)
+	holdCmd.AddCommand(holdListCmd)
+	for _, c := range []*cobra.Command{holdPlaceCmd, holdListCmd} {
+		c.Flags().StringVar(&caseID, "case", "", "the case")
+		c.Flags().StringVar(&holdItem, "item", "", "the evidence item")
+	}
+	holdPlaceCmd.Flags().StringVar(&holdReason, "reason", "", "why the evidence is held, such as the order or case that requires it")
+	holdReleaseCmd.Flags().StringVar(&holdReason, "reason", "", "why the hold is released")
+}
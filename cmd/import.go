@@ -0,0 +1,134 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var importFormat string
+var importMapping []string
+var importDryRun bool
+var importUsers []string
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import file",
+	Short: "Import legacy custody logs from csv or json.",
+	Long: `custody import appends the records of a legacy custody log to the ledger.
+Each record needs an actor, a time and an action, and may name a case, an evidence item,
+an item description and a sha256 digest. By default each field is read from the column of the same name,
+use --map field=column to read it from another column, for example --map actor="Received By".
+The user field names the enrolled user an actor is, or use --user actor=user to map an actor name,
+for example --user "J. Smith=jsmith".
+A csv file needs a header row, a json file holds an array of objects.
+
+Nobody signed these records when the events happened. Each one is stored as an imported entry,
+marked with the file and row it came from and signed by you, the importing administrator.
+Items that are not registered yet are registered from their first record, whose entry registers them.
+The import is all or nothing. Use --dry-run to check every row without storing anything.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var reply custody.ImportResult
+		path := args[0]
+		format := importFormat
+		if format == "" {
+			format = strings.TrimPrefix(filepath.Ext(path), ".")
+		}
+		mapping := map[string]string{}
+		for _, m := range importMapping {
+			kv := strings.SplitN(m, "=", 2)
+			if len(kv) != 2 {
+				log.Fatalf("bad mapping %q, use field=column", m)
+			}
+			mapping[kv[0]] = kv[1]
+		}
+
+		f, err := os.Open(path)
+		Fatal(err, "could not open import file: %s")
+		defer f.Close()
+		recs, errs, err := custody.ParseImport(f, format, filepath.Base(path), mapping)
+		Fatal(err, "could not read import file: %s")
+		users := map[string]string{}
+		for _, u := range importUsers {
+			kv := strings.SplitN(u, "=", 2)
+			if len(kv) != 2 {
+				log.Fatalf("bad user %q, use actor=user", u)
+			}
+			users[kv[0]] = kv[1]
+		}
+		for _, rec := range recs {
+			if rec.User == "" {
+				rec.User = users[rec.Actor]
+			}
+		}
+
+		key, err := client.LoadPrivateKey("")
+		Fatal(err, "could not load private key: %s")
+		for _, rec := range recs {
+			err = rec.Sign(key)
+			Fatal(err, "could not sign record: %s")
+		}
+
+		if len(errs) == 0 || importDryRun {
+			client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+			Fatal(err, "dialing: %s")
+			req := custody.RecordRequest{Name: username, Records: recs, DryRun: importDryRun || len(errs) > 0}
+			err = client.Call("Clerk.Import", &req, &reply)
+			Fatal(err, "import failed: %s")
+		}
+		reply.Errors = append(errs, reply.Errors...)
+		if config.json {
+			Output(reply)
+		} else {
+			for _, e := range reply.Errors {
+				fmt.Println(e)
+			}
+			switch {
+			case len(reply.Errors) > 0:
+				fmt.Printf("%d rows have errors, nothing was imported\n", len(reply.Errors))
+			case importDryRun:
+				fmt.Printf("dry run: %d rows are valid and would register %d new items\n", len(recs), len(reply.Items))
+			default:
+				fmt.Printf("imported %d rows, registered %d new items\n", reply.Imported, len(reply.Items))
+			}
+		}
+		if len(reply.Errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importFormat, "format", "", "csv or json, defaults to the file extension")
+	importCmd.Flags().StringArrayVar(&importMapping, "map", nil, "read a field from a differently named column, as field=column, may be repeated")
+	importCmd.Flags().StringArrayVar(&importUsers, "user", nil, "the enrolled user an actor is, as actor=user, may be repeated")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "check every row and report errors without importing")
+}
@@ -0,0 +1,115 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/container"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var allowMismatch bool
+
+// ingestCmd represents the ingest command
+var ingestCmd = &cobra.Command{
+	Use:   "ingest image tag",
+	Short: "Register a forensic image (E01, Ex01 or AFF4) as an evidence item.",
+	Long: `custody ingest reads the acquisition metadata of an Expert Witness (E01, Ex01) or AFF4 image,
+hashes the media inside it and checks the MD5 and SHA-1 the acquisition tool embedded.
+The item is registered with a ledger entry that records the format, case and evidence numbers, examiner,
+acquisition date, tool, the embedded hashes and whether they matched, and the SHA-256 of the media.
+The case number and description of the image are used unless --case or --description are given.
+An image whose media does not match its embedded hashes is refused unless --allow-mismatch is given,
+in which case the mismatch is recorded in the ledger. Segmented images are read from the path of the first segment.
+The hash list of the media in blocks of --block-size bytes is registered as well, see custody verify-file --media.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, tag := args[0], args[1]
+		img, err := container.Open(path)
+		Fatal(err, "could not open image: %s")
+		defer img.Close()
+		log.Printf("verifying %d bytes of %s media", img.Size, img.Format)
+		v, err := img.Verify()
+		Fatal(err, "could not read media: %s")
+		for _, c := range v.Checks {
+			if c.OK() {
+				fmt.Printf("embedded %s %x verified\n", c.Algorithm, c.Embedded)
+			} else {
+				fmt.Printf("embedded %s %x MISMATCH, media hashes to %x\n", c.Algorithm, c.Embedded, c.Computed)
+			}
+		}
+		if len(v.Checks) == 0 {
+			fmt.Println("the image has no embedded hashes")
+		}
+		if !v.OK() && len(v.Checks) > 0 && !allowMismatch {
+			log.Fatal("the media does not match the embedded hashes, use --allow-mismatch to record it anyway")
+		}
+
+		var list *piecewise.List
+		if blockSize != 0 {
+			list, err = piecewise.Hash(img, img.Size, blockSize)
+			Fatal(err, "could not hash media: %s")
+		}
+		if caseID == "" {
+			caseID = img.CaseNumber
+		}
+		if itemDescription == "" {
+			itemDescription = img.Description
+		}
+		record := &custody.IngestRecord{Metadata: img.Metadata, Checks: v.Checks}
+		message := custody.IngestMessage(tag, itemDescription, record, v.SHA256)
+		if list != nil {
+			message = custody.HashListMessage(message, list)
+		}
+		key, err := client.LoadPrivateKey("")
+		Fatal(err, "could not load private key: %s")
+		hash, err := custody.SignEntry(key, message, caseID, tag)
+		Fatal(err, "could not sign registration: %s")
+
+		var reply models.Item
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Name: username, Data: []byte(message), Hash: hash, Case: caseID, Item: tag,
+			Description: itemDescription, Digest: v.SHA256, HashList: list, Ingest: record}
+		err = client.Call("Clerk.Ingest", &req, &reply)
+		Fatal(err, "could not register item: %s")
+		if config.json {
+			Output(reply)
+		} else {
+			fmt.Printf("registered %s image %s as item %s in case %s\n%s\n", img.Format, path, reply.Tag, reply.CaseID, message)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ingestCmd)
+	ingestCmd.Flags().StringVar(&caseID, "case", "", "the case the item belongs to, the case number of the image if not given")
+	ingestCmd.Flags().StringVar(&itemDescription, "description", "", "a description of the item, the description in the image if not given")
+	ingestCmd.Flags().Int64Var(&blockSize, "block-size", piecewise.DefaultBlockSize, "bytes per block of the hash list of the media, 0 for none")
+	ingestCmd.Flags().BoolVar(&allowMismatch, "allow-mismatch", false, "register the image even if its media does not match its embedded hashes")
+}
@@ -0,0 +1,277 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var itemDescription, itemDigest, itemFile, itemNote, itemState string
+var blockSize int64
+
+// itemCmd represents the item command
+var itemCmd = &cobra.Command{
+	Use:   "item",
+	Short: "Manage evidence items.",
+	Long: `Evidence items are the physical or digital objects whose custody is tracked.
+Each item has a tag, such as the evidence number written on the bag, and ledger entries
+signed with custody sign --item refer to it.
+
+Items go through the lifecycle states ` + strings.Join(custody.States, ", ") + `.
+A registered item is collected, and custody item move records each change of state as a signed entry.`,
+}
+
+// itemAddCmd represents the item add command
+var itemAddCmd = &cobra.Command{
+	Use:   "add tag",
+	Short: "Register a new evidence item.",
+	Long: `custody item add registers an evidence item with a signed ledger entry.
+The digest of a file can be recorded with --file, or given directly as hex with --sha256.
+With --file the SHA-256 of every --block-size bytes of the file is recorded as well,
+and the registration commits to their Merkle root, so that custody verify-file can later
+report which byte ranges of a copy differ. --block-size 0 records only the digest.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var reply models.Item
+		var digest []byte
+		var list *piecewise.List
+		var err error
+		tag := args[0]
+
+		switch {
+		case itemFile != "":
+			digest, list, err = hashFile(itemFile)
+			Fatal(err, "could not hash file: %s")
+		case itemDigest != "":
+			digest, err = hex.DecodeString(itemDigest)
+			Fatal(err, "could not decode digest: %s")
+		}
+
+		key, err := client.LoadPrivateKey("")
+		Fatal(err, "could not load private key: %s")
+		message := custody.ItemMessage(tag, itemDescription)
+		if list != nil {
+			message = custody.HashListMessage(message, list)
+		}
+		data := []byte(message)
+		hash, err := custody.SignEntry(key, message, caseID, tag)
+		Fatal(err, "could not sign registration: %s")
+
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash,
+			Case: caseID, Item: tag, Description: itemDescription, Digest: digest, HashList: list}
+		err = client.Call("Clerk.CreateItem", &req, &reply)
+		Fatal(err, "could not register item: %s")
+		log.Printf("Item: %+v", reply)
+		if config.json {
+			Output(reply)
+		} else {
+			fmt.Printf("registered item %s in case %s\n", reply.Tag, reply.CaseID)
+		}
+	},
+}
+
+// itemSignUploadCmd represents the item sign-upload command
+var itemSignUploadCmd = &cobra.Command{
+	Use:   "sign-upload file tag",
+	Short: "Sign a file for upload to the web server as a new evidence item.",
+	Long: `custody item sign-upload prints the sha256, block_size and signature fields of the web upload form.
+The signature covers the tag, the case given with --case, the description, the digest of the file and the Merkle root
+of its hash list in blocks of --block-size bytes, so the web server only registers the item
+if it receives exactly this file. With --block-size 0 no hash list is recorded and the block_size field is left out.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		digest, list, err := hashFile(args[0])
+		Fatal(err, "could not hash file: %s")
+		key, err := client.LoadPrivateKey("")
+		Fatal(err, "could not load private key: %s")
+		message := custody.UploadMessage(args[1], itemDescription, digest)
+		fmt.Printf("sha256=%x\n", digest)
+		if list != nil {
+			message = custody.HashListMessage(message, list)
+			fmt.Printf("block_size=%d\n", list.BlockSize)
+		}
+		sig, err := custody.SignEntry(key, message, caseID, args[1])
+		Fatal(err, "could not sign upload: %s")
+		fmt.Printf("signature=%s\n", crypto.EncodeBinary(sig))
+	},
+}
+
+// itemMoveCmd represents the item move command
+var itemMoveCmd = &cobra.Command{
+	Use:   "move tag state",
+	Short: "Move an evidence item to another lifecycle state.",
+	Long: `custody item move E-9 checked-out --note "imaging at the lab" signs an entry that moves the item from its
+current state to the new one. The moves an item can make from each state are
+  collected: in-transit, in-storage
+  in-transit: in-storage
+  in-storage: in-transit, checked-out, released, destroyed
+  checked-out: returned
+  returned: in-transit, in-storage, checked-out, released, destroyed
+and released and destroyed items do not move again.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		tag, to := args[0], args[1]
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Item: tag}
+		authorize("Clerk.ItemStatus", &req)
+		var st custody.ItemStatus
+		err = client.Call("Clerk.ItemStatus", &req, &st)
+		Fatal(err, "could not find the state of the item: %s")
+		Fatal(custody.CanMove(st.State.State, to), "%s")
+		data, hash := signMessage(custody.StateMessage(tag, st.State.State, st.State.Ledger, to, itemNote), st.Item.CaseID, tag)
+		req = custody.RecordRequest{Name: username, Data: data, Hash: hash, Item: tag, State: to, Description: itemNote}
+		var reply models.ItemState
+		err = client.Call("Clerk.Move", &req, &reply)
+		Fatal(err, "could not move item: %s")
+		if config.json {
+			Output(reply)
+		} else {
+			fmt.Printf("item %s moved from %s to %s by entry %d\n", tag, st.State.State, reply.State, reply.Ledger)
+		}
+	},
+}
+
+// itemStatusCmd represents the item status command
+var itemStatusCmd = &cobra.Command{
+	Use:   "status tag",
+	Short: "Show the lifecycle state of an evidence item and its moves.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Item: args[0]}
+		authorize("Clerk.ItemStatus", &req)
+		var reply custody.ItemStatus
+		err = client.Call("Clerk.ItemStatus", &req, &reply)
+		Fatal(err, "could not find the state of the item: %s")
+		if config.json {
+			Output(reply)
+			return
+		}
+		fmt.Printf("item %s of case %s is %s since %s\n", reply.Item.Tag, reply.Item.CaseID, reply.State.State,
+			reply.State.UpdatedAt.Format("2006-01-02 15:04:05"))
+		if reply.Disposed != 0 {
+			fmt.Printf("disposed of by entry %d\n", reply.Disposed)
+		}
+		for _, l := range reply.History {
+			fmt.Printf("%d\t%s\t%s\n", l.ID, l.CreatedAt.Format("2006-01-02 15:04:05"), l.Message)
+		}
+	},
+}
+
+// itemListCmd represents the item list command
+var itemListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List evidence items and their lifecycle states.",
+	Long: `custody item list --case C9 --state checked-out lists the items of case C9 that are checked out.
+Without --case it lists the items of every case, for users who read every case, and without --state items in any state.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Case: caseID, State: itemState}
+		authorize("Clerk.ItemStates", &req)
+		var reply []*models.ItemState
+		err = client.Call("Clerk.ItemStates", &req, &reply)
+		Fatal(err, "could not list items: %s")
+		for _, s := range reply {
+			fmt.Printf("%s\t%s\t%s\tentry %d\n", s.Item, s.State, s.UpdatedAt.Format("2006-01-02 15:04:05"), s.Ledger)
+		}
+		Output(reply)
+	},
+}
+
+// itemScope: the case and item of an entry about item, or about caseID if item is empty, which its signature covers.
+// The case of an item is looked up on the server.
+func itemScope(client *rpc.Client, caseID, item string) (string, string) {
+	if item == "" {
+		return caseID, ""
+	}
+	req := custody.RecordRequest{Item: item}
+	authorize("Clerk.ItemStatus", &req)
+	var st custody.ItemStatus
+	err := client.Call("Clerk.ItemStatus", &req, &st)
+	Fatal(err, "could not look up the item: %s")
+	return st.Item.CaseID, item
+}
+
+// hashFile: the SHA-256 of the contents of the file at path and its hash list in blocks of --block-size,
+// nil if it is 0. The file is read once for both.
+func hashFile(path string) ([]byte, *piecewise.List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	h := sha256.New()
+	r := io.TeeReader(f, h)
+	var list *piecewise.List
+	if blockSize == 0 {
+		_, err = io.Copy(ioutil.Discard, r)
+	} else {
+		list, err = piecewise.HashReader(r, fi.Size(), blockSize)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Sum(nil), list, nil
+}
+
+func init() {
+	RootCmd.AddCommand(itemCmd)
+	itemCmd.AddCommand(itemAddCmd)
+	itemCmd.AddCommand(itemSignUploadCmd)
+	itemCmd.AddCommand(itemMoveCmd)
+	itemCmd.AddCommand(itemStatusCmd)
+	itemCmd.AddCommand(itemListCmd)
+	itemAddCmd.Flags().StringVar(&caseID, "case", "", "the case the item belongs to")
+	itemAddCmd.Flags().StringVar(&itemDescription, "description", "", "a description of the item")
+	itemAddCmd.Flags().StringVar(&itemDigest, "sha256", "", "the hex encoded SHA-256 of the item contents")
+	itemAddCmd.Flags().StringVar(&itemFile, "file", "", "a file to hash as the item contents")
+	itemAddCmd.Flags().Int64Var(&blockSize, "block-size", piecewise.DefaultBlockSize, "bytes per block of the hash list of --file, 0 for none")
+	itemSignUploadCmd.Flags().StringVar(&caseID, "case", "", "the case the item belongs to, as in the case field")
+	itemSignUploadCmd.Flags().StringVar(&itemDescription, "description", "", "a description of the item")
+	itemSignUploadCmd.Flags().Int64Var(&blockSize, "block-size", piecewise.DefaultBlockSize, "bytes per block of the hash list, 0 for none")
+	itemMoveCmd.Flags().StringVar(&itemNote, "note", "", "why the item moves, such as where it goes or who takes it")
+	itemListCmd.Flags().StringVar(&caseID, "case", "", "list the items of this case")
+	itemListCmd.Flags().StringVar(&itemState, "state", "", "list only the items in this state")
+}
@@ -0,0 +1,109 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var revokeReason string
+
+// keys: every key the user name has held, asking the server as the configured user.
+func keys(client *rpc.Client, name string) []*custody.KeyStatus {
+	req := custody.RecordRequest{Subject: name}
+	authorize("Clerk.Keys", &req)
+	var reply []*custody.KeyStatus
+	err := client.Call("Clerk.Keys", &req, &reply)
+	Fatal(err, "could not list keys: %s")
+	return reply
+}
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys [user]",
+	Short: "List the keys a user has held and whether they were revoked, only admins can list the keys of others.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := username
+		if len(args) > 0 {
+			name = args[0]
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		reply := keys(client, name)
+		for _, k := range reply {
+			status := "current"
+			if k.Revoked {
+				status = "revoked"
+			} else if k.Rotated {
+				status = "rotated"
+			}
+			fmt.Printf("%s\t%s\t%s\n", k.Identity.CreatedAt.Format("2006-01-02 15:04:05"), crypto.Fingerprint(k.Identity.PublicKey), status)
+			for _, r := range k.Records {
+				fmt.Printf("\t%s\t%s by entry %d\n", r.CreatedAt.Format("2006-01-02 15:04:05"), r.Event, r.Ledger)
+			}
+		}
+		Output(reply)
+	},
+}
+
+// revokeCmd represents the revoke command
+var revokeCmd = &cobra.Command{
+	Use:   "revoke [user]",
+	Short: "Revoke the current key of a user, only admins can revoke the keys of others.",
+	Long: `custody revoke --reason "laptop stolen" signs an entry revoking your current key.
+Entries signed with the key before the revocation stay valid, the server refuses every
+request and entry signed with it afterwards, and bundles carry the revocation so that
+verifiers can tell the two apart. An admin revokes the key of another user with custody revoke user.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := username
+		if len(args) > 0 {
+			name = args[0]
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		ks := keys(client, name)
+		if len(ks) == 0 || ks[len(ks)-1].Revoked {
+			log.Fatalf("%s has no key to revoke", name)
+		}
+		key := ks[len(ks)-1].Identity.PublicKey
+		data, hash := signMessage(custody.RevocationMessage(name, key, revokeReason), "", "")
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash, Subject: name, Description: revokeReason}
+		var reply models.KeyRecord
+		err = client.Call("Clerk.Revoke", &req, &reply)
+		Fatal(err, "could not revoke key: %s")
+		fmt.Printf("revoked key %s of %s by entry %d\n", crypto.Fingerprint(key), name, reply.Ledger)
+		Output(reply)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(keysCmd)
+	RootCmd.AddCommand(revokeCmd)
+	revokeCmd.Flags().StringVar(&revokeReason, "reason", "", "why the key must no longer be trusted")
+}
@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/rpc"
@@ -31,6 +32,15 @@ import (
 	"github.gatech.edu/NIJ-Grant/custody/models"
 )
 
+// listEntry: a ledger entry with its timestamp token and typed payload as printed by list --json.
+type listEntry struct {
+	*models.Ledger
+	Timestamp       *models.Timestamp `json:"timestamp,omitempty"`
+	TimestampStatus string            `json:"timestamp_status"`
+	Type            string            `json:"type,omitempty"`
+	Payload         json.RawMessage   `json:"payload,omitempty"`
+}
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
@@ -45,25 +55,61 @@ var listCmd = &cobra.Command{
 		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
 		Fatal(err, "dialing: %s")
 
-		req := custody.RecordRequest{Name: username}
-
+		req := custody.RecordRequest{Name: username, State: itemState}
+		authorize("Clerk.List", &req)
 		err = client.Call("Clerk.List", &req, &reply)
 		Fatal(err, "Failed to find ledger items %s")
+		var stamps []*models.Timestamp
+		authorize("Clerk.Timestamps", &req)
+		err = client.Call("Clerk.Timestamps", &req, &stamps)
+		Fatal(err, "Failed to find timestamps %s")
+		tsaCert := loadTSACert()
+		byEntry := map[int]*models.Timestamp{}
+		for _, ts := range stamps {
+			byEntry[ts.Ledger] = ts
+		}
 		ls := reply
 		for _, l := range ls {
+			ts := byEntry[l.ID]
+			status := "none"
+			if ts != nil {
+				if _, err := custody.VerifyTimestamp(ts, l, tsaCert); err != nil {
+					status = fmt.Sprintf("FAILED (%s)", err)
+				} else {
+					status = "verified"
+				}
+			}
 			if config.json {
-				Output(l)
+				e := listEntry{Ledger: l, Timestamp: ts, TimestampStatus: status}
+				e.Type, e.Payload, _ = custody.ParsePayload(l.Message)
+				Output(e)
 			} else {
 				fmt.Printf("ID:%d, CreatedAt:%s, Hash:%s, Message:%s\n",
 					l.ID, l.CreatedAt, crypto.EncodeBinary(l.Hash), l.Message)
-
+				if l.Imported != "" {
+					fmt.Printf("  Imported from %s\n", l.Imported)
+				}
+				if ts != nil {
+					fmt.Printf("  Timestamp:%s, Authority:%s, %s\n", ts.GenTime, ts.Authority, status)
+				}
 			}
 		}
+		var prs []*custody.Proposal
+		authorize("Clerk.Proposals", &req)
+		err = client.Call("Clerk.Proposals", &req, &prs)
+		Fatal(err, "Failed to find proposed entries %s")
+		if config.json {
+			Output(prs)
+		} else {
+			printProposals(prs)
+		}
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVar(&tsaCertPath, "tsacert", "", "path to the trusted time stamping authority certificate")
+	listCmd.Flags().StringVar(&itemState, "state", "", "list only the entries about items now in this state")
 
 	// Here you will define your flags and configuration settings.
 
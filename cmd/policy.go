@@ -0,0 +1,104 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"net/rpc"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// policyCmd represents the policy command
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Check policy files and list the entries that broke the policy.",
+	Long: `custody serve --policy policy.json constrains the entries signed with custody sign. The policy names operations,
+each matched by a regular expression on the message, and limits the roles that may record them, the fields they
+require and the operations that must already be recorded on the item. A final operation, such as a release to
+the owner, allows nothing on the item after it. In enforce mode the server rejects an entry that breaks a rule and
+says which, in audit mode it appends the entry and records the violation for custody policy violations.`,
+}
+
+// policyCheckCmd represents the policy check command
+var policyCheckCmd = &cobra.Command{
+	Use:   "check policy.json",
+	Short: "Check a policy file and print its rules.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p, err := custody.LoadPolicy(args[0])
+		Fatal(err, "%s")
+		fmt.Printf("mode %s\n", p.Mode)
+		if p.Strict {
+			fmt.Println("entries that match no operation are violations")
+		}
+		for _, op := range p.Operations {
+			var rules []string
+			if len(op.Roles) > 0 {
+				rules = append(rules, "by "+strings.Join(op.Roles, " or "))
+			}
+			if len(op.Require) > 0 {
+				rules = append(rules, "requires "+strings.Join(op.Require, " and "))
+			}
+			if len(op.After) > 0 {
+				rules = append(rules, "after "+strings.Join(op.After, " or "))
+			}
+			if op.Once {
+				rules = append(rules, "once per item")
+			}
+			if op.Final {
+				rules = append(rules, "final")
+			}
+			if op.Approvals != nil {
+				rules = append(rules, "needs "+op.Approvals.Needs())
+			}
+			fmt.Printf("%s\t%s\n", op.Name, strings.Join(rules, ", "))
+		}
+		Output(p)
+	},
+}
+
+// policyViolationsCmd represents the policy violations command
+var policyViolationsCmd = &cobra.Command{
+	Use:   "violations",
+	Short: "List the entries a server in audit mode accepted although they break the policy, only auditors and admins can list them.",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{}
+		authorize("Clerk.PolicyViolations", &req)
+		var reply []*models.PolicyViolation
+		err = client.Call("Clerk.PolicyViolations", &req, &reply)
+		Fatal(err, "could not list policy violations: %s")
+		for _, v := range reply {
+			fmt.Printf("%s\tentry %d\t%s\t%s\n", v.CreatedAt.Format("2006-01-02 15:04:05"), v.Ledger, v.Rule, v.Reason)
+		}
+		Output(reply)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyCheckCmd)
+	policyCmd.AddCommand(policyViolationsCmd)
+}
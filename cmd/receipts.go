@@ -0,0 +1,152 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+// receiptStatus: the outcome of checking one receipt, as printed by receipts verify --json.
+type receiptStatus struct {
+	Path   string `json:"path"`
+	Entry  int    `json:"entry"`
+	OK     bool   `json:"ok"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// receiptsCmd represents the receipts command
+var receiptsCmd = &cobra.Command{
+	Use:   "receipts",
+	Short: "Manage the receipts the server issued for your ledger entries.",
+	Long: `Every entry accepted by custody sign comes with a receipt countersigned by the server.
+Receipts are stored in ~/.custodyctl/receipts and prove that the server accepted the entry.`,
+}
+
+// receiptsVerifyCmd represents the receipts verify command
+var receiptsVerifyCmd = &cobra.Command{
+	Use:   "verify [receipt.json...]",
+	Short: "Check receipts against the current ledger.",
+	Long: `custody receipts verify checks the server signature on each receipt, then asks the server
+for the entry and a consistency proof from the ledger at the receipt to a freshly signed checkpoint.
+It fails if an entry is missing or altered, or if the ledger has been rewritten since the receipt was issued.
+Without arguments every receipt in ~/.custodyctl/receipts is checked.
+Use --serverkey to pin the server public key, and --witnesses N with --witness keys
+to require that N independent witnesses cosigned the checkpoint the receipts are checked against.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := args
+		if len(paths) == 0 {
+			dir, err := client.ReceiptDir("")
+			Fatal(err, "could not find receipt directory: %s")
+			paths, err = filepath.Glob(filepath.Join(dir, "*.json"))
+			Fatal(err, "could not list receipts: %s")
+		}
+		if len(paths) == 0 {
+			log.Fatal("no receipts found")
+		}
+
+		var pinned *ecdsa.PublicKey
+		if pinnedKeyPath != "" {
+			keybytes, err := ioutil.ReadFile(pinnedKeyPath)
+			Fatal(err, "could not read server key: %s")
+			pinned, err = crypto.ParseECDSAPublicKey(keybytes)
+			Fatal(err, "could not parse server key: %s")
+		}
+
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		failed := 0
+		for _, path := range paths {
+			s := checkReceipt(client, path, pinned)
+			if !s.OK {
+				failed++
+			}
+			if config.json {
+				Output(s)
+			} else if s.OK {
+				fmt.Printf("entry %d: OK (%s)\n", s.Entry, s.Path)
+			} else {
+				fmt.Printf("entry %d: FAILED %s (%s)\n", s.Entry, s.Reason, s.Path)
+			}
+		}
+		if !config.json {
+			fmt.Printf("%d of %d receipts verified\n", len(paths)-failed, len(paths))
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// checkReceipt: verify the receipt at path and compare it with the ledger on the server.
+func checkReceipt(client *rpc.Client, path string, pinned *ecdsa.PublicKey) receiptStatus {
+	s := receiptStatus{Path: path}
+	rc, err := custody.LoadReceipt(path)
+	if err != nil {
+		s.Reason = err.Error()
+		return s
+	}
+	s.Entry = rc.Entry.ID
+	if err = rc.Verify(pinned); err != nil {
+		s.Reason = err.Error()
+		return s
+	}
+	var proof custody.ReceiptProof
+	req := custody.RecordRequest{Entry: rc.Entry.ID, Size: rc.Size()}
+	authorize("Clerk.ReceiptProof", &req)
+	if err = client.Call("Clerk.ReceiptProof", &req, &proof); err != nil {
+		s.Reason = err.Error()
+		return s
+	}
+	if err = rc.Check(&proof); err != nil {
+		s.Reason = err.Error()
+		return s
+	}
+	if requiredWitnesses > 0 {
+		cp, cosigs := custody.Cosigned(proof.Checkpoint, proof.Cosignatures, proof.Witnessed)
+		if _, err = checkWitnesses(cp, cosigs); err != nil {
+			s.Reason = err.Error()
+			return s
+		}
+		if rc.Size() > cp.Size {
+			s.Reason = fmt.Sprintf("the witnesses have only cosigned the first %d entries, check again once they cosign a later checkpoint", cp.Size)
+			return s
+		}
+	}
+	s.OK = true
+	return s
+}
+
+func init() {
+	RootCmd.AddCommand(receiptsCmd)
+	receiptsCmd.AddCommand(receiptsVerifyCmd)
+	receiptsVerifyCmd.Flags().StringVar(&pinnedKeyPath, "serverkey", "", "path to the trusted server public key (custody_server_ecdsa.pub)")
+	addWitnessFlags(receiptsVerifyCmd)
+}
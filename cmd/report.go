@@ -0,0 +1,95 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+	"net/rpc"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var itemTag, reportFormat, reportPath, reportTemplates string
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Render a chain-of-custody report for an evidence item.",
+	Long: `custody report renders a formal chain-of-custody form for an evidence item as html or pdf.
+The form lists the item, every custodian period and transfer, each ledger entry with its signature
+verification status, the fingerprints of the signing keys and the root of a checkpoint signed by the server.
+Signatures and RFC 3161 timestamps are verified on the client, use --tsacert to require a particular
+time stamping authority. Use --serverkey to pin the server public key, otherwise the checkpoint is checked
+against the key that comes with the report and the form says it is unpinned.
+The form is laid out by report.html and report.txt in --templates.
+The output only depends on the ledger, so it can itself be hashed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var reply custody.ItemReport
+		if itemTag == "" {
+			log.Fatal("you must provide an item with --item")
+		}
+		if reportFormat != "html" && reportFormat != "pdf" {
+			log.Fatalf("unknown report format %s, use html or pdf", reportFormat)
+		}
+		pinned := loadPinnedKey()
+		err := custody.LoadReportTemplates(reportTemplates)
+		Fatal(err, "could not load the report templates: %s")
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Item: itemTag}
+		authorize("Clerk.Report", &req)
+		err = client.Call("Clerk.Report", &req, &reply)
+		Fatal(err, "could not get report: %s")
+
+		form := reply.Form(pinned, loadTSACert())
+		render := form.HTML
+		if reportFormat == "pdf" {
+			render = form.PDF
+		}
+		if reportPath == "" {
+			Fatal(render(os.Stdout), "could not render report: %s")
+			return
+		}
+		f, err := os.Create(reportPath)
+		Fatal(err, "could not create report: %s")
+		err = render(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			// Fatal exits without running deferred calls, so do not leave a truncated report behind
+			os.Remove(reportPath)
+		}
+		Fatal(err, "could not render report: %s")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringVar(&itemTag, "item", "", "the tag of the evidence item")
+	reportCmd.Flags().StringVar(&reportFormat, "format", "html", "output format, html or pdf")
+	reportCmd.Flags().StringVar(&reportPath, "out", "", "file to write the report to, defaults to stdout")
+	reportCmd.Flags().StringVar(&tsaCertPath, "tsacert", "", "path to the trusted time stamping authority certificate")
+	reportCmd.Flags().StringVar(&pinnedKeyPath, "serverkey", "", "path to the trusted server public key (custody_server_ecdsa.pub)")
+	reportCmd.Flags().StringVar(&reportTemplates, "templates", "static", "directory holding the report.html and report.txt templates")
+}
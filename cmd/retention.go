@@ -0,0 +1,160 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var retentionItem, retentionBasis, disposeReason string
+var retentionDays int
+
+// retentionCmd represents the retention command
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Manage how long evidence must be kept.",
+	Long: `The retention period of an item, or else of its case, runs from the registration of the item.
+Once it has passed the item can be disposed of with custody dispose, unless a legal hold applies.
+Items without a retention period are kept.`,
+}
+
+// retentionSetCmd represents the retention set command
+var retentionSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the retention period of a case or an item.",
+	Long: `custody retention set --case C --days 3650 --basis "statute" sets the period of every item of case C,
+--item E-9 sets the period of one item, which overrides the period of its case.
+The period is a ledger entry signed by the user, only custodians and admins can set it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (caseID == "") == (retentionItem == "") {
+			log.Fatal("name either a case with --case or an item with --item")
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		scope, item := itemScope(client, caseID, retentionItem)
+		data, hash := signMessage(custody.RetentionMessage(caseID, retentionItem, retentionDays, retentionBasis), scope, item)
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash,
+			Case: caseID, Item: retentionItem, Days: retentionDays, Description: retentionBasis}
+		var reply models.Retention
+		err = client.Call("Clerk.SetRetention", &req, &reply)
+		Fatal(err, "could not set retention: %s")
+		fmt.Printf("set retention by entry %d\n", reply.Ledger)
+		Output(reply)
+	},
+}
+
+// retentionStatusCmd represents the retention status command
+var retentionStatusCmd = &cobra.Command{
+	Use:   "status [item]",
+	Short: "Show when items can be disposed of.",
+	Long: `custody retention status lists every item that has not been disposed of with the end of its
+retention period and its legal holds. Items marked due can be disposed of now.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{}
+		if len(args) == 1 {
+			req.Item = args[0]
+		}
+		authorize("Clerk.Disposals", &req)
+		var reply []*custody.Disposal
+		err = client.Call("Clerk.Disposals", &req, &reply)
+		Fatal(err, "could not get retention status: %s")
+		now := time.Now()
+		for _, d := range reply {
+			status := "due"
+			if err := d.Check(now); err != nil {
+				status = err.Error()
+			}
+			fmt.Printf("%s\t%s\t%s\n", d.Item.Tag, d.Item.CaseID, status)
+		}
+		Output(reply)
+	},
+}
+
+// disposeCmd represents the dispose command
+var disposeCmd = &cobra.Command{
+	Use:   "dispose item",
+	Short: "Dispose of an evidence item whose retention period is over.",
+	Long: `custody dispose signs a disposition entry that stays in the ledger as the tombstone of the item,
+and the server deletes the contents of the item from its evidence store.
+Items under a legal hold or still within their retention period cannot be disposed of.
+Only custodians and admins can dispose of evidence.
+
+If the policy of the server says disposals need approval, propose the disposition instead:
+custody dispose E-4 --reason shredded --require 2 --approver-role custodian --deadline 48h
+and the item is disposed of once the approvers cosign it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		// the tombstone covers the digest of the item, so look it up first
+		req := custody.RecordRequest{Item: args[0]}
+		authorize("Clerk.Disposals", &req)
+		var status []*custody.Disposal
+		err = client.Call("Clerk.Disposals", &req, &status)
+		Fatal(err, "could not get retention status: %s")
+		if len(status) != 1 {
+			log.Fatalf("no item %s", args[0])
+		}
+		Fatal(status[0].Check(time.Now()), "%s")
+
+		message := custody.DisposeMessage(args[0], disposeReason, status[0].Item.Digest)
+		if signRequire > 0 {
+			caseID, itemTag = status[0].Item.CaseID, args[0]
+			propose(message)
+			return
+		}
+		data, hash := signMessage(message, status[0].Item.CaseID, args[0])
+		req = custody.RecordRequest{Name: username, Data: data, Hash: hash, Item: args[0], Description: disposeReason}
+		var reply models.Disposition
+		err = client.Call("Clerk.Dispose", &req, &reply)
+		Fatal(err, "could not dispose of item: %s")
+		fmt.Printf("disposed of item %s by entry %d\n", reply.Item, reply.Ledger)
+		if reply.BlobRemoved {
+			fmt.Println("its file was deleted from the evidence store")
+		}
+		Output(reply)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(retentionCmd)
+	RootCmd.AddCommand(disposeCmd)
+	retentionCmd.AddCommand(retentionSetCmd)
+	retentionCmd.AddCommand(retentionStatusCmd)
+	retentionSetCmd.Flags().StringVar(&caseID, "case", "", "the case")
+	retentionSetCmd.Flags().StringVar(&retentionItem, "item", "", "the evidence item")
+	retentionSetCmd.Flags().IntVar(&retentionDays, "days", 0, "how many days after registration the evidence must be kept")
+	retentionSetCmd.Flags().StringVar(&retentionBasis, "basis", "", "the statute or rule that sets the period")
+	disposeCmd.Flags().StringVar(&disposeReason, "reason", "", "how the item was disposed of, such as destroyed or returned to its owner")
+	disposeCmd.Flags().IntVar(&signRequire, "require", 0, "how many approvals the disposition needs before the item is disposed of")
+	disposeCmd.Flags().StringArrayVar(&signApprovers, "approver", nil, "a user who may approve the disposition, repeat for several")
+	disposeCmd.Flags().StringArrayVar(&signApproverRoles, "approver-role", nil, "a role whose holders may approve the disposition, repeat for several")
+	disposeCmd.Flags().DurationVar(&signDeadline, "deadline", 72*time.Hour, "how long the approvers have before the proposed disposition expires")
+}
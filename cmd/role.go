@@ -0,0 +1,126 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// grantCmd represents the grant command
+var grantCmd = &cobra.Command{
+	Use:   "grant user role",
+	Short: "Give a user a role, only admins can grant roles.",
+	Long: `Roles decide what a user may do:
+
+  officer     sign entries and register items
+  examiner    sign entries
+  custodian   sign entries, register items, read and export every case,
+              set retention, place legal holds and dispose of evidence
+  prosecutor  read and export every case and place legal holds
+  auditor     read and export every case, read the log of denied requests and policy violations
+  admin       everything, including granting roles, importing legacy logs, managing webhooks
+              and registering entry types
+
+Users without a role can only read their own entries, and officers and examiners
+can only read the cases an admin made them a member of, see custody member.
+The first user enrolled on a server is its admin.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !custody.ValidRole(args[1]) {
+			log.Fatalf("unknown role %s, the roles are %s", args[1], strings.Join(custody.Roles, ", "))
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Subject: args[0], Role: args[1]}
+		authorize("Clerk.Grant", &req)
+		var reply models.Role
+		err = client.Call("Clerk.Grant", &req, &reply)
+		Fatal(err, "could not grant role: %s")
+		fmt.Printf("%s is now %s\n", reply.Name, reply.Role)
+		Output(reply)
+	},
+}
+
+var memberRemove bool
+
+// memberCmd represents the member command
+var memberCmd = &cobra.Command{
+	Use:   "member user case",
+	Short: "Give a user access to a case, only admins can add members.",
+	Long: `Users whose role cannot read every case, such as officers and examiners,
+can read a case only once an admin makes them a member of it. Use --remove to take the access away.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		method := "Clerk.AddMember"
+		if memberRemove {
+			method = "Clerk.RemoveMember"
+		}
+		req := custody.RecordRequest{Subject: args[0], Case: args[1]}
+		authorize(method, &req)
+		var reply models.CaseMember
+		err = client.Call(method, &req, &reply)
+		Fatal(err, "could not change the members of the case: %s")
+		if memberRemove {
+			fmt.Printf("%s is no longer a member of case %s\n", reply.Name, reply.CaseID)
+		} else {
+			fmt.Printf("%s is now a member of case %s\n", reply.Name, reply.CaseID)
+		}
+		Output(reply)
+	},
+}
+
+// denialsCmd represents the denials command
+var denialsCmd = &cobra.Command{
+	Use:   "denials",
+	Short: "List the requests refused by access control, only auditors and admins can list them.",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{}
+		authorize("Clerk.Denials", &req)
+		var reply []*models.Denial
+		err = client.Call("Clerk.Denials", &req, &reply)
+		Fatal(err, "could not list denials: %s")
+		for _, d := range reply {
+			target := d.Target
+			if target == "" {
+				target = "-"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", d.CreatedAt.Format("2006-01-02 15:04:05"), d.Name, d.Action, target, d.Reason)
+		}
+		Output(reply)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(grantCmd)
+	RootCmd.AddCommand(memberCmd)
+	RootCmd.AddCommand(denialsCmd)
+	memberCmd.Flags().BoolVar(&memberRemove, "remove", false, "take the access to the case away")
+}
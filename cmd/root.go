@@ -29,11 +29,14 @@ import (
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
 )
 
 var cfgFile, dsn string
 var username string
 var serverAddress string
+var caseID string
 
 // Config: the cmd configuration struct
 type Config struct {
@@ -60,6 +63,26 @@ func Fatal(err error, fmtstring string) {
 	}
 }
 
+// authorize: sign req for method as the user --username, with the key in ~/.custodyctl.
+func authorize(method string, req *custody.RecordRequest) {
+	key, err := client.LoadPrivateKey("")
+	Fatal(err, "could not load private key: %s")
+	req.Name = username
+	err = req.Authorize(method, key)
+	Fatal(err, "could not sign request: %s")
+}
+
+// signMessage: sign the message of a new ledger entry in caseID about item with the key in ~/.custodyctl.
+// The signed entry authenticates the request that carries it.
+func signMessage(message, caseID, item string) (data, hash []byte) {
+	key, err := client.LoadPrivateKey("")
+	Fatal(err, "could not load private key: %s")
+	data = []byte(message)
+	hash, err = custody.SignEntry(key, message, caseID, item)
+	Fatal(err, "could not sign entry: %s")
+	return
+}
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "custody",
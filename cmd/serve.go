@@ -33,8 +33,13 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/spf13/cobra"
 	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+	"github.gatech.edu/NIJ-Grant/custody/tsa"
 )
 
+var serverKeyPath, tsaURL, serveStore, fixityNotifyCmd, policyPath string
+var fixityInterval, fixityRotation, webhookInterval, tsaTimeout, checkpointInterval time.Duration
+
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
@@ -50,8 +55,42 @@ var serveCmd = &cobra.Command{
 		log.Println(cdb)
 		c := custody.NewClerk()
 		c.DB = cdb
+		c.Key, err = custody.LoadServerKey(serverKeyPath)
+		Fatal(err, "could not load server key: %s")
+		c.Witnesses = loadWitnessKeys()
+		c.CheckpointInterval = checkpointInterval
+		if tsaURL != "" {
+			c.Stamper = &tsa.Client{URL: tsaURL, Timeout: tsaTimeout}
+			c.Stamp()
+		}
+		// disposals delete the contents of items from the store, so the server does not run without it
+		if serveStore == "" {
+			log.Fatal("the server needs the evidence store of the web server, give it with --store")
+		}
+		c.Store, err = store.Open(serveStore)
+		Fatal(err, "could not open the evidence store: %s")
+		c.Store.Keys, err = store.LoadKeyring(storeKeyFile)
+		Fatal(err, "could not load the master keys: %s")
+		if policyPath != "" {
+			c.DB.Policy, err = custody.LoadPolicy(policyPath)
+			Fatal(err, "could not load the policy: %s")
+			log.Printf("%s %d operations of policy %s", c.DB.Policy.Mode, len(c.DB.Policy.Operations), policyPath)
+		}
+		if fixityInterval > 0 {
+			notifier := custody.Notifiers{custody.LogNotifier{}}
+			if fixityNotifyCmd != "" {
+				notifier = append(notifier, custody.CommandNotifier{Command: fixityNotifyCmd})
+			}
+			a := &custody.FixityAuditor{Clerk: c, Notifier: notifier, Interval: fixityInterval, Rotation: fixityRotation}
+			a.Start(nil)
+		}
+		if webhookInterval > 0 {
+			d := &custody.WebhookDispatcher{DB: &c.DB, Sender: &custody.WebhookSender{Key: c.Key}, Interval: webhookInterval}
+			d.Start(nil)
+		}
 		rpc.Register(c)
 		rpc.HandleHTTP()
+		http.HandleFunc("/watch", c.Watch)
 		l, e := net.Listen(c.Network, c.Address)
 		if e != nil {
 			log.Fatal("listen error:", e)
@@ -74,6 +113,18 @@ var serveCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serverKeyPath, "serverkey", "custody_server_ecdsa", "path to the server signing key, generated if missing")
+	serveCmd.Flags().StringVar(&serveStore, "store", custody.StoreDir, "the evidence store of the web server, disposed items are deleted from it")
+	serveCmd.Flags().StringVar(&storeKeyFile, "store-key-file", "", "file with the master keys of the evidence store (default $"+store.EnvKey+")")
+	serveCmd.Flags().DurationVar(&fixityInterval, "fixity-interval", 0, "how often to audit the fixity of the evidence and the ledger, e.g. 24h, 0 to never")
+	serveCmd.Flags().DurationVar(&fixityRotation, "fixity-rotation", 7*24*time.Hour, "how long it takes to rehash every blob in the evidence store once")
+	serveCmd.Flags().StringVar(&fixityNotifyCmd, "fixity-notify-cmd", "", "command to run for every fixity alert, with the alert as JSON on its standard input")
+	serveCmd.Flags().DurationVar(&webhookInterval, "webhook-interval", 2*time.Second, "how often to queue and deliver webhook events, 0 to never")
+	serveCmd.Flags().StringVar(&policyPath, "policy", "", "JSON file of the rules signed entries must follow, see custody policy check")
+	serveCmd.Flags().StringVar(&tsaURL, "tsa", "", "URL of an RFC 3161 time stamping authority for ledger entries, such as http://localhost:3161")
+	serveCmd.Flags().StringSliceVar(&witnessKeyPaths, "witness", nil, "path to the public key of a witness whose cosignatures are stored, may be repeated")
+	serveCmd.Flags().DurationVar(&checkpointInterval, "checkpoint-interval", custody.DefaultCheckpointInterval, "how often witnesses can make the server sign a new checkpoint at most")
+	serveCmd.Flags().DurationVar(&tsaTimeout, "tsa-timeout", tsa.DefaultTimeout, "how long to wait for the time stamping authority before trying again later")
 
 	// Here you will define your flags and configuration settings.
 
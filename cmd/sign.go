@@ -21,6 +21,8 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -29,50 +31,115 @@ import (
 	"log"
 	"net/rpc"
 	"os"
+	"path/filepath"
+	"time"
 
-	"github.com/gtank/cryptopasta"
 	"github.gatech.edu/NIJ-Grant/custody/client"
 	"github.gatech.edu/NIJ-Grant/custody/lib"
-	"github.gatech.edu/NIJ-Grant/custody/models"
 )
 
+var signRequire int
+var signApprovers, signApproverRoles []string
+var signDeadline time.Duration
+var signType, signFile, signOp string
+var signLegacy []string
+
 // signCmd represents the sign command
 var signCmd = &cobra.Command{
 	Use:   "sign",
 	Short: "sign creates a ledger entry signed by the current user.",
 	Long: `Signed entries can be used to record operations on files attributed to users.
 You need the private key stored in ~/.custodyctl/id_ecdsa in order to create a valid signature.
-The custody create command is used to generate key pairs and upload the public part to the server.`,
+The custody create command is used to generate key pairs and upload the public part to the server.
+The receipt countersigned by the server is stored in ~/.custodyctl/receipts, see custody receipts verify.
+
+Entries that one person should not make alone need approval:
+echo "submitted to court" | custody sign --case C9 --require 2 --approver bob --approver-role custodian --deadline 48h
+holds the entry until two of bob and the custodians approve it with custody cosign, and drops it if they do not
+before the deadline. The requirement is part of the signed entry.
+
+With --type the input is a JSON payload of a registered entry type, which the server checks against the schema:
+echo '{"serial": "WD-123", "write_blocker": "Tableau T35u"}' | custody sign --type acquisition --item E-7
+
+With --file the file is streamed through SHA-256, and only a statement of the operation, the file name, its size
+and its digests is signed and sent, never the contents:
+custody sign --file disk.dd --op acquire --legacy-digest md5 --item E-7
+signs "acquire file disk.dd: 1073741824 bytes: sha256 ..., md5 ..."`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
-		var reply models.Ledger
-		fmt.Println("signing message from stdin")
+		var reply custody.Receipt
 
 		key, err := client.LoadPrivateKey("")
 		Fatal(err, "could not load public key: %s")
+		receipts, err := client.ReceiptDir("")
+		Fatal(err, "could not find receipt directory: %s")
 
-		data, err := ioutil.ReadAll(os.Stdin)
-		Fatal(err, "could not read input: %s")
-		log.Printf("bytes read from stdin: %d", len(data))
-		log.Printf("string read from stdin: %s", data)
+		var data []byte
+		switch {
+		case signFile != "" && signType != "":
+			log.Fatal("--file signs a statement about the file, it cannot have a --type")
+		case signFile != "":
+			d, err := custody.DigestFile(signFile, signLegacy)
+			Fatal(err, "could not hash file: %s")
+			message, err := custody.FileMessage(signOp, filepath.Base(signFile), d)
+			Fatal(err, "%s")
+			log.Printf("signing statement: %s", message)
+			data = []byte(message)
+		default:
+			fmt.Println("signing message from stdin")
+			data, err = ioutil.ReadAll(os.Stdin)
+			Fatal(err, "could not read input: %s")
+			log.Printf("bytes read from stdin: %d", len(data))
+			log.Printf("string read from stdin: %s", data)
+		}
+		if signType != "" {
+			var payload bytes.Buffer
+			err = json.Compact(&payload, data)
+			Fatal(err, "the payload of a typed entry must be JSON: %s")
+			data = []byte(custody.PayloadMessage(signType, payload.Bytes()))
+		}
+		if signRequire > 0 {
+			propose(string(data))
+			return
+		}
 
-		hash, err := cryptopasta.Sign(data, key)
+		hash, err := custody.SignEntry(key, string(data), caseID, itemTag)
 		Fatal(err, "could not hash input: %s")
 		// log.Printf("Successful hashing: %s", hash)
 
 		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
 		Fatal(err, "dialing: %s")
 
-		req := custody.RecordRequest{Name: username, Data: data, Hash: hash}
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash, Case: caseID, Item: itemTag}
 		err = client.Call("Clerk.Validate", &req, &reply)
 		Fatal(err, "could not add message to ledger %s")
-		log.Printf("Ledger Entry: %+v", reply)
-		Output(reply)
+		log.Printf("Ledger Entry: %+v", reply.Entry)
+		for _, v := range reply.Violations {
+			log.Printf("warning: the entry breaks policy %s", v)
+		}
+		if reply.Signature != nil {
+			err = reply.Verify(nil)
+			Fatal(err, "server returned an invalid receipt: %s")
+			err = custody.SaveReceipt(receipts, &reply)
+			Fatal(err, "could not store receipt: %s")
+			log.Printf("stored receipt at %s", custody.ReceiptPath(receipts, &reply))
+		}
+		Output(reply.Entry)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(signCmd)
+	signCmd.Flags().StringVar(&caseID, "case", "", "the case this entry belongs to")
+	signCmd.Flags().StringVar(&itemTag, "item", "", "the evidence item this entry is about")
+	signCmd.Flags().StringVar(&signType, "type", "", "the entry type of the JSON payload read from stdin, see custody type")
+	signCmd.Flags().StringVar(&signFile, "file", "", "sign a statement of the size and digest of this file instead of a message from stdin")
+	signCmd.Flags().StringVar(&signOp, "op", "acquire", "the operation on --file the statement records, such as acquire or verify")
+	signCmd.Flags().StringSliceVar(&signLegacy, "legacy-digest", nil, "also record the sha1 or md5 of --file for legacy tools")
+	signCmd.Flags().IntVar(&signRequire, "require", 0, "how many approvals the entry needs before it is appended")
+	signCmd.Flags().StringArrayVar(&signApprovers, "approver", nil, "a user who may approve the entry, repeat for several")
+	signCmd.Flags().StringArrayVar(&signApproverRoles, "approver-role", nil, "a role whose holders may approve the entry, repeat for several")
+	signCmd.Flags().DurationVar(&signDeadline, "deadline", 72*time.Hour, "how long the approvers have before the entry expires")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,82 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// storeCmd represents the store command
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Manage the encryption of the evidence store.",
+	Long: `Evidence files uploaded to the web server are kept in a content addressed store.
+Each file is encrypted with its own data key, and the data keys are wrapped by a master key.
+The master keys are read from --store-key-file or from the CUSTODY_STORE_KEY environment variable,
+one key per line or separated by commas. The first key is the current one, the others only unwrap.`,
+}
+
+// keygenCmd represents the store keygen command
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Print a new random master key for the evidence store.",
+	Long: `To rotate the master key, put the new key on the first line of the key file,
+keep the old key below it, run custody store rekey, and then remove the old key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := store.NewMasterKey()
+		Fatal(err, "could not generate a key: %s")
+		fmt.Println(key)
+	},
+}
+
+// rekeyCmd represents the store rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Wrap every data key under the current master key and encrypt plaintext files.",
+	Long: `custody store rekey rewraps the data key of every encrypted file with the current master key,
+which only rewrites the small key files next to the evidence. Files stored before encryption was
+enabled are encrypted. It can be run again after an interruption, files already done are skipped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keys, err := store.LoadKeyring(storeKeyFile)
+		Fatal(err, "could not load the master keys: %s")
+		if keys == nil {
+			log.Fatalf("you must provide the master keys with --store-key-file or $%s", store.EnvKey)
+		}
+		evidence, err := store.Open(custody.StoreDir)
+		Fatal(err, "could not open the evidence store: %s")
+		evidence.Keys = keys
+		rewrapped, sealed, err := evidence.Rekey()
+		fmt.Printf("rewrapped %d data keys and encrypted %d files under master key %s\n", rewrapped, sealed, keys.Current())
+		Fatal(err, "rekey stopped: %s")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(keygenCmd)
+	storeCmd.AddCommand(rekeyCmd)
+	rekeyCmd.Flags().StringVar(&custody.StoreDir, "store", custody.StoreDir, "directory of the content addressed evidence store")
+	rekeyCmd.Flags().StringVar(&storeKeyFile, "store-key-file", "", "file with the master keys of the evidence store (default $"+store.EnvKey+")")
+}
@@ -0,0 +1,73 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"crypto/x509"
+	"log"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/tsa"
+)
+
+var tsaAddress, tsaDir, tsaCertPath string
+
+// tsaCmd represents the tsa command
+var tsaCmd = &cobra.Command{
+	Use:   "tsa",
+	Short: "Run a local RFC 3161 time stamping authority.",
+	Long: `Ledger entries are timestamped by an RFC 3161 time stamping authority so that their times
+do not rest on the custody server clock alone. Deployments without an external authority can run a local one.`,
+}
+
+// tsaServeCmd represents the tsa serve command
+var tsaServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start a local time stamping authority.",
+	Long: `custody tsa serve answers RFC 3161 timestamp queries over HTTP.
+The authority key and self-signed certificate are kept in --dir and generated on first use.
+Point custody serve --tsa at this server, and hand tsa_cert.der to verifiers for --tsacert.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := tsa.LoadServer(tsaDir)
+		Fatal(err, "could not load time stamping authority: %s")
+		log.Printf("time stamping authority %s, certificate %s", s.Cert.Subject.CommonName, crypto.Fingerprint(s.Cert.Raw))
+		log.Printf("listening on %s", tsaAddress)
+		log.Fatal(http.ListenAndServe(tsaAddress, s))
+	},
+}
+
+// loadTSACert: the trusted time stamping authority certificate given with --tsacert, or nil.
+func loadTSACert() *x509.Certificate {
+	if tsaCertPath == "" {
+		return nil
+	}
+	cert, err := tsa.LoadCertificate(tsaCertPath)
+	Fatal(err, "could not read time stamping authority certificate: %s")
+	return cert
+}
+
+func init() {
+	RootCmd.AddCommand(tsaCmd)
+	tsaCmd.AddCommand(tsaServeCmd)
+	tsaServeCmd.Flags().StringVar(&tsaAddress, "addr", "0.0.0.0:3161", "the address to listen on")
+	tsaServeCmd.Flags().StringVar(&tsaDir, "dir", "custody_tsa", "directory holding the authority key and certificate")
+}
@@ -0,0 +1,142 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var queryFields []string
+
+// typeCmd represents the type command
+var typeCmd = &cobra.Command{
+	Use:   "type",
+	Short: "Manage the types of structured entries.",
+	Long: `An entry type is a JSON Schema that the payloads of typed entries must follow, such as acquisition with the
+serial of the device and the write blocker, analysis with the tool and its version, or photo with the GPS position.
+custody sign --type acquisition signs a JSON payload of the type, the server checks it against the schema and
+stores its top level fields, and custody query finds entries by them. Messages without a type are not checked.
+Schemas may use type, properties, required, additionalProperties, items, enum, const, pattern, minLength,
+maxLength, minimum, maximum, minItems and maxItems.`,
+}
+
+// typeAddCmd represents the type add command
+var typeAddCmd = &cobra.Command{
+	Use:   "add name schema.json",
+	Short: "Register an entry type, only admins can register them.",
+	Long: `custody type add acquisition acquisition.json registers the type with a ledger entry signed by the admin,
+which covers the SHA-256 of the schema. A type cannot be changed, register a new version under another name.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		schema, err := ioutil.ReadFile(args[1])
+		Fatal(err, "could not read the schema: %s")
+		data, hash := signMessage(custody.EntryTypeMessage(args[0], schema), "", "")
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash, Type: args[0], Schema: schema}
+		var reply models.EntryType
+		err = client.Call("Clerk.AddEntryType", &req, &reply)
+		Fatal(err, "could not register the entry type: %s")
+		if config.json {
+			Output(reply)
+		} else {
+			fmt.Printf("registered entry type %s by entry %d\n", reply.Name, reply.Ledger)
+		}
+	},
+}
+
+// typeListCmd represents the type list command
+var typeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the entry types, with --json their schemas as well.",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{}
+		authorize("Clerk.EntryTypes", &req)
+		var reply []*models.EntryType
+		err = client.Call("Clerk.EntryTypes", &req, &reply)
+		Fatal(err, "could not list entry types: %s")
+		for _, et := range reply {
+			fmt.Printf("%s\tentry %d\t%s\n", et.Name, et.Ledger, et.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		Output(reply)
+	},
+}
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query type",
+	Short: "Find typed entries by the fields of their payloads.",
+	Long: `custody query acquisition --field serial=WD-123 --case C9 lists the acquisition entries of case C9 whose
+serial is WD-123. Strings match as they are, other values as compact JSON such as --field sectors=1000.
+Without --case users who do not read every case only find their own entries.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fields := map[string]string{}
+		for _, f := range queryFields {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				Fatal(fmt.Errorf("%q is not name=value", f), "%s")
+			}
+			fields[kv[0]] = kv[1]
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Case: caseID, Type: args[0], Fields: fields}
+		authorize("Clerk.Query", &req)
+		var reply []custody.PublishedEntry
+		err = client.Call("Clerk.Query", &req, &reply)
+		Fatal(err, "could not query entries: %s")
+		if config.json {
+			Output(reply)
+			return
+		}
+		for _, e := range reply {
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", e.ID, e.Time.Format("2006-01-02 15:04:05"), e.Signer, e.CaseID, e.Item)
+			payload, _ := custody.PayloadFields(e.Payload)
+			names := make([]string, 0, len(payload))
+			for name := range payload {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("  %s: %s\n", name, payload[name])
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(typeCmd)
+	RootCmd.AddCommand(queryCmd)
+	typeCmd.AddCommand(typeAddCmd)
+	typeCmd.AddCommand(typeListCmd)
+	queryCmd.Flags().StringVar(&caseID, "case", "", "only the entries of this case")
+	queryCmd.Flags().StringArrayVar(&queryFields, "field", nil, "name=value that the payload must have, repeat for several")
+}
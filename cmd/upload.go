@@ -0,0 +1,262 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var uploadURL, uploadEmail string
+var uploadChunk int64
+
+// uploadState: what custody upload remembers about an upload in progress, so it can resume.
+type uploadState struct {
+	URL string `json:"url"`
+	ID  string `json:"id"`
+}
+
+// webClient: a logged in session with the web server.
+type webClient struct {
+	http.Client
+	base string
+	csrf string
+}
+
+// login: log in to the web server as email and fetch the CSRF token of the session.
+func login(base, email, password string) (*webClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &webClient{Client: http.Client{Jar: jar}, base: strings.TrimRight(base, "/")}
+	res, err := c.Get(c.base + "/login")
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	var token string
+	for _, ck := range res.Cookies() {
+		if ck.Name == custody.LoginCookie {
+			token = ck.Value
+		}
+	}
+	form := url.Values{"email": {email}, "password": {password}, custody.CSRFField: {token}}
+	res, err = c.PostForm(c.base+"/login", form)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	res, err = c.Get(c.base + "/session")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not log in as %s", email)
+	}
+	var session struct{ CSRF string }
+	if err = json.NewDecoder(res.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	c.csrf = session.CSRF
+	return c, nil
+}
+
+// do: send a request with the CSRF token of the session and decode the reply.
+func (c *webClient) do(method, path string, body io.Reader, header map[string]string) (*http.Response, *custody.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set(custody.CSRFHeader, c.csrf)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil || len(data) == 0 {
+		return res, nil, err
+	}
+	reply := &custody.Response{}
+	if err = json.Unmarshal(data, reply); err != nil {
+		return res, nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	return res, reply, nil
+}
+
+// offset: how much of the upload id the server has.
+func (c *webClient) offset(id string) (int64, error) {
+	res, _, err := c.do("HEAD", "/uploads/"+id, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("upload %s: %s", id, res.Status)
+	}
+	return strconv.ParseInt(res.Header.Get(custody.UploadOffsetHeader), 10, 64)
+}
+
+// uploadCmd represents the upload command
+var uploadCmd = &cobra.Command{
+	Use:   "upload file tag",
+	Short: "Upload a file to the web server in resumable chunks and register it as an evidence item.",
+	Long: `custody upload sends large files such as disk images in chunks, each with its own checksum.
+If the upload is interrupted, run the same command again and it resumes where the server left off,
+the upload id is kept in file.upload until the upload is finished.
+The hash list of the file in blocks of --block-size bytes is registered with it, see custody item add.
+The signature over the digest of the whole file is only checked when the last chunk has arrived,
+and the file only becomes an evidence item if it matches.
+The password of --email is read from $CUSTODY_PASSWORD or the first line of standard input.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, tag := args[0], args[1]
+		password := os.Getenv("CUSTODY_PASSWORD")
+		if password == "" {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				log.Fatalf("could not read password: %s", err)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+		if uploadEmail == "" {
+			uploadEmail = username
+		}
+
+		f, err := os.Open(path)
+		Fatal(err, "could not open file: %s")
+		defer f.Close()
+		fi, err := f.Stat()
+		Fatal(err, "could not open file: %s")
+		log.Printf("hashing %s", path)
+		digest, list, err := hashFile(path)
+		Fatal(err, "could not hash file: %s")
+		key, err := client.LoadPrivateKey("")
+		Fatal(err, "could not load private key: %s")
+		message := custody.UploadMessage(tag, itemDescription, digest)
+		var blocks int64
+		if list != nil {
+			message = custody.HashListMessage(message, list)
+			blocks = list.BlockSize
+		}
+		sig, err := custody.SignEntry(key, message, caseID, tag)
+		Fatal(err, "could not sign upload: %s")
+
+		web, err := login(uploadURL, uploadEmail, password)
+		Fatal(err, "%s")
+
+		statePath := path + ".upload"
+		var state uploadState
+		var offset int64
+		if data, err := ioutil.ReadFile(statePath); err == nil && json.Unmarshal(data, &state) == nil && state.URL == uploadURL {
+			if offset, err = web.offset(state.ID); err != nil {
+				log.Printf("could not resume upload %s, starting over: %s", state.ID, err)
+				state.ID = ""
+			} else {
+				log.Printf("resuming upload %s at byte %d", state.ID, offset)
+			}
+		}
+		if state.ID == "" {
+			start, _ := json.Marshal(custody.UploadStart{Item: tag, Case: caseID, Description: itemDescription, Size: fi.Size()})
+			_, reply, err := web.do("POST", "/uploads", bytes.NewReader(start), map[string]string{"Content-Type": "application/json"})
+			Fatal(err, "could not start upload: %s")
+			if reply == nil || !reply.Success {
+				log.Fatalf("could not start upload: %v", reply)
+			}
+			state = uploadState{URL: uploadURL, ID: reply.Message[0]}
+			data, _ := json.Marshal(state)
+			err = ioutil.WriteFile(statePath, data, 0600)
+			Fatal(err, "could not save upload state: %s")
+			offset = 0
+		}
+
+		buf := make([]byte, uploadChunk<<20)
+		for failures := 0; offset < fi.Size(); {
+			n, err := f.ReadAt(buf, offset)
+			if err != nil && err != io.EOF {
+				log.Fatalf("could not read file: %s", err)
+			}
+			sum := sha256.Sum256(buf[:n])
+			res, reply, err := web.do("PATCH", "/uploads/"+state.ID, bytes.NewReader(buf[:n]), map[string]string{
+				"Content-Type":               "application/offset+octet-stream",
+				custody.UploadOffsetHeader:   strconv.FormatInt(offset, 10),
+				custody.UploadChecksumHeader: "sha256 " + base64.StdEncoding.EncodeToString(sum[:]),
+			})
+			if err == nil && res.StatusCode == http.StatusNoContent {
+				offset += int64(n)
+				failures = 0
+				log.Printf("sent %d of %d bytes", offset, fi.Size())
+				continue
+			}
+			if failures++; failures > 5 {
+				log.Fatalf("giving up after repeated failures, run the command again to resume: %v %v", err, reply)
+			}
+			log.Printf("chunk at %d failed, retrying: %v %v", offset, err, reply)
+			time.Sleep(time.Duration(failures) * time.Second)
+			if o, err := web.offset(state.ID); err == nil {
+				offset = o
+			}
+		}
+
+		finish, _ := json.Marshal(custody.UploadFinish{SHA256: hex.EncodeToString(digest), Signature: crypto.EncodeBinary(sig), BlockSize: blocks})
+		_, reply, err := web.do("POST", "/uploads/"+state.ID+"/finalize", bytes.NewReader(finish), map[string]string{"Content-Type": "application/json"})
+		Fatal(err, "could not finish upload, run the command again to retry: %s")
+		if reply == nil || !reply.Success {
+			log.Fatalf("upload was not accepted, the server keeps it so the command can be run again: %v", reply)
+		}
+		os.Remove(statePath)
+		fmt.Printf("uploaded %s as item %s with sha256 %x\n", path, tag, digest)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(uploadCmd)
+	uploadCmd.Flags().StringVar(&uploadURL, "url", "http://localhost:3000", "the web server")
+	uploadCmd.Flags().StringVar(&uploadEmail, "email", "", "the email to log in with, --username if not given")
+	uploadCmd.Flags().StringVar(&caseID, "case", "", "the case the item belongs to")
+	uploadCmd.Flags().StringVar(&itemDescription, "description", "", "a description of the item")
+	uploadCmd.Flags().Int64Var(&uploadChunk, "chunk", 64, "chunk size in MiB")
+	uploadCmd.Flags().Int64Var(&blockSize, "block-size", piecewise.DefaultBlockSize, "bytes per block of the hash list, 0 for none")
+}
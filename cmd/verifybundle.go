@@ -0,0 +1,159 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var pinnedKeyPath string
+
+// verifyBundleCmd represents the verify-bundle command
+var verifyBundleCmd = &cobra.Command{
+	Use:   "verify-bundle bundle.zip",
+	Short: "Verify an evidence bundle without contacting the server.",
+	Long: `custody verify-bundle checks the manifest, every ledger entry signature,
+every Merkle inclusion proof, the checkpoint signature, the RFC 3161 timestamp tokens
+and the key rotation and revocation records of a bundle made with custody export.
+An entry signed with a key after its revocation fails the check.
+Use --serverkey to pin the server public key, otherwise the key inside the bundle is trusted
+and its fingerprint is printed so that it can be compared out of band.
+Use --tsacert to require that timestamps were issued by a particular authority,
+and --witnesses N with --witness keys to require that N independent witnesses cosigned the checkpoint.
+Checkpoints are signed when the bundle is made, so the bundle also carries the latest checkpoint the witnesses
+did cosign and the proof that the bundle checkpoint extends it; every entry must be covered by it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := custody.OpenBundle(args[0])
+		Fatal(err, "could not read bundle: %s")
+
+		r := b.Verify(loadPinnedKey(), loadTSACert())
+		if requiredWitnesses > 0 {
+			n, err := checkWitnesses(custody.Cosigned(b.Checkpoint, b.Cosigs, b.Witnessed))
+			fmt.Printf("Witness cosignatures verified: %d of %d required\n", n, requiredWitnesses)
+			if err != nil {
+				r.Failures = append(r.Failures, err.Error())
+			}
+			if r.Witnessed < r.Entries {
+				r.Failures = append(r.Failures, fmt.Sprintf("%d entries are newer than the checkpoint the witnesses cosigned, export again once they cosign a later one",
+					r.Entries-r.Witnessed))
+			}
+		}
+		if config.json {
+			Output(r)
+		} else {
+			printBundleReport(b, r)
+		}
+		if !r.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+// loadPinnedKey: the server public key given with --serverkey, nil if none was given.
+func loadPinnedKey() *ecdsa.PublicKey {
+	if pinnedKeyPath == "" {
+		return nil
+	}
+	keybytes, err := ioutil.ReadFile(pinnedKeyPath)
+	Fatal(err, "could not read server key: %s")
+	pinned, err := crypto.ParseECDSAPublicKey(keybytes)
+	Fatal(err, "could not parse server key: %s")
+	return pinned
+}
+
+// printBundleReport: a human readable summary of a verified bundle.
+func printBundleReport(b *custody.Bundle, r *custody.BundleReport) {
+	names := map[int]string{}
+	for _, i := range b.Identities {
+		names[i.ID] = i.Name
+	}
+	stamps := map[int]*models.Timestamp{}
+	for _, ts := range b.Timestamps {
+		stamps[ts.Ledger] = ts
+	}
+	fmt.Printf("Case: %s\n", r.Case)
+	fmt.Printf("Exported: %s\n", b.Manifest.CreatedAt)
+	if b.Checkpoint != nil {
+		fmt.Printf("Checkpoint: size=%d root=%s signed=%s\n",
+			b.Checkpoint.Size, crypto.EncodeBinary(b.Checkpoint.Root), b.Checkpoint.CreatedAt)
+	}
+	if r.Pinned {
+		fmt.Printf("Server key: %s (pinned)\n", r.ServerKey)
+	} else {
+		fmt.Printf("Server key: %s (NOT pinned, compare this fingerprint with the server operator)\n", r.ServerKey)
+	}
+	fmt.Printf("Signers:\n")
+	for _, i := range b.Identities {
+		fmt.Printf("  %s id=%d enrolled=%s key=%s\n", i.Name, i.ID, i.CreatedAt, crypto.Fingerprint(i.PublicKey))
+	}
+	if len(b.KeyRecords) > 0 {
+		keyEntries := map[int]*models.Ledger{}
+		for _, l := range b.KeyEntries {
+			keyEntries[l.ID] = l
+		}
+		fmt.Printf("Key records:\n")
+		for _, kr := range b.KeyRecords {
+			if l, ok := keyEntries[kr.Ledger]; ok {
+				fmt.Printf("  %s key id=%d by %s in entry %d: %s\n", kr.Event, kr.Identity, names[l.Identity], l.ID, l.Message)
+			}
+		}
+	}
+	fmt.Printf("Entries:\n")
+	for _, l := range b.Entries {
+		fmt.Printf("  ID:%d, CreatedAt:%s, Signer:%s, Message:%s\n", l.ID, l.CreatedAt, names[l.Identity], strings.TrimSpace(l.Message))
+		if l.Imported != "" {
+			fmt.Printf("    Imported from %s\n", l.Imported)
+		}
+		if ts, ok := stamps[l.ID]; ok {
+			fmt.Printf("    Timestamp:%s, Authority:%s\n", ts.GenTime, ts.Authority)
+		}
+	}
+	fmt.Printf("Signatures verified: %d/%d\n", r.Signatures, r.Entries)
+	fmt.Printf("Inclusion proofs verified: %d/%d\n", r.Proofs, r.Entries)
+	fmt.Printf("Timestamps verified: %d/%d\n", r.Timestamps, len(b.Timestamps))
+	fmt.Printf("Key records verified: %d/%d\n", r.KeyRecords, len(b.KeyRecords))
+	fmt.Printf("Entries in a witnessed checkpoint: %d/%d\n", r.Witnessed, r.Entries)
+	for _, f := range r.Failures {
+		fmt.Printf("FAILED: %s\n", f)
+	}
+	if r.OK() {
+		fmt.Println("Bundle OK")
+	} else {
+		fmt.Println("Bundle FAILED verification")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(verifyBundleCmd)
+	verifyBundleCmd.Flags().StringVar(&pinnedKeyPath, "serverkey", "", "path to the trusted server public key (custody_server_ecdsa.pub)")
+	verifyBundleCmd.Flags().StringVar(&tsaCertPath, "tsacert", "", "path to the trusted time stamping authority certificate")
+	addWitnessFlags(verifyBundleCmd)
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/container"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var verifyMedia bool
+
+// fileCheck: the result of custody verify-file.
+type fileCheck struct {
+	File    string
+	Item    string
+	Entry   int
+	Signer  string
+	Size    int64
+	Blocks  int
+	Root    string
+	Differs []piecewise.Range
+}
+
+// verifyFileCmd represents the verify-file command
+var verifyFileCmd = &cobra.Command{
+	Use:   "verify-file file",
+	Short: "Check a copy of an evidence item against the hash list recorded when it was registered.",
+	Long: `custody verify-file hashes the file in the blocks of the hash list of --item, in parallel,
+and reports every byte range that differs from the item as it was registered.
+The hash list is only trusted after checking that the signed registration entry commits to its Merkle root.
+With --media the file is a forensic image (E01, Ex01 or AFF4), and the media inside it is compared,
+as for items registered with custody ingest.
+Exits with status 1 if the file differs.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var reply custody.ItemHashes
+		if itemTag == "" {
+			log.Fatal("you must provide an item with --item")
+		}
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Item: itemTag}
+		authorize("Clerk.ItemHashes", &req)
+		err = client.Call("Clerk.ItemHashes", &req, &reply)
+		Fatal(err, "could not get hash list: %s")
+		signer, err := reply.Verify()
+		Fatal(err, "hash list does not match the ledger: %s")
+
+		var list *piecewise.List
+		if verifyMedia {
+			img, err := container.Open(args[0])
+			Fatal(err, "could not open image: %s")
+			list, err = piecewise.Hash(img, img.Size, reply.List.BlockSize)
+			img.Close()
+			Fatal(err, "could not hash media: %s")
+		} else {
+			list, err = piecewise.HashFile(args[0], reply.List.BlockSize)
+			Fatal(err, "could not hash file: %s")
+		}
+		ranges, err := piecewise.Diff(&reply.List, list)
+		Fatal(err, "could not compare hash lists: %s")
+		r := fileCheck{File: args[0], Item: itemTag, Entry: reply.Entry.ID, Signer: signer,
+			Size: list.Size, Blocks: len(list.Blocks), Root: fmt.Sprintf("%x", list.Root()), Differs: ranges}
+		if config.json {
+			Output(r)
+		} else {
+			fmt.Printf("Item %s registered in entry %d, signed by key %s\n", itemTag, reply.Entry.ID, signer)
+			fmt.Printf("Registered: %d bytes in %d blocks of %d, merkle root %x\n",
+				reply.List.Size, len(reply.List.Blocks), reply.List.BlockSize, reply.List.Root())
+			fmt.Printf("File: %d bytes, merkle root %s\n", list.Size, r.Root)
+			if list.Size != reply.List.Size {
+				fmt.Printf("SIZE DIFFERS: the file has %d bytes, the item had %d\n", list.Size, reply.List.Size)
+			}
+			for _, d := range ranges {
+				fmt.Printf("DIFFERS: %s\n", d)
+			}
+			if len(ranges) == 0 {
+				fmt.Printf("%s matches item %s\n", args[0], itemTag)
+			}
+		}
+		if len(ranges) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyFileCmd)
+	verifyFileCmd.Flags().StringVar(&itemTag, "item", "", "the tag of the evidence item")
+	verifyFileCmd.Flags().BoolVar(&verifyMedia, "media", false, "compare the media inside a forensic image")
+}
@@ -0,0 +1,165 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var watchItem, watchUser string
+var watchAll bool
+var watchAfter int
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print ledger entries as they are committed.",
+	Long: `custody watch --case C tails the entries of case C, --item E-9 those of an item,
+--user bob those signed by bob and --all every entry. Without a filter it tails your own entries, like custody list.
+Users who cannot read every case can only watch the cases they signed entries in and their own entries.
+
+The entries stream from the server as Server-Sent Events from /watch. If the connection drops, custody watch
+reconnects and resumes after the last entry it printed, so no entry is missed. --after N starts after entry N
+instead of at the latest entry, --after 0 replays the whole ledger first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := custody.RecordRequest{Case: caseID, Item: watchItem, Subject: watchUser}
+		if !watchAll && caseID == "" && watchItem == "" && watchUser == "" {
+			filter.Subject = username
+		}
+		cursor, wait := watchAfter, time.Second
+		for {
+			req := filter
+			req.Entry = cursor
+			authorize("Clerk.Watch", &req)
+			started := time.Now()
+			err := watch(&req, &cursor)
+			if herr, ok := err.(watchRefused); ok {
+				log.Fatalf("could not watch: %s", string(herr))
+			}
+			if time.Since(started) > time.Minute {
+				wait = time.Second
+			}
+			log.Printf("watch interrupted: %s, resuming after entry %d in %s", err, cursor, wait)
+			time.Sleep(wait)
+			if wait < time.Minute {
+				wait *= 2
+			}
+		}
+	},
+}
+
+// watchRefused: the server refused a watch request, retrying will not help.
+type watchRefused string
+
+func (e watchRefused) Error() string { return string(e) }
+
+// watch: print the entries streamed for req, advancing cursor past each one, until the stream ends.
+func watch(req *custody.RecordRequest, cursor *int) error {
+	r, err := custody.NewWatchRequest(fmt.Sprintf("http://%s:4911/watch", serverAddress), req)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		if res.StatusCode/100 == 4 {
+			return watchRefused(strings.TrimSpace(string(msg)))
+		}
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	var event, id, data string
+	lines := bufio.NewScanner(res.Body)
+	lines.Buffer(nil, 1<<20)
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = line[len("event: "):]
+		case strings.HasPrefix(line, "id: "):
+			id = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			data = line[len("data: "):]
+		case line == "":
+			if n, err := strconv.Atoi(id); err == nil {
+				*cursor = n
+			}
+			switch event {
+			case "ready":
+				log.Printf("watching entries after %d", *cursor)
+			case "entry":
+				var e custody.PublishedEntry
+				if err := json.Unmarshal([]byte(data), &e); err != nil {
+					return err
+				}
+				printWatched(e)
+			case "error":
+				return fmt.Errorf("the server failed: %s", data)
+			}
+			event, id, data = "", "", ""
+		}
+	}
+	if err = lines.Err(); err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func printWatched(e custody.PublishedEntry) {
+	if config.json {
+		Output(e)
+		return
+	}
+	where := ""
+	if e.CaseID != "" {
+		where += " Case:" + e.CaseID + ","
+	}
+	if e.Item != "" {
+		where += " Item:" + e.Item + ","
+	}
+	fmt.Printf("ID:%d, CreatedAt:%s, Signer:%s,%s Hash:%s, Message:%s\n",
+		e.ID, e.Time.Format(time.RFC3339), e.Signer, where, crypto.EncodeBinary(e.Signature), e.Message)
+}
+
+func init() {
+	RootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVar(&caseID, "case", "", "watch the entries of this case")
+	watchCmd.Flags().StringVar(&watchItem, "item", "", "watch the entries of this evidence item")
+	watchCmd.Flags().StringVar(&watchUser, "user", "", "watch the entries signed by this user")
+	watchCmd.Flags().BoolVar(&watchAll, "all", false, "watch every entry, for users who can read every case")
+	watchCmd.Flags().IntVar(&watchAfter, "after", -1, "start after this entry, the latest if not given")
+}
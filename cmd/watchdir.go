@@ -0,0 +1,133 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+)
+
+var watchDirIgnore, watchDirLegacy []string
+var watchDirDebounce, watchDirRetry time.Duration
+var watchDirAttempts int
+
+// watchDirCmd represents the watch-dir command
+var watchDirCmd = &cobra.Command{
+	Use:   "watch-dir dir",
+	Short: "watch-dir records the files created, modified, renamed and deleted in a case directory.",
+	Long: `watch-dir watches a directory and the directories under it, and signs an entry for every change to a file
+with your key, stating its path in the directory, its size and its digests:
+custody watch-dir /cases/123 --case 123 --ignore '*.tmp' --ignore '.~lock*'
+signs entries such as "create file images/disk.dd: 1073741824 bytes: sha256 ..., observed 2018-06-01T14:02:11Z".
+Files already in the directory when it starts are not recorded, only what happens to them afterwards.
+
+A file is recorded once it has not changed for --debounce, so that a file being written is hashed once.
+Files are hashed in the background, changes made meanwhile are still seen.
+Signed entries are queued in ~/.custodyctl/queue and sent in order, if the server cannot be reached they wait
+there until it can, also across restarts. Entries the server refuses for good, such as for their signature, the policy,
+their contents or your permissions, are moved to queue/rejected. Entries it fails on otherwise, such as on a locked
+database, stay queued for --attempts tries before they are moved there too.
+Receipts are stored in ~/.custodyctl/receipts as with custody sign. Stop it with Ctrl-C.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if caseID == "" {
+			log.Fatal("watch-dir needs the --case the directory belongs to")
+		}
+		info, err := os.Stat(args[0])
+		Fatal(err, "could not watch directory: %s")
+		if !info.IsDir() {
+			log.Fatalf("%s is not a directory", args[0])
+		}
+		key, err := client.LoadPrivateKey("")
+		Fatal(err, "could not load private key: %s")
+		receipts, err := client.ReceiptDir("")
+		Fatal(err, "could not find receipt directory: %s")
+		queue, err := client.QueueDir("")
+		Fatal(err, "could not find queue directory: %s")
+		// Fail now on an unknown digest rather than on the first file.
+		_, err = custody.DigestFile(os.DevNull, watchDirLegacy)
+		Fatal(err, "%s")
+
+		var rpcclient *rpc.Client
+		send := func(req *custody.RecordRequest) error {
+			var err error
+			if rpcclient == nil {
+				if rpcclient, err = rpc.DialHTTP("tcp", serverAddress+":4911"); err != nil {
+					return err
+				}
+			}
+			var reply custody.Receipt
+			err = rpcclient.Call("Clerk.Validate", req, &reply)
+			if _, answered := err.(rpc.ServerError); err != nil && !answered {
+				rpcclient.Close()
+				rpcclient = nil
+			}
+			if err != nil {
+				return err
+			}
+			log.Printf("Ledger Entry: %+v", reply.Entry)
+			for _, v := range reply.Violations {
+				log.Printf("warning: the entry breaks policy %s", v)
+			}
+			if reply.Signature != nil {
+				if err = reply.Verify(nil); err != nil {
+					log.Printf("server returned an invalid receipt: %s", err)
+				} else if err = custody.SaveReceipt(receipts, &reply); err != nil {
+					log.Printf("could not store receipt: %s", err)
+				}
+			}
+			return nil
+		}
+
+		w := &custody.DirWatcher{Dir: args[0], Name: username, Key: key, CaseID: caseID, Item: itemTag,
+			Ignore: watchDirIgnore, Debounce: watchDirDebounce, Legacy: watchDirLegacy, Retry: watchDirRetry,
+			Queue: &custody.EntryQueue{Dir: queue, Attempts: watchDirAttempts}, Send: send}
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+		log.Printf("watching %s for case %s", args[0], caseID)
+		err = w.Run(stop)
+		Fatal(err, "could not watch directory: %s")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(watchDirCmd)
+	watchDirCmd.Flags().StringVar(&caseID, "case", "", "the case the directory belongs to")
+	watchDirCmd.Flags().StringVar(&itemTag, "item", "", "the evidence item the files are about")
+	watchDirCmd.Flags().StringArrayVar(&watchDirIgnore, "ignore", nil, "skip files whose name or path matches this pattern, repeat for several")
+	watchDirCmd.Flags().DurationVar(&watchDirDebounce, "debounce", 2*time.Second, "how long a file must be unchanged before it is recorded")
+	watchDirCmd.Flags().DurationVar(&watchDirRetry, "retry", 30*time.Second, "how long to wait before trying an unreachable server again")
+	watchDirCmd.Flags().IntVar(&watchDirAttempts, "attempts", custody.DefaultAttempts, "how many times to send an entry the server fails on before it is moved to queue/rejected")
+	watchDirCmd.Flags().StringSliceVar(&watchDirLegacy, "legacy-digest", nil, "also record the sha1 or md5 of every file for legacy tools")
+}
@@ -1,33 +1,106 @@
 package cmd
 
 import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.gatech.edu/NIJ-Grant/custody/lib"
-	"log"
+	"github.gatech.edu/NIJ-Grant/custody/store"
 )
 
+var tlsCert, tlsKey string
+var insecureCookies bool
+var storeKeyFile string
+
 // serveCmd represents the serve command
 var httpCmd = &cobra.Command{
 	Use:   "http",
 	Short: "start the custody web server",
-	Long:  `The server must be running in order to conduct operations on the database.`,
+	Long: `The server must be running in order to conduct operations on the database.
+
+Every page except the index and the login page requires a session.
+Session cookies are only sent over https, so serve with --tls-cert and --tls-key
+or put the web server behind a tls proxy. --insecure-cookies is for local development only.
+
+Uploaded evidence is encrypted at rest with the master keys in --store-key-file,
+or in the CUSTODY_STORE_KEY environment variable, see custody store keygen.
+Without a master key the evidence store keeps files in plaintext.
+
+Give the database of the custody server with --dsn: evidence is only served to the members of its case,
+as custody member decides, and to the roles that read every case.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Println("starting web server")
-		server, _ := custody.InitializeHTTPServer()
-		server.ListenAndServe()
+		custody.SecureCookies = !insecureCookies
+		keys, err := store.LoadKeyring(storeKeyFile)
+		Fatal(err, "could not load the master key of the evidence store: %s")
+		if keys == nil {
+			log.Println("WARNING: no master key, evidence is stored in plaintext")
+		}
+		custody.StoreKeys = keys
+		// case membership is kept by the custody server, the web server reads it from the same database
+		if dsn == "" {
+			log.Fatal("the web server needs the database of the custody server, give it with --dsn")
+		}
+		custody.Ledger, err = custody.Dial(dsn)
+		Fatal(err, "could not open the custody database: %s")
+		server, err := custody.InitializeHTTPServer()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if tlsCert != "" {
+			log.Fatal(server.ListenAndServeTLS(tlsCert, tlsKey))
+		}
+		log.Fatal(server.ListenAndServe())
+	},
+}
+
+// addUserCmd enrolls a user of the web application
+var addUserCmd = &cobra.Command{
+	Use:   "adduser email",
+	Short: "add a user who can log in to the web server",
+	Long: `The password is read from the first line of standard input and stored as a bcrypt hash.
+Use this to create the first user, who can then sign up others.
+The user logs in with the role granted to the same name with custody grant, without one they can only sign in.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := sql.Open("sqlite3", "nij.db")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		if err = custody.InitWebDB(db); err != nil {
+			log.Fatal(err)
+		}
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			log.Fatalf("could not read password: %s", err)
+		}
+		flags := cmd.Flags()
+		user := &custody.User{Email: args[0], Password: strings.TrimRight(password, "\r\n")}
+		user.Firstname, _ = flags.GetString("firstname")
+		user.Lastname, _ = flags.GetString("lastname")
+		if err = custody.InsertUser(db, user); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("added user %s\n", user.Email)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(httpCmd)
+	httpCmd.AddCommand(addUserCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// serveCmd.PersistentFlags().String("foo", "", "A help for foo")
+	httpCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "serve https with this certificate file")
+	httpCmd.Flags().StringVar(&tlsKey, "tls-key", "", "the private key file of --tls-cert")
+	httpCmd.Flags().StringVar(&custody.StoreDir, "store", custody.StoreDir, "directory of the content addressed evidence store")
+	httpCmd.Flags().StringVar(&storeKeyFile, "store-key-file", "", "file with the master keys of the evidence store, the first one is current (default $"+store.EnvKey+")")
+	httpCmd.Flags().BoolVar(&insecureCookies, "insecure-cookies", false, "allow session cookies over plain http, for local development only")
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// serveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addUserCmd.Flags().String("firstname", "", "first name of the user")
+	addUserCmd.Flags().String("lastname", "", "last name of the user")
 }
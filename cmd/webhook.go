@@ -0,0 +1,123 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/rpc"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var webhookEvents []string
+
+// webhookCmd represents the webhook command
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Send ledger events to other systems.",
+	Long: `A webhook receives a POST with a JSON payload for every event of the ledger it subscribes to.
+custody serve delivers each event at least once, retrying with backoff, and keeps the events it could not deliver
+as dead letters. X-Custody-Delivery names the event the same way on every attempt, X-Custody-Signature holds the HMAC-SHA256
+of the body with the secret of the webhook, and X-Custody-Server-Signature the signature of the server key.
+Only admins can manage webhooks.
+
+The event types are ` + strings.Join(custody.EventTypes, ", ") + `.`,
+}
+
+// webhookAddCmd represents the webhook add command
+var webhookAddCmd = &cobra.Command{
+	Use:   "add url",
+	Short: "Subscribe a URL to ledger events.",
+	Long: `custody webhook add https://cms.example.com/custody --event transferred --event tainted --case C9
+sends the transfers and tainted items of case C9, without --event every event and without --case every case.
+Adding a webhook is a ledger entry signed by the admin. The secret is printed once, keep it to check the signatures.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, hash := signMessage(custody.WebhookMessage(args[0], webhookEvents, caseID), caseID, "")
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Name: username, Data: data, Hash: hash, URL: args[0], Events: webhookEvents, Case: caseID}
+		var reply models.Webhook
+		err = client.Call("Clerk.AddWebhook", &req, &reply)
+		Fatal(err, "could not add webhook: %s")
+		fmt.Printf("added webhook %d by entry %d\nsecret %s\n", reply.ID, reply.Ledger, reply.Secret)
+		Output(reply)
+	},
+}
+
+// webhookListCmd represents the webhook list command
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the webhooks and their pending and dead deliveries.",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{}
+		authorize("Clerk.Webhooks", &req)
+		var reply []custody.WebhookStatus
+		err = client.Call("Clerk.Webhooks", &req, &reply)
+		Fatal(err, "could not list webhooks: %s")
+		for _, s := range reply {
+			w := s.Webhook
+			events, cases := w.Events, w.CaseID
+			if events == "" {
+				events = "every event"
+			}
+			if cases == "" {
+				cases = "every case"
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\tthrough entry %d\t%d pending\t%d dead\n", w.ID, w.URL, events, cases, w.Cursor, s.Pending, s.Dead)
+		}
+		Output(reply)
+	},
+}
+
+// webhookTestCmd represents the webhook test command
+var webhookTestCmd = &cobra.Command{
+	Use:   "test id",
+	Short: "Send a test event to a webhook now.",
+	Long: `The server posts a test event with the entry that added the webhook, once and without retrying,
+and reports whether the receiver accepted it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rpc.DialHTTP("tcp", serverAddress+":4911")
+		Fatal(err, "dialing: %s")
+		req := custody.RecordRequest{Subject: args[0]}
+		authorize("Clerk.TestWebhook", &req)
+		var reply models.Webhook
+		err = client.Call("Clerk.TestWebhook", &req, &reply)
+		Fatal(err, "the test event was not delivered: %s")
+		fmt.Printf("delivered a test event to %s\n", reply.URL)
+		Output(reply)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(webhookCmd)
+	webhookCmd.AddCommand(webhookAddCmd)
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookTestCmd)
+	webhookAddCmd.Flags().StringArrayVar(&webhookEvents, "event", nil, "an event type to send, repeat for several, every type if not given")
+	webhookAddCmd.Flags().StringVar(&caseID, "case", "", "only send the events of this case")
+}
@@ -0,0 +1,153 @@
+// Copyright © 2018 James Fairbanks <james.fairbanks@gatech.edu>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/lib"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+var primaryAddress, witnessKeyPath, witnessStatePath string
+var witnessInterval time.Duration
+var witnessOnce bool
+
+// witnessKeyPaths and requiredWitnesses are the trusted witnesses of the commands that check checkpoints.
+var witnessKeyPaths []string
+var requiredWitnesses int
+
+// witnessCmd represents the witness command
+var witnessCmd = &cobra.Command{
+	Use:   "witness",
+	Short: "Follow a custody server and cosign its checkpoints.",
+	Long: `custody witness runs an independent witness for a custody server.
+It periodically fetches the latest signed checkpoint with a consistency proof from the last checkpoint it saw,
+and cosigns the checkpoint only if the ledger was append-only in between.
+If the server rewrites history the witness refuses to cosign and keeps its last state.
+The witness key is generated at --key on first use, give --key.pub to clients for --witness,
+and to the server with custody serve --witness, which only accepts cosignatures from the witnesses it knows.
+Pin the server key with --serverkey, otherwise it is pinned on first contact.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := custody.LoadServerKey(witnessKeyPath)
+		Fatal(err, "could not load witness key: %s")
+		state, err := custody.LoadWitnessState(witnessStatePath)
+		Fatal(err, "could not load witness state: %s")
+		if pinnedKeyPath != "" && state.ServerKey == nil {
+			state.ServerKey, err = ioutil.ReadFile(pinnedKeyPath)
+			Fatal(err, "could not read server key: %s")
+		}
+		w := &custody.Witness{Key: key, State: state}
+		pub, err := x509.MarshalPKIXPublicKey(key.Public())
+		Fatal(err, "could not encode witness key: %s")
+		log.Printf("witness %s following %s from size %d", crypto.Fingerprint(pub), primaryAddress, state.Size)
+
+		for {
+			if err = witness(w); err != nil {
+				log.Printf("witness: %s", err)
+			}
+			if witnessOnce {
+				Fatal(err, "%s")
+				return
+			}
+			time.Sleep(witnessInterval)
+		}
+	},
+}
+
+// witness: fetch a consistency proof from the primary, check it and send back a cosignature.
+func witness(w *custody.Witness) error {
+	client, err := rpc.DialHTTP("tcp", primaryAddress)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	var p custody.ConsistencyProof
+	req := custody.RecordRequest{Size: w.State.Size}
+	if err = client.Call("Clerk.Consistency", &req, &p); err != nil {
+		return err
+	}
+	cs, err := w.Observe(&p)
+	if err != nil {
+		return fmt.Errorf("REFUSING to cosign: %s", err)
+	}
+	if err = w.State.Save(witnessStatePath); err != nil {
+		return err
+	}
+	if cs == nil {
+		return nil
+	}
+	var reply models.Cosignature
+	req = custody.RecordRequest{Checkpoint: cs.Checkpoint, PublicKey: cs.Witness, Hash: cs.Signature}
+	if err = client.Call("Clerk.Cosign", &req, &reply); err != nil {
+		return err
+	}
+	log.Printf("cosigned checkpoint of size %d root %s", p.Checkpoint.Size, crypto.EncodeBinary(p.Checkpoint.Root))
+	return nil
+}
+
+// addWitnessFlags: the flags of commands that can require witness cosignatures on checkpoints.
+func addWitnessFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&witnessKeyPaths, "witness", nil, "path to the public key of a trusted witness, may be repeated")
+	cmd.Flags().IntVar(&requiredWitnesses, "witnesses", 0, "number of trusted witness cosignatures required on the checkpoint")
+}
+
+// checkWitnesses: require the cosignatures given with --witnesses and --witness on a checkpoint.
+func checkWitnesses(cp *models.Checkpoint, cosigs []*models.Cosignature) (int, error) {
+	if requiredWitnesses > len(witnessKeyPaths) {
+		log.Fatalf("--witnesses %d needs at least as many --witness keys", requiredWitnesses)
+	}
+	witnesses := loadWitnessKeys()
+	if cp == nil {
+		return 0, fmt.Errorf("no checkpoint to check cosignatures on")
+	}
+	return custody.VerifyCosignatures(cp, cosigs, witnesses, requiredWitnesses)
+}
+
+// loadWitnessKeys: the witness public keys given with --witness.
+func loadWitnessKeys() []*ecdsa.PublicKey {
+	var witnesses []*ecdsa.PublicKey
+	for _, path := range witnessKeyPaths {
+		keybytes, err := ioutil.ReadFile(path)
+		Fatal(err, "could not read witness key: %s")
+		pub, err := crypto.ParseECDSAPublicKey(keybytes)
+		Fatal(err, "could not parse witness key: %s")
+		witnesses = append(witnesses, pub)
+	}
+	return witnesses
+}
+
+func init() {
+	RootCmd.AddCommand(witnessCmd)
+	witnessCmd.Flags().StringVar(&primaryAddress, "primary", "localhost:4911", "address of the custody server to follow")
+	witnessCmd.Flags().StringVar(&witnessKeyPath, "key", "custody_witness_ecdsa", "path to the witness signing key, generated if missing")
+	witnessCmd.Flags().StringVar(&witnessStatePath, "state", "custody_witness.json", "file recording the last checkpoint the witness cosigned")
+	witnessCmd.Flags().StringVar(&pinnedKeyPath, "serverkey", "", "path to the server public key to pin")
+	witnessCmd.Flags().DurationVar(&witnessInterval, "interval", 30*time.Second, "how often to check the server")
+	witnessCmd.Flags().BoolVar(&witnessOnce, "once", false, "check the server once and exit")
+}
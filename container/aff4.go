@@ -0,0 +1,427 @@
+package container
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AFF4 containers follow the AFF4 Standard v1.0: a ZIP64 volume with the metadata as RDF
+// in information.turtle, the media in image streams of compressed chunks stored in segments called bevies,
+// and maps that lay out the regions of a disk image over image streams.
+
+// aff4Volume: an open AFF4 container.
+type aff4Volume struct {
+	file    *os.File
+	urn     string
+	members map[string]*zip.File
+	triples []triple
+}
+
+// openAFF4: open an AFF4 container and the first disk image in it.
+func openAFF4(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Metadata: Metadata{Format: FormatAFF4}, closers: []io.Closer{f}}
+	if err = readAFF4(img, f); err != nil {
+		img.Close()
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return img, nil
+}
+
+func readAFF4(img *Image, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	v := &aff4Volume{file: f, urn: strings.TrimSpace(zr.Comment), members: map[string]*zip.File{}}
+	for _, m := range zr.File {
+		v.members[m.Name] = m
+	}
+	if desc, err := v.read("container.description"); err == nil {
+		v.urn = strings.TrimSpace(string(desc))
+	}
+	info, err := v.read("information.turtle")
+	if err != nil {
+		return fmt.Errorf("not an AFF4 volume: %s", err)
+	}
+	if v.triples, err = parseTurtle(string(info)); err != nil {
+		return err
+	}
+
+	image := v.first(aff4NS + "Image")
+	stream := v.object(image, "dataStream")
+	if image == "" {
+		if stream = v.first(aff4NS + "Map"); stream == "" {
+			stream = v.first(aff4NS + "ImageStream")
+		}
+	}
+	if stream == "" {
+		return fmt.Errorf("the volume holds no disk image")
+	}
+	if img.media, err = v.stream(stream, 0); err != nil {
+		return err
+	}
+	img.Size = v.size(image)
+	if img.Size == 0 {
+		img.Size = v.size(stream)
+	}
+	for _, subject := range []string{stream, image} {
+		for _, t := range v.triples {
+			if t.Subject != subject || t.Predicate != aff4NS+"hash" || !t.Literal {
+				continue
+			}
+			digest, err := hex.DecodeString(t.Object)
+			if err != nil {
+				return fmt.Errorf("hash of %s is not hex: %s", subject, err)
+			}
+			switch t.Datatype {
+			case aff4NS + "MD5":
+				img.MD5 = digest
+			case aff4NS + "SHA1":
+				img.SHA1 = digest
+			case aff4NS + "SHA256":
+				img.SHA256 = digest
+			}
+		}
+	}
+	img.CaseNumber = v.any("caseNumber", "caseName")
+	img.EvidenceNumber = v.any("evidenceNumber")
+	img.Description = v.any("caseDescription", "description")
+	img.Examiner = v.any("examiner")
+	img.Notes = v.any("notes")
+	img.Tool = v.any("tool")
+	if started := v.any("startTime"); started != "" {
+		if img.Acquired, err = time.Parse(time.RFC3339Nano, started); err != nil {
+			return fmt.Errorf("acquisition time %q: %s", started, err)
+		}
+		img.Acquired = img.Acquired.UTC()
+	}
+	return nil
+}
+
+// first: the first subject, in order of their IRIs, of type class.
+func (v *aff4Volume) first(class string) string {
+	var subjects []string
+	for _, t := range v.triples {
+		if t.Predicate == rdfNS+"type" && t.Object == class {
+			subjects = append(subjects, t.Subject)
+		}
+	}
+	sort.Strings(subjects)
+	if len(subjects) == 0 {
+		return ""
+	}
+	return subjects[0]
+}
+
+// object: the first value of the AFF4 property of subject.
+func (v *aff4Volume) object(subject, property string) string {
+	for _, t := range v.triples {
+		if t.Subject == subject && t.Predicate == aff4NS+property {
+			return t.Object
+		}
+	}
+	return ""
+}
+
+// any: the first value of the first of the AFF4 properties that any subject has.
+func (v *aff4Volume) any(properties ...string) string {
+	for _, p := range properties {
+		for _, t := range v.triples {
+			if t.Predicate == aff4NS+p {
+				return t.Object
+			}
+		}
+	}
+	return ""
+}
+
+func (v *aff4Volume) size(subject string) int64 {
+	n, _ := strconv.ParseInt(v.object(subject, "size"), 10, 64)
+	return n
+}
+
+// member: the zip member that stores the segment urn. Segments of the volume are named by the rest of their URN,
+// others by the URN with its scheme escaped.
+func (v *aff4Volume) member(urn string) (*zip.File, error) {
+	names := []string{urn, strings.Replace(urn, "aff4://", "aff4%3A%2F%2F", 1)}
+	if v.urn != "" && strings.HasPrefix(urn, v.urn+"/") {
+		names = append([]string{strings.TrimPrefix(urn, v.urn+"/")}, names...)
+	}
+	for _, name := range names {
+		if m, ok := v.members[name]; ok {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("segment %s is missing", urn)
+}
+
+// read: the contents of the zip member name, or of the segment with that URN.
+func (v *aff4Volume) read(name string) ([]byte, error) {
+	m, ok := v.members[name]
+	if !ok {
+		var err error
+		if m, err = v.member(name); err != nil {
+			return nil, err
+		}
+	}
+	r, err := m.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// segment: random access to a segment. Stored members are read in place, compressed ones are read into memory.
+func (v *aff4Volume) segment(urn string) (io.ReaderAt, error) {
+	m, err := v.member(urn)
+	if err != nil {
+		return nil, err
+	}
+	if m.Method == zip.Store {
+		offset, err := m.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(v.file, offset, int64(m.UncompressedSize64)), nil
+	}
+	data, err := v.read(m.Name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// stream: the data of the stream urn, an image stream, a map or one of the symbolic streams.
+func (v *aff4Volume) stream(urn string, depth int) (io.ReaderAt, error) {
+	if depth > 4 {
+		return nil, fmt.Errorf("maps of %s are nested too deep", urn)
+	}
+	switch {
+	case urn == aff4NS+"Zero":
+		return pattern{0}, nil
+	case urn == aff4NS+"UnknownData":
+		return pattern("UNKNOWN"), nil
+	case urn == aff4NS+"UnreadableData":
+		return pattern("UNREADABLEDATA"), nil
+	case strings.HasPrefix(urn, aff4NS+"SymbolicStream"):
+		b, err := strconv.ParseUint(strings.TrimPrefix(urn, aff4NS+"SymbolicStream"), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("unknown symbolic stream %s", urn)
+		}
+		return pattern{byte(b)}, nil
+	}
+	for _, t := range v.triples {
+		if t.Subject != urn || t.Predicate != rdfNS+"type" {
+			continue
+		}
+		switch t.Object {
+		case aff4NS + "ImageStream":
+			return v.imageStream(urn)
+		case aff4NS + "Map":
+			return v.mapStream(urn, depth)
+		}
+	}
+	return nil, fmt.Errorf("%s is not an image stream or map", urn)
+}
+
+// aff4Stream: an image stream, chunks of chunkSize bytes compressed one by one
+// and stored chunksInSegment to a bevy. The index of a bevy has the offset and length of each chunk in it.
+type aff4Stream struct {
+	v               *aff4Volume
+	urn             string
+	size            int64
+	chunkSize       int64
+	chunksInSegment int64
+	compression     string
+
+	mu      sync.Mutex
+	bevies  map[int64]io.ReaderAt
+	indexes map[int64][]byte
+}
+
+func (v *aff4Volume) imageStream(urn string) (*aff4Stream, error) {
+	s := &aff4Stream{v: v, urn: urn, size: v.size(urn), compression: v.object(urn, "compressionMethod"),
+		bevies: map[int64]io.ReaderAt{}, indexes: map[int64][]byte{}}
+	s.chunkSize, _ = strconv.ParseInt(v.object(urn, "chunkSize"), 10, 64)
+	s.chunksInSegment, _ = strconv.ParseInt(v.object(urn, "chunksInSegment"), 10, 64)
+	if s.chunkSize <= 0 || s.chunksInSegment <= 0 {
+		return nil, fmt.Errorf("image stream %s has chunks of %d bytes, %d to a segment", urn, s.chunkSize, s.chunksInSegment)
+	}
+	return s, nil
+}
+
+// bevy: the data and index of bevy n.
+func (s *aff4Stream) bevy(n int64) (io.ReaderAt, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.bevies[n]; ok {
+		return b, s.indexes[n], nil
+	}
+	name := fmt.Sprintf("%s/%08d", s.urn, n)
+	index, err := s.v.read(name + ".index")
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := s.v.segment(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.bevies[n], s.indexes[n] = b, index
+	return b, index, nil
+}
+
+// chunk: the data of chunk i. A chunk that did not compress is stored as it is.
+func (s *aff4Stream) chunk(i int64) ([]byte, error) {
+	b, index, err := s.bevy(i / s.chunksInSegment)
+	if err != nil {
+		return nil, err
+	}
+	j := i % s.chunksInSegment
+	if int64(len(index)) < 12*(j+1) {
+		return nil, fmt.Errorf("chunk %d of %s is not in its bevy index", i, s.urn)
+	}
+	offset := int64(binary.LittleEndian.Uint64(index[12*j:]))
+	length := int64(binary.LittleEndian.Uint32(index[12*j+8:]))
+	raw := make([]byte, length)
+	if _, err := b.ReadAt(raw, offset); err != nil {
+		return nil, fmt.Errorf("could not read chunk %d of %s: %s", i, s.urn, err)
+	}
+	want := s.chunkSize
+	if rest := s.size - i*s.chunkSize; rest < want {
+		want = rest
+	}
+	data := raw
+	if length != s.chunkSize {
+		switch c := s.compression; {
+		case strings.Contains(c, "snappy"):
+			data, err = unsnappy(raw)
+		case strings.Contains(c, "lz4"):
+			data, err = unlz4(raw, int(s.chunkSize))
+		case strings.Contains(c, "rfc1951"):
+			data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+		case strings.Contains(c, "rfc1950"):
+			data, err = inflate(raw)
+		case c == "" || strings.Contains(c, "NullCompressor"):
+		default:
+			err = fmt.Errorf("unsupported compression %s", c)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("chunk %d of %s: %s", i, s.urn, err)
+	}
+	if int64(len(data)) < want {
+		return nil, fmt.Errorf("chunk %d of %s has %d bytes, not %d", i, s.urn, len(data), want)
+	}
+	return data[:want], nil
+}
+
+func (s *aff4Stream) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= s.size {
+			return n, io.EOF
+		}
+		data, err := s.chunk(pos / s.chunkSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos%s.chunkSize:])
+	}
+	return n, nil
+}
+
+// aff4Region: a region of a map, length bytes at offset read from target at targetOffset.
+type aff4Region struct {
+	offset, length, targetOffset int64
+	target                       io.ReaderAt
+}
+
+// aff4Map: regions of other streams laid out as one stream. Bytes outside every region read as zero.
+type aff4Map struct {
+	regions []aff4Region
+}
+
+// mapStream: read the map of urn. The map segment has 28 bytes for each region, its offset, length,
+// offset in the target and the number of the target, the idx segment the URNs of the targets one per line.
+func (v *aff4Volume) mapStream(urn string, depth int) (*aff4Map, error) {
+	data, err := v.read(urn + "/map")
+	if err != nil {
+		return nil, err
+	}
+	idx, err := v.read(urn + "/idx")
+	if err != nil {
+		return nil, err
+	}
+	var targets []io.ReaderAt
+	for _, t := range strings.Fields(string(idx)) {
+		r, err := v.stream(t, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, r)
+	}
+	m := &aff4Map{}
+	for i := 0; i+28 <= len(data); i += 28 {
+		e := data[i:]
+		id := int(binary.LittleEndian.Uint32(e[24:]))
+		if id >= len(targets) {
+			return nil, fmt.Errorf("map %s refers to target %d of %d", urn, id, len(targets))
+		}
+		m.regions = append(m.regions, aff4Region{offset: int64(binary.LittleEndian.Uint64(e)),
+			length: int64(binary.LittleEndian.Uint64(e[8:])), targetOffset: int64(binary.LittleEndian.Uint64(e[16:])), target: targets[id]})
+	}
+	sort.Slice(m.regions, func(i, j int) bool { return m.regions[i].offset < m.regions[j].offset })
+	return m, nil
+}
+
+func (m *aff4Map) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		// the first region that ends after pos
+		i := sort.Search(len(m.regions), func(i int) bool { return m.regions[i].offset+m.regions[i].length > pos })
+		if i == len(m.regions) || m.regions[i].offset > pos {
+			end := int64(len(p))
+			if i < len(m.regions) && m.regions[i].offset-off < end {
+				end = m.regions[i].offset - off
+			}
+			for ; int64(n) < end; n++ {
+				p[n] = 0
+			}
+			continue
+		}
+		r := m.regions[i]
+		want := p[n:]
+		if rest := r.offset + r.length - pos; int64(len(want)) > rest {
+			want = want[:rest]
+		}
+		k, err := r.target.ReadAt(want, r.targetOffset+pos-r.offset)
+		n += k
+		if err != nil && !(err == io.EOF && k == len(want)) {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,142 @@
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Decoders for the block formats of Snappy and LZ4, the usual compression of AFF4 image streams.
+// Both formats are a sequence of literals and back references, see
+// https://github.com/google/snappy/blob/main/format_description.txt and
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md.
+
+// backref: append length bytes copied from offset bytes back, the ranges may overlap.
+func backref(dst []byte, offset, length int) ([]byte, error) {
+	if offset <= 0 || offset > len(dst) {
+		return nil, fmt.Errorf("back reference to offset %d of %d bytes", offset, len(dst))
+	}
+	start := len(dst) - offset
+	for i := 0; i < length; i++ {
+		dst = append(dst, dst[start+i])
+	}
+	return dst, nil
+}
+
+// unsnappy: decode a Snappy block.
+func unsnappy(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > 1<<32 {
+		return nil, fmt.Errorf("snappy: bad length")
+	}
+	dst := make([]byte, 0, size)
+	var err error
+	for i := n; i < len(src); {
+		tag := src[i]
+		i++
+		switch tag & 3 {
+		case 0:
+			length := int(tag >> 2)
+			if length >= 60 {
+				extra := length - 59
+				if i+extra > len(src) {
+					return nil, fmt.Errorf("snappy: truncated literal")
+				}
+				length = 0
+				for j := extra - 1; j >= 0; j-- {
+					length = length<<8 | int(src[i+j])
+				}
+				i += extra
+			}
+			length++
+			if i+length > len(src) {
+				return nil, fmt.Errorf("snappy: truncated literal")
+			}
+			dst = append(dst, src[i:i+length]...)
+			i += length
+			continue
+		case 1:
+			if i >= len(src) {
+				return nil, fmt.Errorf("snappy: truncated copy")
+			}
+			dst, err = backref(dst, int(tag&0xe0)<<3|int(src[i]), 4+int(tag>>2&7))
+			i++
+		case 2:
+			if i+2 > len(src) {
+				return nil, fmt.Errorf("snappy: truncated copy")
+			}
+			dst, err = backref(dst, int(binary.LittleEndian.Uint16(src[i:])), 1+int(tag>>2))
+			i += 2
+		case 3:
+			if i+4 > len(src) {
+				return nil, fmt.Errorf("snappy: truncated copy")
+			}
+			dst, err = backref(dst, int(binary.LittleEndian.Uint32(src[i:])), 1+int(tag>>2))
+			i += 4
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snappy: %s", err)
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, fmt.Errorf("snappy: decoded %d bytes, not %d", len(dst), size)
+	}
+	return dst, nil
+}
+
+// unlz4: decode an LZ4 block of at most max bytes.
+func unlz4(src []byte, max int) ([]byte, error) {
+	dst := make([]byte, 0, max)
+	// length: a length of 15 continues in the following bytes
+	length := func(i, n int) (int, int, error) {
+		if n != 15 {
+			return i, n, nil
+		}
+		for {
+			if i >= len(src) {
+				return i, n, fmt.Errorf("lz4: truncated length")
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+	var err error
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		var literals int
+		if i, literals, err = length(i, int(token>>4)); err != nil {
+			return nil, err
+		}
+		if i+literals > len(src) {
+			return nil, fmt.Errorf("lz4: truncated literal")
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			break
+		}
+		if i+2 > len(src) {
+			return nil, fmt.Errorf("lz4: truncated offset")
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		var match int
+		if i, match, err = length(i, int(token&15)); err != nil {
+			return nil, err
+		}
+		if len(dst)+match+4 > max {
+			return nil, fmt.Errorf("lz4: block decodes to more than %d bytes", max)
+		}
+		if dst, err = backref(dst, offset, match+4); err != nil {
+			return nil, fmt.Errorf("lz4: %s", err)
+		}
+	}
+	if len(dst) > max {
+		return nil, fmt.Errorf("lz4: block decodes to more than %d bytes", max)
+	}
+	return dst, nil
+}
@@ -0,0 +1,149 @@
+// Package container: read forensic image containers, Expert Witness (E01 and Ex01) and AFF4.
+// A container holds the media of an acquired disk together with acquisition metadata
+// and the hashes the acquisition tool computed. Open parses the metadata and gives access to the media,
+// so that the embedded hashes can be checked against the media itself.
+package container
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// The container formats.
+const (
+	FormatE01  = "E01"
+	FormatEx01 = "Ex01"
+	FormatAFF4 = "AFF4"
+)
+
+// Metadata: the acquisition metadata recorded in a container.
+// Fields the container does not record are empty, and the hashes are nil.
+type Metadata struct {
+	Format         string
+	CaseNumber     string
+	EvidenceNumber string
+	Description    string
+	Examiner       string
+	Notes          string
+	Tool           string
+	Acquired       time.Time
+	Size           int64
+
+	MD5, SHA1, SHA256 []byte
+}
+
+// Image: an open container, reading from it reads the media.
+type Image struct {
+	Metadata
+	media   io.ReaderAt
+	closers []io.Closer
+}
+
+// ReadAt: read the media, it is safe to call from several goroutines at once.
+func (img *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off >= img.Size {
+		return 0, io.EOF
+	}
+	if remaining := img.Size - off; int64(len(p)) > remaining {
+		n, err := img.media.ReadAt(p[:remaining], off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return img.media.ReadAt(p, off)
+}
+
+// Close: close the files of the container.
+func (img *Image) Close() error {
+	var err error
+	for _, c := range img.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Open: open the container at path, the format is recognized by its signature.
+// An E01 or Ex01 image split into segments is opened by the path of its first segment.
+func Open(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 8)
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a forensic image: %s", path, err)
+	}
+	switch {
+	case bytes.Equal(magic, ewfSignature):
+		return openEWF(path)
+	case bytes.Equal(magic, ewf2Signature):
+		return openEWF2(path)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return openAFF4(path)
+	}
+	return nil, fmt.Errorf("%s is not an E01, Ex01 or AFF4 image", path)
+}
+
+// Check: a hash embedded in the container compared with the hash of the media.
+type Check struct {
+	Algorithm string
+	Embedded  []byte
+	Computed  []byte
+}
+
+// OK: the media still has the embedded hash.
+func (c Check) OK() bool {
+	return bytes.Equal(c.Embedded, c.Computed)
+}
+
+// Verification: the hashes of the media, and how they compare with the embedded ones.
+type Verification struct {
+	SHA256 []byte
+	Checks []Check
+}
+
+// OK: every embedded hash matches the media. A container without hashes cannot be verified.
+func (v *Verification) OK() bool {
+	for _, c := range v.Checks {
+		if !c.OK() {
+			return false
+		}
+	}
+	return len(v.Checks) > 0
+}
+
+// Verify: hash the media and compare it with the embedded hashes.
+func (img *Image) Verify() (*Verification, error) {
+	m, s1, s256 := md5.New(), sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(m, s1, s256), io.NewSectionReader(img, 0, img.Size)); err != nil {
+		return nil, err
+	}
+	v := &Verification{SHA256: s256.Sum(nil)}
+	for _, c := range []Check{{"md5", img.MD5, m.Sum(nil)}, {"sha1", img.SHA1, s1.Sum(nil)}, {"sha256", img.SHA256, v.SHA256}} {
+		if c.Embedded != nil {
+			v.Checks = append(v.Checks, c)
+		}
+	}
+	return v, nil
+}
+
+// pattern: media that reads as a repeated pattern, for unwritten or unreadable regions.
+type pattern []byte
+
+func (p pattern) ReadAt(b []byte, off int64) (int, error) {
+	for i := range b {
+		b[i] = p[(off+int64(i))%int64(len(p))]
+	}
+	return len(b), nil
+}
@@ -0,0 +1,475 @@
+package container
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func FailTest(t *testing.T, err error, fmtstring string) {
+	if err != nil {
+		t.Fatalf(fmtstring, err)
+	}
+}
+
+// The fixtures are small synthetic images written by the functions below, following the layouts the readers expect.
+
+// media: size bytes that do not compress to nothing.
+func media(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*i + i/7)
+	}
+	return data
+}
+
+var acquired = time.Date(2021, 3, 4, 10, 19, 59, 0, time.UTC)
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+func utf16le(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func le64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+// ewfWriter: writes the sections of an E01 segment.
+type ewfWriter struct {
+	bytes.Buffer
+}
+
+func newEWFSegment(n int) *ewfWriter {
+	w := &ewfWriter{}
+	w.Write(ewfSignature)
+	w.Write([]byte{1, byte(n), byte(n >> 8), 0, 0})
+	return w
+}
+
+func (w *ewfWriter) section(kind string, data []byte) {
+	offset := int64(w.Len())
+	desc := make([]byte, 76)
+	copy(desc, kind)
+	next, size := offset+76+int64(len(data)), int64(76+len(data))
+	if kind == "next" || kind == "done" {
+		next = offset
+	}
+	binary.LittleEndian.PutUint64(desc[16:], uint64(next))
+	binary.LittleEndian.PutUint64(desc[24:], uint64(size))
+	binary.LittleEndian.PutUint32(desc[72:], adler32.Checksum(desc[:72]))
+	w.Write(desc)
+	w.Write(data)
+}
+
+// sectors: a sectors section with the chunks and the table that lists them.
+// Even chunks are compressed, odd ones stored with their checksum.
+func (w *ewfWriter) sectors(chunks [][]byte, first int) {
+	start := int64(w.Len()) + 76
+	var data, entries []byte
+	for i, c := range chunks {
+		entry := uint32(start + int64(len(data)))
+		if (first+i)%2 == 0 {
+			data = append(data, deflate(c)...)
+			entry |= 0x80000000
+		} else {
+			data = append(data, c...)
+			data = append(data, le32(adler32.Checksum(c))...)
+		}
+		entries = append(entries, le32(entry)...)
+	}
+	w.section("sectors", data)
+	table := append(le32(uint32(len(chunks))), make([]byte, 20)...)
+	copy(table[20:], le32(adler32.Checksum(table[:20])))
+	table = append(table, entries...)
+	w.section("table", append(table, le32(adler32.Checksum(entries))...))
+}
+
+// writeE01: an image of data in two segments at dir/image.E01 and dir/image.E02.
+func writeE01(t *testing.T, dir string, data, md5sum, sha1sum []byte) string {
+	const sectorsPerChunk, bytesPerSector = 4, 512
+	chunkSize := sectorsPerChunk * bytesPerSector
+	var chunks [][]byte
+	for i := 0; i < len(data); i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, data[i:end])
+	}
+	volume := make([]byte, 1052)
+	copy(volume[4:], le32(uint32(len(chunks))))
+	copy(volume[8:], le32(sectorsPerChunk))
+	copy(volume[12:], le32(bytesPerSector))
+	copy(volume[16:], le64(uint64(len(data)/bytesPerSector)))
+
+	header := "1\nmain\nc\tn\ta\te\tt\tav\tov\tm\tu\tp\tr\n" +
+		"C-12\t3\tUSB stick\tJane Doe\tseized at the scene\t6.19\tWindows 7\t2021 3 4 10 19 59\t2021 3 4 10 19 59\t0\tf\n\n"
+	header2 := fmt.Sprintf("3\nmain\na\tc\tn\te\tt\tav\tov\tm\tu\tp\tdc\n"+
+		"USB stick\tC-12\t3\tJane Doe\tseized at the scene\t6.19\tWindows 7\t%d\t%d\t0\t\n\n", acquired.Unix(), acquired.Unix())
+	s1 := newEWFSegment(1)
+	s1.section("header2", deflate(utf16le(header2)))
+	s1.section("header", deflate([]byte(header)))
+	s1.section("volume", volume)
+	s1.sectors(chunks[:2], 0)
+	s1.section("next", nil)
+
+	s2 := newEWFSegment(2)
+	s2.section("data", volume)
+	s2.sectors(chunks[2:], 2)
+	digest := append(append(append([]byte(nil), md5sum...), sha1sum...), make([]byte, 44)...)
+	s2.section("digest", digest)
+	s2.section("done", nil)
+
+	path := filepath.Join(dir, "image.E01")
+	FailTest(t, ioutil.WriteFile(path, s1.Bytes(), 0600), "could not write segment %s")
+	FailTest(t, ioutil.WriteFile(filepath.Join(dir, "image.E02"), s2.Bytes(), 0600), "could not write segment %s")
+	return path
+}
+
+// checkMetadata: the metadata the fixtures record.
+func checkMetadata(t *testing.T, img *Image, format string, size int) {
+	m := img.Metadata
+	got := fmt.Sprintf("%s %s %s %s %s %s %s %d", m.Format, m.CaseNumber, m.EvidenceNumber, m.Description, m.Examiner, m.Tool,
+		m.Acquired.Format(time.RFC3339), m.Size)
+	want := fmt.Sprintf("%s C-12 3 USB stick Jane Doe 6.19 2021-03-04T10:19:59Z %d", format, size)
+	if got != want {
+		t.Fatalf("metadata %q, expected %q", got, want)
+	}
+}
+
+func TestE01(t *testing.T) {
+	dir := t.TempDir()
+	data := media(11 * 512)
+	m, s := md5.Sum(data), sha1.Sum(data)
+	img, err := Open(writeE01(t, dir, data, m[:], s[:]))
+	FailTest(t, err, "could not open image %s")
+	defer img.Close()
+	checkMetadata(t, img, FormatE01, len(data))
+	if img.Notes != "seized at the scene" {
+		t.Fatalf("notes %q", img.Notes)
+	}
+	v, err := img.Verify()
+	FailTest(t, err, "could not verify image %s")
+	if !v.OK() || len(v.Checks) != 2 {
+		t.Fatalf("embedded hashes do not verify: %+v", v.Checks)
+	}
+	part := make([]byte, 1000)
+	_, err = img.ReadAt(part, 1500)
+	FailTest(t, err, "could not read across chunks %s")
+	if !bytes.Equal(part, data[1500:2500]) {
+		t.Fatal("read the wrong media across a chunk boundary")
+	}
+
+	// an embedded hash that does not match the media fails verification
+	m[0]++
+	img, err = Open(writeE01(t, dir, data, m[:], s[:]))
+	FailTest(t, err, "could not open image %s")
+	defer img.Close()
+	if v, err = img.Verify(); err != nil || v.OK() {
+		t.Fatalf("a wrong embedded MD5 verified: %v", err)
+	}
+
+	// a stored chunk that changed no longer matches its checksum
+	seg, err := ioutil.ReadFile(filepath.Join(dir, "image.E01"))
+	FailTest(t, err, "%s")
+	i := bytes.Index(seg, data[2048:2100])
+	seg[i]++
+	FailTest(t, ioutil.WriteFile(filepath.Join(dir, "image.E01"), seg, 0600), "%s")
+	img, err = Open(filepath.Join(dir, "image.E01"))
+	FailTest(t, err, "could not open image %s")
+	defer img.Close()
+	if _, err = img.Verify(); err == nil {
+		t.Fatal("a corrupt chunk was read")
+	}
+
+	os.Remove(filepath.Join(dir, "image.E02"))
+	if _, err = Open(filepath.Join(dir, "image.E01")); err == nil {
+		t.Fatal("opened an image with a missing segment")
+	}
+}
+
+// TestEWFMalformed: corrupt sizes and offsets are refused instead of allocated or read.
+func TestEWFMalformed(t *testing.T) {
+	dir := t.TempDir()
+	data := media(11 * 512)
+	m, s := md5.Sum(data), sha1.Sum(data)
+	path := writeE01(t, dir, data, m[:], s[:])
+	good, err := ioutil.ReadFile(path)
+	FailTest(t, err, "%s")
+	open := func(seg []byte) error {
+		FailTest(t, ioutil.WriteFile(path, seg, 0600), "%s")
+		img, err := Open(path)
+		if err == nil {
+			_, err = img.Verify()
+			img.Close()
+		}
+		return err
+	}
+	// descriptor sets the size of the section whose descriptor is at offset and fixes its checksum
+	descriptor := func(offset int, size uint64) []byte {
+		seg := append([]byte(nil), good...)
+		binary.LittleEndian.PutUint64(seg[offset+24:], size)
+		binary.LittleEndian.PutUint32(seg[offset+72:], adler32.Checksum(seg[offset:offset+72]))
+		return seg
+	}
+	for _, size := range []uint64{1 << 40, 1 << 63, 75, uint64(len(good))} {
+		if open(descriptor(13, size)) == nil {
+			t.Fatalf("opened an E01 section of %d bytes", size)
+		}
+	}
+
+	// a table entry that points past the end of the segment
+	seg := append([]byte(nil), good...)
+	table := bytes.Index(seg, []byte("table\x00")) + 76
+	entries := seg[table+24 : table+32]
+	binary.LittleEndian.PutUint32(entries, 0x80000000|0x7ffffff0)
+	binary.LittleEndian.PutUint32(seg[table+32:], adler32.Checksum(entries))
+	if open(seg) == nil {
+		t.Fatal("opened an E01 chunk beyond the end of its segment")
+	}
+	FailTest(t, open(good), "could not open the image again %s")
+
+	fill := []byte("PATTERN!")
+	path = writeEx01(t, dir, append(media(4096), bytes.Repeat(fill, 1536/8)...), fill)
+	good, err = ioutil.ReadFile(path)
+	FailTest(t, err, "%s")
+	for _, size := range []uint64{1 << 63, 1 << 40} {
+		seg := append([]byte(nil), good...)
+		desc := seg[len(seg)-64:]
+		binary.LittleEndian.PutUint64(desc[16:], size)
+		binary.LittleEndian.PutUint32(desc[60:], adler32.Checksum(desc[:60]))
+		if open(seg) == nil {
+			t.Fatalf("opened an Ex01 section of %d bytes", size)
+		}
+	}
+}
+
+// ewf2Writer: writes the sections of an Ex01 segment, each followed by its descriptor.
+type ewf2Writer struct {
+	bytes.Buffer
+	previous int64
+}
+
+func (w *ewf2Writer) section(kind uint32, data []byte) {
+	w.Write(data)
+	offset := int64(w.Len())
+	desc := make([]byte, 64)
+	binary.LittleEndian.PutUint32(desc, kind)
+	binary.LittleEndian.PutUint32(desc[4:], 1)
+	binary.LittleEndian.PutUint64(desc[8:], uint64(w.previous))
+	binary.LittleEndian.PutUint64(desc[16:], uint64(len(data)))
+	binary.LittleEndian.PutUint32(desc[24:], 64)
+	sum := md5.Sum(data)
+	copy(desc[32:], sum[:])
+	binary.LittleEndian.PutUint32(desc[60:], adler32.Checksum(desc[:60]))
+	w.Write(desc)
+	w.previous = offset
+}
+
+// writeEx01: a single segment image of data at dir/image.Ex01, in chunks of 2048 bytes.
+// The last chunk is not stored, fill is the pattern it repeats.
+func writeEx01(t *testing.T, dir string, data []byte, fill []byte) string {
+	w := &ewf2Writer{}
+	w.Write(ewf2Signature)
+	w.Write([]byte{2, 1, 1, 0, 1, 0})
+	w.Write(make([]byte, 18))
+	w.section(ewf2DeviceInformation, deflate(utf16le(fmt.Sprintf("1\nmain\nsn\tmd\tbp\tts\nSN123\tSanDisk\t512\t%d\n\n", len(data)/512))))
+	w.section(ewf2CaseData, deflate(utf16le(fmt.Sprintf("1\nmain\nnm\tcn\ten\tex\tnt\tav\tos\tat\tsb\n"+
+		"USB stick\tC-12\t3\tJane Doe\tseized\t6.19\tWindows 10\t%d\t4\n\n", acquired.Unix()))))
+
+	start := int64(w.Len())
+	c0, c1 := deflate(data[:2048]), append(append([]byte(nil), data[2048:4096]...), le32(adler32.Checksum(data[2048:4096]))...)
+	w.section(0x03, append(append([]byte(nil), c0...), c1...))
+	table := make([]byte, 32)
+	copy(table, le64(0))
+	copy(table[8:], le32(3))
+	copy(table[16:], le32(adler32.Checksum(table[:16])))
+	var entries []byte
+	entries = append(append(append(entries, le64(uint64(start))...), le32(uint32(len(c0)))...), le32(1)...)
+	entries = append(append(append(entries, le64(uint64(start+int64(len(c0))))...), le32(uint32(len(c1)))...), le32(2)...)
+	entries = append(append(append(entries, fill...), le32(8)...), le32(4)...)
+	table = append(append(table, entries...), le32(adler32.Checksum(entries))...)
+	w.section(ewf2SectorTable, append(table, make([]byte, 12)...))
+	m, s := md5.Sum(data), sha1.Sum(data)
+	w.section(ewf2MD5, append(m[:], make([]byte, 16)...))
+	w.section(ewf2SHA1, append(s[:], make([]byte, 12)...))
+	w.section(ewf2Done, nil)
+
+	path := filepath.Join(dir, "image.Ex01")
+	FailTest(t, ioutil.WriteFile(path, w.Bytes(), 0600), "could not write image %s")
+	return path
+}
+
+func TestEx01(t *testing.T) {
+	fill := []byte("PATTERN!")
+	data := append(media(4096), bytes.Repeat(fill, 1536/8)...)
+	img, err := Open(writeEx01(t, t.TempDir(), data, fill))
+	FailTest(t, err, "could not open image %s")
+	defer img.Close()
+	checkMetadata(t, img, FormatEx01, len(data))
+	v, err := img.Verify()
+	FailTest(t, err, "could not verify image %s")
+	if !v.OK() || len(v.Checks) != 2 {
+		t.Fatalf("embedded hashes do not verify: %+v", v.Checks)
+	}
+}
+
+// snappyLiterals: data as a Snappy block of literals, enough for a fixture.
+func snappyLiterals(data []byte) []byte {
+	var b []byte
+	b = append(b, make([]byte, binary.MaxVarintLen64)...)
+	b = b[:binary.PutUvarint(b, uint64(len(data)))]
+	for len(data) > 0 {
+		n := len(data)
+		if n > 256 {
+			n = 256
+		}
+		b = append(b, 60<<2, byte(n-1))
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
+
+// writeAFF4: a volume holding a disk image of size bytes, mapped from an image stream of data
+// followed by 500 bytes of aff4:Zero and an unmapped region.
+func writeAFF4(t *testing.T, dir string, data []byte, size int, hashes string) string {
+	const chunkSize = 1024
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	zw.SetComment("aff4://volume-1")
+	add := func(name string, contents []byte) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		FailTest(t, err, "could not add member %s")
+		w.Write(contents)
+	}
+	add("container.description", []byte("aff4://volume-1"))
+	add("information.turtle", []byte(fmt.Sprintf(`@prefix aff4: <http://aff4.org/Schema#> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+# the disk image
+<aff4://image-1> a aff4:Image, aff4:DiskImage ;
+    aff4:dataStream <aff4://map-1> ;
+    aff4:size "%d"^^xsd:long .
+
+<aff4://map-1> a aff4:Map ;
+    aff4:size "%d"^^xsd:long ;
+    %s .
+
+<aff4://stream-1> a aff4:ImageStream ;
+    aff4:chunkSize 1024 ; aff4:chunksInSegment 2 ;
+    aff4:size %d ;
+    aff4:compressionMethod <http://code.google.com/p/snappy/> .
+
+_:case a aff4:CaseDetails ;
+    aff4:caseNumber "C-12" ; aff4:evidenceNumber "3" ;
+    aff4:caseDescription "USB stick" ;
+    aff4:examiner "Jane Doe" ; aff4:tool '''6.19''' ;
+    aff4:target <aff4://image-1> .
+
+_:ts a aff4:TimeStamps ;
+    aff4:startTime "2021-03-04T10:19:59Z"^^xsd:dateTime ;
+    aff4:target <aff4://image-1> .
+`, size, size, hashes, len(data))))
+
+	// the second chunk is stored as it is, the others are compressed
+	for bevy := 0; bevy*2*chunkSize < len(data); bevy++ {
+		var stored, index []byte
+		for c := bevy * 2; c < bevy*2+2 && c*chunkSize < len(data); c++ {
+			end := (c + 1) * chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			chunk := data[c*chunkSize : end]
+			if c != 1 {
+				chunk = snappyLiterals(chunk)
+			}
+			index = append(append(index, le64(uint64(len(stored)))...), le32(uint32(len(chunk)))...)
+			stored = append(stored, chunk...)
+		}
+		add(fmt.Sprintf("aff4%%3A%%2F%%2Fstream-1/%08d", bevy), stored)
+		add(fmt.Sprintf("aff4%%3A%%2F%%2Fstream-1/%08d.index", bevy), index)
+	}
+	var regions []byte
+	for _, r := range [][4]uint64{{0, uint64(len(data)), 0, 0}, {uint64(len(data)), 500, 0, 1}} {
+		regions = append(append(append(append(regions, le64(r[0])...), le64(r[1])...), le64(r[2])...), le32(uint32(r[3]))...)
+	}
+	add("aff4%3A%2F%2Fmap-1/map", regions)
+	add("aff4%3A%2F%2Fmap-1/idx", []byte("aff4://stream-1\nhttp://aff4.org/Schema#Zero\n"))
+	FailTest(t, zw.Close(), "could not write volume %s")
+
+	path := filepath.Join(dir, "image.aff4")
+	FailTest(t, ioutil.WriteFile(path, b.Bytes(), 0600), "could not write volume %s")
+	return path
+}
+
+func TestAFF4(t *testing.T) {
+	dir := t.TempDir()
+	data := media(3000)
+	disk := append(append([]byte(nil), data...), make([]byte, 1096)...)
+	m, s := md5.Sum(disk), sha1.Sum(disk)
+	hashes := fmt.Sprintf(`aff4:hash "%x"^^aff4:MD5, "%x"^^aff4:SHA1`, m, s)
+	img, err := Open(writeAFF4(t, dir, data, len(disk), hashes))
+	FailTest(t, err, "could not open volume %s")
+	defer img.Close()
+	checkMetadata(t, img, FormatAFF4, len(disk))
+	v, err := img.Verify()
+	FailTest(t, err, "could not verify volume %s")
+	if !v.OK() || len(v.Checks) != 2 {
+		t.Fatalf("embedded hashes do not verify: %+v", v.Checks)
+	}
+
+	hashes = strings.Replace(hashes, fmt.Sprintf("%x", m), fmt.Sprintf("%x", md5.Sum(data)), 1)
+	img, err = Open(writeAFF4(t, dir, data, len(disk), hashes))
+	FailTest(t, err, "could not open volume %s")
+	defer img.Close()
+	if v, err = img.Verify(); err != nil || v.OK() {
+		t.Fatalf("a wrong embedded MD5 verified: %v", err)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	// "abc" then a copy of 11 bytes from 3 back
+	got, err := unsnappy([]byte{14, 2 << 2, 'a', 'b', 'c', (11-4)<<2 | 1, 3})
+	if err != nil || string(got) != "abcabcabcabcab" {
+		t.Fatalf("snappy decoded %q: %v", got, err)
+	}
+	got, err = unlz4([]byte{3<<4 | (12 - 4), 'a', 'b', 'c', 3, 0, 1 << 4, 'd'}, 64)
+	if err != nil || string(got) != "abcabcabcabcabcd" {
+		t.Fatalf("lz4 decoded %q: %v", got, err)
+	}
+	if _, err = unlz4([]byte{3<<4 | (12 - 4), 'a', 'b', 'c', 9, 0}, 64); err == nil {
+		t.Fatal("lz4 decoded a reference before the start")
+	}
+}
@@ -0,0 +1,432 @@
+package container
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// The Expert Witness formats are described in the libewf documentation,
+// "Expert Witness Compression Format (EWF)" for E01 and "EWF version 2" for Ex01.
+// Both store the media in compressed chunks listed in table sections,
+// and the acquisition metadata as tab separated text in header sections.
+
+var ewfSignature = []byte("EVF\x09\x0d\x0a\xff\x00")
+
+// maxChunkSize: the largest chunk read, far above the 32 KiB imaging tools write,
+// so that a corrupt size cannot make a reader allocate without bound.
+const maxChunkSize = 64 << 20
+
+// ewfChunk: where a chunk of the media is stored.
+type ewfChunk struct {
+	r          io.ReaderAt
+	offset     int64
+	size       int64
+	compressed bool
+	checksum   bool   // the data is followed by its adler32
+	fill       []byte // the chunk is this pattern repeated, it is not stored
+}
+
+// ewfMedia: the media of an E01 or Ex01 image, read chunk by chunk.
+type ewfMedia struct {
+	chunkSize int64
+	size      int64
+	bzip2     bool
+	chunks    []ewfChunk
+}
+
+// checkChunk: the stored data of chunk c, number index, lies within its segment file of size bytes
+// and is no larger than a chunk with its checksum can be.
+func checkChunk(c ewfChunk, index int, size int64) error {
+	if c.fill != nil {
+		return nil
+	}
+	if c.size <= 0 || c.size > maxChunkSize+4 {
+		return fmt.Errorf("chunk %d at %d has %d bytes", index, c.offset, c.size)
+	}
+	if c.offset < 0 || c.offset > size-c.size {
+		return fmt.Errorf("chunk %d at %d of %d bytes is beyond the end of the segment", index, c.offset, c.size)
+	}
+	return nil
+}
+
+// segmentSize: the size of the segment file f.
+func segmentSize(f *os.File) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// chunk: the data of chunk i.
+func (m *ewfMedia) chunk(i int) ([]byte, error) {
+	if i >= len(m.chunks) {
+		return nil, fmt.Errorf("chunk %d is not in the tables of the image", i)
+	}
+	length := m.chunkSize
+	if rest := m.size - int64(i)*m.chunkSize; rest < length {
+		length = rest
+	}
+	c := m.chunks[i]
+	if c.fill != nil {
+		data := make([]byte, length)
+		pattern(c.fill).ReadAt(data, 0)
+		return data, nil
+	}
+	raw := make([]byte, c.size)
+	if _, err := c.r.ReadAt(raw, c.offset); err != nil {
+		return nil, fmt.Errorf("could not read chunk %d: %s", i, err)
+	}
+	if c.compressed {
+		var r io.Reader
+		if m.bzip2 {
+			r = bzip2.NewReader(bytes.NewReader(raw))
+		} else {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("chunk %d is corrupt: %s", i, err)
+			}
+			r = zr
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("chunk %d is corrupt: %s", i, err)
+		}
+		return data, nil
+	}
+	if int64(len(raw)) < length {
+		return nil, fmt.Errorf("chunk %d has %d bytes, not %d", i, len(raw), length)
+	}
+	data := raw[:length]
+	if c.checksum {
+		if int64(len(raw)) < length+4 || adler32.Checksum(data) != binary.LittleEndian.Uint32(raw[length:]) {
+			return nil, fmt.Errorf("chunk %d does not match its checksum", i)
+		}
+	}
+	return data, nil
+}
+
+func (m *ewfMedia) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= m.size {
+			return n, io.EOF
+		}
+		data, err := m.chunk(int(pos / m.chunkSize))
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos%m.chunkSize:])
+	}
+	return n, nil
+}
+
+// segmentPath: the path of segment n of the image whose first segment is at path,
+// image.E01, image.E02 and so on.
+func segmentPath(path string, n int) (string, error) {
+	ext := filepath.Ext(path)
+	if len(ext) < 3 || n > 99 {
+		return "", fmt.Errorf("cannot name segment %d of %s", n, path)
+	}
+	if _, err := strconv.Atoi(ext[len(ext)-2:]); err != nil {
+		return "", fmt.Errorf("cannot name segment %d of %s", n, path)
+	}
+	return fmt.Sprintf("%s%02d", path[:len(path)-2], n), nil
+}
+
+// openSegments: open the segments of the image at path one after another, until read says it has read the last.
+func openSegments(img *Image, path string, read func(f *os.File, segment int) (last bool, err error)) error {
+	for n := 1; ; n++ {
+		p := path
+		if n > 1 {
+			var err error
+			if p, err = segmentPath(path, n); err != nil {
+				return err
+			}
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return fmt.Errorf("could not open segment %d: %s", n, err)
+		}
+		img.closers = append(img.closers, f)
+		last, err := read(f, n)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p, err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// headerValues: the keys and values of the main category of a header section.
+// The text has a line with the number of categories, the category name, a line of tab separated keys
+// and a line of tab separated values.
+func headerValues(text string) map[string]string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	values := map[string]string{}
+	for i := 0; i+2 < len(lines); i++ {
+		if lines[i] != "main" {
+			continue
+		}
+		keys, vals := strings.Split(lines[i+1], "\t"), strings.Split(lines[i+2], "\t")
+		for j, k := range keys {
+			if j < len(vals) {
+				values[k] = vals[j]
+			}
+		}
+		break
+	}
+	return values
+}
+
+// inflate: the zlib compressed data of a section.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// decodeUTF16: little endian UTF-16 text, with or without a byte order mark.
+func decodeUTF16(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte{0xff, 0xfe})
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// ewfDate: an acquisition date, either seconds since the epoch or "year month day hour minute second".
+// E01 headers do not record a time zone, dates are read as UTC.
+func ewfDate(v string) time.Time {
+	fields := strings.Fields(v)
+	if len(fields) == 1 {
+		if secs, err := strconv.ParseInt(fields[0], 10, 64); err == nil && secs > 0 {
+			return time.Unix(secs, 0).UTC()
+		}
+	}
+	if len(fields) == 6 {
+		var n [6]int
+		for i, f := range fields {
+			n[i], _ = strconv.Atoi(f)
+		}
+		return time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// ewfReader: the state of reading the segments of an E01 image.
+type ewfReader struct {
+	header, header2 map[string]string
+	media           ewfMedia
+	chunks          int
+	sectorsEnd      int64
+	md5, sha1       []byte
+}
+
+// openEWF: open an E01 image, described in the libewf documentation of the EWF-E01 format.
+func openEWF(path string) (*Image, error) {
+	img := &Image{Metadata: Metadata{Format: FormatE01}}
+	r := &ewfReader{}
+	if err := openSegments(img, path, r.segment); err != nil {
+		img.Close()
+		return nil, err
+	}
+	if r.media.chunkSize == 0 {
+		img.Close()
+		return nil, fmt.Errorf("%s has no volume section", path)
+	}
+	if len(r.media.chunks) < r.chunks {
+		img.Close()
+		return nil, fmt.Errorf("%s has %d of %d chunks", path, len(r.media.chunks), r.chunks)
+	}
+	h := r.header2
+	if h == nil {
+		h = r.header
+	}
+	img.CaseNumber, img.EvidenceNumber, img.Description = h["c"], h["n"], h["a"]
+	img.Examiner, img.Notes, img.Tool = h["e"], h["t"], h["av"]
+	img.Acquired = ewfDate(h["m"])
+	img.Size = r.media.size
+	img.MD5, img.SHA1 = r.md5, r.sha1
+	img.media = &r.media
+	return img, nil
+}
+
+// segment: read the sections of one segment file.
+func (r *ewfReader) segment(f *os.File, n int) (bool, error) {
+	head := make([]byte, 13)
+	if _, err := f.ReadAt(head, 0); err != nil {
+		return false, err
+	}
+	if !bytes.Equal(head[:8], ewfSignature) {
+		return false, fmt.Errorf("not an E01 segment")
+	}
+	if s := binary.LittleEndian.Uint16(head[9:]); int(s) != n {
+		return false, fmt.Errorf("is segment %d, not %d", s, n)
+	}
+	end, err := segmentSize(f)
+	if err != nil {
+		return false, err
+	}
+	desc := make([]byte, 76)
+	for offset := int64(13); ; {
+		if _, err := f.ReadAt(desc, offset); err != nil {
+			return false, fmt.Errorf("could not read section at %d: %s", offset, err)
+		}
+		if adler32.Checksum(desc[:72]) != binary.LittleEndian.Uint32(desc[72:]) {
+			return false, fmt.Errorf("section descriptor at %d does not match its checksum", offset)
+		}
+		kind := string(bytes.TrimRight(desc[:16], "\x00"))
+		next := int64(binary.LittleEndian.Uint64(desc[16:]))
+		size := int64(binary.LittleEndian.Uint64(desc[24:]))
+		switch kind {
+		case "next":
+			return false, nil
+		case "done":
+			return true, nil
+		}
+		if size < 76 || size > end-offset || next <= offset {
+			return false, fmt.Errorf("section %s at %d is corrupt", kind, offset)
+		}
+		data := make([]byte, size-76)
+		if _, err := f.ReadAt(data, offset+76); err != nil {
+			return false, fmt.Errorf("could not read section %s: %s", kind, err)
+		}
+		if err := r.section(f, kind, offset, size, data); err != nil {
+			return false, fmt.Errorf("section %s: %s", kind, err)
+		}
+		offset = next
+	}
+}
+
+// section: take what is needed from a section.
+func (r *ewfReader) section(f *os.File, kind string, offset, size int64, data []byte) error {
+	switch kind {
+	case "header":
+		text, err := inflate(data)
+		if err != nil {
+			return err
+		}
+		r.header = headerValues(string(text))
+	case "header2":
+		text, err := inflate(data)
+		if err != nil {
+			return err
+		}
+		r.header2 = headerValues(decodeUTF16(text))
+	case "volume", "disk", "data":
+		if r.media.chunkSize != 0 {
+			return nil
+		}
+		if len(data) < 24 {
+			return fmt.Errorf("is %d bytes", len(data))
+		}
+		r.chunks = int(binary.LittleEndian.Uint32(data[4:]))
+		sectorsPerChunk := int64(binary.LittleEndian.Uint32(data[8:]))
+		bytesPerSector := int64(binary.LittleEndian.Uint32(data[12:]))
+		r.media.chunkSize = sectorsPerChunk * bytesPerSector
+		r.media.size = int64(binary.LittleEndian.Uint64(data[16:])) * bytesPerSector
+		if r.media.chunkSize <= 0 || r.media.chunkSize > maxChunkSize || r.media.size < 0 {
+			return fmt.Errorf("chunks of %d sectors of %d bytes", sectorsPerChunk, bytesPerSector)
+		}
+	case "sectors":
+		r.sectorsEnd = offset + size
+	case "table":
+		return r.table(f, data)
+	case "hash":
+		if len(data) >= 16 {
+			r.digest(data[:16], nil)
+		}
+	case "digest":
+		if len(data) >= 36 {
+			r.digest(data[:16], data[16:36])
+		}
+	}
+	return nil
+}
+
+// digest: keep the embedded hashes, all zero means the tool did not compute one.
+func (r *ewfReader) digest(md5, sha1 []byte) {
+	if md5 != nil && !allZero(md5) {
+		r.md5 = append([]byte(nil), md5...)
+	}
+	if sha1 != nil && !allZero(sha1) {
+		r.sha1 = append([]byte(nil), sha1...)
+	}
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// table: add the chunks listed in a table section. The offsets are relative to the base offset of the table,
+// the high bit of an offset marks a compressed chunk. A chunk ends where the next one starts,
+// the last one at the end of the sectors section.
+func (r *ewfReader) table(f *os.File, data []byte) error {
+	if len(data) < 24 {
+		return fmt.Errorf("is %d bytes", len(data))
+	}
+	if adler32.Checksum(data[:20]) != binary.LittleEndian.Uint32(data[20:]) {
+		return fmt.Errorf("table header does not match its checksum")
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	base := int64(binary.LittleEndian.Uint64(data[8:]))
+	if len(data) < 24+4*count {
+		return fmt.Errorf("has room for %d of %d entries", (len(data)-24)/4, count)
+	}
+	entries := data[24 : 24+4*count]
+	if len(data) >= 28+4*count && adler32.Checksum(entries) != binary.LittleEndian.Uint32(data[24+4*count:]) {
+		return fmt.Errorf("table entries do not match their checksum")
+	}
+	size, err := segmentSize(f)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		e := binary.LittleEndian.Uint32(entries[4*i:])
+		c := ewfChunk{r: f, offset: base + int64(e&0x7fffffff), compressed: e&0x80000000 != 0}
+		end := r.sectorsEnd
+		if i+1 < count {
+			end = base + int64(binary.LittleEndian.Uint32(entries[4*i+4:])&0x7fffffff)
+		}
+		if c.compressed {
+			c.size = end - c.offset
+		} else {
+			index := int64(len(r.media.chunks))
+			c.size = r.media.chunkSize
+			if rest := r.media.size - index*r.media.chunkSize; rest < c.size {
+				c.size = rest
+			}
+			c.size += 4
+			c.checksum = true
+		}
+		if err := checkChunk(c, len(r.media.chunks), size); err != nil {
+			return err
+		}
+		r.media.chunks = append(r.media.chunks, c)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package container
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"os"
+	"strconv"
+)
+
+var ewf2Signature = []byte("EVF2\x0d\x0a\x81\x00")
+
+// The section types of Ex01 images that are read.
+const (
+	ewf2DeviceInformation = 0x01
+	ewf2CaseData          = 0x02
+	ewf2SectorTable       = 0x04
+	ewf2MD5               = 0x08
+	ewf2SHA1              = 0x09
+	ewf2Next              = 0x0d
+	ewf2Done              = 0x0f
+)
+
+// ewf2Section: a section of an Ex01 segment. The descriptor follows the data,
+// and points back to the descriptor of the previous section.
+type ewf2Section struct {
+	kind uint32
+	data []byte
+}
+
+// ewf2Reader: the state of reading the segments of an Ex01 image.
+type ewf2Reader struct {
+	device, caseData map[string]string
+	media            ewfMedia
+	md5, sha1        []byte
+}
+
+// openEWF2: open an Ex01 image, described in the libewf documentation of EWF version 2.
+func openEWF2(path string) (*Image, error) {
+	img := &Image{Metadata: Metadata{Format: FormatEx01}}
+	r := &ewf2Reader{}
+	if err := openSegments(img, path, r.segment); err != nil {
+		img.Close()
+		return nil, err
+	}
+	sectorsPerChunk, _ := strconv.ParseInt(r.caseData["sb"], 10, 64)
+	bytesPerSector, _ := strconv.ParseInt(r.device["bp"], 10, 64)
+	sectors, _ := strconv.ParseInt(r.device["ts"], 10, 64)
+	r.media.chunkSize = sectorsPerChunk * bytesPerSector
+	r.media.size = sectors * bytesPerSector
+	if r.media.chunkSize <= 0 || r.media.chunkSize > maxChunkSize || r.media.size < 0 {
+		img.Close()
+		return nil, fmt.Errorf("%s records chunks of %d sectors of %d bytes", path, sectorsPerChunk, bytesPerSector)
+	}
+	if n := (r.media.size + r.media.chunkSize - 1) / r.media.chunkSize; int64(len(r.media.chunks)) < n {
+		img.Close()
+		return nil, fmt.Errorf("%s has %d of %d chunks", path, len(r.media.chunks), n)
+	}
+	h := r.caseData
+	img.CaseNumber, img.EvidenceNumber, img.Description = h["cn"], h["en"], h["nm"]
+	img.Examiner, img.Notes, img.Tool = h["ex"], h["nt"], h["av"]
+	img.Acquired = ewfDate(h["at"])
+	img.Size = r.media.size
+	img.MD5, img.SHA1 = r.md5, r.sha1
+	img.media = &r.media
+	return img, nil
+}
+
+// segment: read the sections of one segment file, starting from the last one.
+func (r *ewf2Reader) segment(f *os.File, n int) (bool, error) {
+	head := make([]byte, 32)
+	if _, err := f.ReadAt(head, 0); err != nil {
+		return false, err
+	}
+	if !bytes.Equal(head[:8], ewf2Signature) {
+		return false, fmt.Errorf("not an Ex01 segment")
+	}
+	if s := binary.LittleEndian.Uint16(head[12:]); int(s) != n {
+		return false, fmt.Errorf("is segment %d, not %d", s, n)
+	}
+	switch method := binary.LittleEndian.Uint16(head[10:]); method {
+	case 1:
+	case 2:
+		r.media.bzip2 = true
+	default:
+		return false, fmt.Errorf("unknown compression method %d", method)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	var sections []ewf2Section
+	desc := make([]byte, 64)
+	for offset := fi.Size() - 64; offset >= 32; {
+		if _, err := f.ReadAt(desc, offset); err != nil {
+			return false, fmt.Errorf("could not read section at %d: %s", offset, err)
+		}
+		if adler32.Checksum(desc[:60]) != binary.LittleEndian.Uint32(desc[60:]) {
+			return false, fmt.Errorf("section descriptor at %d does not match its checksum", offset)
+		}
+		s := ewf2Section{kind: binary.LittleEndian.Uint32(desc)}
+		flags := binary.LittleEndian.Uint32(desc[4:])
+		previous := int64(binary.LittleEndian.Uint64(desc[8:]))
+		size := int64(binary.LittleEndian.Uint64(desc[16:]))
+		padding := int64(binary.LittleEndian.Uint32(desc[28:]))
+		start := offset - padding - size
+		if size < 0 || start < 32 || (previous >= offset) {
+			return false, fmt.Errorf("section %d at %d is corrupt", s.kind, offset)
+		}
+		if flags&0x2 != 0 {
+			return false, fmt.Errorf("section %d is encrypted", s.kind)
+		}
+		s.data = make([]byte, size)
+		if _, err := f.ReadAt(s.data, start); err != nil {
+			return false, fmt.Errorf("could not read section %d: %s", s.kind, err)
+		}
+		if sum := md5.Sum(s.data); flags&0x1 != 0 && !bytes.Equal(sum[:], desc[32:48]) {
+			return false, fmt.Errorf("section %d does not match its MD5", s.kind)
+		}
+		sections = append([]ewf2Section{s}, sections...)
+		if previous == 0 {
+			break
+		}
+		offset = previous
+	}
+
+	last := false
+	for _, s := range sections {
+		if err := r.section(f, s); err != nil {
+			return false, fmt.Errorf("section %d: %s", s.kind, err)
+		}
+		last = s.kind == ewf2Done
+	}
+	if !last && (len(sections) == 0 || sections[len(sections)-1].kind != ewf2Next) {
+		return false, fmt.Errorf("does not end with a next or done section")
+	}
+	return last, nil
+}
+
+// section: take what is needed from a section.
+func (r *ewf2Reader) section(f *os.File, s ewf2Section) error {
+	switch s.kind {
+	case ewf2DeviceInformation, ewf2CaseData:
+		text, err := inflate(s.data)
+		if err != nil {
+			return err
+		}
+		values := headerValues(decodeUTF16(text))
+		if s.kind == ewf2DeviceInformation {
+			r.device = values
+		} else {
+			r.caseData = values
+		}
+	case ewf2SectorTable:
+		return r.table(f, s.data)
+	case ewf2MD5:
+		if len(s.data) >= 16 && !allZero(s.data[:16]) {
+			r.md5 = s.data[:16]
+		}
+	case ewf2SHA1:
+		if len(s.data) >= 20 && !allZero(s.data[:20]) {
+			r.sha1 = s.data[:20]
+		}
+	}
+	return nil
+}
+
+// table: add the chunks listed in a sector table. Each entry has the offset, size and flags of a chunk,
+// flag 0x1 marks compressed data, 0x2 data followed by its adler32 and 0x4 a chunk filled with the 8 byte pattern
+// stored in place of its offset.
+func (r *ewf2Reader) table(f *os.File, data []byte) error {
+	if len(data) < 32 {
+		return fmt.Errorf("is %d bytes", len(data))
+	}
+	if adler32.Checksum(data[:16]) != binary.LittleEndian.Uint32(data[16:]) {
+		return fmt.Errorf("table header does not match its checksum")
+	}
+	first := int64(binary.LittleEndian.Uint64(data))
+	count := int(binary.LittleEndian.Uint32(data[8:]))
+	if first != int64(len(r.media.chunks)) {
+		return fmt.Errorf("table starts at chunk %d, expected %d", first, len(r.media.chunks))
+	}
+	if len(data) < 32+16*count {
+		return fmt.Errorf("has room for %d of %d entries", (len(data)-32)/16, count)
+	}
+	entries := data[32 : 32+16*count]
+	if len(data) >= 36+16*count && adler32.Checksum(entries) != binary.LittleEndian.Uint32(data[32+16*count:]) {
+		return fmt.Errorf("table entries do not match their checksum")
+	}
+	size, err := segmentSize(f)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		e := entries[16*i:]
+		flags := binary.LittleEndian.Uint32(e[12:])
+		c := ewfChunk{r: f, offset: int64(binary.LittleEndian.Uint64(e)), size: int64(binary.LittleEndian.Uint32(e[8:])),
+			compressed: flags&0x1 != 0, checksum: flags&0x2 != 0}
+		if flags&0x4 != 0 {
+			c.fill = append([]byte(nil), e[:8]...)
+		}
+		if err := checkChunk(c, len(r.media.chunks), size); err != nil {
+			return err
+		}
+		r.media.chunks = append(r.media.chunks, c)
+	}
+	return nil
+}
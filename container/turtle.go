@@ -0,0 +1,290 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The RDF namespaces used by AFF4 metadata.
+const (
+	aff4NS = "http://aff4.org/Schema#"
+	rdfNS  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNS  = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// triple: an RDF statement. Object is an IRI unless Literal is set, Datatype is the IRI of a typed literal.
+type triple struct {
+	Subject, Predicate, Object string
+	Literal                    bool
+	Datatype                   string
+}
+
+// turtle: a parser for the subset of RDF Turtle that AFF4 tools write:
+// prefixes, IRIs, prefixed names, blank node labels, literals with a datatype or language,
+// bare numbers and booleans, and the ; and , abbreviations. Collections and [ ] blank nodes are not supported.
+type turtle struct {
+	src      []rune
+	pos      int
+	prefixes map[string]string
+	triples  []triple
+}
+
+// parseTurtle: the triples of a Turtle document.
+func parseTurtle(text string) ([]triple, error) {
+	t := &turtle{src: []rune(text), prefixes: map[string]string{}}
+	for {
+		t.skip()
+		if t.pos >= len(t.src) {
+			return t.triples, nil
+		}
+		if err := t.statement(); err != nil {
+			return nil, fmt.Errorf("turtle: %s at offset %d", err, t.pos)
+		}
+	}
+}
+
+// skip: white space and comments.
+func (t *turtle) skip() {
+	for t.pos < len(t.src) {
+		switch c := t.src[t.pos]; {
+		case unicode.IsSpace(c):
+			t.pos++
+		case c == '#':
+			for t.pos < len(t.src) && t.src[t.pos] != '\n' {
+				t.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (t *turtle) peek() rune {
+	t.skip()
+	if t.pos >= len(t.src) {
+		return 0
+	}
+	return t.src[t.pos]
+}
+
+func (t *turtle) expect(c rune) error {
+	if t.peek() != c {
+		return fmt.Errorf("expected %q", c)
+	}
+	t.pos++
+	return nil
+}
+
+// word: the characters up to the next delimiter.
+func (t *turtle) word() string {
+	t.skip()
+	start := t.pos
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		if unicode.IsSpace(c) || strings.ContainsRune("<>\"';,()[]{}", c) {
+			break
+		}
+		// a final dot ends the statement, it is not part of the name
+		if c == '.' && (t.pos+1 >= len(t.src) || unicode.IsSpace(t.src[t.pos+1]) || t.src[t.pos+1] == '#') {
+			break
+		}
+		t.pos++
+	}
+	return string(t.src[start:t.pos])
+}
+
+func (t *turtle) statement() error {
+	if t.peek() == '@' || t.peek() == 'P' || t.peek() == 'p' || t.peek() == 'B' || t.peek() == 'b' {
+		save := t.pos
+		switch w := strings.ToLower(strings.TrimPrefix(t.word(), "@")); w {
+		case "prefix":
+			name := strings.TrimSuffix(t.word(), ":")
+			iri, err := t.iri()
+			if err != nil {
+				return err
+			}
+			t.prefixes[name] = iri
+			if t.peek() == '.' {
+				t.pos++
+			}
+			return nil
+		case "base":
+			if _, err := t.iri(); err != nil {
+				return err
+			}
+			if t.peek() == '.' {
+				t.pos++
+			}
+			return nil
+		}
+		t.pos = save
+	}
+	subject, _, _, err := t.term()
+	if err != nil {
+		return err
+	}
+	for {
+		predicate, _, _, err := t.term()
+		if err != nil {
+			return err
+		}
+		for {
+			object, literal, datatype, err := t.term()
+			if err != nil {
+				return err
+			}
+			t.triples = append(t.triples, triple{subject, predicate, object, literal, datatype})
+			if t.peek() != ',' {
+				break
+			}
+			t.pos++
+		}
+		switch t.peek() {
+		case ';':
+			t.pos++
+			// a ; may end the predicate list
+			if t.peek() == '.' {
+				t.pos++
+				return nil
+			}
+		case '.':
+			t.pos++
+			return nil
+		default:
+			return fmt.Errorf("expected ; or .")
+		}
+	}
+}
+
+// iri: an IRI in angle brackets.
+func (t *turtle) iri() (string, error) {
+	if err := t.expect('<'); err != nil {
+		return "", err
+	}
+	start := t.pos
+	for t.pos < len(t.src) && t.src[t.pos] != '>' {
+		t.pos++
+	}
+	if t.pos >= len(t.src) {
+		return "", fmt.Errorf("unterminated IRI")
+	}
+	t.pos++
+	return string(t.src[start : t.pos-1]), nil
+}
+
+// term: an IRI, prefixed name, blank node or literal.
+func (t *turtle) term() (value string, literal bool, datatype string, err error) {
+	switch c := t.peek(); {
+	case c == '<':
+		value, err = t.iri()
+		return
+	case c == '"' || c == '\'':
+		if value, err = t.str(); err != nil {
+			return
+		}
+		literal = true
+		if t.pos+1 < len(t.src) && t.src[t.pos] == '^' && t.src[t.pos+1] == '^' {
+			t.pos += 2
+			if t.peek() == '<' {
+				datatype, err = t.iri()
+			} else {
+				datatype, err = t.expand(t.word())
+			}
+		} else if t.pos < len(t.src) && t.src[t.pos] == '@' {
+			t.word()
+		}
+		return
+	case c == 0:
+		err = fmt.Errorf("unexpected end")
+		return
+	}
+	w := t.word()
+	switch {
+	case w == "":
+		err = fmt.Errorf("unexpected %q", t.peek())
+	case w == "a":
+		value = rdfNS + "type"
+	case w == "true" || w == "false":
+		value, literal, datatype = w, true, xsdNS+"boolean"
+	case strings.HasPrefix(w, "_:"):
+		value = w
+	case strings.ContainsAny(w[:1], "+-0123456789"):
+		value, literal, datatype = w, true, xsdNS+"integer"
+		if strings.ContainsAny(w, ".eE") {
+			datatype = xsdNS + "decimal"
+		}
+	default:
+		value, err = t.expand(w)
+	}
+	return
+}
+
+// expand: the IRI of a prefixed name.
+func (t *turtle) expand(name string) (string, error) {
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return "", fmt.Errorf("%q is not a prefixed name", name)
+	}
+	ns, ok := t.prefixes[name[:i]]
+	if !ok {
+		return "", fmt.Errorf("undeclared prefix %q", name[:i])
+	}
+	return ns + name[i+1:], nil
+}
+
+// str: a quoted string, single or triple quoted, with escapes.
+func (t *turtle) str() (string, error) {
+	q := t.src[t.pos]
+	long := t.pos+2 < len(t.src) && t.src[t.pos+1] == q && t.src[t.pos+2] == q
+	if long {
+		t.pos += 3
+	} else {
+		t.pos++
+	}
+	var b strings.Builder
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		switch {
+		case c == '\\' && t.pos+1 < len(t.src):
+			t.pos++
+			switch e := t.src[t.pos]; e {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case 'r':
+				b.WriteRune('\r')
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if t.pos+n >= len(t.src) {
+					return "", fmt.Errorf("short escape")
+				}
+				var r rune
+				if _, err := fmt.Sscanf(string(t.src[t.pos+1:t.pos+1+n]), "%x", &r); err != nil {
+					return "", fmt.Errorf("bad escape")
+				}
+				b.WriteRune(r)
+				t.pos += n
+			default:
+				b.WriteRune(e)
+			}
+			t.pos++
+		case c == q && !long:
+			t.pos++
+			return b.String(), nil
+		case c == q && t.pos+2 < len(t.src) && t.src[t.pos+1] == q && t.src[t.pos+2] == q:
+			t.pos += 3
+			return b.String(), nil
+		case c == '\n' && !long:
+			return "", fmt.Errorf("newline in string")
+		default:
+			b.WriteRune(c)
+			t.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
@@ -2,9 +2,15 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math/big"
+
+	"github.com/gtank/cryptopasta"
 )
 
 // ParseECDSAPublicKey: calls x509.ParsePKIXPublicKey and ensures that the result is an ecdsa.PublicKey.
@@ -27,3 +33,39 @@ func ParseECDSAPublicKey(data []byte) (*ecdsa.PublicKey, error) {
 func EncodeBinary(b []byte) string {
 	return base64.StdEncoding.EncodeToString(b)
 }
+
+// Fingerprint: the hex encoded SHA-256 digest of an x509 public key.
+// Fingerprints are short enough to read aloud or print on a report when comparing keys.
+func Fingerprint(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignatureSize: the length of the signatures made by cryptopasta.Sign, r and s of 32 bytes each.
+const SignatureSize = 64
+
+// Verify: check that sig is the signature of data by key, as cryptopasta.Verify does.
+// cryptopasta.Verify panics on a signature shorter than 64 bytes, Verify returns false for any signature
+// that is not SignatureSize bytes, so that it is safe on signatures read from untrusted input.
+func Verify(data, sig []byte, key *ecdsa.PublicKey) bool {
+	if len(sig) != SignatureSize || key == nil {
+		return false
+	}
+	return cryptopasta.Verify(data, sig, key)
+}
+
+// Twin: the signature (r, n-s) of the signature (r, s) on P-256. ECDSA signatures are malleable, whatever sig
+// verifies its twin verifies too, so a check for a signature used before must look for both.
+// A signature that is not SignatureSize bytes is returned as it is.
+func Twin(sig []byte) []byte {
+	if len(sig) != SignatureSize {
+		return sig
+	}
+	n := elliptic.P256().Params().N
+	s := new(big.Int).SetBytes(sig[32:])
+	s.Sub(n, s)
+	twin := make([]byte, SignatureSize)
+	copy(twin, sig[:32])
+	s.FillBytes(twin[32:])
+	return twin
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/x509"
 	"testing"
@@ -47,3 +48,34 @@ func TestX509(t *testing.T) {
 		t.Fatalf("Could not validate message with key: %s", pub)
 	}
 }
+
+func TestVerifyLength(t *testing.T) {
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "Could not generate key: %v")
+	message := []byte("Can you validate me?")
+	sig, err := cryptopasta.Sign(message, key)
+	FailTest(t, err, "Could not sign Message: %s")
+	if !Verify(message, sig, &key.PublicKey) {
+		t.Fatal("Could not validate message with key")
+	}
+	for _, bad := range [][]byte{nil, sig[:32], append(sig, 0)} {
+		if Verify(message, bad, &key.PublicKey) {
+			t.Fatalf("a signature of %d bytes verified", len(bad))
+		}
+	}
+}
+
+func TestTwin(t *testing.T) {
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "Could not generate key: %v")
+	message := []byte("Can you validate me?")
+	sig, err := cryptopasta.Sign(message, key)
+	FailTest(t, err, "Could not sign Message: %s")
+	twin := Twin(sig)
+	if bytes.Equal(twin, sig) || !Verify(message, twin, &key.PublicKey) {
+		t.Fatal("the twin of a signature should be another valid signature")
+	}
+	if !bytes.Equal(Twin(twin), sig) {
+		t.Fatal("the twin of the twin should be the signature")
+	}
+}
@@ -0,0 +1,204 @@
+// Package merkle: an append-only Merkle tree over ledger entries.
+// The hashing scheme follows RFC 6962 (Certificate Transparency) so that
+// proofs can be checked with any compliant verifier.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// LeafHash: hash a leaf with the 0x00 domain separation prefix.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash: hash two children with the 0x01 domain separation prefix.
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split: the largest power of two strictly less than n.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// Root: compute the Merkle tree hash of a list of leaf hashes.
+// The root of the empty tree is the hash of the empty string.
+func Root(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return NodeHash(Root(leaves[:k]), Root(leaves[k:]))
+}
+
+// InclusionProof: the audit path for the leaf at index in a tree built from leaves.
+func InclusionProof(leaves [][]byte, index int) ([][]byte, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range for tree of size %d", index, len(leaves))
+	}
+	return path(leaves, index), nil
+}
+
+func path(leaves [][]byte, m int) [][]byte {
+	n := len(leaves)
+	if n == 1 {
+		return nil
+	}
+	k := split(n)
+	if m < k {
+		return append(path(leaves[:k], m), Root(leaves[k:]))
+	}
+	return append(path(leaves[k:], m-k), Root(leaves[:k]))
+}
+
+// VerifyInclusion: check that leaf is at index in the tree of the given size with root.
+func VerifyInclusion(leaf []byte, index, size int, proof [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// ConsistencyProof: the proof that the tree of the first size leaves is a prefix of the tree built from leaves.
+func ConsistencyProof(leaves [][]byte, size int) ([][]byte, error) {
+	if size < 0 || size > len(leaves) {
+		return nil, fmt.Errorf("tree size %d out of range for tree of size %d", size, len(leaves))
+	}
+	if size == 0 || size == len(leaves) {
+		return nil, nil
+	}
+	return subproof(size, leaves, true), nil
+}
+
+func subproof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{Root(leaves)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(subproof(m, leaves[:k], complete), Root(leaves[k:]))
+	}
+	return append(subproof(m-k, leaves[k:], false), Root(leaves[:k]))
+}
+
+// VerifyConsistency: check that the tree of size first with root firstRoot
+// is a prefix of the tree of size second with root secondRoot.
+func VerifyConsistency(first, second int, firstRoot, secondRoot []byte, proof [][]byte) bool {
+	switch {
+	case first < 0 || first > second:
+		return false
+	case first == second:
+		return len(proof) == 0 && bytes.Equal(firstRoot, secondRoot)
+	case first == 0:
+		return len(proof) == 0
+	}
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return false
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, firstRoot) && bytes.Equal(sr, secondRoot)
+}
+
+// Frontier: the roots of the perfect subtrees that make up a tree of Size leaves, largest first.
+// It is enough to compute the root of the tree and to extend it one leaf at a time, without the leaves.
+type Frontier struct {
+	Size  int
+	Nodes [][]byte
+}
+
+// Append: extend the tree by one leaf.
+func (f *Frontier) Append(leaf []byte) {
+	nodes := append(make([][]byte, 0, len(f.Nodes)+1), f.Nodes...)
+	nodes = append(nodes, leaf)
+	for n := f.Size; n&1 == 1; n >>= 1 {
+		k := len(nodes)
+		nodes = append(nodes[:k-2], NodeHash(nodes[k-2], nodes[k-1]))
+	}
+	f.Size, f.Nodes = f.Size+1, nodes
+}
+
+// Root: the Merkle tree hash of the tree.
+func (f *Frontier) Root() []byte {
+	if len(f.Nodes) == 0 {
+		return Root(nil)
+	}
+	r := f.Nodes[len(f.Nodes)-1]
+	for i := len(f.Nodes) - 2; i >= 0; i-- {
+		r = NodeHash(f.Nodes[i], r)
+	}
+	return r
+}
+
+// Path: the audit path of the next leaf appended to the tree, which is the frontier smallest first.
+func (f *Frontier) Path() [][]byte {
+	var p [][]byte
+	for i := len(f.Nodes) - 1; i >= 0; i-- {
+		p = append(p, f.Nodes[i])
+	}
+	return p
+}
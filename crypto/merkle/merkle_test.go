@@ -0,0 +1,83 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func leaves(n int) [][]byte {
+	ls := make([][]byte, n)
+	for i := range ls {
+		ls[i] = LeafHash([]byte(fmt.Sprintf("entry %d", i)))
+	}
+	return ls
+}
+
+func TestInclusion(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		ls := leaves(n)
+		root := Root(ls)
+		for i := 0; i < n; i++ {
+			proof, err := InclusionProof(ls, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyInclusion(ls[i], i, n, proof, root) {
+				t.Fatalf("proof for leaf %d of %d did not verify", i, n)
+			}
+			if n > 1 && VerifyInclusion(ls[(i+1)%n], i, n, proof, root) {
+				t.Fatalf("proof for leaf %d of %d verified the wrong leaf", i, n)
+			}
+		}
+	}
+}
+
+func TestInclusionOutOfRange(t *testing.T) {
+	ls := leaves(4)
+	if _, err := InclusionProof(ls, 4); err == nil {
+		t.Fatal("expected an error for an index past the end of the tree")
+	}
+	if VerifyInclusion(ls[0], 4, 4, nil, Root(ls)) {
+		t.Fatal("verified a leaf index past the end of the tree")
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		ls := leaves(n)
+		root := Root(ls)
+		for m := 1; m <= n; m++ {
+			proof, err := ConsistencyProof(ls, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyConsistency(m, n, Root(ls[:m]), root, proof) {
+				t.Fatalf("consistency proof from %d to %d did not verify", m, n)
+			}
+			if m < n && VerifyConsistency(m, n, Root(leaves(m+1)[1:]), root, proof) {
+				t.Fatalf("consistency proof from %d to %d verified the wrong root", m, n)
+			}
+		}
+	}
+	if _, err := ConsistencyProof(leaves(4), 5); err == nil {
+		t.Fatal("expected an error for a size past the end of the tree")
+	}
+}
+
+func TestFrontier(t *testing.T) {
+	ls := leaves(33)
+	var f Frontier
+	for n := 1; n <= len(ls); n++ {
+		path := f.Path()
+		f.Append(ls[n-1])
+		if f.Size != n || !bytes.Equal(f.Root(), Root(ls[:n])) {
+			t.Fatalf("the frontier of %d leaves has the wrong root", n)
+		}
+		proof, _ := InclusionProof(ls[:n], n-1)
+		if !reflect.DeepEqual(path, proof) || !VerifyInclusion(ls[n-1], n-1, n, path, f.Root()) {
+			t.Fatalf("the frontier path of leaf %d is not its inclusion proof", n-1)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package piecewise: hash lists of large files, one SHA-256 per fixed size block.
+// A whole file digest only says that something changed, comparing two hash lists says where.
+// The block hashes are the leaves of a Merkle tree, so a single root commits to the whole list.
+package piecewise
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+)
+
+// DefaultBlockSize: the block size used when none is given, 1 MiB.
+const DefaultBlockSize = 1 << 20
+
+// List: the SHA-256 of every block of a file of Size bytes.
+// The last block is short unless Size is a multiple of BlockSize.
+type List struct {
+	Size      int64
+	BlockSize int64
+	Blocks    [][]byte
+}
+
+// Blocks: how many blocks a file of size bytes has.
+func Blocks(size, blockSize int64) int {
+	return int((size + blockSize - 1) / blockSize)
+}
+
+// Hash: the hash list of the size bytes of r, in blocks of blockSize.
+// The blocks are hashed in parallel, one worker per CPU.
+func Hash(r io.ReaderAt, size, blockSize int64) (*List, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("block size %d is not positive", blockSize)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("size %d is negative", size)
+	}
+	l := &List{Size: size, BlockSize: blockSize, Blocks: make([][]byte, Blocks(size, blockSize))}
+	workers := runtime.NumCPU()
+	if workers > len(l.Blocks) {
+		workers = len(l.Blocks)
+	}
+	next := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, blockSize)
+			for i := range next {
+				start, end := l.Range(i)
+				n, err := r.ReadAt(buf[:end-start], start)
+				if int64(n) == end-start {
+					err = nil
+				}
+				if err != nil {
+					errs <- fmt.Errorf("could not read block %d: %s", i, err)
+					// drain the remaining blocks so the producer does not block
+					for range next {
+					}
+					return
+				}
+				sum := sha256.Sum256(buf[:n])
+				l.Blocks[i] = sum[:]
+			}
+		}()
+	}
+	for i := range l.Blocks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// HashReader: the hash list of the next size bytes of r, in blocks of blockSize, read once from start to end.
+// Unlike Hash it needs no random access, so r can be teed into a digest of the whole file.
+func HashReader(r io.Reader, size, blockSize int64) (*List, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("block size %d is not positive", blockSize)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("size %d is negative", size)
+	}
+	l := &List{Size: size, BlockSize: blockSize, Blocks: make([][]byte, Blocks(size, blockSize))}
+	buf := make([]byte, blockSize)
+	for i := range l.Blocks {
+		start, end := l.Range(i)
+		if _, err := io.ReadFull(r, buf[:end-start]); err != nil {
+			return nil, fmt.Errorf("could not read block %d: %s", i, err)
+		}
+		sum := sha256.Sum256(buf[:end-start])
+		l.Blocks[i] = sum[:]
+	}
+	return l, nil
+}
+
+// HashFile: the hash list of the file at path.
+func HashFile(path string, blockSize int64) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Hash(f, fi.Size(), blockSize)
+}
+
+// Range: the byte range [start, end) of block i.
+func (l *List) Range(i int) (start, end int64) {
+	start = int64(i) * l.BlockSize
+	end = start + l.BlockSize
+	if end > l.Size {
+		end = l.Size
+	}
+	return
+}
+
+// Check: the list has one SHA-256 for every block of the file.
+func (l *List) Check() error {
+	if l.BlockSize <= 0 || l.Size < 0 {
+		return fmt.Errorf("hash list of %d bytes in blocks of %d is not valid", l.Size, l.BlockSize)
+	}
+	if n := Blocks(l.Size, l.BlockSize); len(l.Blocks) != n {
+		return fmt.Errorf("hash list has %d blocks, a file of %d bytes has %d blocks of %d", len(l.Blocks), l.Size, n, l.BlockSize)
+	}
+	for i, b := range l.Blocks {
+		if len(b) != sha256.Size {
+			return fmt.Errorf("hash of block %d is %d bytes, not %d", i, len(b), sha256.Size)
+		}
+	}
+	return nil
+}
+
+// Root: the Merkle tree hash over the block hashes.
+func (l *List) Root() []byte {
+	leaves := make([][]byte, len(l.Blocks))
+	for i, b := range l.Blocks {
+		leaves[i] = merkle.LeafHash(b)
+	}
+	return merkle.Root(leaves)
+}
+
+// Marshal: the block hashes one after another, for storage.
+func (l *List) Marshal() []byte {
+	return bytes.Join(l.Blocks, nil)
+}
+
+// Unmarshal: the hash list of a file of size bytes from the block hashes written by Marshal.
+func Unmarshal(size, blockSize int64, data []byte) (*List, error) {
+	if len(data)%sha256.Size != 0 {
+		return nil, fmt.Errorf("hash list of %d bytes is not a list of SHA-256 hashes", len(data))
+	}
+	l := &List{Size: size, BlockSize: blockSize}
+	for i := 0; i < len(data); i += sha256.Size {
+		l.Blocks = append(l.Blocks, data[i:i+sha256.Size])
+	}
+	return l, l.Check()
+}
+
+// Range: a byte range [Start, End) of a file, and the blocks [First, Last] that cover it.
+type Range struct {
+	Start, End  int64
+	First, Last int
+}
+
+func (r Range) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("bytes %d-%d (block %d)", r.Start, r.End-1, r.First)
+	}
+	return fmt.Sprintf("bytes %d-%d (blocks %d-%d)", r.Start, r.End-1, r.First, r.Last)
+}
+
+// Diff: the byte ranges where got differs from want, adjacent blocks merged into one range.
+// Bytes that only one of the files has differ, so a truncated or extended file
+// shows up as a range at its end. Both lists must use the same block size.
+func Diff(want, got *List) ([]Range, error) {
+	if want.BlockSize != got.BlockSize {
+		return nil, fmt.Errorf("cannot compare blocks of %d bytes with blocks of %d bytes", want.BlockSize, got.BlockSize)
+	}
+	size := want.Size
+	if got.Size > size {
+		size = got.Size
+	}
+	var ranges []Range
+	for i := 0; i < Blocks(size, want.BlockSize); i++ {
+		if i < len(want.Blocks) && i < len(got.Blocks) && bytes.Equal(want.Blocks[i], got.Blocks[i]) {
+			continue
+		}
+		start := int64(i) * want.BlockSize
+		end := start + want.BlockSize
+		if end > size {
+			end = size
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].Last == i-1 {
+			ranges[n-1].End, ranges[n-1].Last = end, i
+			continue
+		}
+		ranges = append(ranges, Range{Start: start, End: end, First: i, Last: i})
+	}
+	return ranges, nil
+}
@@ -0,0 +1,68 @@
+package piecewise
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func image(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestDiff(t *testing.T) {
+	data := image(10000)
+	want, err := Hash(bytes.NewReader(data), int64(len(data)), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want.Blocks) != 20 {
+		t.Fatalf("%d blocks, expected 20", len(want.Blocks))
+	}
+	if err = want.Check(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Unmarshal(want.Size, want.BlockSize, want.Marshal())
+	if err != nil || !bytes.Equal(again.Root(), want.Root()) {
+		t.Fatalf("hash list did not survive a round trip: %v", err)
+	}
+
+	changed := append([]byte(nil), data...)
+	changed[100]++
+	changed[1024]++ // blocks 2 and 3 merge into one range
+	changed[1600]++
+	changed = changed[:9000]
+	got, err := Hash(bytes.NewReader(changed), int64(len(changed)), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got.Root(), want.Root()) {
+		t.Fatal("a changed file has the same root")
+	}
+	ranges, err := Diff(want, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[bytes 0-511 (block 0) bytes 1024-2047 (blocks 2-3) bytes 8704-9999 (blocks 17-19)]"
+	if s := fmt.Sprint(ranges); s != expected {
+		t.Fatalf("differences %s, expected %s", s, expected)
+	}
+	if ranges, _ = Diff(want, want); len(ranges) != 0 {
+		t.Fatalf("a file differs from itself at %v", ranges)
+	}
+
+	if _, err = Hash(bytes.NewReader(data), int64(len(data))+1, 512); err == nil {
+		t.Fatal("hashed past the end of the file")
+	}
+	streamed, err := HashReader(bytes.NewReader(data), int64(len(data)), 512)
+	if err != nil || !bytes.Equal(streamed.Root(), want.Root()) {
+		t.Fatalf("the streamed hash list differs: %v", err)
+	}
+	if _, err = HashReader(bytes.NewReader(data), int64(len(data))+1, 512); err == nil {
+		t.Fatal("streamed past the end of the file")
+	}
+}
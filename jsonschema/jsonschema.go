@@ -0,0 +1,341 @@
+// Package jsonschema: validation of JSON documents against the subset of JSON Schema that entry payloads need.
+// A schema may use the keywords type, properties, required, additionalProperties, items, enum, const,
+// pattern, minLength, maxLength, minimum, maximum, minItems and maxItems, and the annotations $schema, $id,
+// title, description, examples and default. Compile rejects any other keyword, so a schema never seems to
+// constrain a payload that it does not.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Types: the JSON types a schema may name.
+var Types = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// annotations: keywords that do not constrain the document.
+var annotations = map[string]bool{"$schema": true, "$id": true, "title": true, "description": true, "examples": true, "default": true}
+
+// Schema: a compiled schema.
+type Schema struct {
+	Types                []string
+	Properties           map[string]*Schema
+	Required             []string
+	AdditionalProperties *bool
+	Items                *Schema
+	Enum                 []interface{}
+	Const                *interface{}
+	Pattern              *regexp.Regexp
+	MinLength, MaxLength *int
+	Minimum, Maximum     *float64
+	MinItems, MaxItems   *int
+}
+
+// Compile: parse and check the schema in data.
+func Compile(data []byte) (*Schema, error) {
+	var v interface{}
+	if err := decode(data, &v); err != nil {
+		return nil, fmt.Errorf("the schema is not valid JSON: %s", err)
+	}
+	return compile("", v)
+}
+
+func compile(path string, v interface{}) (*Schema, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: a schema must be an object", where(path))
+	}
+	s := &Schema{}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := s.keyword(path, k, m[k]); err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", where(path), k, err)
+		}
+	}
+	return s, nil
+}
+
+// keyword: set the keyword k of the schema at path to v.
+func (s *Schema) keyword(path, k string, v interface{}) (err error) {
+	switch k {
+	case "type":
+		switch t := v.(type) {
+		case string:
+			s.Types = []string{t}
+		case []interface{}:
+			for _, e := range t {
+				name, ok := e.(string)
+				if !ok {
+					return fmt.Errorf("must be a type name or a list of them")
+				}
+				s.Types = append(s.Types, name)
+			}
+		default:
+			return fmt.Errorf("must be a type name or a list of them")
+		}
+		for _, t := range s.Types {
+			if !contains(Types, t) {
+				return fmt.Errorf("unknown type %s, the types are %s", t, strings.Join(Types, ", "))
+			}
+		}
+	case "properties":
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("must be an object")
+		}
+		s.Properties = map[string]*Schema{}
+		for name, p := range props {
+			if s.Properties[name], err = compile(path+"/"+name, p); err != nil {
+				return err
+			}
+		}
+	case "required":
+		list, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("must be a list of property names")
+		}
+		for _, e := range list {
+			name, ok := e.(string)
+			if !ok {
+				return fmt.Errorf("must be a list of property names")
+			}
+			s.Required = append(s.Required, name)
+		}
+	case "additionalProperties":
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("only true and false are supported")
+		}
+		s.AdditionalProperties = &b
+	case "items":
+		s.Items, err = compile(path+"/*", v)
+	case "enum":
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return fmt.Errorf("must be a list of values")
+		}
+		s.Enum = list
+	case "const":
+		s.Const = &v
+	case "pattern":
+		p, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("must be a regular expression")
+		}
+		s.Pattern, err = regexp.Compile(p)
+	case "minLength":
+		s.MinLength, err = count(v)
+	case "maxLength":
+		s.MaxLength, err = count(v)
+	case "minItems":
+		s.MinItems, err = count(v)
+	case "maxItems":
+		s.MaxItems, err = count(v)
+	case "minimum":
+		s.Minimum, err = number(v)
+	case "maximum":
+		s.Maximum, err = number(v)
+	default:
+		if !annotations[k] {
+			return fmt.Errorf("unsupported keyword")
+		}
+	}
+	return err
+}
+
+// Validate: check the JSON document in data against the schema.
+// The error lists every problem found, each with the path of the value it is about.
+func (s *Schema) Validate(data []byte) error {
+	var v interface{}
+	if err := decode(data, &v); err != nil {
+		return fmt.Errorf("not valid JSON: %s", err)
+	}
+	var problems []string
+	s.validate("", v, &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}, problems *[]string) {
+	problem := func(format string, args ...interface{}) {
+		*problems = append(*problems, where(path)+": "+fmt.Sprintf(format, args...))
+	}
+	if len(s.Types) > 0 && !s.hasType(v) {
+		problem("must be %s, not %s", strings.Join(s.Types, " or "), typeOf(v))
+		return
+	}
+	if s.Const != nil && !equal(v, *s.Const) {
+		problem("must be %s", encode(*s.Const))
+	}
+	if s.Enum != nil {
+		found := false
+		for _, e := range s.Enum {
+			found = found || equal(v, e)
+		}
+		if !found {
+			problem("must be one of %s", encode(s.Enum))
+		}
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, where(path+"/"+name)+": is required")
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p, ok := s.Properties[name]
+			switch {
+			case ok:
+				p.validate(path+"/"+name, v[name], problems)
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				*problems = append(*problems, where(path+"/"+name)+": is not a property of the schema")
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			problem("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			problem("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, e := range v {
+				s.Items.validate(fmt.Sprintf("%s/%d", path, i), e, problems)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			problem("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			problem("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(v) {
+			problem("must match %s", s.Pattern)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			problem("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			problem("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+// hasType: true if v has one of the types of the schema.
+func (s *Schema) hasType(v interface{}) bool {
+	t := typeOf(v)
+	for _, want := range s.Types {
+		if want == t || want == "number" && t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf: the JSON type of a decoded value, integer for numbers without a fraction.
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "null"
+}
+
+// equal: true if two decoded values are the same JSON value, numbers compare by value.
+func equal(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// decode: unmarshal data keeping numbers exact, and reject anything after the value.
+func decode(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.More() {
+		return fmt.Errorf("unexpected data after the value")
+	}
+	return nil
+}
+
+func encode(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func count(v interface{}) (*int, error) {
+	n, ok := v.(json.Number)
+	i, err := n.Int64()
+	if !ok || err != nil || i < 0 {
+		return nil, fmt.Errorf("must be a count")
+	}
+	c := int(i)
+	return &c, nil
+}
+
+func number(v interface{}) (*float64, error) {
+	n, ok := v.(json.Number)
+	f, err := n.Float64()
+	if !ok || err != nil {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &f, nil
+}
+
+// where: how the value at path is named in problems, the document itself is /.
+func where(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const acquisition = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "acquisition",
+  "type": "object",
+  "properties": {
+    "serial": {"type": "string", "minLength": 1},
+    "write_blocker": {"type": "string", "enum": ["Tableau T35u", "WiebeTech Forensic UltraDock"]},
+    "sectors": {"type": "integer", "minimum": 1},
+    "hashes": {"type": "array", "items": {"type": "string", "pattern": "^[0-9a-f]{64}$"}, "maxItems": 2}
+  },
+  "required": ["serial", "write_blocker"],
+  "additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(acquisition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []string{
+		`{"serial": "S1", "write_blocker": "Tableau T35u"}`,
+		`{"serial": "S1", "write_blocker": "Tableau T35u", "sectors": 1e3, "hashes": []}`,
+	} {
+		if err := s.Validate([]byte(doc)); err != nil {
+			t.Errorf("%s is valid: %s", doc, err)
+		}
+	}
+	for doc, want := range map[string]string{
+		`{"serial": "S1"}`: "/write_blocker: is required",
+		`{"serial": "", "write_blocker": "Tableau T35u"}`:                    "/serial: must be at least 1 characters long",
+		`{"serial": 7, "write_blocker": "Tableau T35u"}`:                     "/serial: must be string, not integer",
+		`{"serial": "S1", "write_blocker": "tape"}`:                          `/write_blocker: must be one of ["Tableau T35u","WiebeTech Forensic UltraDock"]`,
+		`{"serial": "S1", "write_blocker": "Tableau T35u", "sectors": 0.5}`:  "/sectors: must be integer, not number",
+		`{"serial": "S1", "write_blocker": "Tableau T35u", "hashes": ["x"]}`: "/hashes/0: must match",
+		`{"serial": "S1", "write_blocker": "Tableau T35u", "gps": "here"}`:   "/gps: is not a property of the schema",
+		`["S1"]`:                       "/: must be object, not array",
+		`{"serial": "S1"} {"more": 1}`: "not valid JSON",
+	} {
+		err := s.Validate([]byte(doc))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", doc, want, err)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	for schema, want := range map[string]string{
+		`{"type": "text"}`:                                  "unknown type text",
+		`{"properties": {"gps": {"format": "geo"}}}`:        "/gps: format: unsupported keyword",
+		`{"additionalProperties": {"type": "string"}}`:      "only true and false",
+		`{"properties": {"n": {"minLength": -1}}}`:          "must be a count",
+		`{"type": "object", "properties": {"a": "string"}}`: "/a: a schema must be an object",
+		`{"pattern": "("}`:                                  "pattern: error parsing regexp",
+	} {
+		_, err := Compile([]byte(schema))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", schema, want, err)
+		}
+	}
+}
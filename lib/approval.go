@@ -0,0 +1,414 @@
+package custody
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// Entries that need approval. Some entries, such as submitting evidence to court or destroying it, should not be
+// made by one person alone. The proposer signs the entry together with its Requirement, M approvals from named
+// users or holders of some roles before a deadline, and the entry stays pending outside the ledger.
+// Each approval is a ledger entry signed by the approver. Once the threshold is met the proposed entry is appended
+// with the proposer's signature, and if the deadline passes first it never is.
+
+// Requirement: who must approve a proposed entry, and by when.
+// An operation of the policy that needs approval names a Requirement without a deadline.
+type Requirement struct {
+	// Threshold is how many approvals the entry needs.
+	Threshold int `json:"threshold"`
+	// Approvers are the names of users who may approve.
+	Approvers []string `json:"approvers,omitempty"`
+	// Roles are the roles whose holders may approve.
+	Roles    []string  `json:"roles,omitempty"`
+	Deadline time.Time `json:"-"`
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s before %s", r.Needs(), r.Deadline.UTC().Format(time.RFC3339))
+}
+
+// Needs: how many approvals r needs and from whom.
+func (r Requirement) Needs() string {
+	var who []string
+	who = append(who, r.Approvers...)
+	for _, role := range r.Roles {
+		if strings.ContainsRune("aeiou", rune(role[0])) {
+			who = append(who, "an "+role)
+		} else {
+			who = append(who, "a "+role)
+		}
+	}
+	list := strings.Join(who, ", ")
+	if n := len(who); n > 1 {
+		list = strings.Join(who[:n-1], ", ") + " or " + who[n-1]
+	}
+	plural := "s"
+	if r.Threshold == 1 {
+		plural = ""
+	}
+	return fmt.Sprintf("%d approval%s from %s", r.Threshold, plural, list)
+}
+
+// Check: an error if the requirement cannot be met at now.
+func (r Requirement) Check(now time.Time) error {
+	if err := r.check(); err != nil {
+		return err
+	}
+	if !r.Deadline.After(now) {
+		return fmt.Errorf("the deadline %s has passed", r.Deadline.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// check: an error if the requirement cannot be met, whatever its deadline.
+func (r Requirement) check() error {
+	switch {
+	case r.Threshold < 1:
+		return fmt.Errorf("an entry that needs approval needs at least one")
+	case len(r.Approvers) == 0 && len(r.Roles) == 0:
+		return fmt.Errorf("name the users or roles who may approve the entry")
+	case len(r.Roles) == 0 && r.Threshold > len(r.Approvers):
+		return fmt.Errorf("%d approvals cannot come from %d approvers", r.Threshold, len(r.Approvers))
+	}
+	for _, role := range r.Roles {
+		if !ValidRole(role) {
+			return fmt.Errorf("unknown role %s, the roles are %s", role, strings.Join(Roles, ", "))
+		}
+	}
+	for _, name := range r.Approvers {
+		if name == "" || strings.Contains(name, ",") {
+			return fmt.Errorf("%q is not a user name", name)
+		}
+	}
+	return nil
+}
+
+// Covers: true if an entry approved as r requires is also approved as rule requires:
+// r needs at least as many approvals, and only from the users and roles rule names.
+func (r Requirement) Covers(rule Requirement) bool {
+	if r.Threshold < rule.Threshold {
+		return false
+	}
+	for _, a := range r.Approvers {
+		if !contains(rule.Approvers, a) {
+			return false
+		}
+	}
+	for _, role := range r.Roles {
+		if !contains(rule.Roles, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// ProposalMessage: the message a user signs to propose an entry that needs approval,
+// which is the message of the entry once it is appended.
+func ProposalMessage(message string, r Requirement) string {
+	return strings.TrimRight(message, "\n") + "\nrequires " + r.String()
+}
+
+var proposalSuffix = regexp.MustCompile(`\nrequires \d+ approvals? from .+ before \S+$`)
+
+// IsProposal: true if message states an approval requirement, such an entry can only be appended by approval.
+func IsProposal(message string) bool {
+	return proposalSuffix.MatchString(message)
+}
+
+// ProposedMessage: the message proposed by the ProposalMessage message, without its requirement.
+// It is message itself if message is not a proposal.
+func ProposedMessage(message string) string {
+	if loc := proposalSuffix.FindStringIndex(message); loc != nil {
+		return message[:loc[0]]
+	}
+	return message
+}
+
+// ApprovalMessage: the message a user signs to approve the proposed entry with id and message.
+func ApprovalMessage(id int, message string) string {
+	return fmt.Sprintf("approve proposed entry %d: sha256 %x", id, sha256.Sum256([]byte(message)))
+}
+
+// requirement: the requirement of a pending entry.
+func requirement(p *models.PendingEntry) Requirement {
+	r := Requirement{Threshold: p.Threshold, Deadline: p.Deadline.Time}
+	if p.Approvers != "" {
+		r.Approvers = strings.Split(p.Approvers, ",")
+	}
+	if p.Roles != "" {
+		r.Roles = strings.Split(p.Roles, ",")
+	}
+	return r
+}
+
+// Proposal: a proposed entry and the state of its approval.
+type Proposal struct {
+	Entry    *models.PendingEntry
+	Proposer string
+	// Approvals are the names of the users who approved, in order.
+	Approvals []string
+	// Status is pending, appended or expired.
+	Status string
+}
+
+// The states of a Proposal.
+const (
+	ProposalPending  = "pending"
+	ProposalAppended = "appended"
+	ProposalExpired  = "expired"
+)
+
+// Propose: hold entry, signed by identity, until it is approved as r requires.
+// entry must hold the signed ProposalMessage and may name a case and an item.
+// If the policy names the operation of the entry with the approvals it needs, r must cover them.
+// The payload of a typed entry, and the item of a disposition, are checked now rather than when it is approved.
+func (db *DB) Propose(identity *models.Identity, r Requirement, entry models.Ledger) (*Proposal, error) {
+	if err := r.Check(time.Now()); err != nil {
+		return nil, err
+	}
+	suffix := "\nrequires " + r.String()
+	if !strings.HasSuffix(entry.Message, suffix) || len(entry.Message) == len(suffix) {
+		return nil, fmt.Errorf("the proposal must sign the entry followed by %q", suffix)
+	}
+	if op := db.Policy.Operation(entry.Message); op != nil && op.Approvals != nil && !r.Covers(*op.Approvals) {
+		return nil, fmt.Errorf("the policy requires %s for %s", op.Approvals.Needs(), op.Name)
+	}
+	message := ProposedMessage(entry.Message)
+	if _, _, err := db.CheckPayload(message); err != nil {
+		return nil, err
+	}
+	if IsDisposeMessage(message) {
+		item, err := models.ItemByTag(db, entry.Item)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("a proposed disposition must name the item")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := disposalReason(message, item); !ok {
+			return nil, fmt.Errorf("the proposed disposition must sign %q", DisposeMessage(item.Tag, "reason", item.Digest))
+		}
+	}
+	entry.Identity = identity.ID
+	if err := VerifyEntry(&entry, identity); err != nil {
+		return nil, err
+	}
+	var n int
+	if err := db.QueryRow(`select count(*) from pending_entries where hash in (?, ?)`, entry.Hash, crypto.Twin(entry.Hash)).Scan(&n); err != nil {
+		return nil, err
+	}
+	used, err := db.signatureUsed(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 || used {
+		return nil, fmt.Errorf("the signature is already on another entry, sign the entry again")
+	}
+	p := &models.PendingEntry{Identity: identity.ID, Message: entry.Message, Hash: entry.Hash, CaseID: entry.CaseID, Item: entry.Item,
+		Threshold: r.Threshold, Approvers: strings.Join(r.Approvers, ","), Roles: strings.Join(r.Roles, ","),
+		Deadline: XONow(), CreatedAt: XONow()}
+	p.Deadline.Time = r.Deadline
+	if err := p.Insert(db); err != nil {
+		return nil, err
+	}
+	return &Proposal{Entry: p, Proposer: identity.Name, Status: ProposalPending}, nil
+}
+
+// Proposal: the proposed entry with id and the state of its approval.
+func (db *DB) Proposal(id int) (*Proposal, error) {
+	p, err := models.PendingEntryByID(db, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no proposed entry %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.proposal(p)
+}
+
+func (db *DB) proposal(p *models.PendingEntry) (*Proposal, error) {
+	proposer, err := models.IdentityByID(db, p.Identity)
+	if err != nil {
+		return nil, err
+	}
+	pr := &Proposal{Entry: p, Proposer: proposer.Name, Status: ProposalPending}
+	switch {
+	case p.Ledger != 0:
+		pr.Status = ProposalAppended
+	case time.Now().After(p.Deadline.Time):
+		pr.Status = ProposalExpired
+	}
+	as, err := models.ApprovalsByPending(db, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range as {
+		approver, err := models.IdentityByID(db, a.Identity)
+		if err != nil {
+			return nil, err
+		}
+		pr.Approvals = append(pr.Approvals, approver.Name)
+	}
+	return pr, nil
+}
+
+// MayApprove: true if the user name with role may approve the proposal and has not yet.
+func (pr *Proposal) MayApprove(name, role string) bool {
+	if pr.Status != ProposalPending || name == pr.Proposer {
+		return false
+	}
+	for _, a := range pr.Approvals {
+		if a == name {
+			return false
+		}
+	}
+	r := requirement(pr.Entry)
+	for _, a := range r.Approvers {
+		if a == name {
+			return true
+		}
+	}
+	for _, ro := range r.Roles {
+		if ro == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Proposals: the proposals of the user name with role, and those the user may approve.
+func (db *DB) Proposals(name, role string) ([]*Proposal, error) {
+	ps, err := models.AllPendingEntries(db)
+	if err != nil {
+		return nil, err
+	}
+	var prs []*Proposal
+	for _, p := range ps {
+		pr, err := db.proposal(p)
+		if err != nil {
+			return nil, err
+		}
+		if pr.Proposer == name || pr.MayApprove(name, role) {
+			prs = append(prs, pr)
+		}
+	}
+	return prs, nil
+}
+
+// Approve: approve the proposed entry with id as identity holding role. entry must hold the signed ApprovalMessage,
+// it is appended to the ledger. The approval that meets the threshold appends the proposed entry after it,
+// checked like any other entry: a disposition disposes of the item, deleting its contents from evidence
+// if it is not nil, and a typed entry must follow its schema. If the proposed entry is refused so is the approval.
+func (db *DB) Approve(identity *models.Identity, role string, id int, entry models.Ledger, evidence *store.Store) (*Proposal, error) {
+	pr, err := db.Proposal(id)
+	if err != nil {
+		return nil, err
+	}
+	p := pr.Entry
+	switch {
+	case pr.Status == ProposalAppended:
+		return nil, fmt.Errorf("proposed entry %d was already approved and appended as entry %d", id, p.Ledger)
+	case pr.Status == ProposalExpired:
+		return nil, fmt.Errorf("proposed entry %d expired unapproved at %s", id, p.Deadline.UTC().Format(time.RFC3339))
+	case identity.Name == pr.Proposer:
+		return nil, fmt.Errorf("users cannot approve their own entries")
+	case !pr.MayApprove(identity.Name, role):
+		return nil, fmt.Errorf("%s may not approve proposed entry %d, it needs %s", identity.Name, id, requirement(p))
+	}
+	if msg := ApprovalMessage(id, p.Message); entry.Message != msg {
+		return nil, fmt.Errorf("the approval must sign %q", msg)
+	}
+	var dp *models.Disposition
+	err = db.atomic(func(tdb *DB) error {
+		entry.CaseID, entry.Item = p.CaseID, p.Item
+		entry, err := tdb.Append(identity, entry)
+		if err != nil {
+			return err
+		}
+		a := models.Approval{Pending: id, Identity: identity.ID, Ledger: entry.ID, CreatedAt: XONow()}
+		if err = a.Insert(tdb); err != nil {
+			return err
+		}
+		pr.Approvals = append(pr.Approvals, identity.Name)
+		if len(pr.Approvals) < p.Threshold {
+			return nil
+		}
+		proposer, err := models.IdentityByID(tdb, p.Identity)
+		if err != nil {
+			return err
+		}
+		l := models.Ledger{Message: p.Message, Hash: p.Hash, CaseID: p.CaseID, Item: p.Item}
+		if l, dp, err = tdb.appendProposed(proposer, l); err != nil {
+			return err
+		}
+		p.Ledger = l.ID
+		return p.Update(tdb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Ledger != 0 {
+		pr.Status = ProposalAppended
+	}
+	if dp != nil {
+		return pr, db.removeContents(dp, evidence)
+	}
+	return pr, nil
+}
+
+// appendProposed: append the approved entry l signed by proposer, and the disposition it records if it is one.
+func (db *DB) appendProposed(proposer *models.Identity, l models.Ledger) (models.Ledger, *models.Disposition, error) {
+	message := ProposedMessage(l.Message)
+	if IsDisposeMessage(message) {
+		d, err := db.Disposal(l.Item)
+		if err != nil {
+			return l, nil, err
+		}
+		if _, ok := disposalReason(message, d.Item); !ok {
+			return l, nil, fmt.Errorf("the proposed entry is not a disposition of item %s", l.Item)
+		}
+		dp, err := db.dispose(proposer, d, l)
+		if err != nil {
+			return l, nil, err
+		}
+		l.ID = dp.Ledger
+		return l, dp, nil
+	}
+	entryType, fields, err := db.CheckPayload(message)
+	if err != nil {
+		return l, nil, err
+	}
+	if l, err = db.Append(proposer, l); err != nil {
+		return l, nil, err
+	}
+	return l, nil, db.RecordFields(l, entryType, fields)
+}
+
+// approved: true if entry is a proposed entry that was approved at least as rule requires.
+func (db *DB) approved(entry *models.Ledger, rule Requirement) (bool, error) {
+	var id int
+	err := db.QueryRow(`select id from pending_entries where hash = ? and message = ?`, entry.Hash, entry.Message).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	p, err := models.PendingEntryByID(db, id)
+	if err != nil {
+		return false, err
+	}
+	as, err := models.ApprovalsByPending(db, id)
+	if err != nil {
+		return false, err
+	}
+	return requirement(p).Covers(rule) && len(as) >= rule.Threshold, nil
+}
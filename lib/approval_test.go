@@ -0,0 +1,194 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// sign: a request carrying message in caseID about item, signed by name with key.
+func sign(t *testing.T, name string, key *ecdsa.PrivateKey, message, caseID, item string) *RecordRequest {
+	hash, err := SignEntry(key, message, caseID, item)
+	FailTest(t, err, "failed to sign %s")
+	return &RecordRequest{Name: name, Data: []byte(message), Hash: hash, Case: caseID, Item: item}
+}
+
+func TestApproval(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	admin := enroll(t, ck, "admin")
+	keys := map[string]*ecdsa.PrivateKey{"admin": admin}
+	for name, role := range map[string]string{"officer": RoleOfficer, "bob": RoleCustodian, "carol": RoleCustodian, "dave": RoleExaminer} {
+		keys[name] = enroll(t, ck, name)
+		FailTest(t, ck.Grant(signed(t, "Clerk.Grant", "admin", admin, RecordRequest{Subject: name, Role: role}), &models.Role{}), "could not grant role %s")
+	}
+
+	r := Requirement{Threshold: 2, Approvers: []string{"dave"}, Roles: []string{RoleCustodian}, Deadline: time.Now().Add(time.Hour).Truncate(time.Second)}
+	msg := ProposalMessage("submitted to court\n", r)
+	if msg != "submitted to court\nrequires 2 approvals from dave or a custodian before "+r.Deadline.UTC().Format(time.RFC3339) {
+		t.Fatalf("wrong proposal message %q", msg)
+	}
+	var rc Receipt
+	if err := ck.Validate(sign(t, "officer", keys["officer"], msg, "C1", ""), &rc); err == nil {
+		t.Fatal("an entry that needs approval was appended without it")
+	}
+	req := sign(t, "officer", keys["officer"], msg, "C1", "")
+	req.Requirement = &r
+	var pr Proposal
+	FailTest(t, ck.Propose(req, &pr), "could not propose %s")
+	id := pr.Entry.ID
+
+	approve := func(name string) error {
+		req := sign(t, name, keys[name], ApprovalMessage(id, msg), "C1", "")
+		req.Entry = id
+		return ck.Approve(req, &pr)
+	}
+	if approve("officer") == nil {
+		t.Fatal("the proposer approved their own entry")
+	}
+	if approve("admin") == nil {
+		t.Fatal("a user who is neither named nor holds the role approved")
+	}
+	FailTest(t, approve("bob"), "bob could not approve %s")
+	if pr.Status != ProposalPending || len(pr.Approvals) != 1 {
+		t.Fatalf("one approval appended the entry %+v", pr)
+	}
+	if approve("bob") == nil {
+		t.Fatal("bob approved twice")
+	}
+	prs, err := ck.DB.Proposals("carol", RoleCustodian)
+	FailTest(t, err, "%s")
+	if len(prs) != 1 || !prs[0].MayApprove("carol", RoleCustodian) {
+		t.Fatalf("the proposal is not waiting for carol %+v", prs)
+	}
+	FailTest(t, approve("dave"), "dave could not approve %s")
+	l, err := models.LedgerByID(ck.DB, pr.Entry.Ledger)
+	FailTest(t, err, "the entry was not appended %s")
+	if pr.Status != ProposalAppended || l.Message != msg || l.CaseID != "C1" || l.Identity != pr.Entry.Identity {
+		t.Fatalf("wrong appended entry %+v %+v", pr, l)
+	}
+	if approve("carol") == nil {
+		t.Fatal("an appended entry was approved")
+	}
+
+	if ck.Propose(req, &pr) == nil {
+		t.Fatal("the signature of an appended entry was proposed again")
+	}
+
+	// a proposal expires at its deadline
+	req = sign(t, "officer", keys["officer"], msg, "C1", "")
+	req.Requirement = &r
+	FailTest(t, ck.Propose(req, &pr), "could not propose %s")
+	id = pr.Entry.ID
+	_, err = ck.DB.Exec("UPDATE pending_entries SET deadline = ? WHERE id = ?", XONow(), id)
+	FailTest(t, err, "%s")
+	if approve("bob") == nil {
+		t.Fatal("an expired entry was approved")
+	}
+
+	report, err := ck.DB.Fsck(nil, nil)
+	FailTest(t, err, "fsck failed %s")
+	if !report.OK() {
+		t.Fatalf("fsck found %v %v", report.Audit.Failures, report.Findings)
+	}
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	admin := enroll(t, ck, "admin")
+	keys := map[string]*ecdsa.PrivateKey{"admin": admin}
+	for name, role := range map[string]string{"bob": RoleCustodian, "carol": RoleCustodian, "dave": RoleExaminer} {
+		keys[name] = enroll(t, ck, name)
+		FailTest(t, ck.Grant(signed(t, "Clerk.Grant", "admin", admin, RecordRequest{Subject: name, Role: role}), &models.Role{}), "could not grant role %s")
+	}
+	evidence, err := store.Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+	ck.Store = evidence
+	ck.DB.Policy = &Policy{Operations: []Operation{
+		{Name: "dispose", Match: `^dispose of item `, Approvals: &Requirement{Threshold: 2, Roles: []string{RoleCustodian, RoleAdmin}}},
+	}}
+	FailTest(t, ck.DB.Policy.Compile(), "%s")
+
+	// an item whose retention period is over
+	bob, err := ck.identity("bob")
+	FailTest(t, err, "%s")
+	staged, err := evidence.Stage(strings.NewReader("seized drive"))
+	FailTest(t, err, "could not stage %s")
+	_, err = staged.Commit()
+	FailTest(t, err, "could not commit %s")
+	item := models.Item{Tag: "E-1", CaseID: "C1", Description: "drive", Digest: staged.Digest}
+	_, err = ck.DB.UploadItem(bob, item, entry(t, keys["bob"], UploadMessage(item.Tag, item.Description, item.Digest), "C1", "E-1"), nil)
+	FailTest(t, err, "failed to register upload %s")
+	_, err = ck.DB.SetRetention(bob, models.Retention{CaseID: "C1", Days: 30, Basis: "statute 1"},
+		entry(t, keys["bob"], RetentionMessage("C1", "", 30, "statute 1"), "C1", ""))
+	FailTest(t, err, "failed to set retention %s")
+	_, err = ck.DB.Exec("UPDATE items SET created_at = ? WHERE tag = 'E-1'", time.Now().AddDate(0, 0, -31))
+	FailTest(t, err, "failed to age item %s")
+	s, err := ck.DB.State("E-1")
+	FailTest(t, err, "%s")
+	move := StateMessage("E-1", s.State, s.Ledger, StateInStorage, "shelf 4")
+	_, err = ck.DB.Move(bob, "E-1", StateInStorage, "shelf 4", entry(t, keys["bob"], move, "C1", "E-1"))
+	FailTest(t, err, "failed to store item %s")
+
+	message := DisposeMessage("E-1", "shredded", item.Digest)
+	req := sign(t, "bob", keys["bob"], message, "C1", "E-1")
+	req.Description = "shredded"
+	if err = ck.Dispose(req, &models.Disposition{}); err == nil || !strings.Contains(err.Error(), "rule dispose.approvals:") {
+		t.Fatalf("an item was disposed of without the approvals the policy requires: %v", err)
+	}
+	propose := func(name string, r Requirement) (*Proposal, error) {
+		r.Deadline = time.Now().Add(time.Hour).Truncate(time.Second)
+		req := sign(t, name, keys[name], ProposalMessage(message, r), "C1", "E-1")
+		req.Requirement = &r
+		var pr Proposal
+		err := ck.Propose(req, &pr)
+		return &pr, err
+	}
+	if _, err = propose("bob", Requirement{Threshold: 1, Roles: []string{RoleCustodian}}); err == nil {
+		t.Fatal("a disposition was proposed with fewer approvals than the policy requires")
+	}
+	if _, err = propose("dave", Requirement{Threshold: 2, Roles: []string{RoleCustodian}}); err == nil {
+		t.Fatal("an examiner proposed a disposition")
+	}
+	pr, err := propose("bob", Requirement{Threshold: 2, Roles: []string{RoleCustodian, RoleAdmin}})
+	FailTest(t, err, "could not propose the disposition %s")
+	for _, name := range []string{"carol", "admin"} {
+		req := sign(t, name, keys[name], ApprovalMessage(pr.Entry.ID, pr.Entry.Message), "C1", "E-1")
+		req.Entry = pr.Entry.ID
+		FailTest(t, ck.Approve(req, pr), "could not approve %s")
+	}
+	dp, err := models.DispositionByItem(ck.DB, "E-1")
+	FailTest(t, err, "the approved disposition was not recorded %s")
+	if pr.Status != ProposalAppended || dp.Ledger != pr.Entry.Ledger || evidence.Has(item.Digest) {
+		t.Fatalf("wrong approved disposition %+v %+v", pr, dp)
+	}
+
+	// a typed entry is checked against its schema when it is proposed and its fields are recorded when it is appended
+	req = sign(t, "admin", admin, EntryTypeMessage("acquisition", []byte(acquisitionSchema)), "", "")
+	req.Type, req.Schema = "acquisition", []byte(acquisitionSchema)
+	FailTest(t, ck.AddEntryType(req, &models.EntryType{}), "could not register the entry type %s")
+	r := Requirement{Threshold: 1, Approvers: []string{"dave"}, Deadline: time.Now().Add(time.Hour).Truncate(time.Second)}
+	for _, payload := range []string{`{"serial": "WD-1"}`, `{"serial": "WD-1", "write_blocker": "T35u"}`} {
+		message = ProposalMessage(PayloadMessage("acquisition", []byte(payload)), r)
+		req = sign(t, "bob", keys["bob"], message, "C1", "")
+		req.Requirement = &r
+		err = ck.Propose(req, pr)
+		if payload == `{"serial": "WD-1"}` {
+			if err == nil {
+				t.Fatal("a payload that breaks its schema was proposed")
+			}
+			continue
+		}
+		FailTest(t, err, "could not propose typed entry %s")
+	}
+	req = sign(t, "dave", keys["dave"], ApprovalMessage(pr.Entry.ID, message), "C1", "")
+	req.Entry = pr.Entry.ID
+	FailTest(t, ck.Approve(req, pr), "could not approve %s")
+	CheckCount(t, &ck.DB, fmt.Sprintf("select count(*) from entry_fields where ledger = %d", pr.Entry.Ledger), 2)
+}
@@ -0,0 +1,161 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// AuditReport: the outcome of checking every signature and link stored in a custody database.
+type AuditReport struct {
+	Entries      int
+	Signatures   int
+	Checkpoints  int
+	Timestamps   int
+	Cosignatures int
+	Root         []byte
+	Failures     []string
+}
+
+// OK: true if every check passed.
+func (r *AuditReport) OK() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *AuditReport) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// verifyEntries: check the signature of every entry by its identity, in parallel on every CPU.
+// The key of each identity is parsed once. The errors are in the order of ls, nil for a valid signature.
+func verifyEntries(ls []*models.Ledger, ids map[int]*models.Identity) []error {
+	keys := map[int]*ecdsa.PublicKey{}
+	bad := map[int]error{}
+	for id, ident := range ids {
+		pub, err := ident.Public()
+		if err != nil {
+			bad[id] = fmt.Errorf("could not parse key of identity %d: %s", id, err)
+			continue
+		}
+		keys[id] = pub
+	}
+	errs := make([]error, len(ls))
+	next := make(chan int, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				l := ls[i]
+				pub, ok := keys[l.Identity]
+				switch {
+				case bad[l.Identity] != nil:
+					errs[i] = bad[l.Identity]
+				case !ok:
+					errs[i] = fmt.Errorf("signing identity %d is unknown", l.Identity)
+				case !crypto.Verify(EntryStatement(l.Message, l.CaseID, l.Item), l.Hash, pub):
+					errs[i] = fmt.Errorf("signature by %s is invalid", ids[l.Identity].Name)
+				}
+			}
+		}()
+	}
+	for i := range ls {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
+
+// Audit: check the whole database. Every ledger entry must be signed by its identity,
+// every checkpoint must be signed by server and commit to a prefix of the current ledger,
+// and every timestamp and cosignature must verify against the entry or checkpoint it covers.
+// If server is nil checkpoint signatures are not checked, the Merkle roots still are.
+func (db *DB) Audit(server *ecdsa.PublicKey) (*AuditReport, error) {
+	r := &AuditReport{}
+	idents, err := models.AllIdentities(db)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[int]*models.Identity{}
+	for _, i := range idents {
+		ids[i.ID] = i
+	}
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	r.Entries = len(ls)
+	entries := map[int]*models.Ledger{}
+	for i, err := range verifyEntries(ls, ids) {
+		entries[ls[i].ID] = ls[i]
+		if err != nil {
+			r.fail("entry %d: %s", ls[i].ID, err)
+			continue
+		}
+		r.Signatures++
+	}
+	leaves := Leaves(ls)
+	r.Root = merkle.Root(leaves)
+
+	cps, err := models.AllCheckpoints(db)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := map[int]*models.Checkpoint{}
+	for _, cp := range cps {
+		checkpoints[cp.ID] = cp
+		switch {
+		case server != nil && !VerifyCheckpoint(cp, server):
+			r.fail("checkpoint %d: server signature is invalid", cp.ID)
+		case cp.Size > len(leaves):
+			r.fail("checkpoint %d: covers %d entries but the ledger has %d", cp.ID, cp.Size, len(leaves))
+		case !bytes.Equal(merkle.Root(leaves[:cp.Size]), cp.Root):
+			r.fail("checkpoint %d: root does not match the first %d entries", cp.ID, cp.Size)
+		default:
+			r.Checkpoints++
+		}
+	}
+
+	stamps, err := models.AllTimestamps(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range stamps {
+		l, ok := entries[ts.Ledger]
+		if !ok {
+			r.fail("timestamp %d: entry %d is missing", ts.ID, ts.Ledger)
+			continue
+		}
+		if _, err := VerifyTimestamp(ts, l, nil); err != nil {
+			r.fail("timestamp %d: %s", ts.ID, err)
+			continue
+		}
+		r.Timestamps++
+	}
+
+	cosigs, err := models.AllCosignatures(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, cs := range cosigs {
+		cp, ok := checkpoints[cs.Checkpoint]
+		if !ok {
+			r.fail("cosignature %d: checkpoint %d is missing", cs.ID, cs.Checkpoint)
+			continue
+		}
+		if err := VerifyCosignature(cp, cs); err != nil {
+			r.fail("cosignature %d: %s", cs.ID, err)
+			continue
+		}
+		r.Cosignatures++
+	}
+	return r, nil
+}
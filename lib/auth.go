@@ -0,0 +1,397 @@
+package custody
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The cookies of the web application. The session cookie holds the session token,
+// the login cookie holds the CSRF token of the login form before there is a session.
+const (
+	SessionCookie = "custody_session"
+	LoginCookie   = "custody_login"
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFField     = "csrf_token"
+)
+
+// SessionLifetime: how long a session lasts after login.
+var SessionLifetime = 12 * time.Hour
+
+// SecureCookies: send cookies over https only. Only turn it off to develop without tls.
+var SecureCookies = true
+
+// webSchema: the tables of the web application database.
+var webSchema = []string{
+	`create table if not exists users (
+	id integer primary key,
+	username varchar(256) not null,
+	email varchar(256) not null unique,
+	firstname varchar(256) not null,
+	lastname varchar(256) not null,
+	usertype varchar(256) not null, -- unused, roles are granted in the custody database
+	password varchar(256) not null
+)`,
+	`create table if not exists submissions (
+	id integer primary key,
+	filetype varchar(256) not null,
+	location varchar(256) not null,
+	email varchar(256) not null,
+	firstname varchar(256) not null,
+	lastname varchar(256) not null
+)`,
+	// only a hash of the token is stored, so a copy of the database cannot be used to log in
+	`create table if not exists sessions (
+	token varchar(64) primary key,
+	email varchar(256) not null,
+	csrf varchar(64) not null,
+	created_at timestamp not null,
+	expires_at timestamp not null
+)`,
+	// uploads in progress, their data is in the evidence store
+	`create table if not exists partial_uploads (
+	id varchar(32) primary key,
+	email varchar(256) not null,
+	item varchar(256) not null,
+	case_id varchar(256) not null,
+	description varchar(256) not null,
+	size integer not null,
+	created_at timestamp not null
+)`,
+	// who uploaded which file of the evidence store
+	`create table if not exists uploads (
+	id integer primary key,
+	digest varchar(64) not null,
+	email varchar(256) not null,
+	item varchar(256) not null,
+	created_at timestamp not null
+)`,
+	`create table if not exists denials (
+	id integer primary key,
+	created_at timestamp not null,
+	email varchar(256) not null,
+	action varchar(256) not null,
+	target varchar(256) not null,
+	reason varchar(256) not null
+)`,
+}
+
+// InitWebDB: create the tables of the web application if they do not exist.
+func InitWebDB(db *sql.DB) error {
+	for _, stmt := range webSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertUser: store a web user with a bcrypt hash of the password, the username is the email.
+// The role of the user is not kept here, it is the one granted in the custody database, see LookupSession.
+func InsertUser(db *sql.DB, user *User) error {
+	if user.Email == "" || user.Password == "" {
+		return fmt.Errorf("email and password are required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT into users (username, email, firstname, lastname, usertype, password) VALUES(?, ?, ?, ?, ?, ?)",
+		user.Email, user.Email, user.Firstname, user.Lastname, user.UserType, hash)
+	return err
+}
+
+// dummyHash: compared against when the user does not exist, so that a login takes as long either way.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("custody"), bcrypt.DefaultCost)
+
+// Authenticate: check the password of the user with email against the bcrypt hash in users.
+func Authenticate(db *sql.DB, email, password string) error {
+	var hash []byte
+	err := db.QueryRow("SELECT password from users where email = ?", email).Scan(&hash)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return fmt.Errorf("invalid email or password")
+	}
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return fmt.Errorf("invalid email or password")
+	}
+	return nil
+}
+
+// Session: a logged in user with the role of their user type. Requests that change state must carry CSRF.
+type Session struct {
+	Email     string
+	Role      string
+	CSRF      string
+	ExpiresAt time.Time
+}
+
+// randomToken: 32 random bytes, url safe.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSession: start a session for email, the returned token goes into the session cookie.
+func NewSession(db *sql.DB, email string) (string, *Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	s := &Session{Email: email, ExpiresAt: time.Now().Add(SessionLifetime).UTC()}
+	if s.CSRF, err = randomToken(); err != nil {
+		return "", nil, err
+	}
+	_, err = db.Exec("INSERT into sessions (token, email, csrf, created_at, expires_at) VALUES(?, ?, ?, ?, ?)",
+		tokenHash(token), s.Email, s.CSRF, time.Now().UTC(), s.ExpiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, s, nil
+}
+
+// LookupSession: the session of token, nil if there is none or it has expired.
+// The role of the session is looked up in Ledger with RoleOf on every request, like the clerk does,
+// so a role granted or taken away with custody grant applies to the web server at once.
+func LookupSession(db *sql.DB, token string) (*Session, error) {
+	if token == "" {
+		return nil, nil
+	}
+	s := &Session{}
+	err := db.QueryRow("SELECT s.email, s.csrf, s.expires_at from sessions s join users u on u.email = s.email where s.token = ?",
+		tokenHash(token)).Scan(&s.Email, &s.CSRF, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return nil, DeleteSession(db, token)
+	}
+	if Ledger == nil {
+		return nil, fmt.Errorf("the web server has no custody database to look up roles in")
+	}
+	if s.Role, err = Ledger.RoleOf(s.Email); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DeleteSession: end the session of token.
+func DeleteSession(db *sql.DB, token string) error {
+	_, err := db.Exec("DELETE from sessions where token = ?", tokenHash(token))
+	return err
+}
+
+// currentSession: the session of the cookie sent with r, nil if there is none.
+func currentSession(db *sql.DB, r *http.Request) (*Session, error) {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	return LookupSession(db, c.Value)
+}
+
+type sessionKey struct{}
+
+// SessionFrom: the session of a request that passed RequireSession.
+func SessionFrom(r *http.Request) *Session {
+	s, _ := r.Context().Value(sessionKey{}).(*Session)
+	return s
+}
+
+// safeMethod: methods that must not change state and so need no CSRF token.
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// csrfToken: the CSRF token sent with a request, in the header for scripts or in the form for html forms.
+// A multipart form sends it in the header or the query string: reading it from the body would buffer the whole
+// body before the request is authorized, and leave nothing for a handler that streams it.
+func csrfToken(r *http.Request) string {
+	if t := r.Header.Get(CSRFHeader); t != "" {
+		return t
+	}
+	if mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); strings.HasPrefix(mediatype, "multipart/") {
+		return r.URL.Query().Get(CSRFField)
+	}
+	return r.FormValue(CSRFField)
+}
+
+func tokensEqual(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// wantsHTML: true for requests from a browser page rather than a script.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// RequireSession: only let requests with a valid session through to next.
+// Browsers without a session are sent to the login page, scripts get 401.
+// Requests that change state must carry the CSRF token of the session.
+func RequireSession(db *sql.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := currentSession(db, r)
+		if err != nil {
+			fivehundred(w, r, err)
+			return
+		}
+		if s == nil {
+			if wantsHTML(r) && safeMethod(r.Method) {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			SendResponse(w, false, "login required")
+			return
+		}
+		if !safeMethod(r.Method) && !tokensEqual(csrfToken(r), s.CSRF) {
+			log.Printf("rejected %s %s by %s: missing or invalid CSRF token", r.Method, r.URL.Path, s.Email)
+			w.WriteHeader(http.StatusForbidden)
+			SendResponse(w, false, "missing or invalid CSRF token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, s)))
+	})
+}
+
+// Deny: record a request refused by access control and answer it with 403.
+func Deny(db *sql.DB, w http.ResponseWriter, r *http.Request, s *Session, reason string) {
+	log.Printf("denied %s %s to %s: %s", r.Method, r.URL.Path, s.Email, reason)
+	_, err := db.Exec("INSERT into denials (created_at, email, action, target, reason) VALUES(?, ?, ?, ?, ?)",
+		time.Now().UTC(), s.Email, r.Method, r.URL.Path, reason)
+	if err != nil {
+		log.Printf("could not record denial: %s", err)
+	}
+	w.WriteHeader(http.StatusForbidden)
+	SendResponse(w, false, "access denied: "+reason)
+}
+
+// RequirePermission: only let users whose role has permission p through to next.
+// It must be wrapped in RequireSession.
+func RequirePermission(db *sql.DB, p Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := SessionFrom(r)
+		if !Can(s.Role, p) {
+			Deny(db, w, r, s, fmt.Sprintf("%s does not have the %s permission", s.Role, p))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SessionHandler: the email, role and CSRF token of the session as json, for scripts.
+func SessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := SessionFrom(r)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"Email": s.Email, "Role": s.Role, "CSRF": s.CSRF})
+	}
+}
+
+func setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   SecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// LoginHandler: shows the login form and checks the password posted from it.
+// Before there is a session the form is protected against CSRF by a token in the login cookie
+// that must match the token in the form.
+func LoginHandler(db *sql.DB) http.HandlerFunc {
+	render := func(w http.ResponseWriter, r *http.Request, code int, msg string) {
+		csrf, err := randomToken()
+		if err != nil {
+			fivehundred(w, r, err)
+			return
+		}
+		setCookie(w, LoginCookie, csrf, 600)
+		w.WriteHeader(code)
+		data := map[string]interface{}{"Version": versionInfo, "CSRF": csrf, "CSRFField": CSRFField, "Message": msg}
+		if err = templates.ExecuteTemplate(w, "login.html", data); err != nil {
+			log.Println(err)
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			render(w, r, http.StatusOK, "")
+		case "POST":
+			c, err := r.Cookie(LoginCookie)
+			if err != nil || !tokensEqual(r.FormValue(CSRFField), c.Value) {
+				render(w, r, http.StatusForbidden, "The login form expired, please try again.")
+				return
+			}
+			email := r.FormValue("email")
+			if err = Authenticate(db, email, r.FormValue("password")); err != nil {
+				log.Printf("failed login for %q: %s", email, err)
+				render(w, r, http.StatusUnauthorized, "Invalid email or password.")
+				return
+			}
+			token, s, err := NewSession(db, email)
+			if err != nil {
+				fivehundred(w, r, err)
+				return
+			}
+			setCookie(w, LoginCookie, "", -1)
+			setCookie(w, SessionCookie, token, int(time.Until(s.ExpiresAt).Seconds()))
+			log.Printf("%s logged in", email)
+			http.Redirect(w, r, "/index", http.StatusSeeOther)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// LogoutHandler: ends the session. It must be wrapped in RequireSession, which checks the CSRF token.
+func LogoutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if c, err := r.Cookie(SessionCookie); err == nil {
+			if err = DeleteSession(db, c.Value); err != nil {
+				fivehundred(w, r, err)
+				return
+			}
+		}
+		setCookie(w, SessionCookie, "", -1)
+		if s := SessionFrom(r); s != nil {
+			log.Printf("%s logged out", s.Email)
+		}
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+}
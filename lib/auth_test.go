@@ -0,0 +1,192 @@
+package custody
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func webdb(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "nij.db"))
+	FailTest(t, err, "could not open web database %s")
+	FailTest(t, InitWebDB(db), "could not create web tables %s")
+	return db
+}
+
+// cookie: the value of the cookie name set by a response.
+func cookie(res *http.Response, name string) *http.Cookie {
+	for _, c := range res.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestErrorPage(t *testing.T) {
+	templates = nil
+	w := httptest.NewRecorder()
+	fivehundred(w, httptest.NewRequest("GET", "/", nil), errors.New("no database"))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "no database") {
+		t.Fatalf("error without templates got %d %q", w.Code, w.Body.String())
+	}
+
+	LoadTemplates([]string{"../static/index.html", "../static/login.html", "../static/500.html"})
+	w = httptest.NewRecorder()
+	fivehundred(w, httptest.NewRequest("GET", "/", nil), errors.New("no database"))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<h2>Internal Server Error</h2>") {
+		t.Fatalf("error page got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestAuth(t *testing.T) {
+	db := webdb(t)
+	LoadTemplates([]string{"../static/index.html", "../static/login.html", "../static/500.html"})
+	Ledger = tempdb(t)
+	defer func() { Ledger = nil }()
+	admin, _ := signer(t, Ledger, "admin")
+	_, err := Ledger.Grant(admin, "alice@example.com", RoleOfficer)
+	FailTest(t, err, "could not grant role %s")
+	FailTest(t, InsertUser(db, &User{Email: "alice@example.com", Password: "correct horse", UserType: RoleAdmin}), "could not add user %s")
+	if err := Authenticate(db, "alice@example.com", "correct horse"); err != nil {
+		t.Fatalf("valid password rejected: %s", err)
+	}
+	if Authenticate(db, "alice@example.com", "wrong") == nil || Authenticate(db, "bob@example.com", "correct horse") == nil {
+		t.Fatal("invalid login accepted")
+	}
+
+	m := http.NewServeMux()
+	m.Handle("/login", LoginHandler(db))
+	m.Handle("/logout", RequireSession(db, LogoutHandler(db)))
+	m.Handle("/private", RequireSession(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(SessionFrom(r).Email))
+	})))
+	m.Handle("/audit", RequireSession(db, RequirePermission(db, PermAudit, SessionHandler())))
+	m.Handle("/stream", RequireSession(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(part)
+		w.Write(data)
+	})))
+	do := func(method, path string, form url.Values, cookies ...*http.Cookie) *http.Response {
+		var body *strings.Reader
+		if form == nil {
+			body = strings.NewReader("")
+		} else {
+			body = strings.NewReader(form.Encode())
+		}
+		req := httptest.NewRequest(method, path, body)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for _, c := range cookies {
+			if c != nil {
+				req.AddCookie(c)
+			}
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	if res := do("GET", "/private", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("request without a session got %d", res.StatusCode)
+	}
+
+	res := do("GET", "/login", nil)
+	login := cookie(res, LoginCookie)
+	if login == nil || !login.Secure || !login.HttpOnly {
+		t.Fatalf("login form did not set a secure CSRF cookie: %v", login)
+	}
+	creds := url.Values{"email": {"alice@example.com"}, "password": {"correct horse"}}
+	if res = do("POST", "/login", creds, login); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("login without CSRF token got %d", res.StatusCode)
+	}
+	creds.Set(CSRFField, login.Value)
+	creds.Set("password", "wrong")
+	if res = do("POST", "/login", creds, login); res.StatusCode != http.StatusUnauthorized || cookie(res, SessionCookie) != nil {
+		t.Fatalf("login with a wrong password got %d", res.StatusCode)
+	}
+	creds.Set("password", "correct horse")
+	res = do("POST", "/login", creds, login)
+	session := cookie(res, SessionCookie)
+	if res.StatusCode != http.StatusSeeOther || session == nil || !session.Secure || !session.HttpOnly || session.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("login got %d and session cookie %v", res.StatusCode, session)
+	}
+
+	if res = do("GET", "/private", nil, session); res.StatusCode != http.StatusOK {
+		t.Fatalf("request with a session got %d", res.StatusCode)
+	}
+	s, err := LookupSession(db, session.Value)
+	FailTest(t, err, "could not look up session %s")
+	// the role comes from the custody database, not from the user type of the web user
+	if s.Role != RoleOfficer {
+		t.Fatalf("session has role %q, not the granted %q", s.Role, RoleOfficer)
+	}
+	if res = do("GET", "/audit", nil, session); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("an officer got %d from an auditor page", res.StatusCode)
+	}
+	_, err = Ledger.Grant(admin, "alice@example.com", RoleAuditor)
+	FailTest(t, err, "could not grant role %s")
+	if res = do("GET", "/audit", nil, session); res.StatusCode != http.StatusOK {
+		t.Fatalf("a newly granted auditor got %d from an auditor page", res.StatusCode)
+	}
+	if res = do("POST", "/private", url.Values{}, session); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("post without CSRF token got %d", res.StatusCode)
+	}
+	if res = do("POST", "/private", url.Values{CSRFField: {s.CSRF}}, session); res.StatusCode != http.StatusOK {
+		t.Fatalf("post with CSRF token got %d", res.StatusCode)
+	}
+
+	// a multipart body is left for the handler to stream, so its token comes in the header or the query string
+	stream := func(path, header string, fields url.Values) *http.Response {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		for k, v := range fields {
+			mw.WriteField(k, v[0])
+		}
+		fw, _ := mw.CreateFormFile("file", "image.dd")
+		fw.Write([]byte("evidence"))
+		mw.Close()
+		req := httptest.NewRequest("POST", path, body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if header != "" {
+			req.Header.Set(CSRFHeader, header)
+		}
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		return w.Result()
+	}
+	if res = stream("/stream", "", url.Values{CSRFField: {s.CSRF}}); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("a token in a multipart body got %d", res.StatusCode)
+	}
+	for _, res = range []*http.Response{stream("/stream", s.CSRF, nil), stream("/stream?"+CSRFField+"="+url.QueryEscape(s.CSRF), "", nil)} {
+		if data, _ := ioutil.ReadAll(res.Body); res.StatusCode != http.StatusOK || string(data) != "evidence" {
+			t.Fatalf("streaming upload got %d %q", res.StatusCode, data)
+		}
+	}
+
+	if res = do("POST", "/logout", url.Values{CSRFField: {s.CSRF}}, session); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("logout got %d", res.StatusCode)
+	}
+	if res = do("GET", "/private", nil, session); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("request after logout got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,298 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// BackupVersion: the format version written into backup manifests.
+const BackupVersion = 1
+
+// The files of a backup directory.
+const (
+	BackupSnapshot  = "custody.sqlite"
+	BackupManifest  = "manifest.json"
+	BackupSignature = "manifest.sig"
+	BackupServerKey = "server_key.pub"
+)
+
+// backupTables: the tables whose row counts are recorded in a backup manifest.
+var backupTables = []string{"identities", "ledger", "items", "checkpoints", "timestamps", "cosignatures", "roles", "denials", "hash_lists", "retention_policies", "legal_holds", "dispositions", "fixity_runs",
+	"webhooks", "webhook_deliveries", "webhook_dead_letters", "pending_entries", "approvals", "policy_violations", "item_states",
+	"entry_types", "entry_fields", "key_records", "tree_frontiers", "case_members"}
+
+// BackupTip: the last ledger entry in a snapshot.
+type BackupTip struct {
+	Entry int    `json:"entry"`
+	Leaf  []byte `json:"leaf"`
+}
+
+// SnapshotManifest: describes a snapshot of the database. The server signs the manifest.
+type SnapshotManifest struct {
+	Version    int                `json:"version"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Digest     string             `json:"digest"`
+	Rows       map[string]int     `json:"rows"`
+	Tip        *BackupTip         `json:"tip"`
+	Root       []byte             `json:"root"`
+	Checkpoint *models.Checkpoint `json:"checkpoint"`
+}
+
+// openSnapshot: open a snapshot read only, so that verifying it cannot change it.
+func openSnapshot(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", "file:"+path+"?mode=ro")
+}
+
+// describe: the row counts, tip, Merkle root and latest checkpoint of a database.
+func (db *DB) describe() (*SnapshotManifest, error) {
+	m := &SnapshotManifest{Version: BackupVersion, Rows: map[string]int{}}
+	for _, table := range backupTables {
+		// snapshots taken by older versions lack the newer tables
+		var n int
+		if err := db.QueryRow("select count(*) from sqlite_master where type = 'table' and name = ?", table).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := db.QueryRow("select count(*) from " + table).Scan(&n); err != nil {
+			return nil, err
+		}
+		m.Rows[table] = n
+	}
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	leaves := Leaves(ls)
+	if n := len(ls); n > 0 {
+		m.Tip = &BackupTip{Entry: ls[n-1].ID, Leaf: leaves[n-1]}
+	}
+	m.Root = merkle.Root(leaves)
+	m.Checkpoint, err = models.LatestCheckpoint(db)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return m, err
+}
+
+// Backup: take a consistent snapshot of the live database into dir with VACUUM INTO,
+// and write a manifest of the snapshot signed by key next to it.
+func (db *DB) Backup(key *ecdsa.PrivateKey, dir string) (*SnapshotManifest, error) {
+	if key == nil {
+		return nil, fmt.Errorf("the server has no signing key")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, BackupSnapshot)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return nil, err
+	}
+
+	// describe the snapshot rather than the live database, which may have moved on
+	sdb, err := openSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	m, err := (&DB{XODB: sdb}).describe()
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt = time.Now().UTC()
+	if m.Digest, err = fileDigest(path); err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := cryptopasta.Sign(manifest, key)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{BackupManifest: manifest, BackupSignature: sig, BackupServerKey: pub}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// BackupReport: the outcome of verifying a backup.
+type BackupReport struct {
+	Manifest  SnapshotManifest
+	ServerKey string
+	Pinned    bool
+	Audit     *AuditReport
+	Failures  []string
+}
+
+// OK: true if every check passed.
+func (r *BackupReport) OK() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *BackupReport) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// VerifyBackup: check the manifest signature, the snapshot digest and contents against the manifest,
+// and audit every signature and link in the snapshot.
+// If pinned is not nil the backup must be signed by that server key,
+// otherwise the key stored with the backup is trusted and the report says so.
+func VerifyBackup(dir string, pinned *ecdsa.PublicKey) (*BackupReport, error) {
+	r := &BackupReport{}
+	files := map[string][]byte{}
+	for _, name := range []string{BackupManifest, BackupSignature, BackupServerKey} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	if err := json.Unmarshal(files[BackupManifest], &r.Manifest); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", BackupManifest, err)
+	}
+	r.ServerKey = crypto.Fingerprint(files[BackupServerKey])
+	server, err := crypto.ParseECDSAPublicKey(files[BackupServerKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse server key: %s", err)
+	}
+	if pinned != nil {
+		r.Pinned = true
+		if pinned.X.Cmp(server.X) != 0 || pinned.Y.Cmp(server.Y) != 0 {
+			r.fail("backup is signed by server key %s, not the pinned key", r.ServerKey)
+			return r, nil
+		}
+	}
+	if !crypto.Verify(files[BackupManifest], files[BackupSignature], server) {
+		r.fail("manifest signature is invalid")
+		return r, nil
+	}
+
+	path := filepath.Join(dir, BackupSnapshot)
+	sum, err := fileDigest(path)
+	if err != nil {
+		return nil, err
+	}
+	if sum != r.Manifest.Digest {
+		r.fail("snapshot does not match its manifest digest")
+		return r, nil
+	}
+
+	sdb, err := openSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	snap := &DB{XODB: sdb}
+	got, err := snap.describe()
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range backupTables {
+		if got.Rows[table] != r.Manifest.Rows[table] {
+			r.fail("table %s has %d rows, the manifest says %d", table, got.Rows[table], r.Manifest.Rows[table])
+		}
+	}
+	switch {
+	case (got.Tip == nil) != (r.Manifest.Tip == nil):
+		r.fail("ledger tip does not match the manifest")
+	case got.Tip != nil && (got.Tip.Entry != r.Manifest.Tip.Entry || !bytes.Equal(got.Tip.Leaf, r.Manifest.Tip.Leaf)):
+		r.fail("ledger tip is entry %d, the manifest says entry %d", got.Tip.Entry, r.Manifest.Tip.Entry)
+	}
+	if !bytes.Equal(got.Root, r.Manifest.Root) {
+		r.fail("Merkle root of the ledger does not match the manifest")
+	}
+
+	if r.Audit, err = snap.Audit(server); err != nil {
+		return nil, err
+	}
+	r.Failures = append(r.Failures, r.Audit.Failures...)
+	return r, nil
+}
+
+// Restore: verify the backup in dir and only then copy its snapshot to target.
+// The snapshot is written next to target and renamed into place, so target never holds a partial copy.
+// Restore refuses to replace an existing database.
+func Restore(dir, target string, pinned *ecdsa.PublicKey) (*BackupReport, error) {
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("%s already exists, refusing to overwrite it", target)
+	}
+	r, err := VerifyBackup(dir, pinned)
+	if err != nil {
+		return nil, err
+	}
+	if !r.OK() {
+		return r, fmt.Errorf("backup failed verification, not restoring")
+	}
+	src, err := os.Open(filepath.Join(dir, BackupSnapshot))
+	if err != nil {
+		return r, err
+	}
+	defer src.Close()
+	tmp := target + ".restore"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return r, err
+	}
+	if _, err = io.Copy(dst, src); err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// the copy must still be the snapshot that was verified
+		var sum string
+		if sum, err = fileDigest(tmp); err == nil && sum != r.Manifest.Digest {
+			err = fmt.Errorf("snapshot changed while it was being restored")
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return r, err
+	}
+	return r, os.Rename(tmp, target)
+}
+
+// fileDigest: the hex encoded SHA-256 of the file at path.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
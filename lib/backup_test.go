@@ -0,0 +1,63 @@
+package custody
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+)
+
+func TestBackupRestore(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	alice, akey := signer(t, cdb, "alice")
+	record(t, cdb, alice, akey, "C1", "seize laptop")
+	record(t, cdb, alice, akey, "C1", "image laptop")
+	_, err = cdb.Checkpoint(serverkey)
+	FailTest(t, err, "could not checkpoint %s")
+
+	dir, err := ioutil.TempDir("", "backup")
+	FailTest(t, err, "could not make tempdir %s")
+	backup := filepath.Join(dir, "b1")
+	m, err := cdb.Backup(serverkey, backup)
+	FailTest(t, err, "backup failed %s")
+	if m.Rows["ledger"] != 2 || m.Tip == nil || m.Checkpoint == nil || m.Checkpoint.Size != 2 {
+		t.Fatalf("manifest does not describe the database: %+v", m)
+	}
+	if _, err = cdb.Backup(serverkey, backup); err == nil {
+		t.Fatal("backup overwrote an existing snapshot")
+	}
+
+	r, err := VerifyBackup(backup, &serverkey.PublicKey)
+	FailTest(t, err, "could not verify backup %s")
+	if !r.OK() || r.Audit.Signatures != 2 || r.Audit.Checkpoints != 1 {
+		t.Fatalf("backup did not verify: %v", r.Failures)
+	}
+	other, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	if r, _ = VerifyBackup(backup, &other.PublicKey); r.OK() {
+		t.Fatal("backup verified against the wrong server key")
+	}
+
+	target := filepath.Join(dir, "restored.sqlite")
+	_, err = Restore(backup, target, nil)
+	FailTest(t, err, "restore failed %s")
+	restored := setupdb(t, target)
+	CheckCount(t, restored, "select count(*) from ledger", 2)
+	if _, err = Restore(backup, target, nil); err == nil {
+		t.Fatal("restore overwrote an existing database")
+	}
+
+	// a snapshot altered after the backup is refused
+	db, err := sql.Open("sqlite3", filepath.Join(backup, BackupSnapshot))
+	FailTest(t, err, "could not open snapshot %s")
+	_, err = db.Exec("update ledger set message = 'image desktop' where id = 2")
+	FailTest(t, err, "could not alter snapshot %s")
+	db.Close()
+	if _, err = Restore(backup, filepath.Join(dir, "tampered.sqlite"), nil); err == nil {
+		t.Fatal("restored a tampered snapshot")
+	}
+}
@@ -0,0 +1,498 @@
+package custody
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// BundleVersion: the format version written into bundle manifests.
+const BundleVersion = 1
+
+// The files of a bundle archive.
+const (
+	BundleManifest   = "manifest.json"
+	BundleSignature  = "manifest.sig"
+	BundleEntries    = "entries.json"
+	BundleIdentities = "identities.json"
+	BundleProofs     = "proofs.json"
+	BundleCheckpoint = "checkpoint.json"
+	BundleServerKey  = "server_key.pub"
+	BundleTimestamps = "timestamps.json"
+	BundleCosigs     = "cosignatures.json"
+	BundleKeyRecords = "key_records.json"
+	BundleKeyEntries = "key_entries.json"
+	BundleWitnessed  = "witnessed.json"
+)
+
+// Manifest: describes the contents of a bundle. The server signs the manifest,
+// and the manifest lists the SHA-256 digest of every other file in the bundle.
+type Manifest struct {
+	Version    int               `json:"version"`
+	Case       string            `json:"case"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Entries    int               `json:"entries"`
+	Identities int               `json:"identities"`
+	Files      map[string]string `json:"files"`
+}
+
+// Proof: the Merkle inclusion proof of a ledger entry in the bundle checkpoint.
+type Proof struct {
+	Entry int      `json:"entry"`
+	Index int      `json:"index"`
+	Path  [][]byte `json:"path"`
+}
+
+// Bundle: an offline-verifiable export of every ledger entry of a case.
+// It carries every identity that signed an entry, including earlier keys of the same user,
+// the inclusion proof of each entry in a signed checkpoint, the server public key,
+// the RFC 3161 timestamp tokens of the entries that have one, the witness cosignatures of the checkpoint,
+// and the latest checkpoint witnesses did cosign with the proof that the checkpoint extends it.
+// The rotations and revocations of the keys of the signers come with the ledger entries that record them,
+// which have inclusion proofs too.
+type Bundle struct {
+	Manifest   Manifest
+	Entries    []*models.Ledger
+	Identities []*models.Identity
+	Proofs     []Proof
+	Checkpoint *models.Checkpoint
+	Timestamps []*models.Timestamp
+	Cosigs     []*models.Cosignature
+	Witnessed  *Witnessed
+	KeyRecords []*models.KeyRecord
+	KeyEntries []*models.Ledger
+	ServerKey  []byte
+	Signature  []byte
+
+	files map[string][]byte
+}
+
+// Export: collect a bundle for every ledger entry in caseID and seal it with the server key.
+func (db *DB) Export(key *ecdsa.PrivateKey, caseID string) (*Bundle, error) {
+	if key == nil {
+		return nil, fmt.Errorf("the server has no signing key")
+	}
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := db.checkpoint(key, ls)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{Checkpoint: cp}
+	b.ServerKey, err = x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := Leaves(ls)
+	index := map[int]int{}
+	var names []string
+	seen := map[string]bool{}
+	signer := func(l *models.Ledger) error {
+		ident, err := models.IdentityByID(db, l.Identity)
+		if err != nil {
+			return fmt.Errorf("entry %d has no identity %d: %s", l.ID, l.Identity, err)
+		}
+		if !seen[ident.Name] {
+			seen[ident.Name] = true
+			names = append(names, ident.Name)
+		}
+		return nil
+	}
+	prove := func(l *models.Ledger) error {
+		path, err := merkle.InclusionProof(leaves, index[l.ID])
+		if err != nil {
+			return err
+		}
+		b.Proofs = append(b.Proofs, Proof{Entry: l.ID, Index: index[l.ID], Path: path})
+		return signer(l)
+	}
+	for i, l := range ls {
+		index[l.ID] = i
+		if l.CaseID != caseID {
+			continue
+		}
+		b.Entries = append(b.Entries, l)
+		if err = prove(l); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.Entries) == 0 {
+		return nil, fmt.Errorf("no ledger entries found for case %q", caseID)
+	}
+
+	// the rotations and revocations of the keys of the signers, which may be signed by admins
+	for _, name := range append([]string(nil), names...) {
+		ks, err := db.Keys(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range ks {
+			for _, r := range k.Records {
+				l := ls[index[r.Ledger]]
+				b.KeyRecords = append(b.KeyRecords, r)
+				b.KeyEntries = append(b.KeyEntries, l)
+				if err = prove(l); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if b.Timestamps, err = db.Timestamps(b.Entries); err != nil {
+		return nil, err
+	}
+	if b.Cosigs, err = models.CosignaturesByCheckpoint(db, cp.ID); err != nil {
+		return nil, err
+	}
+	if len(b.Cosigs) == 0 {
+		if b.Witnessed, err = db.witnessed(leaves); err != nil {
+			return nil, err
+		}
+	}
+
+	// every key a signer has held, so that rotated keys still verify old entries
+	sort.Strings(names)
+	for _, name := range names {
+		ids, err := models.IdentitiesByName(db, name)
+		if err != nil {
+			return nil, err
+		}
+		b.Identities = append(b.Identities, ids...)
+	}
+
+	b.Manifest = Manifest{Version: BundleVersion, Case: caseID, CreatedAt: time.Now().UTC(),
+		Entries: len(b.Entries), Identities: len(b.Identities)}
+	return b, b.Seal(key)
+}
+
+// Seal: encode the files of the bundle, record their digests in the manifest and sign it.
+func (b *Bundle) Seal(key *ecdsa.PrivateKey) (err error) {
+	b.files = map[string][]byte{BundleServerKey: b.ServerKey}
+	contents := map[string]interface{}{
+		BundleEntries:    b.Entries,
+		BundleIdentities: b.Identities,
+		BundleProofs:     b.Proofs,
+		BundleCheckpoint: b.Checkpoint,
+		BundleTimestamps: b.Timestamps,
+		BundleCosigs:     b.Cosigs,
+		BundleKeyRecords: b.KeyRecords,
+		BundleKeyEntries: b.KeyEntries,
+	}
+	if b.Witnessed != nil {
+		contents[BundleWitnessed] = b.Witnessed
+	}
+	for name, v := range contents {
+		if b.files[name], err = json.MarshalIndent(v, "", "  "); err != nil {
+			return
+		}
+	}
+	b.Manifest.Files = map[string]string{}
+	for name, data := range b.files {
+		b.Manifest.Files[name] = digest(data)
+	}
+	if b.files[BundleManifest], err = json.MarshalIndent(b.Manifest, "", "  "); err != nil {
+		return
+	}
+	b.Signature, err = cryptopasta.Sign(b.files[BundleManifest], key)
+	b.files[BundleSignature] = b.Signature
+	return
+}
+
+// Write: write the sealed bundle as a zip archive.
+func (b *Bundle) Write(w io.Writer) error {
+	if b.files == nil {
+		return fmt.Errorf("bundle has not been sealed")
+	}
+	zw := zip.NewWriter(w)
+	var names []string
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// a fixed modification time keeps the archive bytes reproducible
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: b.Manifest.CreatedAt})
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(b.files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Bytes: the zip archive of the sealed bundle.
+func (b *Bundle) Bytes() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := b.Write(buf)
+	return buf.Bytes(), err
+}
+
+// ReadBundle: parse a bundle zip archive. The bundle is not verified, call Verify for that.
+func ReadBundle(data []byte) (*Bundle, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{files: map[string][]byte{}}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b.files[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	contents := map[string]interface{}{
+		BundleManifest:   &b.Manifest,
+		BundleEntries:    &b.Entries,
+		BundleIdentities: &b.Identities,
+		BundleProofs:     &b.Proofs,
+		BundleCheckpoint: &b.Checkpoint,
+	}
+	for name, v := range contents {
+		data, ok := b.files[name]
+		if !ok {
+			return nil, fmt.Errorf("bundle is missing %s", name)
+		}
+		if err = json.Unmarshal(data, v); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", name, err)
+		}
+	}
+	// bundles exported by older servers lack the files added since
+	optional := map[string]interface{}{
+		BundleTimestamps: &b.Timestamps,
+		BundleCosigs:     &b.Cosigs,
+		BundleKeyRecords: &b.KeyRecords,
+		BundleKeyEntries: &b.KeyEntries,
+		BundleWitnessed:  &b.Witnessed,
+	}
+	for name, v := range optional {
+		data, ok := b.files[name]
+		if !ok {
+			continue
+		}
+		if err = json.Unmarshal(data, v); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", name, err)
+		}
+	}
+	b.ServerKey = b.files[BundleServerKey]
+	b.Signature = b.files[BundleSignature]
+	return b, nil
+}
+
+// OpenBundle: read and parse a bundle zip archive from a file.
+func OpenBundle(path string) (*Bundle, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ReadBundle(data)
+}
+
+// BundleReport: the outcome of verifying a bundle.
+type BundleReport struct {
+	Case       string
+	Entries    int
+	Signatures int
+	Proofs     int
+	Timestamps int
+	KeyRecords int
+	// Witnessed is the number of entries covered by a checkpoint that witnesses cosigned.
+	Witnessed int
+	ServerKey string
+	Pinned    bool
+	Failures  []string
+}
+
+// OK: true if every check passed.
+func (r *BundleReport) OK() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *BundleReport) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// Verify: check every signature and proof in the bundle without network access.
+// If pinned is not nil the bundle must be signed by that server key,
+// otherwise the key carried in the bundle is trusted and the report says so.
+// Timestamp tokens are checked against tsaCert if it is not nil, otherwise against the certificate they carry.
+func (b *Bundle) Verify(pinned *ecdsa.PublicKey, tsaCert *x509.Certificate) *BundleReport {
+	r := &BundleReport{Case: b.Manifest.Case, Entries: len(b.Entries), ServerKey: crypto.Fingerprint(b.ServerKey)}
+	server, err := crypto.ParseECDSAPublicKey(b.ServerKey)
+	if err != nil {
+		r.fail("could not parse server key: %s", err)
+		return r
+	}
+	if pinned != nil {
+		r.Pinned = true
+		if pinned.X.Cmp(server.X) != 0 || pinned.Y.Cmp(server.Y) != 0 {
+			r.fail("bundle is signed by server key %s, not the pinned key", r.ServerKey)
+			return r
+		}
+	}
+
+	if !crypto.Verify(b.files[BundleManifest], b.Signature, server) {
+		r.fail("manifest signature is invalid")
+	}
+	for name, data := range b.files {
+		if name == BundleManifest || name == BundleSignature {
+			continue
+		}
+		want, ok := b.Manifest.Files[name]
+		switch {
+		case !ok:
+			r.fail("%s is not listed in the manifest", name)
+		case want != digest(data):
+			r.fail("%s does not match its manifest digest", name)
+		}
+	}
+	for name := range b.Manifest.Files {
+		if _, ok := b.files[name]; !ok {
+			r.fail("%s is listed in the manifest but missing", name)
+		}
+	}
+	if b.Manifest.Entries != len(b.Entries) {
+		r.fail("manifest lists %d entries, bundle has %d", b.Manifest.Entries, len(b.Entries))
+	}
+
+	cp := b.Checkpoint
+	if cp == nil {
+		r.fail("bundle has no checkpoint")
+		return r
+	}
+	if !VerifyCheckpoint(cp, server) {
+		r.fail("checkpoint signature is invalid")
+	}
+	if b.Witnessed != nil {
+		if err := b.Witnessed.Verify(cp, server); err != nil {
+			r.fail("%s", err)
+		}
+	}
+	witnessed := 0
+	if cosigned, cosigs := Cosigned(cp, b.Cosigs, b.Witnessed); len(cosigs) > 0 {
+		witnessed = cosigned.Size
+	}
+
+	ids := map[int]*models.Identity{}
+	for _, i := range b.Identities {
+		ids[i.ID] = i
+	}
+	entries := map[int]*models.Ledger{}
+	for _, l := range b.Entries {
+		entries[l.ID] = l
+	}
+	for _, ts := range b.Timestamps {
+		l, ok := entries[ts.Ledger]
+		if !ok {
+			r.fail("timestamp for entry %d which is not in the bundle", ts.Ledger)
+			continue
+		}
+		if _, err := VerifyTimestamp(ts, l, tsaCert); err != nil {
+			r.fail("timestamp of entry %d: %s", l.ID, err)
+			continue
+		}
+		r.Timestamps++
+	}
+	proofs := map[int]Proof{}
+	for _, p := range b.Proofs {
+		proofs[p.Entry] = p
+	}
+	included := func(l *models.Ledger) bool {
+		p, ok := proofs[l.ID]
+		if !ok {
+			r.fail("entry %d has no inclusion proof", l.ID)
+			return false
+		}
+		if !merkle.VerifyInclusion(merkle.LeafHash(LeafData(l)), p.Index, cp.Size, p.Path, cp.Root) {
+			r.fail("entry %d is not included in the checkpoint", l.ID)
+			return false
+		}
+		return true
+	}
+
+	keyEntries := map[int]*models.Ledger{}
+	for _, l := range b.KeyEntries {
+		keyEntries[l.ID] = l
+	}
+	revoked := map[int]int{}
+	for _, kr := range b.KeyRecords {
+		l, ok := keyEntries[kr.Ledger]
+		switch {
+		case !ok:
+			r.fail("the %s record of key %d has no entry", kr.Event, kr.Identity)
+		case ids[kr.Identity] == nil:
+			r.fail("the %s record of entry %d is about unknown key %d", kr.Event, l.ID, kr.Identity)
+		case VerifyEntry(l, ids[l.Identity]) != nil:
+			r.fail("the %s record of key %d: %s", kr.Event, kr.Identity, VerifyEntry(l, ids[l.Identity]))
+		case included(l):
+			r.KeyRecords++
+			if kr.Event == KeyRevoked {
+				revoked[kr.Identity] = l.ID
+			}
+		}
+	}
+
+	for _, l := range b.Entries {
+		if l.CaseID != b.Manifest.Case {
+			r.fail("entry %d belongs to case %q", l.ID, l.CaseID)
+		}
+		if err := VerifyEntry(l, ids[l.Identity]); err != nil {
+			r.fail("entry %d: %s", l.ID, err)
+		} else {
+			r.Signatures++
+		}
+		if at, ok := revoked[l.Identity]; ok && l.ID > at {
+			r.fail("entry %d is signed with key %d after its revocation by entry %d", l.ID, l.Identity, at)
+		}
+		if included(l) {
+			r.Proofs++
+			if proofs[l.ID].Index < witnessed {
+				r.Witnessed++
+			}
+		}
+	}
+	return r
+}
+
+// VerifyEntry: check the signature of a ledger entry, over its EntryStatement, against the identity that signed it.
+func VerifyEntry(l *models.Ledger, ident *models.Identity) error {
+	if ident == nil || ident.ID != l.Identity {
+		return fmt.Errorf("signing identity %d is unknown", l.Identity)
+	}
+	pub, err := ident.Public()
+	if err != nil {
+		return fmt.Errorf("could not parse key of identity %d: %s", ident.ID, err)
+	}
+	if !crypto.Verify(EntryStatement(l.Message, l.CaseID, l.Item), l.Hash, pub) {
+		return fmt.Errorf("signature by %s is invalid", ident.Name)
+	}
+	return nil
+}
+
+// digest: the hex encoded SHA-256 of data.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
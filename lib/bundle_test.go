@@ -0,0 +1,137 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// tempdb: a fresh database in a temporary directory.
+func tempdb(t *testing.T) *DB {
+	dir, err := ioutil.TempDir("", "custody")
+	FailTest(t, err, "could not make tempdir %s")
+	return setupdb(t, filepath.Join(dir, "custody.sqlite"))
+}
+
+// signer: enroll a new user and return their identity and private key.
+func signer(t *testing.T, cdb *DB, name string) (*models.Identity, *ecdsa.PrivateKey) {
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	pubbytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	FailTest(t, err, "failed to encode key %s")
+	i, err := cdb.NewUser(name, pubbytes)
+	FailTest(t, err, "failed to create user %s")
+	return &i, key
+}
+
+// record: sign message with key and append it to the ledger in caseID.
+func record(t *testing.T, cdb *DB, i *models.Identity, key *ecdsa.PrivateKey, caseID, message string) models.Ledger {
+	return recordEntry(t, cdb, i, key, models.Ledger{Message: message, CaseID: caseID})
+}
+
+// recordEntry: sign the message of entry with key and append it to the ledger.
+func recordEntry(t *testing.T, cdb *DB, i *models.Identity, key *ecdsa.PrivateKey, entry models.Ledger) models.Ledger {
+	var err error
+	entry.Hash, err = SignEntry(key, entry.Message, entry.CaseID, entry.Item)
+	FailTest(t, err, "failed to sign %s")
+	l, err := cdb.Append(i, entry)
+	FailTest(t, err, "failed to append %s")
+	return l
+}
+
+func TestExportBundle(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	alice, akey := signer(t, cdb, "alice")
+	bob, bkey := signer(t, cdb, "bob")
+	record(t, cdb, alice, akey, "C1", "seize laptop")
+	record(t, cdb, bob, bkey, "C2", "unrelated case")
+	record(t, cdb, bob, bkey, "C1", "image laptop")
+
+	b, err := cdb.Export(serverkey, "C1")
+	FailTest(t, err, "export failed %s")
+	data, err := b.Bytes()
+	FailTest(t, err, "could not write bundle %s")
+
+	read, err := ReadBundle(data)
+	FailTest(t, err, "could not read bundle %s")
+	r := read.Verify(&serverkey.PublicKey, nil)
+	if !r.OK() || r.Entries != 2 || r.Signatures != 2 || r.Proofs != 2 {
+		t.Fatalf("bundle did not verify: %+v", r)
+	}
+	if read.Checkpoint.Size != 3 {
+		t.Fatalf("checkpoint should cover the whole ledger, got size %d", read.Checkpoint.Size)
+	}
+
+	other, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	if read.Verify(&other.PublicKey, nil).OK() {
+		t.Fatal("bundle verified against the wrong server key")
+	}
+
+	read.Entries[0].Message = "seize phone"
+	if r = read.Verify(nil, nil); r.OK() {
+		t.Fatal("tampered entry verified")
+	}
+
+	// truncated signatures are reported, not panicked on
+	read, err = ReadBundle(data)
+	FailTest(t, err, "could not read bundle %s")
+	read.Entries[0].Hash = read.Entries[0].Hash[:10]
+	if r = read.Verify(nil, nil); r.OK() {
+		t.Fatal("a truncated entry signature verified")
+	}
+	read.Signature = nil
+	if r = read.Verify(nil, nil); r.OK() {
+		t.Fatal("a bundle without a manifest signature verified")
+	}
+
+	if _, err = cdb.Export(serverkey, "missing"); err == nil {
+		t.Fatal("exported a case with no entries")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	l := record(t, cdb, alice, akey, "C1", "seize laptop")
+
+	replay := models.Ledger{Message: l.Message, Hash: l.Hash, CaseID: l.CaseID}
+	if _, err := cdb.Append(alice, replay); err == nil {
+		t.Fatal("a signature was appended twice")
+	}
+	replay.Hash = crypto.Twin(l.Hash)
+	if _, err := cdb.Append(alice, replay); err == nil {
+		t.Fatal("the malleated twin of a signature was appended")
+	}
+
+	// concurrent appends of one signature check for it in their transaction, only one can pass
+	second := models.Ledger{Message: "image laptop", CaseID: "C1"}
+	var err error
+	second.Hash, err = SignEntry(akey, second.Message, second.CaseID, "")
+	FailTest(t, err, "failed to sign %s")
+	var wg sync.WaitGroup
+	var appended int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cdb.Append(alice, second); err == nil {
+				atomic.AddInt32(&appended, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if appended != 1 {
+		t.Fatalf("a signature was appended by %d concurrent requests", appended)
+	}
+}
@@ -0,0 +1,208 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// LoadServerKey: read the server signing key from path, generating it on first use.
+// The public half is written next to it as path.pub so it can be handed to verifiers.
+func LoadServerKey(path string) (*ecdsa.PrivateKey, error) {
+	keybytes, err := ioutil.ReadFile(path)
+	if err == nil {
+		return x509.ParseECPrivateKey(keybytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	log.Printf("generating new server key at %s", path)
+	key, err := cryptopasta.NewSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	privbytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(path, privbytes, 0600); err != nil {
+		return nil, err
+	}
+	pubbytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(path+".pub", pubbytes, 0644); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LeafData: the canonical encoding of a ledger entry that is committed to by the Merkle tree.
+// Timestamps are truncated to seconds so that the encoding survives a round trip through the database.
+// The import marker is only encoded when it is set, so entries signed at the time keep their leaf hashes.
+func LeafData(l *models.Ledger) []byte {
+	data := fmt.Sprintf("%d\n%d\n%d\n%s\n%s\n%s\n%s\n",
+		l.ID, l.CreatedAt.Unix(), l.Identity,
+		crypto.EncodeBinary([]byte(l.CaseID)),
+		crypto.EncodeBinary([]byte(l.Item)),
+		crypto.EncodeBinary([]byte(l.Message)),
+		crypto.EncodeBinary(l.Hash))
+	if l.Imported != "" {
+		data += fmt.Sprintf("imported\n%s\n", crypto.EncodeBinary([]byte(l.Imported)))
+	}
+	return []byte(data)
+}
+
+// Leaves: the Merkle leaf hashes of a list of ledger entries.
+func Leaves(ls []*models.Ledger) [][]byte {
+	leaves := make([][]byte, len(ls))
+	for i, l := range ls {
+		leaves[i] = merkle.LeafHash(LeafData(l))
+	}
+	return leaves
+}
+
+// The frontier of the ledger tree after every entry is kept in tree_frontiers, so that the root of the
+// tree and the inclusion proof of an entry in the tree it ends can be found without reading the whole ledger.
+
+// frontier: the frontier of the ledger tree that ends with the entry id, or of the empty tree if id is 0.
+// The frontiers of a ledger written before they were kept are computed on first use.
+func (db *DB) frontier(id int) (*merkle.Frontier, error) {
+	if id == 0 {
+		return &merkle.Frontier{}, nil
+	}
+	tf, err := models.TreeFrontierByLedger(db, id)
+	if err == sql.ErrNoRows {
+		if err = db.rebuildFrontiers(id); err != nil {
+			return nil, err
+		}
+		tf, err = models.TreeFrontierByLedger(db, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &merkle.Frontier{Size: tf.Size}
+	for n := tf.Nodes; len(n) >= sha256.Size; n = n[sha256.Size:] {
+		f.Nodes = append(f.Nodes, n[:sha256.Size])
+	}
+	return f, nil
+}
+
+// saveFrontier: record f as the frontier of the ledger tree that ends with the entry id.
+func (db *DB) saveFrontier(id int, f *merkle.Frontier) error {
+	tf := &models.TreeFrontier{Ledger: id, Size: f.Size, Nodes: bytes.Join(f.Nodes, nil)}
+	return tf.Insert(db)
+}
+
+// previousEntry: the id of the ledger entry before the entry id, 0 if it is the first.
+func (db *DB) previousEntry(id int) (prev int, err error) {
+	err = db.QueryRow(`select coalesce(max(id), 0) from ledger where id < ?`, id).Scan(&prev)
+	return
+}
+
+// extendTree: record the frontier of the ledger tree that ends with l, the entry just appended.
+func (db *DB) extendTree(l *models.Ledger) error {
+	prev, err := db.previousEntry(l.ID)
+	if err != nil {
+		return err
+	}
+	f, err := db.frontier(prev)
+	if err != nil {
+		return err
+	}
+	f.Append(merkle.LeafHash(LeafData(l)))
+	return db.saveFrontier(l.ID, f)
+}
+
+// rebuildFrontiers: compute the frontier after every entry of the ledger up to the entry through
+// from the entries themselves.
+func (db *DB) rebuildFrontiers(through int) error {
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return err
+	}
+	if _, err = db.Exec(`delete from tree_frontiers`); err != nil {
+		return err
+	}
+	f := &merkle.Frontier{}
+	for _, l := range ls {
+		if l.ID > through {
+			break
+		}
+		f.Append(merkle.LeafHash(LeafData(l)))
+		if err = db.saveFrontier(l.ID, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckpointStatement: the bytes signed by the server for a checkpoint.
+func CheckpointStatement(cp *models.Checkpoint) []byte {
+	return []byte(fmt.Sprintf("custody checkpoint v1\n%d\n%s\n%d\n",
+		cp.Size, crypto.EncodeBinary(cp.Root), cp.CreatedAt.Unix()))
+}
+
+// VerifyCheckpoint: check the server signature on a checkpoint.
+func VerifyCheckpoint(cp *models.Checkpoint, key *ecdsa.PublicKey) bool {
+	return crypto.Verify(CheckpointStatement(cp), cp.Signature, key)
+}
+
+// Checkpoint: sign the Merkle root of the whole ledger with the server key and store it.
+// If the ledger has not grown since the last checkpoint, the last checkpoint is returned.
+func (db *DB) Checkpoint(key *ecdsa.PrivateKey) (*models.Checkpoint, error) {
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	return db.checkpoint(key, ls)
+}
+
+// recentCheckpoint: the latest checkpoint if it was signed less than interval ago, else the checkpoint of ls.
+// It keeps callers that need no particular size from making the server sign a checkpoint on every request.
+func (db *DB) recentCheckpoint(key *ecdsa.PrivateKey, ls []*models.Ledger, interval time.Duration) (*models.Checkpoint, error) {
+	last, err := models.LatestCheckpoint(db)
+	switch {
+	case err == nil && last.Size <= len(ls) && time.Since(last.CreatedAt.Time) < interval:
+		return last, nil
+	case err != nil && err != sql.ErrNoRows:
+		return nil, err
+	}
+	return db.checkpoint(key, ls)
+}
+
+// checkpoint: sign the Merkle root of ls, which must be the whole ledger in id order.
+func (db *DB) checkpoint(key *ecdsa.PrivateKey, ls []*models.Ledger) (*models.Checkpoint, error) {
+	if key == nil {
+		return nil, fmt.Errorf("the server has no signing key")
+	}
+	last, err := models.LatestCheckpoint(db)
+	switch {
+	case err == nil && last.Size == len(ls):
+		return last, nil
+	case err != nil && err != sql.ErrNoRows:
+		return nil, err
+	}
+	cp := &models.Checkpoint{CreatedAt: XONow(), Size: len(ls), Root: merkle.Root(Leaves(ls))}
+	cp.Signature, err = cryptopasta.Sign(CheckpointStatement(cp), key)
+	if err != nil {
+		return nil, err
+	}
+	if err = cp.Insert(db); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
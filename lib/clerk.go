@@ -1,10 +1,18 @@
 package custody
 
 import (
+	"crypto/ecdsa"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
 	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+	"github.gatech.edu/NIJ-Grant/custody/tsa"
 )
 
 // NetConfig: a struct to hold network configuration information
@@ -21,51 +29,1026 @@ func NewNetConfig() NetConfig {
 // Clerk: a struct to represent the global state of the custody application.
 // The clerk is used to register functions for RPC.
 // each method of the Clerk is accessible through the server using an RPC client.
+// Key is the server signing key used for checkpoints, it may be nil if the server does not sign.
+// Stamper is the RFC 3161 time stamping authority for new entries, it may be nil if entries are not timestamped.
+// Store is the evidence store that disposed items are deleted from, it may be nil if the server has none.
 type Clerk struct {
-	DB DB
+	DB      DB
+	Key     *ecdsa.PrivateKey
+	Stamper tsa.Stamper
+	Store   *store.Store
 	NetConfig
+	// Witnesses: the keys of the witnesses whose cosignatures the clerk stores.
+	Witnesses []*ecdsa.PublicKey
+	// CheckpointInterval: how often Consistency signs a new checkpoint at most.
+	CheckpointInterval time.Duration
+
+	stamping sync.Once
+	stamps   chan struct{} // asks the stamping goroutine to run
 }
 
 // NewClerk: create a new Clerk with default configuration
 func NewClerk() *Clerk {
-	return &Clerk{NetConfig: NewNetConfig()}
+	return &Clerk{NetConfig: NewNetConfig(), CheckpointInterval: DefaultCheckpointInterval}
 }
 
-// Create: ask the clerk to create a user
+// Create: ask the clerk to create a user.
+// Anyone can enroll a new name, but it has no role until an admin grants one.
+// The first user ever enrolled becomes the admin. The name of the server cannot be enrolled.
+// A name that is taken can only enroll a new key as a rotation: req.Data must be the KeyRotationMessage of the key
+// and req.Hash its signature by the current key of the user.
 func (c *Clerk) Create(req *RecordRequest, reply *models.Identity) (err error) {
 	if req.PublicKey == nil {
-		err = fmt.Errorf("you must provide an x509 ECDSA public key with a user creation request")
+		return fmt.Errorf("you must provide an x509 ECDSA public key with a user creation request")
+	}
+	if req.Name == SystemName {
+		return c.DB.Deny(req.Name, "Clerk.Create", req.Name, "the name is reserved for the server")
+	}
+	ids, err := models.AllIdentities(c.DB)
+	if err != nil {
+		return
+	}
+	users := 0
+	for _, id := range ids {
+		if id.Name == req.Name {
+			return c.rotate(req, reply)
+		}
+		if id.Name != SystemName {
+			users++
+		}
 	}
 	i, err := c.DB.NewUser(req.Name, req.PublicKey)
 	if err != nil {
 		return
 	}
+	if users == 0 {
+		if _, err = c.DB.Grant(&i, i.Name, RoleAdmin); err != nil {
+			return
+		}
+		log.Printf("%s is the first user and the admin", i.Name)
+	}
 	*reply = i
 	return
 }
 
-// Validate: ask the clerk to validate a message
-func (c *Clerk) Validate(req *RecordRequest, reply *models.Ledger) (err error) {
-	var ids []*models.Identity
+// rotate: enroll req.PublicKey as the next key of the enrolled user req.Name, signed by their current key.
+func (c *Clerk) rotate(req *RecordRequest, reply *models.Identity) error {
+	if req.Hash == nil {
+		return c.DB.Deny(req.Name, "Clerk.Create", req.Name, "the name is already enrolled, a new key must be signed by the current key")
+	}
+	current, err := c.identity(req.Name)
+	if err != nil {
+		return err
+	}
+	i, err := c.DB.Rotate(current, req.PublicKey, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s rotated key %d to key %d", i.Name, current.ID, i.ID)
+	c.Stamp()
+	*reply = i
+	return nil
+}
+
+// RequestWindow: how far the time of an authenticated request may be from the clock of the server.
+var RequestWindow = 5 * time.Minute
+
+// caller: the identity and role of the user who sent a request for method, authenticated by req.Auth.
+func (c *Clerk) caller(method string, req *RecordRequest) (*models.Identity, string, error) {
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return nil, "", c.DB.Deny(req.Name, method, "", "unknown user")
+	}
+	pub, err := i.Public()
+	if err != nil {
+		return nil, "", err
+	}
+	age := time.Since(time.Unix(req.Time, 0))
+	if age > RequestWindow || age < -RequestWindow {
+		return nil, "", c.DB.Deny(req.Name, method, "", "the request is not signed or has expired")
+	}
+	if !crypto.Verify(RequestStatement(method, req), req.Auth, pub) {
+		return nil, "", c.DB.Deny(req.Name, method, "", "the request signature is invalid")
+	}
+	revoked, err := c.DB.Revoked(i)
+	if err != nil {
+		return nil, "", err
+	}
+	if revoked {
+		return nil, "", c.DB.Deny(req.Name, method, "", "the key of the user is revoked")
+	}
+	role, err := c.DB.RoleOf(i.Name)
+	return i, role, err
+}
+
+// permit: check that role has permission p, recording a denial if it does not.
+func (c *Clerk) permit(name, role string, p Permission, method, target string) error {
+	if Can(role, p) {
+		return nil
+	}
+	if role == "" {
+		role = "no role"
+	}
+	return c.DB.Deny(name, method, target, fmt.Sprintf("%s does not have the %s permission", role, p))
+}
+
+// permitRead: check that the user may read the case, recording a denial if they may not.
+func (c *Clerk) permitRead(name, role, method, caseID string) error {
+	ok, err := c.DB.CanRead(name, role, caseID)
+	if err != nil || ok {
+		return err
+	}
+	return c.DB.Deny(name, method, caseTarget(caseID), "the user is not a member of the case")
+}
+
+// identity: the current identity of a user, which is the most recently created one.
+func (c *Clerk) identity(name string) (*models.Identity, error) {
+	log.Printf("clerk is accessing identities of user: %v", name)
+	ids, err := models.IdentitiesByName(c.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) < 1 {
+		return nil, fmt.Errorf("no identities found with username:%s", name)
+	}
+	return ids[len(ids)-1], nil
+}
+
+// Validate: ask the clerk to validate a message.
+// The reply is a receipt for the new entry signed by the server, if the server has a key.
+// An entry refused for good gets an error starting with RefusedPrefix, so that queued entries are not sent again.
+func (c *Clerk) Validate(req *RecordRequest, reply *Receipt) (err error) {
+	defer func() { err = refusal(err) }()
 	var ledg models.Ledger
-	log.Printf("clerk is accessing identities of user: %v", req.Name)
-	ids, err = models.IdentitiesByName(c.DB, req.Name)
-	if err != nil || len(ids) < 1 {
-		err = fmt.Errorf("no identities found with username:%s, err:%s", req.Name, err)
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return
+	}
+	// the signature checked by Append authenticates the request
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
 		return
 	}
-	i := ids[len(ids)-1]
-	ledg, err = c.DB.Operate(i, string(req.Data), req.Hash)
+	if err = c.permit(i.Name, role, PermSign, "Clerk.Validate", caseTarget(req.Case)); err != nil {
+		return
+	}
+	if IsProposal(string(req.Data)) {
+		return fmt.Errorf("the entry states an approval requirement, it can only be appended once it is approved")
+	}
+	if IsStateMessage(string(req.Data)) {
+		return fmt.Errorf("the entry moves an item, use custody item move")
+	}
+	// a typed entry is appended with its fields or not at all
+	err = c.DB.atomic(func(tdb *DB) error {
+		entryType, fields, err := tdb.CheckPayload(string(req.Data))
+		if err != nil {
+			return err
+		}
+		ledg, err = tdb.Append(i, models.Ledger{Message: string(req.Data), Hash: req.Hash, CaseID: req.Case, Item: req.Item})
+		if err != nil {
+			return err
+		}
+		return tdb.RecordFields(ledg, entryType, fields)
+	})
+	if err != nil {
+		return
+	}
+	violations, err := c.DB.Violations(ledg.ID)
 	if err != nil {
 		return
 	}
-	*reply = ledg
+	c.Stamp()
+	if c.Key == nil {
+		*reply = Receipt{Entry: ledg, Violations: violations}
+		return
+	}
+	rc, err := c.DB.Receipt(c.Key, ledg.ID)
+	if err != nil {
+		return
+	}
+	*reply = *rc
+	reply.Violations = violations
 	return
 }
 
-// List: ask the clerk to list the ledger entries associated with an identity
+// Stamp: have every entry that does not have a token yet timestamped, without waiting for the authority.
+// Entries are stamped by one goroutine of the clerk, started on the first call, so that a slow authority does not
+// hold up requests and two requests do not stamp the same entry. A failure to reach the authority does not reject
+// the entry, it is stamped on a later attempt.
+func (c *Clerk) Stamp() {
+	if c.Stamper == nil {
+		return
+	}
+	c.stamping.Do(func() {
+		c.stamps = make(chan struct{}, 1)
+		go c.stampPending()
+	})
+	select {
+	case c.stamps <- struct{}{}:
+	default:
+		// a run is already due, it stamps this entry too
+	}
+}
+
+// stampPending: timestamp the entries without a token whenever Stamp asks for it.
+func (c *Clerk) stampPending() {
+	for range c.stamps {
+		n, err := c.DB.StampPending(c.Stamper)
+		if n > 0 {
+			log.Printf("timestamped %d ledger entries", n)
+		}
+		if err != nil {
+			log.Printf("timestamping failed: %s", err)
+		}
+	}
+}
+
+// List: ask the clerk to list the ledger entries associated with an identity.
+// Users can only list their own entries. With req.State only the entries about items now in that state are listed.
 func (c *Clerk) List(req *RecordRequest, reply *[]*models.Ledger) (err error) {
+	if _, _, err = c.caller("Clerk.List", req); err != nil {
+		return
+	}
 	ls, err := models.LedgersByName(c.DB, req.Name)
-	*reply = ls
+	if err != nil || req.State == "" {
+		*reply = ls
+		return
+	}
+	ss, err := c.DB.ItemStates("", req.State)
+	if err != nil {
+		return
+	}
+	in := map[string]bool{}
+	for _, s := range ss {
+		in[s.Item] = true
+	}
+	*reply = []*models.Ledger{}
+	for _, l := range ls {
+		if in[l.Item] {
+			*reply = append(*reply, l)
+		}
+	}
+	return
+}
+
+// Timestamps: ask the clerk for the timestamp tokens of the ledger entries associated with an identity.
+func (c *Clerk) Timestamps(req *RecordRequest, reply *[]*models.Timestamp) (err error) {
+	if _, _, err = c.caller("Clerk.Timestamps", req); err != nil {
+		return
+	}
+	ls, err := models.LedgersByName(c.DB, req.Name)
+	if err != nil {
+		return
+	}
+	*reply, err = c.DB.Timestamps(ls)
+	return
+}
+
+// ReceiptProof: ask the clerk for the current state of the entry req.Entry,
+// with a consistency proof from the ledger of size req.Size to a fresh checkpoint.
+// Users can check their own entries and the entries of the cases they can read.
+func (c *Clerk) ReceiptProof(req *RecordRequest, reply *ReceiptProof) (err error) {
+	i, role, err := c.caller("Clerk.ReceiptProof", req)
+	if err != nil {
+		return
+	}
+	p, err := c.DB.ReceiptProof(c.Key, req.Entry, req.Size)
+	if err != nil {
+		return
+	}
+	if p.Entry != nil {
+		signer, err := models.IdentityByID(c.DB, p.Entry.Identity)
+		if err != nil {
+			return err
+		}
+		if signer.Name != i.Name {
+			if err = c.permitRead(i.Name, role, "Clerk.ReceiptProof", p.Entry.CaseID); err != nil {
+				return err
+			}
+		}
+	}
+	*reply = *p
+	return
+}
+
+// DefaultCheckpointInterval: how often Consistency signs a new checkpoint at most, unless the clerk says otherwise.
+const DefaultCheckpointInterval = time.Minute
+
+// Consistency: ask the clerk for a recent checkpoint and the proof that it extends the ledger of req.Size entries.
+// Witnesses use it to follow the server. Anyone may ask, so a new checkpoint is signed at most every CheckpointInterval.
+func (c *Clerk) Consistency(req *RecordRequest, reply *ConsistencyProof) (err error) {
+	p, err := c.DB.ConsistencyProof(c.Key, req.Size, c.CheckpointInterval)
+	if err != nil {
+		return
+	}
+	*reply = *p
+	return
+}
+
+// Cosign: hand the clerk a witness cosignature, req.Hash signs req.Checkpoint with the witness key req.PublicKey.
+// Only the cosignatures of the Witnesses of the clerk are stored.
+func (c *Clerk) Cosign(req *RecordRequest, reply *models.Cosignature) (err error) {
+	if !KnownWitness(req.PublicKey, c.Witnesses) {
+		return fmt.Errorf("witness %s is not known to the server", crypto.Fingerprint(req.PublicKey))
+	}
+	cs := models.Cosignature{Checkpoint: req.Checkpoint, Witness: req.PublicKey, Signature: req.Hash}
+	if err = c.DB.AddCosignature(&cs); err != nil {
+		return
+	}
+	log.Printf("checkpoint %d cosigned by witness %s", cs.Checkpoint, crypto.Fingerprint(cs.Witness))
+	*reply = cs
+	return
+}
+
+// Export: ask the clerk for an evidence bundle of every ledger entry in a case.
+// The reply is the bundle as a zip archive that can be verified offline with ReadBundle.
+func (c *Clerk) Export(req *RecordRequest, reply *[]byte) (err error) {
+	i, role, err := c.caller("Clerk.Export", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermExport, "Clerk.Export", caseTarget(req.Case)); err != nil {
+		return
+	}
+	if err = c.permitRead(i.Name, role, "Clerk.Export", req.Case); err != nil {
+		return
+	}
+	b, err := c.DB.Export(c.Key, req.Case)
+	if err != nil {
+		return
+	}
+	*reply, err = b.Bytes()
+	return
+}
+
+// CreateItem: ask the clerk to register an evidence item.
+// Data must be the ItemMessage for the item signed by the user,
+// or its HashListMessage if the request carries the hash list of the item contents.
+func (c *Clerk) CreateItem(req *RecordRequest, reply *models.Item) (err error) {
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return
+	}
+	// the signature checked by NewItem authenticates the request
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermRegisterItem, "Clerk.CreateItem", "item "+req.Item); err != nil {
+		return
+	}
+	item := models.Item{Tag: req.Item, CaseID: req.Case, Description: req.Description, Digest: req.Digest}
+	item, err = c.DB.NewItem(i, item, models.Ledger{Message: string(req.Data), Hash: req.Hash}, req.HashList)
+	if err != nil {
+		return
+	}
+	c.Stamp()
+	*reply = item
+	return
+}
+
+// Upload: ask the clerk to register an uploaded file as an evidence item.
+// Data must be the UploadMessage for the item signed by the user, Digest the SHA-256 of the file.
+func (c *Clerk) Upload(req *RecordRequest, reply *models.Item) (err error) {
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return
+	}
+	// the signature checked by UploadItem authenticates the request
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermRegisterItem, "Clerk.Upload", "item "+req.Item); err != nil {
+		return
+	}
+	item := models.Item{Tag: req.Item, CaseID: req.Case, Description: req.Description, Digest: req.Digest}
+	item, err = c.DB.UploadItem(i, item, models.Ledger{Message: string(req.Data), Hash: req.Hash}, req.HashList)
+	if err != nil {
+		return
+	}
+	c.Stamp()
+	*reply = item
+	return
+}
+
+// Ingest: ask the clerk to register a forensic image as an evidence item.
+// Data must be the IngestMessage for the item signed by the user, Digest the SHA-256 of the media
+// and Ingest the metadata and hash checks the user found in the image.
+func (c *Clerk) Ingest(req *RecordRequest, reply *models.Item) (err error) {
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return
+	}
+	// the signature checked by IngestItem authenticates the request
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermRegisterItem, "Clerk.Ingest", "item "+req.Item); err != nil {
+		return
+	}
+	if req.Ingest == nil {
+		return fmt.Errorf("no image metadata for item %s", req.Item)
+	}
+	item := models.Item{Tag: req.Item, CaseID: req.Case, Description: req.Description, Digest: req.Digest}
+	item, err = c.DB.IngestItem(i, item, models.Ledger{Message: string(req.Data), Hash: req.Hash}, req.Ingest, req.HashList)
+	if err != nil {
+		return
+	}
+	c.Stamp()
+	*reply = item
+	return
+}
+
+// Import: ask the clerk to append legacy records as imported entries signed by the user req.Name.
+// With req.DryRun the records are only checked, and the reply lists the problems found per row.
+// Only admins can import, their signatures on the records authenticate the request.
+func (c *Clerk) Import(req *RecordRequest, reply *ImportResult) (err error) {
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return
+	}
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermImport, "Clerk.Import", ""); err != nil {
+		return
+	}
+	res, err := c.DB.Import(i, req.Records, req.DryRun)
+	if err != nil {
+		return
+	}
+	if res.Imported > 0 {
+		log.Printf("imported %d legacy records signed by %s", res.Imported, i.Name)
+		c.Stamp()
+	}
+	*reply = *res
+	return
+}
+
+// ItemHashes: ask the clerk for the piecewise hash list of an evidence item, to check a copy of it.
+// The user must be able to read the case of the item.
+func (c *Clerk) ItemHashes(req *RecordRequest, reply *ItemHashes) (err error) {
+	i, role, err := c.caller("Clerk.ItemHashes", req)
+	if err != nil {
+		return
+	}
+	h, err := c.DB.ItemHashes(req.Item)
+	if err != nil {
+		return
+	}
+	if err = c.permitRead(i.Name, role, "Clerk.ItemHashes", h.Item.CaseID); err != nil {
+		return
+	}
+	*reply = *h
+	return
+}
+
+// Report: ask the clerk for the chain of custody of an evidence item.
+// The user must be able to read the case of the item.
+func (c *Clerk) Report(req *RecordRequest, reply *ItemReport) (err error) {
+	i, role, err := c.caller("Clerk.Report", req)
+	if err != nil {
+		return
+	}
+	r, err := c.DB.ItemReport(c.Key, req.Item)
+	if err != nil {
+		return
+	}
+	if err = c.permitRead(i.Name, role, "Clerk.Report", r.Item.CaseID); err != nil {
+		return
+	}
+	*reply = *r
+	return
+}
+
+// Move: ask the clerk to move the item req.Item to the state req.State, req.Description is the note of the move.
+// Data must be the StateMessage signed by the user.
+func (c *Clerk) Move(req *RecordRequest, reply *models.ItemState) (err error) {
+	// the signature checked by Move authenticates the request
+	i, err := c.signer(req, PermSign, "Clerk.Move", "item "+req.Item)
+	if err != nil {
+		return
+	}
+	s, err := c.DB.Move(i, req.Item, req.State, req.Description, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	log.Printf("%s moved item %s to %s", i.Name, s.Item, s.State)
+	c.Stamp()
+	*reply = *s
+	return
+}
+
+// ItemStatus: ask the clerk for the lifecycle state of the item req.Item and the entries that moved it.
+// The user must be able to read the case of the item.
+func (c *Clerk) ItemStatus(req *RecordRequest, reply *ItemStatus) (err error) {
+	i, role, err := c.caller("Clerk.ItemStatus", req)
+	if err != nil {
+		return
+	}
+	st, err := c.DB.ItemStatus(req.Item)
+	if err != nil {
+		return
+	}
+	if err = c.permitRead(i.Name, role, "Clerk.ItemStatus", st.Item.CaseID); err != nil {
+		return
+	}
+	*reply = *st
+	return
+}
+
+// ItemStates: ask the clerk for the states of the items of req.Case in the state req.State, any state if empty.
+// Without a case it lists every item, for users who read every case.
+func (c *Clerk) ItemStates(req *RecordRequest, reply *[]*models.ItemState) (err error) {
+	i, role, err := c.caller("Clerk.ItemStates", req)
+	if err != nil {
+		return
+	}
+	if req.Case != "" {
+		err = c.permitRead(i.Name, role, "Clerk.ItemStates", req.Case)
+	} else {
+		err = c.permit(i.Name, role, PermReadAll, "Clerk.ItemStates", "")
+	}
+	if err != nil {
+		return
+	}
+	*reply, err = c.DB.ItemStates(req.Case, req.State)
+	return
+}
+
+// Grant: ask the clerk to give the user req.Subject the role req.Role. Only admins can grant roles.
+func (c *Clerk) Grant(req *RecordRequest, reply *models.Role) (err error) {
+	i, role, err := c.caller("Clerk.Grant", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermManageUsers, "Clerk.Grant", req.Subject); err != nil {
+		return
+	}
+	if _, err = c.identity(req.Subject); err != nil {
+		return
+	}
+	r, err := c.DB.Grant(i, req.Subject, req.Role)
+	if err != nil {
+		return
+	}
+	log.Printf("%s granted %s the role %s", i.Name, r.Name, r.Role)
+	*reply = *r
+	return
+}
+
+// AddMember: ask the clerk to give the user req.Subject access to the case req.Case. Only admins can add members.
+func (c *Clerk) AddMember(req *RecordRequest, reply *models.CaseMember) (err error) {
+	i, role, err := c.caller("Clerk.AddMember", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermManageUsers, "Clerk.AddMember", caseTarget(req.Case)); err != nil {
+		return
+	}
+	if _, err = c.identity(req.Subject); err != nil {
+		return
+	}
+	m, err := c.DB.AddMember(i, req.Case, req.Subject)
+	if err != nil {
+		return
+	}
+	log.Printf("%s made %s a member of case %s", i.Name, m.Name, m.CaseID)
+	*reply = *m
+	return
+}
+
+// RemoveMember: ask the clerk to take away the access of the user req.Subject to the case req.Case.
+// Only admins can remove members.
+func (c *Clerk) RemoveMember(req *RecordRequest, reply *models.CaseMember) (err error) {
+	i, role, err := c.caller("Clerk.RemoveMember", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermManageUsers, "Clerk.RemoveMember", caseTarget(req.Case)); err != nil {
+		return
+	}
+	m, err := c.DB.RemoveMember(req.Case, req.Subject)
+	if err != nil {
+		return
+	}
+	log.Printf("%s removed %s from case %s", i.Name, m.Name, m.CaseID)
+	*reply = *m
+	return
+}
+
+// Revoke: ask the clerk to revoke the current key of the user req.Subject, or of req.Name if empty,
+// for the reason req.Description. Data must be the RevocationMessage signed by the user.
+// Users can revoke their own key, only admins can revoke the keys of others.
+func (c *Clerk) Revoke(req *RecordRequest, reply *models.KeyRecord) (err error) {
+	// the signature checked by Revoke authenticates the request
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return
+	}
+	subject := req.Subject
+	if subject == "" {
+		subject = i.Name
+	}
+	if subject != i.Name {
+		role, err := c.DB.RoleOf(i.Name)
+		if err != nil {
+			return err
+		}
+		if err = c.permit(i.Name, role, PermManageUsers, "Clerk.Revoke", subject); err != nil {
+			return err
+		}
+	}
+	target, err := c.identity(subject)
+	if err != nil {
+		return
+	}
+	r, err := c.DB.Revoke(i, target, req.Description, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	log.Printf("%s revoked key %d of %s", i.Name, target.ID, subject)
+	c.Stamp()
+	*reply = *r
+	return
+}
+
+// Keys: ask the clerk for every key the user req.Subject, or req.Name if empty, has held and their records.
+// Users can list their own keys, only admins can list the keys of others.
+func (c *Clerk) Keys(req *RecordRequest, reply *[]*KeyStatus) (err error) {
+	i, role, err := c.caller("Clerk.Keys", req)
+	if err != nil {
+		return
+	}
+	subject := req.Subject
+	if subject == "" {
+		subject = i.Name
+	}
+	if subject != i.Name {
+		if err = c.permit(i.Name, role, PermManageUsers, "Clerk.Keys", subject); err != nil {
+			return
+		}
+	}
+	*reply, err = c.DB.Keys(subject)
+	return
+}
+
+// Denials: ask the clerk for the log of denied requests. Only auditors and admins can read it.
+func (c *Clerk) Denials(req *RecordRequest, reply *[]*models.Denial) (err error) {
+	i, role, err := c.caller("Clerk.Denials", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermAudit, "Clerk.Denials", ""); err != nil {
+		return
+	}
+	*reply, err = models.AllDenials(c.DB)
+	return
+}
+
+// PolicyViolations: ask the clerk for the entries appended in audit mode that break the policy.
+// Only auditors and admins can read them.
+func (c *Clerk) PolicyViolations(req *RecordRequest, reply *[]*models.PolicyViolation) (err error) {
+	i, role, err := c.caller("Clerk.PolicyViolations", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermAudit, "Clerk.PolicyViolations", ""); err != nil {
+		return
+	}
+	*reply, err = models.AllPolicyViolations(c.DB)
+	return
+}
+
+// signer: the identity and role of the user whose signed message authenticates a request for method,
+// checked to have permission p on target.
+func (c *Clerk) signer(req *RecordRequest, p Permission, method, target string) (*models.Identity, error) {
+	i, err := c.identity(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
+		return nil, err
+	}
+	return i, c.permit(i.Name, role, p, method, target)
+}
+
+// SetRetention: ask the clerk to set the retention period of req.Case or req.Item to req.Days,
+// req.Description names the statute or rule. Data must be the RetentionMessage signed by the user.
+func (c *Clerk) SetRetention(req *RecordRequest, reply *models.Retention) (err error) {
+	// the signature checked by SetRetention authenticates the request
+	i, err := c.signer(req, PermRetain, "Clerk.SetRetention", scope(req.Case, req.Item))
+	if err != nil {
+		return
+	}
+	r := models.Retention{CaseID: req.Case, Item: req.Item, Days: req.Days, Basis: req.Description}
+	p, err := c.DB.SetRetention(i, r, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	c.Stamp()
+	*reply = *p
+	return
+}
+
+// PlaceHold: ask the clerk to place a legal hold on req.Case or req.Item for the reason req.Description.
+// Data must be the HoldMessage with the nonce req.Nonce signed by the user.
+func (c *Clerk) PlaceHold(req *RecordRequest, reply *models.Hold) (err error) {
+	// the signature checked by PlaceHold authenticates the request
+	i, err := c.signer(req, PermHold, "Clerk.PlaceHold", scope(req.Case, req.Item))
+	if err != nil {
+		return
+	}
+	h := models.Hold{CaseID: req.Case, Item: req.Item, Reason: req.Description}
+	p, err := c.DB.PlaceHold(i, h, req.Nonce, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	log.Printf("%s placed legal hold %d on %s", i.Name, p.ID, scope(p.CaseID, p.Item))
+	c.Stamp()
+	*reply = *p
+	return
+}
+
+// ReleaseHold: ask the clerk to release the legal hold req.Hold for the reason req.Description.
+// Data must be the ReleaseMessage signed by the user.
+func (c *Clerk) ReleaseHold(req *RecordRequest, reply *models.Hold) (err error) {
+	// the signature checked by ReleaseHold authenticates the request
+	i, err := c.signer(req, PermHold, "Clerk.ReleaseHold", fmt.Sprintf("legal hold %d", req.Hold))
+	if err != nil {
+		return
+	}
+	h, err := c.DB.ReleaseHold(i, req.Hold, req.Description, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	log.Printf("%s released legal hold %d", i.Name, h.ID)
+	c.Stamp()
+	*reply = *h
+	return
+}
+
+// Holds: ask the clerk for the legal holds on req.Case or req.Item.
+// The user must be able to read the case, and without either only users who read every case get every hold.
+func (c *Clerk) Holds(req *RecordRequest, reply *[]*models.Hold) (err error) {
+	i, role, err := c.caller("Clerk.Holds", req)
+	if err != nil {
+		return
+	}
+	caseID := req.Case
+	if req.Item != "" {
+		item, err := models.ItemByTag(c.DB, req.Item)
+		if err != nil {
+			return fmt.Errorf("no item %s", req.Item)
+		}
+		caseID = item.CaseID
+	}
+	if caseID == "" {
+		err = c.permit(i.Name, role, PermReadAll, "Clerk.Holds", "")
+	} else {
+		err = c.permitRead(i.Name, role, "Clerk.Holds", caseID)
+	}
+	if err != nil {
+		return
+	}
+	*reply, err = c.DB.Holds(req.Case, req.Item)
+	return
+}
+
+// Disposals: ask the clerk for the retention status of req.Item, or of every item that has not been disposed of.
+// Only users who read every case get every item.
+func (c *Clerk) Disposals(req *RecordRequest, reply *[]*Disposal) (err error) {
+	i, role, err := c.caller("Clerk.Disposals", req)
+	if err != nil {
+		return
+	}
+	if req.Item == "" {
+		if err = c.permit(i.Name, role, PermReadAll, "Clerk.Disposals", ""); err != nil {
+			return
+		}
+		*reply, err = c.DB.Disposals()
+		return
+	}
+	d, err := c.DB.Disposal(req.Item)
+	if err != nil {
+		return
+	}
+	if err = c.permitRead(i.Name, role, "Clerk.Disposals", d.Item.CaseID); err != nil {
+		return
+	}
+	*reply = []*Disposal{d}
+	return
+}
+
+// Dispose: ask the clerk to dispose of the item req.Item for the reason req.Description,
+// and to delete its contents from the evidence store.
+// Data must be the DisposeMessage signed by the user, which stays in the ledger as the tombstone of the item.
+func (c *Clerk) Dispose(req *RecordRequest, reply *models.Disposition) (err error) {
+	// the signature checked by Dispose authenticates the request
+	i, err := c.signer(req, PermDispose, "Clerk.Dispose", "item "+req.Item)
+	if err != nil {
+		return
+	}
+	dp, err := c.DB.Dispose(i, req.Item, req.Description, models.Ledger{Message: string(req.Data), Hash: req.Hash}, c.Store)
+	if err != nil {
+		return
+	}
+	log.Printf("%s disposed of item %s, file deleted: %t", i.Name, dp.Item, dp.BlobRemoved)
+	c.Stamp()
+	*reply = *dp
+	return
+}
+
+// AddWebhook: ask the clerk to subscribe req.URL to the event types req.Events of req.Case, all of them if empty.
+// Data must be the WebhookMessage signed by the admin. The reply holds the secret that signs the payloads,
+// it is not shown again.
+func (c *Clerk) AddWebhook(req *RecordRequest, reply *models.Webhook) (err error) {
+	// the signature checked by AddWebhook authenticates the request
+	i, err := c.signer(req, PermWebhooks, "Clerk.AddWebhook", "webhook "+req.URL)
+	if err != nil {
+		return
+	}
+	w := models.Webhook{URL: req.URL, Events: strings.Join(req.Events, ","), CaseID: req.Case}
+	hook, err := c.DB.AddWebhook(i, w, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	log.Printf("%s added webhook %d for %s", i.Name, hook.ID, hook.URL)
+	c.Stamp()
+	*reply = *hook
+	return
+}
+
+// Webhooks: ask the clerk for every webhook and the state of its deliveries.
+func (c *Clerk) Webhooks(req *RecordRequest, reply *[]WebhookStatus) (err error) {
+	i, role, err := c.caller("Clerk.Webhooks", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermWebhooks, "Clerk.Webhooks", ""); err != nil {
+		return
+	}
+	*reply, err = c.DB.WebhookStatuses()
+	return
+}
+
+// TestWebhook: ask the clerk to post a test event to the webhook numbered req.Subject right away.
+func (c *Clerk) TestWebhook(req *RecordRequest, reply *models.Webhook) (err error) {
+	i, role, err := c.caller("Clerk.TestWebhook", req)
+	if err != nil {
+		return
+	}
+	if err = c.permit(i.Name, role, PermWebhooks, "Clerk.TestWebhook", "webhook "+req.Subject); err != nil {
+		return
+	}
+	id, err := strconv.Atoi(req.Subject)
+	if err != nil {
+		return fmt.Errorf("a webhook is named by its number, not %q", req.Subject)
+	}
+	w, err := models.WebhookByID(c.DB, id)
+	if err != nil {
+		return fmt.Errorf("no webhook %d", id)
+	}
+	if err = c.DB.TestWebhook(&WebhookSender{Key: c.Key}, w); err != nil {
+		return
+	}
+	w.Secret = ""
+	*reply = *w
+	return
+}
+
+// Propose: ask the clerk to hold the entry in req.Data until it is approved as req.Requirement requires.
+// Data must be the ProposalMessage signed by the user.
+func (c *Clerk) Propose(req *RecordRequest, reply *Proposal) (err error) {
+	// the signature checked by Propose authenticates the request
+	i, err := c.signer(req, PermSign, "Clerk.Propose", caseTarget(req.Case))
+	if err != nil {
+		return
+	}
+	if req.Requirement == nil {
+		return fmt.Errorf("a proposed entry needs an approval requirement")
+	}
+	if IsStateMessage(string(req.Data)) {
+		return fmt.Errorf("moving an item cannot wait for approval")
+	}
+	if IsDisposeMessage(string(req.Data)) {
+		role, err := c.DB.RoleOf(i.Name)
+		if err != nil {
+			return err
+		}
+		if err = c.permit(i.Name, role, PermDispose, "Clerk.Propose", "item "+req.Item); err != nil {
+			return err
+		}
+	}
+	pr, err := c.DB.Propose(i, *req.Requirement, models.Ledger{Message: string(req.Data), Hash: req.Hash, CaseID: req.Case, Item: req.Item})
+	if err != nil {
+		return
+	}
+	log.Printf("%s proposed entry %d, it needs %s", i.Name, pr.Entry.ID, *req.Requirement)
+	*reply = *pr
+	return
+}
+
+// Approve: ask the clerk to approve the proposed entry req.Entry, Data must be the ApprovalMessage signed by the user.
+// The approval that meets the threshold appends the proposed entry.
+func (c *Clerk) Approve(req *RecordRequest, reply *Proposal) (err error) {
+	// the signature checked by Approve authenticates the request
+	i, err := c.signer(req, PermSign, "Clerk.Approve", fmt.Sprintf("proposed entry %d", req.Entry))
+	if err != nil {
+		return
+	}
+	role, err := c.DB.RoleOf(i.Name)
+	if err != nil {
+		return
+	}
+	pr, err := c.DB.Approve(i, role, req.Entry, models.Ledger{Message: string(req.Data), Hash: req.Hash}, c.Store)
+	if err != nil {
+		return
+	}
+	if pr.Status == ProposalAppended {
+		log.Printf("%s approved proposed entry %d, it is appended as entry %d", i.Name, req.Entry, pr.Entry.Ledger)
+	}
+	c.Stamp()
+	*reply = *pr
+	return
+}
+
+// Proposals: ask the clerk for the entries the user proposed and those awaiting their approval.
+func (c *Clerk) Proposals(req *RecordRequest, reply *[]*Proposal) (err error) {
+	i, role, err := c.caller("Clerk.Proposals", req)
+	if err != nil {
+		return
+	}
+	*reply, err = c.DB.Proposals(i.Name, role)
+	return
+}
+
+// AddEntryType: ask the clerk to register the entry type req.Type with the JSON Schema req.Schema.
+// Data must be the EntryTypeMessage signed by the admin.
+func (c *Clerk) AddEntryType(req *RecordRequest, reply *models.EntryType) (err error) {
+	// the signature checked by AddEntryType authenticates the request
+	i, err := c.signer(req, PermEntryTypes, "Clerk.AddEntryType", "entry type "+req.Type)
+	if err != nil {
+		return
+	}
+	et, err := c.DB.AddEntryType(i, req.Type, req.Schema, models.Ledger{Message: string(req.Data), Hash: req.Hash})
+	if err != nil {
+		return
+	}
+	log.Printf("%s registered entry type %s", i.Name, et.Name)
+	c.Stamp()
+	*reply = *et
+	return
+}
+
+// EntryTypes: ask the clerk for the registered entry types and their schemas.
+func (c *Clerk) EntryTypes(req *RecordRequest, reply *[]*models.EntryType) (err error) {
+	if _, _, err = c.caller("Clerk.EntryTypes", req); err != nil {
+		return
+	}
+	*reply, err = models.AllEntryTypes(c.DB)
+	return
+}
+
+// Query: ask the clerk for the entries of type req.Type whose payload fields have the values in req.Fields.
+// With req.Case only the entries of the case are listed, which the user must be able to read,
+// and without it users who do not read every case only get their own entries.
+func (c *Clerk) Query(req *RecordRequest, reply *[]PublishedEntry) (err error) {
+	i, role, err := c.caller("Clerk.Query", req)
+	if err != nil {
+		return
+	}
+	if req.Case != "" {
+		if err = c.permitRead(i.Name, role, "Clerk.Query", req.Case); err != nil {
+			return
+		}
+	}
+	ls, err := models.LedgersByFields(c.DB, req.Type, req.Fields)
+	if err != nil {
+		return
+	}
+	f := WatchFilter{CaseID: req.Case}
+	if req.Case == "" && !Can(role, PermReadAll) {
+		f.Signer = i.Name
+	}
+	names := map[int]string{}
+	*reply = []PublishedEntry{}
+	for _, l := range ls {
+		name, ok := names[l.Identity]
+		if !ok {
+			ident, err := models.IdentityByID(c.DB, l.Identity)
+			if err != nil {
+				return err
+			}
+			name, names[l.Identity] = ident.Name, ident.Name
+		}
+		if f.Matches(l, name) {
+			*reply = append(*reply, PublishEntry(l, name))
+		}
+	}
 	return
 }
@@ -4,10 +4,12 @@ import (
 	"crypto/ecdsa"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gtank/cryptopasta"
 	"github.com/xo/xoutil"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
 	"github.gatech.edu/NIJ-Grant/custody/models"
 )
 
@@ -29,6 +31,8 @@ func (e CustodyError) Error() string {
 // DB: a handle to a modelx.XODB so that we can code with DB.method().
 type DB struct {
 	models.XODB
+	// Policy constrains every entry appended, nil for none.
+	Policy *Policy
 }
 
 // Dial: connect to the custody server and return a handle to the connection.
@@ -40,11 +44,52 @@ func Dial(dsn string) (*DB, error) {
 		return nil, err
 	}
 
-	conn := &DB{db}
+	conn := &DB{XODB: db}
 	conn.Init()
 	return conn, nil
 }
 
+// begin: start a transaction on the database connection underneath db.
+func (db *DB) begin() (*sql.Tx, error) {
+	var conn models.XODB = db
+	for {
+		switch c := conn.(type) {
+		case *sql.DB:
+			return c.Begin()
+		case *DB:
+			conn = c.XODB
+		default:
+			return nil, fmt.Errorf("cannot start a transaction on %T", conn)
+		}
+	}
+}
+
+// atomic: run f on a transaction of db that commits if f returns nil and rolls back otherwise.
+// If db is a transaction already f runs on it, and the outer transaction decides.
+func (db *DB) atomic(f func(tdb *DB) error) error {
+	var conn models.XODB = db
+	for c, ok := conn.(*DB); ok; c, ok = conn.(*DB) {
+		conn = c.XODB
+	}
+	if _, ok := conn.(*sql.Tx); ok {
+		return f(db)
+	}
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(&DB{XODB: tx, Policy: db.Policy}); err != nil {
+		if denied, ok := err.(AccessDenied); ok {
+			// the denial recorded in the transaction is rolled back with it
+			tx.Rollback()
+			db.recordDenial(denied)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
 // Request: a structure for dispatching the network requests RPC style.
 type Request struct {
 	Operation       OpCode `json:"operation"`
@@ -88,9 +133,281 @@ create table if not exists ledger (
   identity integer not null,
   message text not null,
   hash blob not null,
+  case_id text not null default '',
+  item text not null default '',
+  imported text not null default '',
+
+  foreign key (identity) references identities(id)
+);
+
+create table if not exists items (
+  id integer not null primary key,
+  tag text not null unique,
+  case_id text not null default '',
+  description text not null,
+  digest blob,
+  created_at timestamp not null,
+  identity integer not null,
+  ledger integer not null default 0,
 
   foreign key (identity) references identities(id)
 );
+
+create table if not exists checkpoints (
+  id integer not null primary key,
+  created_at timestamp not null,
+  size integer not null,
+  root blob not null,
+  signature blob not null
+);
+
+create table if not exists timestamps (
+  id integer not null primary key,
+  ledger integer not null unique,
+  created_at timestamp not null,
+  token blob not null,
+  gen_time timestamp not null,
+  authority text not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists cosignatures (
+  id integer not null primary key,
+  checkpoint integer not null,
+  created_at timestamp not null,
+  witness blob not null,
+  signature blob not null,
+
+  foreign key (checkpoint) references checkpoints(id)
+);
+
+create table if not exists roles (
+  id integer not null primary key,
+  name text not null unique,
+  role text not null,
+  granted_by integer not null,
+  created_at timestamp not null
+);
+
+create table if not exists denials (
+  id integer not null primary key,
+  created_at timestamp not null,
+  name text not null,
+  action text not null,
+  target text not null default '',
+  reason text not null
+);
+
+create table if not exists hash_lists (
+  id integer not null primary key,
+  item text not null unique,
+  ledger integer not null,
+  size integer not null,
+  block_size integer not null,
+  root blob not null,
+  blocks blob not null,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists retention_policies (
+  id integer not null primary key,
+  case_id text not null default '',
+  item text not null default '',
+  days integer not null,
+  basis text not null,
+  ledger integer not null,
+  created_at timestamp not null,
+
+  unique (case_id, item),
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists legal_holds (
+  id integer not null primary key,
+  case_id text not null default '',
+  item text not null default '',
+  reason text not null,
+  ledger integer not null,
+  released integer not null default 0,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists dispositions (
+  id integer not null primary key,
+  item text not null unique,
+  ledger integer not null,
+  digest blob,
+  blob_removed boolean not null default 0,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists fixity_runs (
+  id integer not null primary key,
+  ledger integer not null,
+  created_at timestamp not null,
+  blobs integer not null,
+  through text not null,
+  entries_to integer not null,
+  failures integer not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists webhooks (
+  id integer not null primary key,
+  url text not null,
+  events text not null,
+  case_id text not null,
+  secret text not null,
+  ledger integer not null,
+  cursor integer not null,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists webhook_deliveries (
+  id integer not null primary key,
+  webhook integer not null,
+  ledger integer not null,
+  event text not null,
+  payload blob not null,
+  attempts integer not null,
+  next_attempt integer not null,
+  last_error text not null,
+  created_at timestamp not null,
+
+  foreign key (webhook) references webhooks(id),
+  foreign key (ledger) references ledger(id)
+);
+
+create index if not exists webhook_delivery_next_idx on webhook_deliveries (next_attempt);
+
+create table if not exists webhook_dead_letters (
+  id integer not null primary key,
+  webhook integer not null,
+  ledger integer not null,
+  event text not null,
+  payload blob not null,
+  attempts integer not null,
+  last_error text not null,
+  created_at timestamp not null,
+
+  foreign key (webhook) references webhooks(id),
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists pending_entries (
+  id integer not null primary key,
+  identity integer not null,
+  message text not null,
+  hash blob not null,
+  case_id text not null,
+  item text not null,
+  threshold integer not null,
+  approvers text not null,
+  roles text not null,
+  deadline timestamp not null,
+  ledger integer not null,
+  created_at timestamp not null,
+
+  foreign key (identity) references identities(id)
+);
+
+create table if not exists approvals (
+  id integer not null primary key,
+  pending integer not null,
+  identity integer not null,
+  ledger integer not null,
+  created_at timestamp not null,
+
+  foreign key (pending) references pending_entries(id),
+  foreign key (identity) references identities(id),
+  foreign key (ledger) references ledger(id)
+);
+
+create unique index if not exists approval_pending_identity_idx on approvals (pending, identity);
+
+create table if not exists policy_violations (
+  id integer not null primary key,
+  ledger integer not null,
+  rule text not null,
+  reason text not null,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists item_states (
+  id integer not null primary key,
+  item text not null unique,
+  state text not null,
+  ledger integer not null,
+  updated_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists entry_types (
+  id integer not null primary key,
+  name text not null unique,
+  schema text not null,
+  ledger integer not null,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create table if not exists entry_fields (
+  id integer not null primary key,
+  ledger integer not null,
+  entry_type text not null,
+  name text not null,
+  value text not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+create index if not exists entry_field_idx on entry_fields (entry_type, name, value);
+
+create index if not exists ledger_hash_idx on ledger (hash);
+
+create table if not exists tree_frontiers (
+  id integer not null primary key,
+  ledger integer not null,
+  size integer not null,
+  nodes blob not null,
+
+  foreign key (ledger) references ledger(id)
+);
+create unique index if not exists tree_frontier_ledger_idx on tree_frontiers (ledger);
+create table if not exists case_members (
+  id integer not null primary key,
+  case_id text not null,
+  name text not null,
+  granted_by integer not null,
+  created_at timestamp not null,
+
+  unique (case_id, name),
+  foreign key (granted_by) references identities(id)
+);
+create table if not exists key_records (
+  id integer not null primary key,
+  identity integer not null,
+  event text not null,
+  ledger integer not null,
+  created_at timestamp not null,
+
+  foreign key (identity) references identities(id),
+  foreign key (ledger) references ledger(id)
+);
 `
 	if _, err := db.Exec(query); err != nil {
 		return err
@@ -116,23 +433,88 @@ func (db *DB) NewUser(name string, publickey []byte) (models.Identity, error) {
 
 // Operate: validate a message and insert it into the database as a ledger entry.
 func (db *DB) Operate(identity *models.Identity, message string, hash []byte) (ledg models.Ledger, err error) {
+	return db.Append(identity, models.Ledger{Message: message, Hash: hash})
+}
+
+// entryHeader: the first line of the statement signed for an entry with a case or an item.
+const entryHeader = "custody entry v1\n"
+
+// EntryStatement: the bytes a user signs for a ledger entry with message in caseID about item.
+// An entry with neither is signed over its message alone, as every entry was before entries had cases,
+// otherwise the statement covers all three so that the signature cannot be replayed under another case or item.
+func EntryStatement(message, caseID, item string) []byte {
+	if caseID == "" && item == "" {
+		return []byte(message)
+	}
+	return []byte(fmt.Sprintf("%scase %q\nitem %q\n%s", entryHeader, caseID, item, message))
+}
+
+// SignEntry: sign the statement of an entry with message in caseID about item.
+func SignEntry(key *ecdsa.PrivateKey, message, caseID, item string) ([]byte, error) {
+	return cryptopasta.Sign(EntryStatement(message, caseID, item), key)
+}
+
+// signatureUsed: true if the signature hash, or its malleated twin, is already on a ledger entry,
+// which would make entry a replay.
+func (db *DB) signatureUsed(hash []byte) (bool, error) {
+	var n int
+	err := db.QueryRow(`select count(*) from ledger where hash in (?, ?)`, hash, crypto.Twin(hash)).Scan(&n)
+	return n > 0, err
+}
+
+// Append: validate the signature on entry and insert it into the database as a ledger entry of identity.
+// The caller fills in the message, signature and any metadata such as the case,
+// Append sets the identity and timestamp. The signature must cover the EntryStatement of the entry,
+// it must not be on any other entry, and the key of identity must not be revoked.
+// The entry must also pass db.Policy, whose violations are recorded with it in audit mode.
+func (db *DB) Append(identity *models.Identity, entry models.Ledger) (ledg models.Ledger, err error) {
 	var key *ecdsa.PublicKey
 	var valid bool
 	key, err = identity.Public()
 	if err != nil {
 		return
 	}
-	data := []byte(message)
-	// log.Printf("data  read from stdin: %v", data)
-	valid = cryptopasta.Verify(data, hash, key)
-	if !valid {
-		err = CustodyError{Operation: "InvalidSignature", ID: identity, Message: data, Signature: hash}
+	if strings.HasPrefix(entry.Message, entryHeader) {
+		err = fmt.Errorf("a message cannot start with %q", entryHeader)
 		return
 	}
-	ledg = models.Ledger{Identity: identity.ID, CreatedAt: XONow(), Message: message, Hash: hash}
-	if err = ledg.Insert(db); err != nil {
+	data := EntryStatement(entry.Message, entry.CaseID, entry.Item)
+	valid = crypto.Verify(data, entry.Hash, key)
+	if !valid {
+		err = CustodyError{Operation: "InvalidSignature", ID: identity, Message: data, Signature: entry.Hash}
 		return
 	}
+	ledg = entry
+	ledg.Identity = identity.ID
+	ledg.CreatedAt = XONow()
+	// the checks run in the transaction of the insert, so that concurrent appends cannot both pass them
+	err = db.atomic(func(tdb *DB) error {
+		used, err := tdb.signatureUsed(entry.Hash)
+		if err != nil {
+			return err
+		}
+		if used {
+			return fmt.Errorf("the signature is already on a ledger entry, sign the entry again")
+		}
+		revoked, err := tdb.Revoked(identity)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return CustodyError{Operation: "RevokedKey", ID: identity, Message: data, Signature: entry.Hash}
+		}
+		violations, err := tdb.checkPolicy(identity, &entry)
+		if err != nil {
+			return err
+		}
+		if err := ledg.Insert(tdb); err != nil {
+			return err
+		}
+		if err := tdb.extendTree(&ledg); err != nil {
+			return err
+		}
+		return tdb.RecordViolations(ledg, violations)
+	})
 	return
 }
 
@@ -143,7 +525,7 @@ func (db *DB) Validate(identity models.Identity, data []byte, hash []byte) (bool
 	if err != nil {
 		return false, err
 	}
-	valid := cryptopasta.Verify(data, hash, pub)
+	valid := crypto.Verify(data, hash, pub)
 	return valid, nil
 }
 
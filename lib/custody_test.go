@@ -40,7 +40,7 @@ func setupdb(t *testing.T, path string) *DB {
 	if err != nil {
 		t.Fatal(err)
 	}
-	cdb := &DB{db}
+	cdb := &DB{XODB: db}
 	if err = cdb.Init(); err != nil {
 		t.Fatal(err)
 	}
@@ -146,8 +146,9 @@ func TestUploadExistingKey(t *testing.T) {
 	createcheckuser(t, cdb, "premade_user_file", pubkey)
 
 	// you can also insert premade users with a Clerk / with RPC
+	// the clerk refuses a new key for a name enrolled by an earlier run, so it gets a fresh database
 	ck := NewClerk()
-	ck.DB = *cdb
+	ck.DB = *tempdb(t)
 	req := RecordRequest{Name: "premade_clerk", PublicKey: pubkey}
 	reply := new(models.Identity)
 	err = ck.Create(&req, reply)
@@ -0,0 +1,84 @@
+package custody
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// LegacyDigests: the digests that can be recorded next to SHA-256 for tools that still compare them.
+// Neither resists collisions, they never replace the SHA-256.
+var LegacyDigests = []string{"sha1", "md5"}
+
+// FileDigests: the size and digests of a file, the legacy ones are nil unless asked for.
+type FileDigests struct {
+	Size   int64
+	SHA256 []byte
+	SHA1   []byte
+	MD5    []byte
+}
+
+// DigestFile: stream the file at path through SHA-256 and the legacy digests named, reading it once.
+func DigestFile(path string, legacy []string) (*FileDigests, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s256 := sha256.New()
+	hashes := []io.Writer{s256}
+	var s1, m5 hash.Hash
+	for _, name := range legacy {
+		switch name {
+		case "sha1":
+			s1 = sha1.New()
+			hashes = append(hashes, s1)
+		case "md5":
+			m5 = md5.New()
+			hashes = append(hashes, m5)
+		default:
+			return nil, fmt.Errorf("unknown digest %s, the legacy digests are %s", name, strings.Join(LegacyDigests, ", "))
+		}
+	}
+	d := &FileDigests{}
+	if d.Size, err = io.Copy(io.MultiWriter(hashes...), f); err != nil {
+		return nil, err
+	}
+	d.SHA256 = s256.Sum(nil)
+	if s1 != nil {
+		d.SHA1 = s1.Sum(nil)
+	}
+	if m5 != nil {
+		d.MD5 = m5.Sum(nil)
+	}
+	return d, nil
+}
+
+var operationName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// FileMessage: the message a user signs to record the operation op on the file named name with digests d.
+// It covers the size of the file and every digest, never its contents. Name the file without the directories
+// it is in on the workstation, such as by its base name.
+func FileMessage(op, name string, d *FileDigests) (string, error) {
+	if !operationName.MatchString(op) {
+		return "", fmt.Errorf("an operation is a lower case word such as acquire or verify, not %q", op)
+	}
+	return fmt.Sprintf("%s file %s: %s", op, name, d), nil
+}
+
+func (d *FileDigests) String() string {
+	s := fmt.Sprintf("%d bytes: sha256 %x", d.Size, d.SHA256)
+	if d.SHA1 != nil {
+		s += fmt.Sprintf(", sha1 %x", d.SHA1)
+	}
+	if d.MD5 != nil {
+		s += fmt.Sprintf(", md5 %x", d.MD5)
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package custody
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "custody")
+	FailTest(t, err, "could not make tempdir %s")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "disk.dd")
+	FailTest(t, ioutil.WriteFile(path, []byte("abc"), 0600), "%s")
+
+	d, err := DigestFile(path, nil)
+	FailTest(t, err, "%s")
+	if d.SHA1 != nil || d.MD5 != nil {
+		t.Fatal("legacy digests were computed unasked")
+	}
+	msg, err := FileMessage("acquire", "disk.dd", d)
+	FailTest(t, err, "%s")
+	if want := "acquire file disk.dd: 3 bytes: sha256 ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; msg != want {
+		t.Fatalf("wrong statement %q", msg)
+	}
+
+	d, err = DigestFile(path, []string{"md5", "sha1"})
+	FailTest(t, err, "%s")
+	msg, err = FileMessage("verify", "disk.dd", d)
+	FailTest(t, err, "%s")
+	if want := "verify file disk.dd: 3 bytes: sha256 ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" +
+		", sha1 a9993e364706816aba3e25717850c26c9cd0d89d, md5 900150983cd24fb0d6963f7d28e17f72"; msg != want {
+		t.Fatalf("wrong statement %q", msg)
+	}
+
+	if _, err = DigestFile(path, []string{"crc32"}); err == nil {
+		t.Fatal("an unknown digest was accepted")
+	}
+	if _, err = FileMessage("acquire disk: sha256 00", "disk.dd", d); err == nil {
+		t.Fatal("an operation that forges the statement was accepted")
+	}
+}
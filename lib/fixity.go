@@ -0,0 +1,262 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// SystemName: the identity of the server itself, which signs the entries it makes on its own
+// such as the record of a fixity audit. Users cannot enroll under this name.
+const SystemName = "custody-server"
+
+// SystemIdentity: the identity of the server key, enrolled under SystemName the first time it is needed.
+// A new server key is enrolled as a new identity of the same name.
+func (db *DB) SystemIdentity(key *ecdsa.PrivateKey) (*models.Identity, error) {
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	ids, err := models.IdentitiesByName(db, SystemName)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 && bytes.Equal(ids[len(ids)-1].PublicKey, pub) {
+		return ids[len(ids)-1], nil
+	}
+	i, err := db.NewUser(SystemName, pub)
+	return &i, err
+}
+
+// Alert: a problem found by a background audit.
+type Alert struct {
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	Problem string    `json:"problem"`
+	// Entry is the system ledger entry that records the audit run.
+	Entry int `json:"entry"`
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s: %s", a.Subject, a.Problem)
+}
+
+// Notifier: where alerts go.
+type Notifier interface {
+	Notify(a Alert) error
+}
+
+// LogNotifier: writes alerts to the server log.
+type LogNotifier struct{}
+
+// Notify: log the alert.
+func (LogNotifier) Notify(a Alert) error {
+	log.Printf("ALERT: %s (recorded by entry %d)", a, a.Entry)
+	return nil
+}
+
+// CommandNotifier: runs a command for every alert with the alert as JSON on its standard input,
+// for example a script that sends mail or pages someone.
+type CommandNotifier struct {
+	Command string
+	Args    []string
+}
+
+// Notify: run the command with the alert.
+func (n CommandNotifier) Notify(a Alert) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(n.Command, n.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notifier %s failed: %s: %s", n.Command, err, out)
+	}
+	return nil
+}
+
+// Notifiers: sends every alert to each notifier in turn.
+type Notifiers []Notifier
+
+// Notify: notify each notifier, and return the first error.
+func (ns Notifiers) Notify(a Alert) (err error) {
+	for _, n := range ns {
+		if nerr := n.Notify(a); nerr != nil && err == nil {
+			err = nerr
+		}
+	}
+	return
+}
+
+// FixityAuditor: the background audit of the evidence store and the ledger run by custody serve.
+// Every Interval it rehashes the next share of the blobs in the store, so that each blob is rehashed
+// once per Rotation, verifies the signatures of the entries appended since the last run and checks
+// the latest checkpoint against the ledger. Each run is recorded as a ledger entry signed by the server,
+// and every mismatch is sent to the Notifier.
+type FixityAuditor struct {
+	Clerk    *Clerk
+	Notifier Notifier
+	Interval time.Duration
+	Rotation time.Duration
+}
+
+// FixityMessage: the message of the system entry that records a fixity audit run.
+func FixityMessage(run *models.FixityRun, total, first, last int, problems []string) string {
+	msg := fmt.Sprintf("fixity audit: %d of %d blobs rehashed through %s, entries %d to %d verified, %d problems",
+		run.Blobs, total, run.Through, first, last, run.Failures)
+	if len(problems) > 0 {
+		msg += ": " + strings.Join(problems, "; ")
+	}
+	return msg
+}
+
+// Start: run an audit every Interval, the first one Interval from now, until stop is closed.
+func (a *FixityAuditor) Start(stop <-chan struct{}) {
+	go func() {
+		tick := time.NewTicker(a.Interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+			}
+			if _, err := a.Run(); err != nil {
+				log.Printf("fixity audit failed: %s", err)
+			}
+		}
+	}()
+}
+
+// share: how many of total blobs each run rehashes so that all of them are rehashed once per Rotation.
+func (a *FixityAuditor) share(total int) int {
+	if a.Rotation <= a.Interval {
+		return total
+	}
+	runs := int(a.Rotation / a.Interval)
+	return (total + runs - 1) / runs
+}
+
+// Run: audit once and record the run.
+func (a *FixityAuditor) Run() (*models.FixityRun, error) {
+	c := a.Clerk
+	if c.Key == nil {
+		return nil, fmt.Errorf("fixity audits are signed by the server and it has no key")
+	}
+	db := &c.DB
+	prev, err := models.LatestFixityRun(db)
+	switch {
+	case err == sql.ErrNoRows:
+		prev = &models.FixityRun{}
+	case err != nil:
+		return nil, err
+	}
+	run := &models.FixityRun{Through: prev.Through}
+	var problems []string
+	var alerts []Alert
+	problem := func(subject, format string, args ...interface{}) {
+		al := Alert{Time: time.Now().UTC(), Subject: subject, Problem: fmt.Sprintf(format, args...)}
+		alerts = append(alerts, al)
+		problems = append(problems, al.String())
+	}
+
+	// the next share of the blobs in digest order, wrapping around at the end
+	var digests [][]byte
+	if c.Store != nil {
+		if digests, _, err = c.Store.List(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(digests, func(i, j int) bool { return bytes.Compare(digests[i], digests[j]) < 0 })
+	start := sort.Search(len(digests), func(i int) bool { return hex.EncodeToString(digests[i]) > prev.Through })
+	for n := a.share(len(digests)); run.Blobs < n; run.Blobs++ {
+		d := digests[(start+run.Blobs)%len(digests)]
+		run.Through = hex.EncodeToString(d)
+		if err := c.Store.Verify(d); err != nil {
+			problem("blob "+run.Through, "%s", err)
+		}
+	}
+
+	// the entries appended since the last run, and the latest checkpoint
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	idents, err := models.AllIdentities(db)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[int]*models.Identity{}
+	for _, i := range idents {
+		ids[i.ID] = i
+	}
+	from := sort.Search(len(ls), func(i int) bool { return ls[i].ID > prev.EntriesTo })
+	for i, err := range verifyEntries(ls[from:], ids) {
+		if err != nil {
+			problem(fmt.Sprintf("entry %d", ls[from+i].ID), "%s", err)
+		}
+	}
+	first, last := prev.EntriesTo+1, prev.EntriesTo
+	if len(ls) > 0 {
+		last = ls[len(ls)-1].ID
+	}
+	cp, err := models.LatestCheckpoint(db)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, err
+	case !VerifyCheckpoint(cp, &c.Key.PublicKey):
+		problem(fmt.Sprintf("checkpoint %d", cp.ID), "the server signature is invalid")
+	case cp.Size > len(ls) || !bytes.Equal(merkle.Root(Leaves(ls[:cp.Size])), cp.Root):
+		problem(fmt.Sprintf("checkpoint %d", cp.ID), "its root does not match the first %d entries of the ledger", cp.Size)
+	}
+
+	run.EntriesTo, run.Failures = last, len(problems)
+	system, err := db.SystemIdentity(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	msg := FixityMessage(run, len(digests), first, last, problems)
+	hash, err := cryptopasta.Sign([]byte(msg), c.Key)
+	if err != nil {
+		return nil, err
+	}
+	var entry models.Ledger
+	err = db.atomic(func(tdb *DB) error {
+		entry, err = tdb.Append(system, models.Ledger{Message: msg, Hash: hash})
+		if err != nil {
+			return err
+		}
+		run.Ledger, run.CreatedAt = entry.ID, entry.CreatedAt
+		return run.Insert(tdb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Stamp()
+	log.Printf("fixity audit %d: %d blobs rehashed, entries %d to %d verified, %d problems", run.ID, run.Blobs, first, last, run.Failures)
+	for _, al := range alerts {
+		al.Entry = entry.ID
+		if a.Notifier == nil {
+			continue
+		}
+		if err := a.Notifier.Notify(al); err != nil {
+			log.Printf("could not send alert %s: %s", al, err)
+		}
+	}
+	return run, nil
+}
@@ -0,0 +1,94 @@
+package custody
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+type alerts []Alert
+
+func (as *alerts) Notify(a Alert) error {
+	*as = append(*as, a)
+	return nil
+}
+
+func TestFixityAuditor(t *testing.T) {
+	cdb := tempdb(t)
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate server key %s")
+	evidence, err := store.Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+	var paths []string
+	var digests [][]byte
+	for _, contents := range []string{"disk one", "disk two", "disk three"} {
+		staged, err := evidence.Stage(strings.NewReader(contents))
+		FailTest(t, err, "could not stage %s")
+		path, err := staged.Commit()
+		FailTest(t, err, "could not commit %s")
+		paths, digests = append(paths, path), append(digests, staged.Digest)
+	}
+	alice, akey := signer(t, cdb, "alice")
+	record(t, cdb, alice, akey, "C1", "seized")
+
+	// three blobs rehashed over three runs, one per run
+	var sent alerts
+	a := &FixityAuditor{Clerk: &Clerk{DB: *cdb, Key: key, Store: evidence}, Notifier: &sent, Interval: time.Hour, Rotation: 3 * time.Hour}
+	run, err := a.Run()
+	FailTest(t, err, "fixity audit failed %s")
+	first := run.Through
+	if run.Blobs != 1 || run.Failures != 0 || run.EntriesTo != 1 {
+		t.Fatalf("first run: %+v", run)
+	}
+	system, err := models.IdentitiesByName(cdb, SystemName)
+	FailTest(t, err, "%s")
+	l, err := models.LedgerByID(cdb, run.Ledger)
+	FailTest(t, err, "%s")
+	if len(system) != 1 || l.Identity != system[0].ID || !strings.HasPrefix(l.Message, "fixity audit: 1 of 3 blobs") {
+		t.Fatalf("the run is not recorded by the server: %+v", l)
+	}
+
+	// tamper with the blob the next run rehashes
+	var next string
+	for _, d := range digests {
+		if name := hex.EncodeToString(d); name > run.Through && (next == "" || name < next) {
+			next = name
+		}
+	}
+	for i, d := range digests {
+		if hex.EncodeToString(d) == next {
+			FailTest(t, os.Chmod(paths[i], 0600), "%s")
+			FailTest(t, ioutil.WriteFile(paths[i], []byte("tampered"), 0600), "%s")
+		}
+	}
+	record(t, cdb, alice, akey, "C1", "transferred")
+	run, err = a.Run()
+	FailTest(t, err, "fixity audit failed %s")
+	if run.Through != next || run.Failures != 1 || len(sent) != 1 || sent[0].Subject != "blob "+next || sent[0].Entry != run.Ledger {
+		t.Fatalf("tampering was not reported: %+v %+v", run, sent)
+	}
+	if run.EntriesTo != 3 {
+		t.Fatalf("the second run verified entries through %d", run.EntriesTo)
+	}
+
+	// the third run finishes the rotation and the fourth starts over
+	for i := 0; i < 2; i++ {
+		run, err = a.Run()
+		FailTest(t, err, "fixity audit failed %s")
+	}
+	if run.Through != first || len(sent) != 1 {
+		t.Fatalf("the rotation did not wrap around: %+v %+v", run, sent)
+	}
+	r, err := cdb.Audit(&key.PublicKey)
+	FailTest(t, err, "audit failed %s")
+	if !r.OK() {
+		t.Fatalf("the server entries do not audit: %v", r.Failures)
+	}
+}
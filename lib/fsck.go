@@ -0,0 +1,310 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// Finding: a problem found by Fsck.
+type Finding struct {
+	// Check is the kind of check that failed: link, orphan, state or blob.
+	Check   string `json:"check"`
+	Subject string `json:"subject"`
+	Problem string `json:"problem"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Check, f.Subject, f.Problem)
+}
+
+// FsckReport: the outcome of a full integrity scan of a custody database and its evidence store.
+// Audit holds the checks of signatures, checkpoints, timestamps and cosignatures,
+// Findings the broken links between rows, orphaned rows and blobs that do not verify.
+type FsckReport struct {
+	Audit    *AuditReport `json:"audit"`
+	Blobs    int          `json:"blobs"`
+	Verified int          `json:"verified_blobs"`
+	Findings []Finding    `json:"findings"`
+}
+
+// OK: true if nothing was found.
+func (r *FsckReport) OK() bool {
+	return r.Audit.OK() && len(r.Findings) == 0
+}
+
+func (r *FsckReport) find(check, subject, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{Check: check, Subject: subject, Problem: fmt.Sprintf(format, args...)})
+}
+
+// orphanQueries: rows that refer to rows that do not exist. Each query selects the subject of a finding.
+var orphanQueries = []struct {
+	query, problem string
+}{
+	{`select 'item ' || tag from items where identity not in (select id from identities)`,
+		"registered by an identity that does not exist"},
+	{`select 'item ' || tag from items where tag not in (select item from ledger)`,
+		"has no ledger entries, not even its registration"},
+	{`select 'item ' || tag from items where ledger != 0 and ledger not in (select id from ledger where item = items.tag)`,
+		"its registration entry does not exist"},
+	{`select 'hash list of item ' || item from hash_lists where ledger not in (select id from ledger)`,
+		"its registration entry does not exist"},
+	{`select 'hash list of item ' || item from hash_lists where item not in (select tag from items)`,
+		"the item does not exist"},
+	{`select 'retention of ' || case when item = '' then 'case ' || case_id else 'item ' || item end from retention_policies where ledger not in (select id from ledger)`,
+		"the entry that set it does not exist"},
+	{`select 'retention of item ' || item from retention_policies where item != '' and item not in (select tag from items)`,
+		"the item does not exist"},
+	{`select 'legal hold ' || id from legal_holds where ledger not in (select id from ledger)`,
+		"the entry that placed it does not exist"},
+	{`select 'legal hold ' || id from legal_holds where released != 0 and released not in (select id from ledger)`,
+		"the entry that released it does not exist"},
+	{`select 'legal hold ' || id from legal_holds where item != '' and item not in (select tag from items)`,
+		"the item does not exist"},
+	{`select 'disposition of item ' || item from dispositions where ledger not in (select id from ledger)`,
+		"its tombstone entry does not exist"},
+	{`select 'disposition of item ' || item from dispositions where item not in (select tag from items)`,
+		"the item does not exist"},
+	{`select 'fixity run ' || id from fixity_runs where ledger not in (select id from ledger)`,
+		"the entry that records it does not exist"},
+	{`select 'webhook ' || id from webhooks where ledger not in (select id from ledger)`,
+		"the entry that added it does not exist"},
+	{`select 'webhook delivery ' || id from webhook_deliveries where webhook not in (select id from webhooks)`,
+		"the webhook does not exist"},
+	{`select 'approval ' || id from approvals where ledger not in (select id from ledger)`,
+		"its entry does not exist"},
+	{`select 'approval ' || id from approvals where pending not in (select id from pending_entries)`,
+		"the proposed entry does not exist"},
+	{`select 'proposed entry ' || id from pending_entries where ledger != 0 and ledger not in (select id from ledger)`,
+		"the entry it was appended as does not exist"},
+	{`select 'proposed entry ' || id from pending_entries where ledger != 0 and threshold > (select count(*) from approvals where pending = pending_entries.id and ledger < pending_entries.ledger)`,
+		"it was appended without the approvals it requires"},
+	{`select 'policy violation ' || id from policy_violations where ledger not in (select id from ledger)`,
+		"its entry does not exist"},
+	{`select 'state of item ' || item from item_states where ledger not in (select id from ledger)`,
+		"the entry that set it does not exist"},
+	{`select 'state of item ' || item from item_states where item not in (select tag from items)`,
+		"the item does not exist"},
+	{`select 'entry type ' || name from entry_types where ledger not in (select id from ledger)`,
+		"the entry that registered it does not exist"},
+	{`select 'field ' || name || ' of entry ' || ledger from entry_fields where ledger not in (select id from ledger)`,
+		"the entry does not exist"},
+	{`select 'field ' || name || ' of entry ' || ledger from entry_fields where entry_type not in (select name from entry_types)`,
+		"the entry type does not exist"},
+	{`select 'role of ' || name from roles where name not in (select name from identities)`,
+		"the user does not exist"},
+	{`select 'role of ' || name from roles where granted_by not in (select id from identities)`,
+		"granted by an identity that does not exist"},
+	{`select 'tree frontier ' || id from tree_frontiers where ledger not in (select id from ledger)`,
+		"the entry does not exist"},
+	{`select 'key record ' || id from key_records where ledger not in (select id from ledger)`,
+		"the entry does not exist"},
+	{`select 'key record ' || id from key_records where identity not in (select id from identities)`,
+		"the key does not exist"},
+	{`select 'case member ' || id from case_members where granted_by not in (select id from identities)`,
+		"the granting admin does not exist"},
+}
+
+// Fsck: check a custody database end to end. On top of Audit it checks that entries and checkpoints
+// follow each other in time, that no row refers to a row that does not exist, that the cached state of each item
+// is the one its ledger entries give it, and if evidence is not nil that every blob in the store still matches
+// its digest and belongs to an item.
+// Entry signatures and blobs are checked in parallel.
+func (db *DB) Fsck(server *ecdsa.PublicKey, evidence *store.Store) (*FsckReport, error) {
+	audit, err := db.Audit(server)
+	if err != nil {
+		return nil, err
+	}
+	r := &FsckReport{Audit: audit}
+	if err = db.checkLinks(r); err != nil {
+		return nil, err
+	}
+	for _, o := range orphanQueries {
+		if err = db.checkOrphans(r, o.query, o.problem); err != nil {
+			return nil, err
+		}
+	}
+	if err = db.checkStates(r); err != nil {
+		return nil, err
+	}
+	if evidence != nil {
+		if err = db.checkBlobs(r, evidence); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// checkLinks: entries and checkpoints must not go back in time, and a later checkpoint must not cover fewer entries.
+func (db *DB) checkLinks(r *FsckReport) error {
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return err
+	}
+	var last time.Time
+	for i, l := range ls {
+		if i > 0 && l.CreatedAt.Time.Before(last) {
+			r.find("link", fmt.Sprintf("entry %d", l.ID), "created at %s, before entry %d at %s",
+				l.CreatedAt.Format(time.RFC3339), ls[i-1].ID, last.Format(time.RFC3339))
+		}
+		last = l.CreatedAt.Time
+	}
+	if len(ls) > 0 {
+		// the frontier receipts are issued from must be the one the entries give
+		id := ls[len(ls)-1].ID
+		_, err = models.TreeFrontierByLedger(db, id)
+		switch {
+		case err == sql.ErrNoRows:
+			// computed on first use
+		case err != nil:
+			return err
+		default:
+			f, err := db.frontier(id)
+			if err != nil {
+				return err
+			}
+			if f.Size != len(ls) || !bytes.Equal(f.Root(), merkle.Root(Leaves(ls))) {
+				r.find("link", fmt.Sprintf("entry %d", id), "the stored ledger tree does not match the entries")
+			}
+		}
+	}
+	cps, err := models.AllCheckpoints(db)
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(cps); i++ {
+		prev, cp := cps[i-1], cps[i]
+		if cp.Size < prev.Size {
+			r.find("link", fmt.Sprintf("checkpoint %d", cp.ID), "covers %d entries, fewer than the %d of checkpoint %d",
+				cp.Size, prev.Size, prev.ID)
+		}
+		if cp.CreatedAt.Time.Before(prev.CreatedAt.Time) {
+			r.find("link", fmt.Sprintf("checkpoint %d", cp.ID), "signed before checkpoint %d", prev.ID)
+		}
+	}
+	return nil
+}
+
+// checkStates: the cached state of every item must be the state its ledger entries moved it to.
+func (db *DB) checkStates(r *FsckReport) error {
+	items, err := models.AllItems(db)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		subject := "state of item " + item.Tag
+		want, _, err := db.replayState(item)
+		if err != nil {
+			r.find("state", subject, "%s", err)
+			continue
+		}
+		s, err := models.ItemStateByItem(db, item.Tag)
+		switch {
+		case err == sql.ErrNoRows:
+			// cached on first use
+		case err != nil:
+			return err
+		case s.State != want.State || s.Ledger != want.Ledger:
+			r.find("state", subject, "cached as %s by entry %d, the ledger says %s by entry %d", s.State, s.Ledger, want.State, want.Ledger)
+		}
+	}
+	return nil
+}
+
+// checkOrphans: a finding for every subject selected by query.
+func (db *DB) checkOrphans(r *FsckReport, query, problem string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var subject string
+		if err = rows.Scan(&subject); err != nil {
+			return err
+		}
+		r.find("orphan", subject, "%s", problem)
+	}
+	return rows.Err()
+}
+
+// checkBlobs: verify every blob in parallel, and find the blobs no item refers to
+// and the blobs of disposed items that should have been deleted.
+func (db *DB) checkBlobs(r *FsckReport, evidence *store.Store) error {
+	digests, strays, err := evidence.List()
+	if err != nil {
+		return err
+	}
+	for _, path := range strays {
+		r.find("orphan", path, "belongs to no blob in the evidence store")
+	}
+	items, err := models.AllItems(db)
+	if err != nil {
+		return err
+	}
+	owners := map[string][]string{}
+	for _, item := range items {
+		owners[hex.EncodeToString(item.Digest)] = append(owners[hex.EncodeToString(item.Digest)], item.Tag)
+	}
+	removed := map[string]string{}
+	rows, err := db.Query(`select item, digest from dispositions where blob_removed`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		var digest []byte
+		if err = rows.Scan(&tag, &digest); err != nil {
+			return err
+		}
+		removed[hex.EncodeToString(digest)] = tag
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	r.Blobs = len(digests)
+	errs := make([]error, len(digests))
+	next := make(chan int, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = evidence.Verify(digests[i])
+			}
+		}()
+	}
+	for i := range digests {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, digest := range digests {
+		name := hex.EncodeToString(digest)
+		subject := "blob " + name
+		if errs[i] != nil {
+			r.find("blob", subject, "%s", errs[i])
+		} else {
+			r.Verified++
+		}
+		if tag, ok := removed[name]; ok {
+			r.find("blob", subject, "item %s was disposed of and its file deleted, but the blob is stored", tag)
+		} else if len(owners[name]) == 0 {
+			r.find("orphan", subject, "no item has these contents")
+		}
+	}
+	return nil
+}
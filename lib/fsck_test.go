@@ -0,0 +1,67 @@
+package custody
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+func TestFsck(t *testing.T) {
+	cdb := tempdb(t)
+	server, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate server key %s")
+	alice, akey := signer(t, cdb, "alice")
+	evidence, err := store.Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+	staged, err := evidence.Stage(strings.NewReader("disk image"))
+	FailTest(t, err, "could not stage %s")
+	path, err := staged.Commit()
+	FailTest(t, err, "could not commit %s")
+	item := models.Item{Tag: "E-1", CaseID: "C1", Description: "laptop image", Digest: staged.Digest}
+	_, err = cdb.UploadItem(alice, item, entry(t, akey, UploadMessage(item.Tag, item.Description, item.Digest), item.CaseID, item.Tag), nil)
+	FailTest(t, err, "failed to register upload %s")
+	for _, m := range []string{"seized", "transferred"} {
+		record(t, cdb, alice, akey, "C1", m)
+	}
+	_, err = cdb.Checkpoint(server)
+	FailTest(t, err, "failed to checkpoint %s")
+
+	r, err := cdb.Fsck(&server.PublicKey, evidence)
+	FailTest(t, err, "fsck failed %s")
+	if !r.OK() || r.Audit.Signatures != 3 || r.Verified != 1 {
+		t.Fatalf("fsck of a sound database: %+v %+v", r.Audit, r.Findings)
+	}
+
+	// break a signature, orphan a row, and add a blob no item refers to and change another
+	_, err = cdb.Exec("UPDATE ledger SET message = 'returned' WHERE message = 'transferred'")
+	FailTest(t, err, "%s")
+	_, err = cdb.Exec("INSERT INTO hash_lists (item, ledger, size, block_size, root, blocks, created_at) VALUES ('E-2', 99, 0, 1, x'', x'', ?)", XONow())
+	FailTest(t, err, "%s")
+	stray, err := evidence.Stage(strings.NewReader("nobody's file"))
+	FailTest(t, err, "could not stage %s")
+	_, err = stray.Commit()
+	FailTest(t, err, "could not commit %s")
+	FailTest(t, os.Chmod(path, 0600), "%s")
+	FailTest(t, ioutil.WriteFile(path, []byte("tampered"), 0600), "%s")
+
+	r, err = cdb.Fsck(&server.PublicKey, evidence)
+	FailTest(t, err, "fsck failed %s")
+	if r.OK() || len(r.Audit.Failures) != 2 {
+		t.Fatalf("expected the bad signature and the checkpoint it breaks, got %v", r.Audit.Failures)
+	}
+	found := map[string]bool{}
+	for _, f := range r.Findings {
+		found[f.Check+" "+f.Subject] = true
+	}
+	for _, want := range []string{"orphan hash list of item E-2", "blob blob " + hex.EncodeToString(staged.Digest), "orphan blob " + hex.EncodeToString(stray.Digest)} {
+		if !found[want] {
+			t.Fatalf("fsck did not report %q, found %v", want, r.Findings)
+		}
+	}
+}
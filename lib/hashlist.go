@@ -0,0 +1,73 @@
+package custody
+
+import (
+	"fmt"
+	"strings"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// ItemHashes: the piecewise hash list of an evidence item with the signed registration entry that commits to it.
+// The server collects it, the client checks it and compares it with a copy of the file.
+type ItemHashes struct {
+	Item      *models.Item
+	Entry     *models.Ledger
+	PublicKey []byte
+	List      piecewise.List
+}
+
+// ItemHashes: the hash list recorded when the item with tag was registered.
+func (db *DB) ItemHashes(tag string) (*ItemHashes, error) {
+	item, err := models.ItemByTag(db, tag)
+	if err != nil {
+		return nil, err
+	}
+	hl, err := models.HashListByItem(db, tag)
+	if err != nil {
+		return nil, fmt.Errorf("item %s has no hash list: %s", tag, err)
+	}
+	entry, err := hl.LedgerByLedger(db)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := models.IdentityByID(db, entry.Identity)
+	if err != nil {
+		return nil, err
+	}
+	list, err := piecewise.Unmarshal(hl.Size, hl.BlockSize, hl.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	return &ItemHashes{Item: item, Entry: entry, PublicKey: signer.PublicKey, List: *list}, nil
+}
+
+// Verify: check that the registration entry of the item commits to the Merkle root of the hash list
+// and carries a valid signature of PublicKey. Returns the fingerprint of the signing key.
+func (h *ItemHashes) Verify() (string, error) {
+	if err := h.List.Check(); err != nil {
+		return "", err
+	}
+	if h.Entry.Item != h.Item.Tag {
+		return "", fmt.Errorf("entry %d registers item %q, not %s", h.Entry.ID, h.Entry.Item, h.Item.Tag)
+	}
+	commitment := HashListMessage("", &h.List)
+	if !strings.HasSuffix(h.Entry.Message, commitment) {
+		return "", fmt.Errorf("entry %d does not commit to the hash list with root %x", h.Entry.ID, h.List.Root())
+	}
+	base := strings.TrimSuffix(h.Entry.Message, commitment)
+	ingested := strings.HasPrefix(base, fmt.Sprintf("ingest item %s: %s: ", h.Item.Tag, h.Item.Description)) &&
+		strings.HasSuffix(base, fmt.Sprintf(": sha256 %x", h.Item.Digest))
+	if base != ItemMessage(h.Item.Tag, h.Item.Description) && base != UploadMessage(h.Item.Tag, h.Item.Description, h.Item.Digest) && !ingested {
+		return "", fmt.Errorf("entry %d is not the registration of item %s", h.Entry.ID, h.Item.Tag)
+	}
+	key, err := crypto.ParseECDSAPublicKey(h.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	if !crypto.Verify(EntryStatement(h.Entry.Message, h.Entry.CaseID, h.Entry.Item), h.Entry.Hash, key) {
+		return "", fmt.Errorf("signature on entry %d does not verify", h.Entry.ID)
+	}
+	return crypto.Fingerprint(h.PublicKey), nil
+}
@@ -0,0 +1,310 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// ImportFields: the fields of a legacy custody record. A mapping assigns a column of the input to each.
+// actor, time and action are required, the others may be empty. user is the enrolled user name of the actor.
+var ImportFields = []string{"actor", "user", "time", "action", "case", "item", "description", "sha256"}
+
+// importTimeFormats: the time layouts accepted in legacy records, times without a zone are UTC.
+var importTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+// ImportRecord: one event of a legacy custody log.
+// Nobody signed it when it happened, so the importing administrator signs ImportMessage instead.
+// User is the enrolled user the actor is, when the administrator knows it.
+type ImportRecord struct {
+	Source      string
+	Row         int
+	Actor       string
+	User        string
+	Time        time.Time
+	Action      string
+	Case        string
+	Item        string
+	Description string
+	Digest      []byte
+	Signature   []byte
+}
+
+// ImportError: a problem with one row of an import.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+func (e ImportError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// ImportResult: the outcome of an import, or of a dry run of one.
+type ImportResult struct {
+	DryRun   bool
+	Entries  []models.Ledger
+	Items    []string
+	Errors   []ImportError
+	Imported int
+}
+
+// Marker: the import marker stored with the entry, which says where the record came from.
+func (rec *ImportRecord) Marker() string {
+	return fmt.Sprintf("%s row %d", rec.Source, rec.Row)
+}
+
+// ImportMessage: the message the importing administrator signs for a legacy record.
+// It states that the entry was imported, who recorded the event and when, and every other field of the record,
+// free text quoted so that one field cannot pass for another. The entry signature covers the case and item.
+func ImportMessage(rec *ImportRecord) string {
+	msg := fmt.Sprintf("imported from %s: recorded by %q", rec.Marker(), rec.Actor)
+	if rec.User != "" {
+		msg += fmt.Sprintf(" as user %s", rec.User)
+	}
+	msg += fmt.Sprintf(" at %s: %q", rec.Time.UTC().Format(time.RFC3339), rec.Action)
+	if rec.Description != "" {
+		msg += fmt.Sprintf(", item description %q", rec.Description)
+	}
+	if rec.Digest != nil {
+		msg += fmt.Sprintf(", sha256 %x", rec.Digest)
+	}
+	return msg
+}
+
+// Sign: sign the import message of the record, in its case and about its item, with the administrator key.
+func (rec *ImportRecord) Sign(key *ecdsa.PrivateKey) (err error) {
+	rec.Signature, err = SignEntry(key, ImportMessage(rec), rec.Case, rec.Item)
+	return
+}
+
+// Validate: check the record for problems that do not depend on the database.
+func (rec *ImportRecord) Validate() []string {
+	var problems []string
+	if strings.TrimSpace(rec.Actor) == "" {
+		problems = append(problems, "actor is empty")
+	}
+	if rec.Time.IsZero() {
+		problems = append(problems, "time is empty")
+	} else if rec.Time.After(time.Now()) {
+		problems = append(problems, fmt.Sprintf("time %s is in the future", rec.Time.UTC().Format(time.RFC3339)))
+	}
+	if strings.TrimSpace(rec.Action) == "" {
+		problems = append(problems, "action is empty")
+	}
+	if rec.Digest != nil && len(rec.Digest) != 32 {
+		problems = append(problems, "sha256 must be 64 hex characters")
+	}
+	return problems
+}
+
+// ParseImport: read legacy records in csv or json format from r.
+// mapping assigns an input column to each of ImportFields, fields that are not mapped use the column of the same name.
+// A csv file must have a header row, a json file must hold an array of objects.
+// Rows that cannot be parsed are reported as errors, the rest are returned.
+func ParseImport(r io.Reader, format, source string, mapping map[string]string) ([]*ImportRecord, []ImportError, error) {
+	for field := range mapping {
+		if !knownField(field) {
+			return nil, nil, fmt.Errorf("unknown import field %q, the fields are %s", field, strings.Join(ImportFields, ", "))
+		}
+	}
+	var rows []map[string]string
+	var first int
+	switch format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		lines, err := cr.ReadAll()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(lines) == 0 {
+			return nil, nil, fmt.Errorf("%s is empty", source)
+		}
+		header := lines[0]
+		for _, line := range lines[1:] {
+			row := map[string]string{}
+			for i, v := range line {
+				if i < len(header) {
+					row[strings.TrimSpace(header[i])] = v
+				}
+			}
+			rows = append(rows, row)
+		}
+		// row numbers count the header, so they match the line numbers of the spreadsheet
+		first = 2
+	case "json":
+		var objs []map[string]interface{}
+		if err := json.NewDecoder(r).Decode(&objs); err != nil {
+			return nil, nil, err
+		}
+		for _, obj := range objs {
+			row := map[string]string{}
+			for k, v := range obj {
+				if v != nil {
+					row[k] = fmt.Sprint(v)
+				}
+			}
+			rows = append(rows, row)
+		}
+		first = 1
+	default:
+		return nil, nil, fmt.Errorf("unknown import format %s, use csv or json", format)
+	}
+
+	var recs []*ImportRecord
+	var errs []ImportError
+	for i, row := range rows {
+		get := func(field string) string {
+			col, ok := mapping[field]
+			if !ok {
+				col = field
+			}
+			return strings.TrimSpace(row[col])
+		}
+		rec := &ImportRecord{Source: source, Row: first + i, Actor: get("actor"), User: get("user"), Action: get("action"),
+			Case: get("case"), Item: get("item"), Description: get("description")}
+		var problems []string
+		if t := get("time"); t != "" {
+			var err error
+			if rec.Time, err = parseImportTime(t); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if d := get("sha256"); d != "" {
+			var err error
+			if rec.Digest, err = hex.DecodeString(d); err != nil {
+				problems = append(problems, fmt.Sprintf("sha256 %q is not hex", d))
+			}
+		}
+		problems = append(problems, rec.Validate()...)
+		if len(problems) > 0 {
+			errs = append(errs, ImportError{Row: rec.Row, Message: strings.Join(problems, "; ")})
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, errs, nil
+}
+
+func knownField(field string) bool {
+	for _, f := range ImportFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func parseImportTime(s string) (time.Time, error) {
+	for _, layout := range importTimeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time %q", s)
+}
+
+// Import: append legacy records to the ledger as imported entries signed by admin.
+// Items that are not registered yet are registered by admin with the description of their first record,
+// whose entry is their registration entry.
+// The import is all or nothing: if any record fails every record is reported and nothing is stored.
+// With dryRun the records are checked the same way and nothing is stored either.
+func (db *DB) Import(admin *models.Identity, recs []*ImportRecord, dryRun bool) (*ImportResult, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	tdb := &DB{XODB: tx, Policy: db.Policy}
+	pub, err := admin.Public()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{DryRun: dryRun}
+	sort.Slice(recs, func(a, b int) bool { return recs[a].Row < recs[b].Row })
+	for _, rec := range recs {
+		fail := func(format string, args ...interface{}) {
+			res.Errors = append(res.Errors, ImportError{Row: rec.Row, Message: fmt.Sprintf(format, args...)})
+		}
+		if problems := rec.Validate(); len(problems) > 0 {
+			fail("%s", strings.Join(problems, "; "))
+			continue
+		}
+		msg := ImportMessage(rec)
+		if !crypto.Verify(EntryStatement(msg, rec.Case, rec.Item), rec.Signature, pub) {
+			fail("signature by %s is invalid", admin.Name)
+			continue
+		}
+		if rec.User != "" {
+			ids, err := models.IdentitiesByName(tdb, rec.User)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				fail("actor %s is user %s, who is not enrolled", rec.Actor, rec.User)
+				continue
+			}
+		}
+		register := false
+		if rec.Item != "" {
+			item, err := models.ItemByTag(tdb, rec.Item)
+			switch {
+			case err == sql.ErrNoRows:
+				register = true
+			case err != nil:
+				return nil, err
+			case rec.Case != "" && item.CaseID != "" && rec.Case != item.CaseID:
+				fail("item %s belongs to case %s, not %s", rec.Item, item.CaseID, rec.Case)
+				continue
+			}
+		}
+		l, err := tdb.Append(admin, models.Ledger{Message: msg, Hash: rec.Signature, CaseID: rec.Case, Item: rec.Item, Imported: rec.Marker()})
+		if err != nil {
+			fail("%s", err)
+			continue
+		}
+		if register {
+			// the entry of the first record about the item is its registration, as for a registered item
+			item := &models.Item{Tag: rec.Item, CaseID: rec.Case, Description: rec.Description, Digest: rec.Digest,
+				CreatedAt: XONow(), Identity: admin.ID, Ledger: l.ID}
+			if err = item.Insert(tdb); err != nil {
+				return nil, err
+			}
+			s := models.ItemState{Item: item.Tag, State: StateCollected, Ledger: l.ID, UpdatedAt: l.CreatedAt}
+			if err = s.Insert(tdb); err != nil {
+				return nil, err
+			}
+			res.Items = append(res.Items, rec.Item)
+		}
+		res.Entries = append(res.Entries, l)
+	}
+	if dryRun || len(res.Errors) > 0 {
+		res.Entries = nil
+		return res, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	res.Imported = len(res.Entries)
+	return res, nil
+}
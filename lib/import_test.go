@@ -0,0 +1,103 @@
+package custody
+
+import (
+	"strings"
+	"testing"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+const legacyCSV = `Officer,Date,Event,Case,Evidence,Description
+J. Smith,2015-03-02 10:15,collected from scene,C9,E-1,Glock 19
+K. Jones,03/04/2015 09:00,received at lab,C9,E-1,
+,2015-03-05,missing actor,C9,E-1,
+L. Brown,yesterday,bad time,C9,E-1,
+`
+
+func TestImport(t *testing.T) {
+	cdb := tempdb(t)
+	admin, akey := signer(t, cdb, "admin")
+	mapping := map[string]string{"actor": "Officer", "time": "Date", "action": "Event", "case": "Case", "item": "Evidence", "description": "Description"}
+
+	recs, errs, err := ParseImport(strings.NewReader(legacyCSV), "csv", "legacy.csv", mapping)
+	FailTest(t, err, "could not parse %s")
+	if len(recs) != 2 || len(errs) != 2 || errs[0].Row != 4 || errs[1].Row != 5 {
+		t.Fatalf("expected rows 4 and 5 to fail, got %d records and errors %v", len(recs), errs)
+	}
+	if _, _, err = ParseImport(strings.NewReader(legacyCSV), "csv", "legacy.csv", map[string]string{"officer": "Officer"}); err == nil {
+		t.Fatal("accepted a mapping for an unknown field")
+	}
+	signer(t, cdb, "jsmith")
+	recs[0].User = "jsmith"
+	for _, rec := range recs {
+		FailTest(t, rec.Sign(akey), "could not sign %s")
+	}
+
+	// the signature covers every field of the record
+	recs[0].Description = "Glock 17"
+	if res, err := cdb.Import(admin, recs, true); err != nil || len(res.Errors) != 1 {
+		t.Fatalf("a record changed after signing was accepted %v", err)
+	}
+	recs[0].Description, recs[0].User = "Glock 19", "nobody"
+	FailTest(t, recs[0].Sign(akey), "could not sign %s")
+	if res, err := cdb.Import(admin, recs, true); err != nil || len(res.Errors) != 1 {
+		t.Fatalf("an actor mapped to an unknown user was accepted %v", err)
+	}
+	recs[0].User = "jsmith"
+	FailTest(t, recs[0].Sign(akey), "could not sign %s")
+
+	res, err := cdb.Import(admin, recs, true)
+	FailTest(t, err, "dry run failed %s")
+	if len(res.Errors) != 0 || len(res.Items) != 1 {
+		t.Fatalf("dry run reported %v and items %v", res.Errors, res.Items)
+	}
+	CheckCount(t, cdb, "select count(*) from ledger", 0)
+	CheckCount(t, cdb, "select count(*) from items", 0)
+
+	// one bad signature stops the whole import
+	good := recs[1].Signature
+	recs[1].Signature = recs[0].Signature
+	res, err = cdb.Import(admin, recs, false)
+	FailTest(t, err, "import failed %s")
+	if len(res.Errors) != 1 || res.Errors[0].Row != 3 || res.Imported != 0 {
+		t.Fatalf("expected row 3 to fail, got %v", res.Errors)
+	}
+	CheckCount(t, cdb, "select count(*) from ledger", 0)
+
+	recs[1].Signature = good
+	res, err = cdb.Import(admin, recs, false)
+	FailTest(t, err, "import failed %s")
+	if res.Imported != 2 {
+		t.Fatalf("imported %d records: %v", res.Imported, res.Errors)
+	}
+	ls, err := models.LedgersByItem(cdb, "E-1")
+	FailTest(t, err, "could not list entries %s")
+	if len(ls) != 2 || ls[0].Imported != "legacy.csv row 2" || !strings.Contains(ls[1].Message, `recorded by "K. Jones" at 2015-03-04T09:00:00Z`) ||
+		!strings.Contains(ls[0].Message, `recorded by "J. Smith" as user jsmith at`) {
+		t.Fatalf("imported entries are not marked: %+v", ls[0])
+	}
+	item, err := models.ItemByTag(cdb, "E-1")
+	FailTest(t, err, "item was not registered %s")
+	if item.Description != "Glock 19" || item.CaseID != "C9" || item.Ledger != ls[0].ID {
+		t.Fatalf("item registered as %+v", item)
+	}
+	st, err := cdb.State("E-1")
+	FailTest(t, err, "%s")
+	if st.State != StateCollected || st.Ledger != ls[0].ID {
+		t.Fatalf("the imported item is %s by entry %d", st.State, st.Ledger)
+	}
+	r, err := cdb.Audit(nil)
+	FailTest(t, err, "audit failed %s")
+	if !r.OK() || r.Signatures != 2 {
+		t.Fatalf("imported entries did not verify: %v", r.Failures)
+	}
+
+	// records the ledger refuses are reported row by row, in a dry run too
+	for _, dryRun := range []bool{true, false} {
+		res, err = cdb.Import(admin, recs, dryRun)
+		FailTest(t, err, "import failed %s")
+		if len(res.Errors) != 2 || res.Errors[0].Row != 2 || res.Errors[1].Row != 3 || !strings.Contains(res.Errors[0].Message, "already on a ledger entry") {
+			t.Fatalf("expected rows 2 and 3 to be refused, got %v", res.Errors)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package custody
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/container"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// IngestRecord: the acquisition metadata of a forensic image and the checks of its embedded hashes against the media.
+type IngestRecord struct {
+	Metadata container.Metadata
+	Checks   []container.Check
+}
+
+// IngestMessage: the message a user signs to register a forensic image as an evidence item.
+// It records the acquisition metadata, each embedded hash and whether the media still matched it,
+// and digest, the SHA-256 of the media.
+func IngestMessage(tag, description string, r *IngestRecord, digest []byte) string {
+	m := r.Metadata
+	acquired := "unknown"
+	if !m.Acquired.IsZero() {
+		acquired = m.Acquired.UTC().Format(time.RFC3339)
+	}
+	fields := []string{
+		fmt.Sprintf("%s image", m.Format),
+		fmt.Sprintf("case number %q", m.CaseNumber),
+		fmt.Sprintf("evidence number %q", m.EvidenceNumber),
+		fmt.Sprintf("examiner %q", m.Examiner),
+		fmt.Sprintf("acquired %s", acquired),
+		fmt.Sprintf("tool %q", m.Tool),
+		fmt.Sprintf("notes %q", m.Notes),
+		fmt.Sprintf("%d bytes", m.Size),
+	}
+	for _, c := range r.Checks {
+		if c.OK() {
+			fields = append(fields, fmt.Sprintf("%s %x verified", c.Algorithm, c.Embedded))
+		} else {
+			fields = append(fields, fmt.Sprintf("%s %x MISMATCH, media hashes to %x", c.Algorithm, c.Embedded, c.Computed))
+		}
+	}
+	if len(r.Checks) == 0 {
+		fields = append(fields, "no embedded hashes")
+	}
+	return fmt.Sprintf("ingest item %s: %s: %s: sha256 %x", tag, description, strings.Join(fields, ", "), digest)
+}
+
+// IngestItem: register a forensic image as an evidence item, item.Digest is the SHA-256 of its media.
+// entry must hold the signed IngestMessage, or its HashListMessage if list is not nil.
+// The checks must cover exactly the hashes embedded in the image.
+func (db *DB) IngestItem(identity *models.Identity, item models.Item, entry models.Ledger, r *IngestRecord, list *piecewise.List) (models.Item, error) {
+	if len(item.Digest) != sha256.Size {
+		return item, fmt.Errorf("an ingested item needs the SHA-256 digest of its media")
+	}
+	embedded := map[string][]byte{"md5": r.Metadata.MD5, "sha1": r.Metadata.SHA1, "sha256": r.Metadata.SHA256}
+	checked := map[string]bool{}
+	for _, c := range r.Checks {
+		if e := embedded[c.Algorithm]; e == nil || checked[c.Algorithm] || string(e) != string(c.Embedded) {
+			return item, fmt.Errorf("the %s check of item %s is not of a hash embedded in the image", c.Algorithm, item.Tag)
+		}
+		checked[c.Algorithm] = true
+	}
+	for algorithm, e := range embedded {
+		if e != nil && !checked[algorithm] {
+			return item, fmt.Errorf("the embedded %s of item %s was not checked", algorithm, item.Tag)
+		}
+	}
+	return db.registerItem(identity, item, entry, IngestMessage(item.Tag, item.Description, r, item.Digest), list)
+}
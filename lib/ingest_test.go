@@ -0,0 +1,48 @@
+package custody
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/container"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestIngestItem(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	media := []byte("sectors of a usb stick")
+	m, digest := md5.Sum(media), sha256.Sum256(media)
+	r := &IngestRecord{Metadata: container.Metadata{Format: container.FormatE01, CaseNumber: "C-12", EvidenceNumber: "3",
+		Examiner: "Jane Doe", Tool: "6.19", Acquired: time.Date(2021, 3, 4, 10, 19, 59, 0, time.UTC), Size: int64(len(media)), MD5: m[:]}}
+	item := models.Item{Tag: "E-3", CaseID: "C-12", Description: "usb stick", Digest: digest[:]}
+
+	// every embedded hash must have been checked
+	msg := IngestMessage(item.Tag, item.Description, r, item.Digest)
+	hash, err := SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	if _, err = cdb.IngestItem(alice, item, models.Ledger{Message: msg, Hash: hash}, r, nil); err == nil {
+		t.Fatal("accepted an image whose embedded MD5 was not checked")
+	}
+
+	r.Checks = []container.Check{{Algorithm: "md5", Embedded: m[:], Computed: m[:]}}
+	msg = IngestMessage(item.Tag, item.Description, r, item.Digest)
+	for _, want := range []string{`case number "C-12"`, `examiner "Jane Doe"`, "acquired 2021-03-04T10:19:59Z", fmt.Sprintf("md5 %x verified", m)} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("ingest message %q does not record %s", msg, want)
+		}
+	}
+	hash, err = SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	_, err = cdb.IngestItem(alice, item, models.Ledger{Message: msg, Hash: hash}, r, nil)
+	FailTest(t, err, "failed to ingest image %s")
+	ls, err := models.LedgersByItem(cdb, "E-3")
+	FailTest(t, err, "failed to list entries %s")
+	if len(ls) != 1 || ls[0].Message != msg {
+		t.Fatalf("expected the signed ingest message in the ledger, got %d entries", len(ls))
+	}
+}
@@ -0,0 +1,88 @@
+package custody
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// ItemMessage: the message a user signs to register an evidence item.
+func ItemMessage(tag, description string) string {
+	return fmt.Sprintf("register item %s: %s", tag, description)
+}
+
+// UploadMessage: the message a user signs to register an uploaded file as an evidence item.
+// Unlike ItemMessage it covers the SHA-256 digest of the file.
+func UploadMessage(tag, description string, digest []byte) string {
+	return fmt.Sprintf("upload item %s: %s: sha256 %x", tag, description, digest)
+}
+
+// HashListMessage: message extended to commit to the piecewise hash list of the item contents.
+func HashListMessage(message string, list *piecewise.List) string {
+	return fmt.Sprintf("%s: %d bytes in blocks of %d, merkle root %x", message, list.Size, list.BlockSize, list.Root())
+}
+
+// NewItem: register an evidence item. The registration is recorded as a ledger entry
+// signed by identity, entry must hold the signed ItemMessage for the item.
+// With a hash list the message is the HashListMessage of the ItemMessage, and the list is stored with the item.
+func (db *DB) NewItem(identity *models.Identity, item models.Item, entry models.Ledger, list *piecewise.List) (models.Item, error) {
+	return db.registerItem(identity, item, entry, ItemMessage(item.Tag, item.Description), list)
+}
+
+// UploadItem: register an uploaded file as an evidence item.
+// entry must hold the signed UploadMessage, so the signature covers the digest of the file,
+// or its HashListMessage if list is not nil.
+func (db *DB) UploadItem(identity *models.Identity, item models.Item, entry models.Ledger, list *piecewise.List) (models.Item, error) {
+	if len(item.Digest) != sha256.Size {
+		return item, fmt.Errorf("an uploaded item needs a SHA-256 digest")
+	}
+	return db.registerItem(identity, item, entry, UploadMessage(item.Tag, item.Description, item.Digest), list)
+}
+
+// registerItem: record the item and its registration entry, which must sign message,
+// and the hash list of the item if there is one. Either all of them are written or none.
+func (db *DB) registerItem(identity *models.Identity, item models.Item, entry models.Ledger, message string, list *piecewise.List) (models.Item, error) {
+	if item.Tag == "" {
+		return item, fmt.Errorf("an evidence item needs a tag")
+	}
+	if list != nil {
+		if err := list.Check(); err != nil {
+			return item, err
+		}
+		message = HashListMessage(message, list)
+	}
+	if entry.Message != message {
+		return item, fmt.Errorf("registration of item %s must sign %q", item.Tag, message)
+	}
+	_, err := models.ItemByTag(db, item.Tag)
+	switch {
+	case err == nil:
+		return item, fmt.Errorf("item %s is already registered", item.Tag)
+	case err != sql.ErrNoRows:
+		return item, err
+	}
+	entry.Item = item.Tag
+	entry.CaseID = item.CaseID
+	err = db.atomic(func(tdb *DB) error {
+		entry, err := tdb.Append(identity, entry)
+		if err != nil {
+			return err
+		}
+		item.Identity, item.Ledger = identity.ID, entry.ID
+		item.CreatedAt = XONow()
+		if err = item.Insert(tdb); err != nil {
+			return err
+		}
+		s := models.ItemState{Item: item.Tag, State: StateCollected, Ledger: entry.ID, UpdatedAt: entry.CreatedAt}
+		if err = s.Insert(tdb); err != nil || list == nil {
+			return err
+		}
+		hl := models.HashList{Item: item.Tag, Ledger: entry.ID, Size: list.Size, BlockSize: list.BlockSize,
+			Root: list.Root(), Blocks: list.Marshal(), CreatedAt: item.CreatedAt}
+		return hl.Insert(tdb)
+	})
+	return item, err
+}
@@ -0,0 +1,103 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestUploadItem(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	image := sha256.Sum256([]byte("disk image"))
+	other := sha256.Sum256([]byte("another image"))
+	item := models.Item{Tag: "E-1", CaseID: "C1", Description: "laptop image", Digest: image[:]}
+
+	// a registration that does not cover the digest is not an upload
+	msg := ItemMessage(item.Tag, item.Description)
+	hash, err := SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	if _, err = cdb.UploadItem(alice, item, models.Ledger{Message: msg, Hash: hash}, nil); err == nil {
+		t.Fatal("accepted an upload whose signature does not cover the digest")
+	}
+
+	// the signature must cover the digest of the uploaded file
+	msg = UploadMessage(item.Tag, item.Description, other[:])
+	hash, err = SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	if _, err = cdb.UploadItem(alice, item, models.Ledger{Message: msg, Hash: hash}, nil); err == nil {
+		t.Fatal("accepted an upload signed for another file")
+	}
+
+	msg = UploadMessage(item.Tag, item.Description, image[:])
+	hash, err = SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	_, err = cdb.UploadItem(alice, item, models.Ledger{Message: msg, Hash: hash}, nil)
+	FailTest(t, err, "failed to register upload %s")
+	ls, err := models.LedgersByItem(cdb, "E-1")
+	FailTest(t, err, "failed to list entries %s")
+	if len(ls) != 1 || ls[0].Message != msg {
+		t.Fatalf("expected the signed upload message in the ledger, got %d entries", len(ls))
+	}
+
+	// a registration that fails part way leaves neither the entry nor the item
+	_, err = cdb.Exec(`create trigger fail_state before insert on item_states begin select raise(abort, 'disk full'); end`)
+	FailTest(t, err, "could not create trigger %s")
+	item = models.Item{Tag: "E-3", CaseID: "C1", Description: "phone image", Digest: other[:]}
+	msg = UploadMessage(item.Tag, item.Description, other[:])
+	hash, err = SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	if _, err = cdb.UploadItem(alice, item, models.Ledger{Message: msg, Hash: hash}, nil); err == nil {
+		t.Fatal("registration succeeded without its item state")
+	}
+	if ls, _ = models.LedgersByItem(cdb, "E-3"); len(ls) != 0 {
+		t.Fatal("a failed registration left its entry in the ledger")
+	}
+	if _, err = models.ItemByTag(cdb, "E-3"); err == nil {
+		t.Fatal("a failed registration left its item")
+	}
+}
+
+func TestItemHashes(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	data := bytes.Repeat([]byte("sector "), 1000)
+	list, err := piecewise.Hash(bytes.NewReader(data), int64(len(data)), 512)
+	FailTest(t, err, "failed to hash %s")
+	item := models.Item{Tag: "E-2", CaseID: "C1", Description: "usb drive"}
+
+	// the signature must cover the merkle root of the hash list
+	msg := ItemMessage(item.Tag, item.Description)
+	hash, err := SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	if _, err = cdb.NewItem(alice, item, models.Ledger{Message: msg, Hash: hash}, list); err == nil {
+		t.Fatal("accepted a hash list the registration does not commit to")
+	}
+	msg = HashListMessage(msg, list)
+	hash, err = SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	_, err = cdb.NewItem(alice, item, models.Ledger{Message: msg, Hash: hash}, list)
+	FailTest(t, err, "failed to register item %s")
+
+	h, err := cdb.ItemHashes("E-2")
+	FailTest(t, err, "failed to read hash list %s")
+	_, err = h.Verify()
+	FailTest(t, err, "hash list does not verify %s")
+	data[2000]++
+	copied, err := piecewise.Hash(bytes.NewReader(data), int64(len(data)), h.List.BlockSize)
+	FailTest(t, err, "failed to hash %s")
+	ranges, err := piecewise.Diff(&h.List, copied)
+	FailTest(t, err, "failed to compare %s")
+	if len(ranges) != 1 || ranges[0].Start != 1536 || ranges[0].End != 2048 {
+		t.Fatalf("expected bytes 1536-2047 to differ, got %v", ranges)
+	}
+
+	// a hash list changed after registration no longer matches the signed root
+	h.List.Blocks[3] = copied.Blocks[3]
+	if _, err = h.Verify(); err == nil {
+		t.Fatal("a changed hash list verified")
+	}
+}
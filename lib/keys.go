@@ -0,0 +1,122 @@
+package custody
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// Key records. Every identity row is a key a user holds or held. A rotation is a ledger entry signed with the current
+// key of a user that names their next key, which becomes current from then on. A revocation is a ledger entry, signed by the user
+// or an admin, stating that a key must no longer be trusted: entries signed with it before the revocation stay valid,
+// and no entry signed with it is accepted afterwards. The records are kept in key_records and exported in bundles,
+// so that a verifier can tell which entries a revoked key signed in time.
+
+// The events of key records.
+const (
+	KeyRotated = "rotate"
+	KeyRevoked = "revoke"
+)
+
+// RevocationMessage: the message a user signs to revoke the key of the user name with the public key key.
+func RevocationMessage(name string, key []byte, reason string) string {
+	return fmt.Sprintf("revoke key %s of %s: %s", crypto.Fingerprint(key), name, reason)
+}
+
+// KeyRotationMessage: the message a user signs with their current key to replace it with the public key key.
+func KeyRotationMessage(name string, key []byte) string {
+	return fmt.Sprintf("rotate key of %s to %s", name, crypto.Fingerprint(key))
+}
+
+// KeyStatus: a key of a user and the records about it.
+type KeyStatus struct {
+	Identity *models.Identity
+	Records  []*models.KeyRecord
+	Revoked  bool
+	Rotated  bool
+}
+
+// Revoked: true if the key of identity was revoked.
+func (db *DB) Revoked(identity *models.Identity) (bool, error) {
+	var n int
+	err := db.QueryRow(`select count(*) from key_records where identity = ? and event = ?`, identity.ID, KeyRevoked).Scan(&n)
+	return n > 0, err
+}
+
+// Keys: every key the user name has held, oldest first, with their records.
+func (db *DB) Keys(name string) ([]*KeyStatus, error) {
+	ids, err := models.IdentitiesByName(db, name)
+	if err != nil {
+		return nil, err
+	}
+	var ks []*KeyStatus
+	for _, i := range ids {
+		k := &KeyStatus{Identity: i}
+		if k.Records, err = models.KeyRecordsByIdentity(db, i.ID); err != nil {
+			return nil, err
+		}
+		for _, r := range k.Records {
+			k.Revoked = k.Revoked || r.Event == KeyRevoked
+			k.Rotated = k.Rotated || r.Event == KeyRotated
+		}
+		ks = append(ks, k)
+	}
+	return ks, nil
+}
+
+// Revoke: revoke the key target, entry must hold the RevocationMessage signed by identity.
+func (db *DB) Revoke(identity, target *models.Identity, reason string, entry models.Ledger) (*models.KeyRecord, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("a revocation needs a reason, such as the key was lost")
+	}
+	revoked, err := db.Revoked(target)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("key %s of %s is already revoked", crypto.Fingerprint(target.PublicKey), target.Name)
+	}
+	if msg := RevocationMessage(target.Name, target.PublicKey, reason); entry.Message != msg {
+		return nil, fmt.Errorf("the revocation must sign %q", msg)
+	}
+	return db.keyRecord(identity, target, KeyRevoked, entry)
+}
+
+// Rotate: enroll key as the next key of the user of current, entry must hold the KeyRotationMessage signed with current.
+// The entry, its record and the new identity are written together.
+func (db *DB) Rotate(current *models.Identity, key []byte, entry models.Ledger) (i models.Identity, err error) {
+	ids, err := models.IdentitiesByName(db, current.Name)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if bytes.Equal(id.PublicKey, key) {
+			return i, fmt.Errorf("key %s was already enrolled for %s", crypto.Fingerprint(key), current.Name)
+		}
+	}
+	if msg := KeyRotationMessage(current.Name, key); entry.Message != msg {
+		return i, fmt.Errorf("the rotation must sign %q", msg)
+	}
+	err = db.atomic(func(tdb *DB) error {
+		if _, err := tdb.keyRecord(current, current, KeyRotated, entry); err != nil {
+			return err
+		}
+		i, err = tdb.NewUser(current.Name, key)
+		return err
+	})
+	return
+}
+
+// keyRecord: append entry signed by identity and record it as the event about the key target, both or neither.
+func (db *DB) keyRecord(identity, target *models.Identity, event string, entry models.Ledger) (r *models.KeyRecord, err error) {
+	err = db.atomic(func(tdb *DB) error {
+		if entry, err = tdb.Append(identity, entry); err != nil {
+			return err
+		}
+		r = &models.KeyRecord{Identity: target.ID, Event: event, Ledger: entry.ID, CreatedAt: entry.CreatedAt}
+		return r.Insert(tdb)
+	})
+	return
+}
@@ -0,0 +1,94 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestRevoke(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	record(t, cdb, alice, akey, "C1", "seize laptop")
+
+	revoke := func(reason string) error {
+		_, err := cdb.Revoke(alice, alice, reason, entry(t, akey, RevocationMessage("alice", alice.PublicKey, reason), "", ""))
+		return err
+	}
+	if revoke("") == nil {
+		t.Fatal("a key was revoked without a reason")
+	}
+	FailTest(t, revoke("laptop stolen"), "could not revoke %s")
+	if revoke("laptop stolen") == nil {
+		t.Fatal("a key was revoked twice")
+	}
+	if _, err := cdb.Append(alice, entry(t, akey, "image laptop", "", "")); err == nil || !strings.Contains(err.Error(), "Revoked") {
+		t.Fatal("an entry signed with a revoked key was appended")
+	}
+	ks, err := cdb.Keys("alice")
+	FailTest(t, err, "%s")
+	if len(ks) != 1 || !ks[0].Revoked || len(ks[0].Records) != 1 || ks[0].Records[0].Event != KeyRevoked {
+		t.Fatalf("the revocation was not recorded %+v", ks)
+	}
+
+	// the entry signed before the revocation still verifies, and the bundle carries the revocation
+	b, err := cdb.Export(akey, "C1")
+	FailTest(t, err, "export failed %s")
+	data, err := b.Bytes()
+	FailTest(t, err, "could not write bundle %s")
+	read, err := ReadBundle(data)
+	FailTest(t, err, "could not read bundle %s")
+	if r := read.Verify(nil, nil); !r.OK() || r.Entries != 1 || r.KeyRecords != 1 {
+		t.Fatalf("bundle did not verify: %+v", r)
+	}
+	read.KeyEntries = []*models.Ledger{}
+	if read.Verify(nil, nil).OK() {
+		t.Fatal("a key record without its entry verified")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	old := enroll(t, ck, "alice")
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	FailTest(t, err, "failed to encode key %s")
+
+	rotate := func(signer *ecdsa.PrivateKey, msg string) error {
+		sig, err := cryptopasta.Sign([]byte(msg), signer)
+		FailTest(t, err, "could not sign %s")
+		return ck.Create(&RecordRequest{Name: "alice", PublicKey: pub, Data: []byte(msg), Hash: sig}, &models.Identity{})
+	}
+	if err := ck.Create(&RecordRequest{Name: "alice", PublicKey: pub}, &models.Identity{}); err == nil {
+		t.Fatal("a new key was enrolled for a taken name without a signature")
+	}
+	if rotate(key, KeyRotationMessage("alice", pub)) == nil {
+		t.Fatal("a new key signed its own rotation")
+	}
+	if rotate(old, KeyRotationMessage("bob", pub)) == nil {
+		t.Fatal("a rotation signed the wrong message")
+	}
+	FailTest(t, rotate(old, KeyRotationMessage("alice", pub)), "could not rotate %s")
+	if rotate(old, KeyRotationMessage("alice", pub)) == nil {
+		t.Fatal("a key was enrolled twice")
+	}
+
+	ks, err := ck.DB.Keys("alice")
+	FailTest(t, err, "%s")
+	if len(ks) != 2 || !ks[0].Rotated || ks[0].Revoked || ks[1].Rotated || len(ks[0].Records) != 1 {
+		t.Fatalf("the rotation was not recorded %+v", ks)
+	}
+	alice, err := ck.identity("alice")
+	FailTest(t, err, "%s")
+	if !bytes.Equal(alice.PublicKey, pub) {
+		t.Fatal("the new key is not the current key")
+	}
+	record(t, &ck.DB, alice, key, "C1", "seize laptop")
+}
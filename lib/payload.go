@@ -0,0 +1,132 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.gatech.edu/NIJ-Grant/custody/jsonschema"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// Typed entries. An admin registers an entry type with a JSON Schema, such as acquisition with the serial of the
+// device and the write blocker used. A typed entry signs the PayloadMessage of its type and a JSON object,
+// which must follow the schema, and the top level fields of the object are stored so that entries can be found
+// by their values. Types cannot be changed once registered, a new version of a schema is a new type.
+// Entries whose messages are not typed are not checked.
+
+// entryTypeName: the names an entry type may have.
+var entryTypeName = regexp.MustCompile(`^[a-z][a-z0-9_.-]*$`)
+
+// EntryTypeMessage: the message an admin signs to register the entry type name with schema.
+func EntryTypeMessage(name string, schema []byte) string {
+	return fmt.Sprintf("register entry type %s: schema sha256 %x", name, sha256.Sum256(schema))
+}
+
+// PayloadMessage: the message a user signs for an entry of type entryType with the JSON object payload.
+func PayloadMessage(entryType string, payload []byte) string {
+	return fmt.Sprintf("type %s: %s", entryType, payload)
+}
+
+var payloadMessage = regexp.MustCompile(`(?s)^type (\S+): (\{.*\})$`)
+
+// ParsePayload: the type and payload of a typed message, ok false if message is not typed.
+func ParsePayload(message string) (entryType string, payload json.RawMessage, ok bool) {
+	m := payloadMessage.FindStringSubmatch(message)
+	if m == nil {
+		return "", nil, false
+	}
+	return m[1], json.RawMessage(m[2]), true
+}
+
+// AddEntryType: register the entry type name with schema, entry must hold the signed EntryTypeMessage.
+func (db *DB) AddEntryType(identity *models.Identity, name string, schema []byte, entry models.Ledger) (*models.EntryType, error) {
+	if !entryTypeName.MatchString(name) {
+		return nil, fmt.Errorf("an entry type name is lower case letters, digits, _, . and -, starting with a letter")
+	}
+	if _, err := jsonschema.Compile(schema); err != nil {
+		return nil, err
+	}
+	_, err := models.EntryTypeByName(db, name)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("entry type %s is already registered, register a new version under another name", name)
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+	if msg := EntryTypeMessage(name, schema); entry.Message != msg {
+		return nil, fmt.Errorf("the entry type must sign %q", msg)
+	}
+	if entry, err = db.Append(identity, entry); err != nil {
+		return nil, err
+	}
+	et := &models.EntryType{Name: name, Schema: string(schema), Ledger: entry.ID, CreatedAt: XONow()}
+	return et, et.Insert(db)
+}
+
+// CheckPayload: check the payload of a typed message against its type, and return its top level fields.
+// A message that is not typed has no type and no fields.
+func (db *DB) CheckPayload(message string) (string, map[string]string, error) {
+	entryType, payload, ok := ParsePayload(message)
+	if !ok {
+		return "", nil, nil
+	}
+	et, err := models.EntryTypeByName(db, entryType)
+	if err == sql.ErrNoRows {
+		return "", nil, fmt.Errorf("no entry type %s", entryType)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	schema, err := jsonschema.Compile([]byte(et.Schema))
+	if err != nil {
+		return "", nil, err
+	}
+	if err = schema.Validate(payload); err != nil {
+		return "", nil, fmt.Errorf("the payload does not follow the schema of %s: %s", entryType, err)
+	}
+	fields, err := PayloadFields(payload)
+	return entryType, fields, err
+}
+
+// PayloadFields: the top level fields of a JSON object, strings as they are and other values as compact JSON.
+func PayloadFields(payload []byte) (map[string]string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &object); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	for name, raw := range object {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			fields[name] = s
+			continue
+		}
+		var b bytes.Buffer
+		if err := json.Compact(&b, raw); err != nil {
+			return nil, err
+		}
+		fields[name] = b.String()
+	}
+	return fields, nil
+}
+
+// RecordFields: store the fields of the typed entry l.
+func (db *DB) RecordFields(l models.Ledger, entryType string, fields map[string]string) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := models.EntryField{Ledger: l.ID, EntryType: entryType, Name: name, Value: fields[name]}
+		if err := f.Insert(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
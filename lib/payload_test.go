@@ -0,0 +1,85 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+const acquisitionSchema = `{"type": "object", "properties": {"serial": {"type": "string"}, "write_blocker": {"type": "string"},
+  "sectors": {"type": "integer"}}, "required": ["serial", "write_blocker"]}`
+
+func TestTypedEntries(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	admin := enroll(t, ck, "admin")
+	keys := map[string]*ecdsa.PrivateKey{"admin": admin}
+	for name, role := range map[string]string{"officer": RoleOfficer, "examiner": RoleExaminer} {
+		keys[name] = enroll(t, ck, name)
+		FailTest(t, ck.Grant(signed(t, "Clerk.Grant", "admin", admin, RecordRequest{Subject: name, Role: role}), &models.Role{}), "could not grant role %s")
+	}
+
+	addType := func(name, by string) error {
+		req := sign(t, by, keys[by], EntryTypeMessage("acquisition", []byte(acquisitionSchema)), "", "")
+		req.Type, req.Schema = name, []byte(acquisitionSchema)
+		return ck.AddEntryType(req, &models.EntryType{})
+	}
+	if addType("acquisition", "officer") == nil {
+		t.Fatal("an officer registered an entry type")
+	}
+	if addType("analysis", "admin") == nil {
+		t.Fatal("the signature of one type registered another")
+	}
+	FailTest(t, addType("acquisition", "admin"), "could not register the entry type %s")
+	if addType("acquisition", "admin") == nil {
+		t.Fatal("an entry type was registered twice")
+	}
+
+	validate := func(name, caseID, message string) error {
+		req := sign(t, name, keys[name], message, caseID, "")
+		return ck.Validate(req, &Receipt{})
+	}
+	FailTest(t, validate("officer", "C1", PayloadMessage("acquisition", []byte(`{"serial":"WD-1","write_blocker":"T35u","sectors":1000}`))),
+		"a valid payload was refused %s")
+	FailTest(t, validate("examiner", "C2", PayloadMessage("acquisition", []byte(`{"serial":"WD-2","write_blocker":"T35u"}`))), "%s")
+	FailTest(t, validate("officer", "C1", "collected a laptop"), "an untyped message was refused %s")
+	if validate("officer", "C1", PayloadMessage("acquisition", []byte(`{"serial":"WD-3"}`))) == nil {
+		t.Fatal("a payload without a required field was accepted")
+	}
+	if validate("officer", "C1", PayloadMessage("photo", []byte(`{"gps":"33.77,-84.39"}`))) == nil {
+		t.Fatal("a payload of an unknown type was accepted")
+	}
+
+	query := func(name, caseID string, fields map[string]string) []PublishedEntry {
+		var es []PublishedEntry
+		FailTest(t, ck.Query(signed(t, "Clerk.Query", name, keys[name], RecordRequest{Case: caseID, Type: "acquisition", Fields: fields}), &es), "%s")
+		return es
+	}
+	es := query("admin", "", map[string]string{"sectors": "1000"})
+	if len(es) != 1 || es[0].Type != "acquisition" || string(es[0].Payload) != `{"serial":"WD-1","write_blocker":"T35u","sectors":1000}` {
+		t.Fatalf("wrong entries for sectors 1000 %+v", es)
+	}
+	if es = query("admin", "", map[string]string{"write_blocker": "T35u"}); len(es) != 2 {
+		t.Fatalf("expected both acquisitions, got %+v", es)
+	}
+	if es = query("officer", "", nil); len(es) != 1 || es[0].Signer != "officer" {
+		t.Fatalf("an officer found entries of others %+v", es)
+	}
+	if ck.Query(signed(t, "Clerk.Query", "officer", keys["officer"], RecordRequest{Case: "C2", Type: "acquisition"}), &es) == nil {
+		t.Fatal("an officer queried a case they cannot read")
+	}
+
+	// a typed entry whose fields cannot be stored is not appended either
+	var before, after int
+	FailTest(t, ck.DB.QueryRow(`select count(*) from ledger`).Scan(&before), "%s")
+	_, err := ck.DB.Exec(`create trigger fail_fields before insert on entry_fields begin select raise(abort, 'disk full'); end`)
+	FailTest(t, err, "could not create trigger %s")
+	if validate("officer", "C1", PayloadMessage("acquisition", []byte(`{"serial":"WD-4","write_blocker":"T35u"}`))) == nil {
+		t.Fatal("an entry was accepted without its fields")
+	}
+	FailTest(t, ck.DB.QueryRow(`select count(*) from ledger`).Scan(&after), "%s")
+	if after != before {
+		t.Fatalf("the entry stayed in the ledger without its fields, %d entries before and %d after", before, after)
+	}
+}
@@ -0,0 +1,103 @@
+package custody
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// page layout of writePDF in points, US Letter with Courier 9pt
+const (
+	pdfWidth      = 612
+	pdfHeight     = 792
+	pdfMargin     = 54
+	pdfFontSize   = 9
+	pdfLeading    = 11
+	pdfLineChars  = 92
+	pdfPageLines  = (pdfHeight - 2*pdfMargin) / pdfLeading
+	pdfFirstObjID = 5
+)
+
+// writePDF: lay out lines of text on pages in a monospaced font.
+// Long lines are wrapped. The document carries no creation date or random ID,
+// so the same lines always produce the same bytes and the file can itself be hashed.
+func writePDF(w io.Writer, title string, lines []string) error {
+	var wrapped []string
+	for _, l := range lines {
+		l = pdfASCII(l)
+		for len(l) > pdfLineChars {
+			wrapped = append(wrapped, l[:pdfLineChars])
+			l = "    " + l[pdfLineChars:]
+		}
+		wrapped = append(wrapped, l)
+	}
+	var pages [][]string
+	for len(wrapped) > 0 {
+		n := pdfPageLines
+		if n > len(wrapped) {
+			n = len(wrapped)
+		}
+		pages = append(pages, wrapped[:n])
+		wrapped = wrapped[n:]
+	}
+	if len(pages) == 0 {
+		pages = append(pages, nil)
+	}
+
+	buf := &bytes.Buffer{}
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n")
+
+	// objects 1-4 are fixed, each page then takes a page object and a content stream
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pdfFirstObjID+2*i))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (custody) >>", pdfEscape(pdfASCII(title))))
+	for i, page := range pages {
+		content := &bytes.Buffer{}
+		fmt.Fprintf(content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfHeight-pdfMargin)
+		for _, l := range page {
+			fmt.Fprintf(content, "(%s) Tj T*\n", pdfEscape(l))
+		}
+		fmt.Fprintf(content, "ET\n")
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, pdfFirstObjID+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfASCII: the standard Courier font only covers ASCII, replace everything else.
+func pdfASCII(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// pdfEscape: escape a string for use in a PDF literal string.
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
@@ -0,0 +1,331 @@
+package custody
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// Policies. A policy names the operations recorded by signed entries and the rules each of them must follow:
+// who may record it, which fields the entry must carry, which operations must already be recorded on the item,
+// and whether anything may follow it. The policy is a JSON file loaded by custody serve, for example
+//
+//	{
+//	  "mode": "enforce",
+//	  "operations": [
+//	    {"name": "acquire", "match": "^acquired?\\b", "roles": ["officer", "examiner"], "require": ["case", "item"]},
+//	    {"name": "analyze", "require": ["item"], "roles": ["examiner"], "after": ["acquire"]},
+//	    {"name": "release", "match": "^released? to owner\\b", "after": ["acquire"], "final": true},
+//	    {"name": "dispose", "match": "^dispose of item ", "approvals": {"threshold": 2, "roles": ["custodian", "admin"]}}
+//	  ]
+//	}
+//
+// The policy applies to every entry appended to the ledger, whichever request appends it, except the entries
+// signed by the server and imported ones, which record what happened elsewhere. In enforce mode an entry that
+// breaks a rule is refused, in audit mode it is appended and the violation recorded.
+// An entry that matches no operation is allowed unless the policy is strict.
+
+// The modes of a Policy.
+const (
+	PolicyEnforce = "enforce"
+	PolicyAudit   = "audit"
+)
+
+// The fields an Operation may require.
+var policyFields = map[string]func(l *models.Ledger) string{
+	"case": func(l *models.Ledger) string { return l.CaseID },
+	"item": func(l *models.Ledger) string { return l.Item },
+}
+
+// Operation: an operation recorded by signed entries and its rules.
+type Operation struct {
+	Name string `json:"name"`
+	// Match is a regular expression the message of the entry matches, by default the name at the start
+	// of the message as a word, ignoring case.
+	Match string `json:"match,omitempty"`
+	// Roles are the roles that may record the operation, any role if empty.
+	Roles []string `json:"roles,omitempty"`
+	// Require are the fields the entry must carry, case and item.
+	Require []string `json:"require,omitempty"`
+	// After are operations one of which must already be recorded on the item.
+	After []string `json:"after,omitempty"`
+	// Once allows the operation only once per item.
+	Once bool `json:"once,omitempty"`
+	// Final allows no entry at all on the item after the operation.
+	Final bool `json:"final,omitempty"`
+	// Approvals are the approvals the operation needs: it is only appended as a proposed entry, see Propose,
+	// whose requirement covers them. The proposer chooses the deadline.
+	Approvals *Requirement `json:"approvals,omitempty"`
+
+	match *regexp.Regexp
+}
+
+// Policy: the operations a custody server accepts and how it treats entries that break their rules.
+type Policy struct {
+	// Mode is enforce or audit, enforce if empty.
+	Mode string `json:"mode,omitempty"`
+	// Strict rejects entries that match no operation.
+	Strict     bool        `json:"strict,omitempty"`
+	Operations []Operation `json:"operations"`
+}
+
+// Violation: a rule of the policy an entry breaks. Rule is the operation and the rule, such as analyze.after.
+type Violation struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("rule %s: %s", v.Rule, v.Reason)
+}
+
+// LoadPolicy: read and check the policy in the JSON file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	// a misspelt rule must not be ignored and leave the operation unconstrained
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("policy %s is not valid: %s", path, err)
+	}
+	if err = p.Compile(); err != nil {
+		return nil, fmt.Errorf("policy %s: %s", path, err)
+	}
+	return &p, nil
+}
+
+// Compile: check the policy and compile its patterns.
+func (p *Policy) Compile() error {
+	switch p.Mode {
+	case "":
+		p.Mode = PolicyEnforce
+	case PolicyEnforce, PolicyAudit:
+	default:
+		return fmt.Errorf("unknown mode %s, the modes are %s and %s", p.Mode, PolicyEnforce, PolicyAudit)
+	}
+	names := map[string]bool{}
+	for i := range p.Operations {
+		op := &p.Operations[i]
+		if op.Name == "" || names[op.Name] {
+			return fmt.Errorf("operation %d needs a name of its own", i+1)
+		}
+		names[op.Name] = true
+		pattern := op.Match
+		if pattern == "" {
+			pattern = `(?i)^` + regexp.QuoteMeta(op.Name) + `\b`
+		}
+		var err error
+		if op.match, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("operation %s: %s", op.Name, err)
+		}
+		for _, role := range op.Roles {
+			if !ValidRole(role) {
+				return fmt.Errorf("operation %s: unknown role %s, the roles are %s", op.Name, role, strings.Join(Roles, ", "))
+			}
+		}
+		for _, field := range op.Require {
+			if policyFields[field] == nil {
+				return fmt.Errorf("operation %s: unknown field %s, operations can require case and item", op.Name, field)
+			}
+		}
+		if op.Approvals != nil {
+			if err := op.Approvals.check(); err != nil {
+				return fmt.Errorf("operation %s: approvals: %s", op.Name, err)
+			}
+		}
+	}
+	for _, op := range p.Operations {
+		for _, after := range op.After {
+			if !names[after] {
+				return fmt.Errorf("operation %s: comes after %s, which is not an operation", op.Name, after)
+			}
+		}
+	}
+	return nil
+}
+
+// Operation: the first operation whose pattern matches message, nil if none does or there is no policy.
+// The operation of a proposal is the operation of the entry it proposes.
+func (p *Policy) Operation(message string) *Operation {
+	if p == nil {
+		return nil
+	}
+	message = ProposedMessage(message)
+	for i := range p.Operations {
+		if p.Operations[i].match.MatchString(message) {
+			return &p.Operations[i]
+		}
+	}
+	return nil
+}
+
+// Check: the rules the entry would break if the user holding role appended it.
+// The entries already recorded on the item are read from db.
+func (p *Policy) Check(db *DB, role string, entry *models.Ledger) ([]Violation, error) {
+	var vs []Violation
+	op := p.Operation(entry.Message)
+	if op == nil && p.Strict {
+		vs = append(vs, Violation{Rule: "strict", Reason: "the entry matches no operation of the policy"})
+	}
+	if op != nil {
+		if len(op.Roles) > 0 && !contains(op.Roles, role) {
+			vs = append(vs, Violation{Rule: op.Name + ".roles",
+				Reason: fmt.Sprintf("%s may be recorded by %s, not by %s", op.Name, strings.Join(op.Roles, " or "), roleName(role))})
+		}
+		for _, field := range op.Require {
+			if policyFields[field](entry) == "" {
+				vs = append(vs, Violation{Rule: op.Name + ".require", Reason: fmt.Sprintf("%s must name the %s", op.Name, field)})
+			}
+		}
+		if op.Approvals != nil {
+			approved, err := db.approved(entry, *op.Approvals)
+			if err != nil {
+				return nil, err
+			}
+			if !approved {
+				vs = append(vs, Violation{Rule: op.Name + ".approvals",
+					Reason: fmt.Sprintf("%s needs %s, propose it for approval", op.Name, op.Approvals.Needs())})
+			}
+		}
+	}
+	if entry.Item == "" {
+		if op != nil && (len(op.After) > 0 || op.Once) {
+			vs = append(vs, Violation{Rule: op.Name + ".item", Reason: fmt.Sprintf("%s is ordered per item and must name the item", op.Name)})
+		}
+		return vs, nil
+	}
+
+	// the operations already recorded on the item, in ledger order
+	ls, err := models.LedgersByItem(db, entry.Item)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].ID < ls[j].ID })
+	done := map[string]int{}
+	for _, l := range ls {
+		prev := p.Operation(l.Message)
+		if prev == nil {
+			continue
+		}
+		if prev.Final {
+			vs = append(vs, Violation{Rule: prev.Name + ".final",
+				Reason: fmt.Sprintf("entry %d recorded %s on item %s, nothing may be recorded on it after that", l.ID, prev.Name, entry.Item)})
+		}
+		if _, ok := done[prev.Name]; !ok {
+			done[prev.Name] = l.ID
+		}
+	}
+	if op == nil {
+		return vs, nil
+	}
+	if id, ok := done[op.Name]; ok && op.Once {
+		vs = append(vs, Violation{Rule: op.Name + ".once",
+			Reason: fmt.Sprintf("entry %d already recorded %s on item %s, it happens once per item", id, op.Name, entry.Item)})
+	}
+	if len(op.After) > 0 {
+		found := false
+		for _, after := range op.After {
+			_, ok := done[after]
+			found = found || ok
+		}
+		if !found {
+			vs = append(vs, Violation{Rule: op.Name + ".after",
+				Reason: fmt.Sprintf("item %s has no %s entry, %s must come after it", entry.Item, strings.Join(op.After, " or "), op.Name)})
+		}
+	}
+	return vs, nil
+}
+
+// CheckEntry: apply the policy to an entry about to be appended by identity holding role. In enforce mode
+// the violations deny the request for method, in audit mode they are returned to be recorded.
+func (p *Policy) CheckEntry(db *DB, identity *models.Identity, role, method string, entry *models.Ledger) ([]Violation, error) {
+	if p == nil {
+		return nil, nil
+	}
+	vs, err := p.Check(db, role, entry)
+	if err != nil || len(vs) == 0 {
+		return nil, err
+	}
+	if p.Mode == PolicyEnforce {
+		target := caseTarget(entry.CaseID)
+		if entry.Item != "" {
+			target = "item " + entry.Item
+		}
+		reasons := make([]string, len(vs))
+		for i, v := range vs {
+			reasons[i] = "policy " + v.String()
+		}
+		return nil, db.Deny(identity.Name, method, target, strings.Join(reasons, "; "))
+	}
+	return vs, nil
+}
+
+// checkPolicy: apply db.Policy to entry, about to be appended by identity.
+func (db *DB) checkPolicy(identity *models.Identity, entry *models.Ledger) ([]Violation, error) {
+	if db.Policy == nil || identity.Name == SystemName || entry.Imported != "" {
+		return nil, nil
+	}
+	role, err := db.RoleOf(identity.Name)
+	if err != nil {
+		return nil, err
+	}
+	return db.Policy.CheckEntry(db, identity, role, "DB.Append", entry)
+}
+
+// Violations: the recorded violations of the entry with id.
+func (db *DB) Violations(id int) ([]Violation, error) {
+	rows, err := db.Query(`select rule, reason from policy_violations where ledger = ? order by id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var vs []Violation
+	for rows.Next() {
+		var v Violation
+		if err = rows.Scan(&v.Rule, &v.Reason); err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, rows.Err()
+}
+
+// RecordViolations: record the violations of the appended entry l.
+func (db *DB) RecordViolations(l models.Ledger, vs []Violation) error {
+	for _, v := range vs {
+		log.Printf("entry %d breaks policy %s", l.ID, v)
+		pv := models.PolicyViolation{Ledger: l.ID, Rule: v.Rule, Reason: v.Reason, CreatedAt: XONow()}
+		if err := pv.Insert(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// roleName: role for messages, which says so when the user has none.
+func roleName(role string) string {
+	if role == "" {
+		return "a user without a role"
+	}
+	return role
+}
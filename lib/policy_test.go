@@ -0,0 +1,108 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestPolicy(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	admin := enroll(t, ck, "admin")
+	keys := map[string]*ecdsa.PrivateKey{}
+	for name, role := range map[string]string{"officer": RoleOfficer, "examiner": RoleExaminer} {
+		keys[name] = enroll(t, ck, name)
+		FailTest(t, ck.Grant(signed(t, "Clerk.Grant", "admin", admin, RecordRequest{Subject: name, Role: role}), &models.Role{}), "could not grant role %s")
+	}
+	ck.DB.Policy = &Policy{Operations: []Operation{
+		{Name: "acquire", Match: `^acquired?\b`, Roles: []string{RoleOfficer, RoleExaminer}, Require: []string{"case", "item"}, Once: true},
+		{Name: "analyze", Roles: []string{RoleExaminer}, After: []string{"acquire"}},
+		{Name: "release", Match: `^released? to owner\b`, After: []string{"acquire"}, Final: true},
+		{Name: "register", Match: `^register item `, Roles: []string{RoleExaminer}},
+	}}
+	FailTest(t, ck.DB.Policy.Compile(), "%s")
+	if bad := (&Policy{Operations: []Operation{{Name: "analyze", After: []string{"acquire"}}}}); bad.Compile() == nil {
+		t.Fatal("a policy that refers to an unknown operation compiled")
+	}
+
+	validate := func(name, message, item string) (*Receipt, error) {
+		req := sign(t, name, keys[name], message, "C1", item)
+		var rc Receipt
+		err := ck.Validate(req, &rc)
+		return &rc, err
+	}
+	refused := func(rule, name, message, item string) {
+		_, err := validate(name, message, item)
+		if err == nil || !strings.Contains(err.Error(), "rule "+rule+":") {
+			t.Fatalf("%s %q on %s was not refused by rule %s: %v", name, message, item, rule, err)
+		}
+	}
+	refused("analyze.after", "examiner", "analyze disk image", "E1")
+	refused("acquire.require", "officer", "acquired laptop", "")
+	_, err := validate("officer", "acquired laptop", "E1")
+	FailTest(t, err, "could not acquire %s")
+	refused("acquire.once", "examiner", "acquire laptop", "E1")
+	refused("analyze.roles", "officer", "analyze disk image", "E1")
+	_, err = validate("examiner", "Analyze disk image", "E1")
+	FailTest(t, err, "could not analyze %s")
+	_, err = validate("officer", "released to owner", "E1")
+	FailTest(t, err, "could not release %s")
+	refused("release.final", "examiner", "photographed", "E1")
+
+	// the policy applies to every request that appends an entry, not only to Validate
+	req := sign(t, "officer", keys["officer"], ItemMessage("E3", "phone"), "C1", "E3")
+	req.Description = "phone"
+	if err = ck.CreateItem(req, &models.Item{}); err == nil || !strings.Contains(err.Error(), "rule register.roles:") {
+		t.Fatalf("an officer registered an item the policy reserves to examiners: %v", err)
+	}
+	CheckCount(t, &ck.DB, "select count(*) from items", 0)
+
+	var denials []*models.Denial
+	FailTest(t, ck.Denials(signed(t, "Clerk.Denials", "admin", admin, RecordRequest{}), &denials), "%s")
+	if len(denials) != 6 || !strings.HasPrefix(denials[0].Reason, "policy rule analyze.after: item E1 has no acquire entry") {
+		t.Fatalf("the refused entries were not recorded as denials %+v", denials[0])
+	}
+
+	// in audit mode the entry is appended and the violation recorded
+	ck.DB.Policy.Mode = PolicyAudit
+	rc, err := validate("examiner", "analyze disk image", "E2")
+	FailTest(t, err, "audit mode refused an entry %s")
+	if len(rc.Violations) != 1 || rc.Violations[0].Rule != "analyze.after" {
+		t.Fatalf("wrong violations in the receipt %+v", rc.Violations)
+	}
+	var vs []*models.PolicyViolation
+	if ck.PolicyViolations(signed(t, "Clerk.PolicyViolations", "examiner", keys["examiner"], RecordRequest{}), &vs) == nil {
+		t.Fatal("an examiner read the policy violations")
+	}
+	FailTest(t, ck.PolicyViolations(signed(t, "Clerk.PolicyViolations", "admin", admin, RecordRequest{}), &vs), "%s")
+	if len(vs) != 1 || vs[0].Ledger != rc.Entry.ID || vs[0].Rule != "analyze.after" {
+		t.Fatalf("wrong recorded violations %+v", vs)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	FailTest(t, err, "%s")
+	defer os.RemoveAll(dir)
+	for _, c := range []struct {
+		json string
+		ok   bool
+	}{
+		{`{"operations": [{"name": "analyze", "require": ["item"]}]}`, true},
+		{`{"operations": [{"name": "analyze", "requires": ["item"]}]}`, false},
+		{`{"operations": [{"name": "analyze", "require": ["badge"]}]}`, false},
+		{`{"mode": "audit", "strict": true, "operation": []}`, false},
+	} {
+		path := filepath.Join(dir, "policy.json")
+		FailTest(t, ioutil.WriteFile(path, []byte(c.json), 0600), "%s")
+		if _, err := LoadPolicy(path); (err == nil) != c.ok {
+			t.Fatalf("loading policy %s: %v", c.json, err)
+		}
+	}
+}
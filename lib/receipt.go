@@ -0,0 +1,216 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// Receipt: the server's signed acknowledgement that it accepted a ledger entry.
+// It commits to the entry through its Merkle leaf hash, and to the entry's position in the
+// ledger through the root of the tree that ends with the entry.
+// A client that keeps its receipts can later prove that the entry was accepted,
+// and detect if the server has since removed or altered it.
+type Receipt struct {
+	Entry     models.Ledger `json:"entry"`
+	Index     int           `json:"index"`
+	LeafHash  []byte        `json:"leaf_hash"`
+	Root      []byte        `json:"root"`
+	Path      [][]byte      `json:"path"`
+	IssuedAt  time.Time     `json:"issued_at"`
+	ServerKey []byte        `json:"server_key"`
+	Signature []byte        `json:"signature"`
+	// Violations are the policy rules the entry breaks, accepted by a server in audit mode.
+	// The server signature does not cover them.
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Size: the size of the ledger tree whose root the receipt carries, the entry is its last leaf.
+func (rc *Receipt) Size() int {
+	return rc.Index + 1
+}
+
+// Statement: the bytes signed by the server for a receipt.
+func (rc *Receipt) Statement() []byte {
+	return []byte(fmt.Sprintf("custody receipt v1\n%d\n%d\n%s\n%d\n%s\n%d\n",
+		rc.Entry.ID, rc.Index, crypto.EncodeBinary(rc.LeafHash), rc.Entry.CreatedAt.Unix(),
+		crypto.EncodeBinary(rc.Root), rc.IssuedAt.Unix()))
+}
+
+// Receipt: issue a receipt for the ledger entry with id, signed by key.
+func (db *DB) Receipt(key *ecdsa.PrivateKey, id int) (*Receipt, error) {
+	if key == nil {
+		return nil, fmt.Errorf("the server has no signing key")
+	}
+	l, err := models.LedgerByID(db, id)
+	if err != nil {
+		return nil, fmt.Errorf("no ledger entry %d", id)
+	}
+	tree, err := db.frontier(id)
+	if err != nil {
+		return nil, err
+	}
+	// the entry is the last leaf of its tree, so its audit path is the frontier of the tree before it
+	prev, err := db.previousEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	before, err := db.frontier(prev)
+	if err != nil {
+		return nil, err
+	}
+	rc := &Receipt{Entry: *l, Index: tree.Size - 1, LeafHash: merkle.LeafHash(LeafData(l)), Root: tree.Root(),
+		Path: before.Path(), IssuedAt: time.Now().UTC()}
+	if rc.ServerKey, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return nil, err
+	}
+	rc.Signature, err = cryptopasta.Sign(rc.Statement(), key)
+	return rc, err
+}
+
+// Verify: check the receipt on its own, without the ledger.
+// If pinned is not nil the receipt must be signed by that server key,
+// otherwise the key carried in the receipt is used.
+func (rc *Receipt) Verify(pinned *ecdsa.PublicKey) error {
+	server, err := crypto.ParseECDSAPublicKey(rc.ServerKey)
+	if err != nil {
+		return fmt.Errorf("could not parse server key: %s", err)
+	}
+	if pinned != nil && (pinned.X.Cmp(server.X) != 0 || pinned.Y.Cmp(server.Y) != 0) {
+		return fmt.Errorf("receipt is signed by server key %s, not the pinned key", crypto.Fingerprint(rc.ServerKey))
+	}
+	if !crypto.Verify(rc.Statement(), rc.Signature, server) {
+		return fmt.Errorf("server signature is invalid")
+	}
+	if !merkle.VerifyInclusion(rc.LeafHash, rc.Index, rc.Size(), rc.Path, rc.Root) {
+		return fmt.Errorf("entry is not the last leaf of the receipt root")
+	}
+	if !bytes.Equal(merkle.LeafHash(LeafData(&rc.Entry)), rc.LeafHash) {
+		return fmt.Errorf("entry does not match the receipt digest")
+	}
+	return nil
+}
+
+// ReceiptProof: what the server currently holds for a receipt, used to check that the entry is still in the ledger.
+// Consistency proves that the ledger at the receipt is a prefix of the ledger at Checkpoint.
+// When witnesses have not cosigned Checkpoint yet, Witnessed is the latest checkpoint they did cosign.
+type ReceiptProof struct {
+	Entry        *models.Ledger
+	Index        int
+	Checkpoint   *models.Checkpoint
+	Cosignatures []*models.Cosignature
+	Witnessed    *Witnessed
+	ServerKey    []byte
+	Consistency  [][]byte
+}
+
+// ReceiptProof: collect the current state of the ledger entry id and a consistency proof
+// from the tree of size to a fresh checkpoint.
+func (db *DB) ReceiptProof(key *ecdsa.PrivateKey, id, size int) (*ReceiptProof, error) {
+	if key == nil {
+		return nil, fmt.Errorf("the server has no signing key")
+	}
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := db.checkpoint(key, ls)
+	if err != nil {
+		return nil, err
+	}
+	p := &ReceiptProof{Checkpoint: cp, Index: -1}
+	if p.ServerKey, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return nil, err
+	}
+	for i, l := range ls {
+		if l.ID == id {
+			p.Entry, p.Index = l, i
+			break
+		}
+	}
+	if size <= len(ls) {
+		if p.Consistency, err = merkle.ConsistencyProof(Leaves(ls), size); err != nil {
+			return nil, err
+		}
+	}
+	if p.Cosignatures, err = models.CosignaturesByCheckpoint(db, cp.ID); err != nil || len(p.Cosignatures) > 0 {
+		return p, err
+	}
+	p.Witnessed, err = db.witnessed(Leaves(ls))
+	return p, err
+}
+
+// Check: compare a verified receipt with the current state of the ledger.
+// It fails if the entry is missing or altered, has moved, or if the ledger
+// has been rewritten since the receipt was issued.
+func (rc *Receipt) Check(p *ReceiptProof) error {
+	if !bytes.Equal(p.ServerKey, rc.ServerKey) {
+		return fmt.Errorf("server key has changed from %s to %s", crypto.Fingerprint(rc.ServerKey), crypto.Fingerprint(p.ServerKey))
+	}
+	server, err := crypto.ParseECDSAPublicKey(p.ServerKey)
+	if err != nil {
+		return fmt.Errorf("could not parse server key: %s", err)
+	}
+	cp := p.Checkpoint
+	if cp == nil || !VerifyCheckpoint(cp, server) {
+		return fmt.Errorf("server checkpoint signature is invalid")
+	}
+	if p.Witnessed != nil {
+		if err = p.Witnessed.Verify(cp, server); err != nil {
+			return err
+		}
+	}
+	if p.Entry == nil {
+		return fmt.Errorf("entry %d is missing from the ledger", rc.Entry.ID)
+	}
+	if p.Index != rc.Index {
+		return fmt.Errorf("entry %d has moved from position %d to %d", rc.Entry.ID, rc.Index, p.Index)
+	}
+	if !bytes.Equal(merkle.LeafHash(LeafData(p.Entry)), rc.LeafHash) {
+		return fmt.Errorf("entry %d has been altered", rc.Entry.ID)
+	}
+	if !merkle.VerifyConsistency(rc.Size(), cp.Size, rc.Root, cp.Root, p.Consistency) {
+		return fmt.Errorf("ledger of size %d is not an extension of the ledger at the receipt", cp.Size)
+	}
+	return nil
+}
+
+// ReceiptPath: where a receipt is stored under dir.
+// The name starts with the server key fingerprint so that receipts from different servers do not collide.
+func ReceiptPath(dir string, rc *Receipt) string {
+	return filepath.Join(dir, fmt.Sprintf("%.16s-%d.json", crypto.Fingerprint(rc.ServerKey), rc.Entry.ID))
+}
+
+// SaveReceipt: write the receipt as json into dir.
+func SaveReceipt(dir string, rc *Receipt) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ReceiptPath(dir, rc), data, 0600)
+}
+
+// LoadReceipt: read a receipt written by SaveReceipt.
+func LoadReceipt(path string) (*Receipt, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rc := &Receipt{}
+	err = json.Unmarshal(data, rc)
+	return rc, err
+}
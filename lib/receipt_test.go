@@ -0,0 +1,70 @@
+package custody
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestReceipt(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	alice, akey := signer(t, cdb, "alice")
+	record(t, cdb, alice, akey, "C1", "seize laptop")
+	l := record(t, cdb, alice, akey, "C1", "image laptop")
+
+	rc, err := cdb.Receipt(serverkey, l.ID)
+	FailTest(t, err, "could not issue receipt %s")
+	FailTest(t, rc.Verify(&serverkey.PublicKey), "receipt did not verify %s")
+	other, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	if rc.Verify(&other.PublicKey) == nil {
+		t.Fatal("receipt verified against the wrong server key")
+	}
+
+	dir, err := ioutil.TempDir("", "receipts")
+	FailTest(t, err, "could not make tempdir %s")
+	FailTest(t, SaveReceipt(dir, rc), "could not save receipt %s")
+	rc, err = LoadReceipt(ReceiptPath(dir, rc))
+	FailTest(t, err, "could not load receipt %s")
+	FailTest(t, rc.Verify(nil), "stored receipt did not verify %s")
+
+	// the ledger grows after the receipt and the receipt still checks out
+	record(t, cdb, alice, akey, "C1", "return laptop")
+	p, err := cdb.ReceiptProof(serverkey, l.ID, rc.Size())
+	FailTest(t, err, "could not get proof %s")
+	FailTest(t, rc.Check(p), "receipt did not check against the ledger %s")
+
+	// a ledger written before the tree was kept issues the same receipts
+	_, err = cdb.Exec("DELETE FROM tree_frontiers")
+	FailTest(t, err, "%s")
+	again, err := cdb.Receipt(serverkey, l.ID)
+	FailTest(t, err, "could not issue receipt %s")
+	if !bytes.Equal(again.Root, rc.Root) || again.Index != rc.Index {
+		t.Fatalf("the rebuilt tree gave another receipt %+v", again)
+	}
+	FailTest(t, again.Verify(nil), "receipt did not verify %s")
+
+	// altering the entry on the server is detected
+	entry, err := models.LedgerByID(cdb, l.ID)
+	FailTest(t, err, "could not load entry %s")
+	entry.Message = "image desktop"
+	FailTest(t, entry.Update(cdb), "could not alter entry %s")
+	p, err = cdb.ReceiptProof(serverkey, l.ID, rc.Size())
+	FailTest(t, err, "could not get proof %s")
+	if rc.Check(p) == nil {
+		t.Fatal("altered entry passed the receipt check")
+	}
+
+	// so is removing it
+	FailTest(t, entry.Delete(cdb), "could not delete entry %s")
+	p, err = cdb.ReceiptProof(serverkey, l.ID, rc.Size())
+	FailTest(t, err, "could not get proof %s")
+	if rc.Check(p) == nil {
+		t.Fatal("deleted entry passed the receipt check")
+	}
+}
@@ -0,0 +1,267 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// ItemReport: everything needed to render the chain of custody of an evidence item.
+// The server collects it, the client verifies and renders it.
+type ItemReport struct {
+	Item       *models.Item
+	Entries    []*models.Ledger
+	Identities []*models.Identity
+	Proofs     []Proof
+	Checkpoint *models.Checkpoint
+	Timestamps []*models.Timestamp
+	ServerKey  []byte
+}
+
+// ItemReport: collect the ledger entries of the item with tag, with inclusion proofs in a fresh checkpoint.
+func (db *DB) ItemReport(key *ecdsa.PrivateKey, tag string) (*ItemReport, error) {
+	item, err := models.ItemByTag(db, tag)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := db.checkpoint(key, ls)
+	if err != nil {
+		return nil, err
+	}
+	r := &ItemReport{Item: item, Checkpoint: cp}
+	r.ServerKey, err = x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	leaves := Leaves(ls)
+	seen := map[int]bool{}
+	for i, l := range ls {
+		if l.Item != tag {
+			continue
+		}
+		path, err := merkle.InclusionProof(leaves, i)
+		if err != nil {
+			return nil, err
+		}
+		r.Entries = append(r.Entries, l)
+		r.Proofs = append(r.Proofs, Proof{Entry: l.ID, Index: i, Path: path})
+		if !seen[l.Identity] {
+			seen[l.Identity] = true
+			ident, err := models.IdentityByID(db, l.Identity)
+			if err != nil {
+				return nil, err
+			}
+			r.Identities = append(r.Identities, ident)
+		}
+	}
+	sort.Slice(r.Identities, func(a, b int) bool { return r.Identities[a].ID < r.Identities[b].ID })
+	r.Timestamps, err = db.Timestamps(r.Entries)
+	return r, err
+}
+
+// FormEntry: a ledger entry as shown on a custody form.
+type FormEntry struct {
+	ID        int
+	Time      string
+	Signer    string
+	Key       string
+	Message   string
+	Signature string
+	Verified  bool
+	Included  bool
+	Imported  string
+
+	// Timestamp is the time asserted by the RFC 3161 authority, empty if the entry has no token.
+	Timestamp         string
+	Authority         string
+	TimestampVerified bool
+}
+
+// CustodyPeriod: a stretch of time during which one person signed every entry about the item.
+type CustodyPeriod struct {
+	Custodian string
+	Key       string
+	From      string
+	Until     string
+	Entries   int
+}
+
+// Transfer: a change of custodian, shown with the last entry signed by the outgoing custodian
+// and the first entry signed by the incoming one.
+type Transfer struct {
+	From     string
+	To       string
+	Released FormEntry
+	Accepted FormEntry
+}
+
+// FormKey: a signing key that appears on a custody form.
+type FormKey struct {
+	Name        string
+	ID          int
+	Enrolled    string
+	Fingerprint string
+}
+
+// CustodyForm: the verified, formatted chain of custody of an item, ready to render.
+type CustodyForm struct {
+	Tag         string
+	Case        string
+	Description string
+	Digest      string
+	Periods     []CustodyPeriod
+	Transfers   []Transfer
+	Entries     []FormEntry
+	Keys        []FormKey
+
+	CheckpointSize     int
+	CheckpointRoot     string
+	CheckpointTime     string
+	CheckpointVerified bool
+	ServerKey          string
+	Pinned             bool // the checkpoint was checked against a server key the reader trusts, not the one in the report
+	Verified           int
+}
+
+// formTime: timestamps on forms are always UTC so the output does not depend on the local zone.
+func formTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// Form: verify every signature, proof and timestamp in the report and lay it out as a custody form.
+// If pinned is not nil the checkpoint must be signed by that server key, otherwise the key that came with
+// the report is used and the form says it is unpinned.
+// Timestamps are checked against tsaCert if it is not nil, otherwise against the certificate they carry.
+func (r *ItemReport) Form(pinned *ecdsa.PublicKey, tsaCert *x509.Certificate) *CustodyForm {
+	f := &CustodyForm{
+		Tag:         r.Item.Tag,
+		Case:        r.Item.CaseID,
+		Description: r.Item.Description,
+		Digest:      hex.EncodeToString(r.Item.Digest),
+		ServerKey:   crypto.Fingerprint(r.ServerKey),
+		Pinned:      pinned != nil,
+	}
+	ids := map[int]*models.Identity{}
+	for _, i := range r.Identities {
+		ids[i.ID] = i
+		f.Keys = append(f.Keys, FormKey{Name: i.Name, ID: i.ID, Enrolled: formTime(i.CreatedAt.Time), Fingerprint: crypto.Fingerprint(i.PublicKey)})
+	}
+	cp := r.Checkpoint
+	if cp != nil {
+		f.CheckpointSize = cp.Size
+		f.CheckpointRoot = crypto.EncodeBinary(cp.Root)
+		f.CheckpointTime = formTime(cp.CreatedAt.Time)
+		server, err := crypto.ParseECDSAPublicKey(r.ServerKey)
+		if pinned != nil {
+			server, err = pinned, nil
+		}
+		if err == nil {
+			f.CheckpointVerified = VerifyCheckpoint(cp, server)
+		}
+	}
+	proofs := map[int]Proof{}
+	for _, p := range r.Proofs {
+		proofs[p.Entry] = p
+	}
+	stamps := map[int]*models.Timestamp{}
+	for _, ts := range r.Timestamps {
+		stamps[ts.Ledger] = ts
+	}
+
+	for _, l := range r.Entries {
+		e := FormEntry{ID: l.ID, Time: formTime(l.CreatedAt.Time), Message: strings.TrimSpace(l.Message), Signature: crypto.EncodeBinary(l.Hash), Imported: l.Imported}
+		if ident, ok := ids[l.Identity]; ok {
+			e.Signer = ident.Name
+			e.Key = crypto.Fingerprint(ident.PublicKey)
+		}
+		e.Verified = VerifyEntry(l, ids[l.Identity]) == nil
+		if p, ok := proofs[l.ID]; ok && cp != nil {
+			e.Included = merkle.VerifyInclusion(merkle.LeafHash(LeafData(l)), p.Index, cp.Size, p.Path, cp.Root)
+		}
+		if ts, ok := stamps[l.ID]; ok {
+			e.Timestamp = formTime(ts.GenTime.Time)
+			e.Authority = ts.Authority
+			_, err := VerifyTimestamp(ts, l, tsaCert)
+			e.TimestampVerified = err == nil
+		}
+		if e.Verified {
+			f.Verified++
+		}
+
+		n := len(f.Periods)
+		if n > 0 && f.Periods[n-1].Custodian == e.Signer {
+			f.Periods[n-1].Entries++
+		} else {
+			if n > 0 {
+				f.Periods[n-1].Until = e.Time
+				f.Transfers = append(f.Transfers, Transfer{From: f.Periods[n-1].Custodian, To: e.Signer, Released: f.Entries[len(f.Entries)-1], Accepted: e})
+			}
+			f.Periods = append(f.Periods, CustodyPeriod{Custodian: e.Signer, Key: e.Key, From: e.Time, Until: "present", Entries: 1})
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	return f
+}
+
+// textTemplates: the plain text templates, which html/template would escape.
+var textTemplates *texttemplate.Template
+
+// LoadReportTemplates: load the custody form templates in dir, report.html into the template cache with
+// LoadTemplates, and report.txt, the layout of text and PDF forms. The web server loads report.html with its pages.
+func LoadReportTemplates(dir string) error {
+	html, text := filepath.Join(dir, "report.html"), filepath.Join(dir, "report.txt")
+	for _, path := range []string{html, text} {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	t, err := texttemplate.New("report.txt").Funcs(templateFuncs).ParseFiles(text)
+	if err != nil {
+		return err
+	}
+	LoadTemplates([]string{html})
+	textTemplates = t
+	return nil
+}
+
+// HTML: render the form as a standalone html page.
+func (f *CustodyForm) HTML(w io.Writer) error {
+	if templates == nil || templates.Lookup("report.html") == nil {
+		return fmt.Errorf("the report templates are not loaded")
+	}
+	return templates.ExecuteTemplate(w, "report.html", f)
+}
+
+// Text: render the form as plain text, this is the layout used for PDF output.
+func (f *CustodyForm) Text(w io.Writer) error {
+	if textTemplates == nil {
+		return fmt.Errorf("the report templates are not loaded")
+	}
+	return textTemplates.ExecuteTemplate(w, "report.txt", f)
+}
+
+// PDF: render the form as a PDF document.
+func (f *CustodyForm) PDF(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	if err := f.Text(buf); err != nil {
+		return err
+	}
+	return writePDF(w, "Chain of Custody: "+f.Tag, strings.Split(buf.String(), "\n"))
+}
@@ -0,0 +1,80 @@
+package custody
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestItemReport(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	alice, akey := signer(t, cdb, "alice")
+	bob, bkey := signer(t, cdb, "bob")
+
+	msg := ItemMessage("E-1", "laptop")
+	hash, err := SignEntry(akey, msg, "C1", "E-1")
+	FailTest(t, err, "failed to sign %s")
+	_, err = cdb.NewItem(alice, models.Item{Tag: "E-1", CaseID: "C1", Description: "laptop"}, models.Ledger{Message: msg, Hash: hash}, nil)
+	FailTest(t, err, "failed to register item %s")
+	if _, err = cdb.NewItem(alice, models.Item{Tag: "E-1", Description: "laptop"}, models.Ledger{Message: msg, Hash: hash}, nil); err == nil {
+		t.Fatal("registered the same item twice")
+	}
+
+	recordEntry(t, cdb, alice, akey, models.Ledger{Message: "bagged", CaseID: "C1", Item: "E-1"})
+	record(t, cdb, alice, akey, "C1", "not about the item")
+	recordEntry(t, cdb, bob, bkey, models.Ledger{Message: "received from alice", CaseID: "C1", Item: "E-1"})
+	recordEntry(t, cdb, bob, bkey, models.Ledger{Message: "imaged", CaseID: "C1", Item: "E-1"})
+
+	r, err := cdb.ItemReport(serverkey, "E-1")
+	FailTest(t, err, "failed to build report %s")
+	FailTest(t, LoadReportTemplates("../static"), "could not load templates %s")
+	f := r.Form(&serverkey.PublicKey, nil)
+	if len(f.Entries) != 4 || f.Verified != 4 {
+		t.Fatalf("expected 4 verified entries, got %d of %d", f.Verified, len(f.Entries))
+	}
+	if len(f.Periods) != 2 || f.Periods[0].Custodian != "alice" || f.Periods[1].Entries != 2 {
+		t.Fatalf("wrong custodian periods %+v", f.Periods)
+	}
+	if len(f.Transfers) != 1 || f.Transfers[0].Released.Message != "bagged" || f.Transfers[0].Accepted.Signer != "bob" {
+		t.Fatalf("wrong transfers %+v", f.Transfers)
+	}
+	if !f.CheckpointVerified || !f.Entries[3].Included {
+		t.Fatal("checkpoint or inclusion proof did not verify")
+	}
+
+	for _, render := range []func(*CustodyForm, *bytes.Buffer) error{
+		func(f *CustodyForm, b *bytes.Buffer) error { return f.HTML(b) },
+		func(f *CustodyForm, b *bytes.Buffer) error { return f.PDF(b) },
+	} {
+		a, b := &bytes.Buffer{}, &bytes.Buffer{}
+		FailTest(t, render(f, a), "failed to render %s")
+		again, err := cdb.ItemReport(serverkey, "E-1")
+		FailTest(t, err, "failed to build report %s")
+		FailTest(t, render(again.Form(&serverkey.PublicKey, nil), b), "failed to render %s")
+		if !bytes.Equal(a.Bytes(), b.Bytes()) {
+			t.Fatal("report output is not deterministic")
+		}
+	}
+	// a report checked against the key that came with it says so, and a report from another server fails the pin
+	html := &bytes.Buffer{}
+	FailTest(t, r.Form(nil, nil).HTML(html), "failed to render %s")
+	if !strings.Contains(html.String(), "unpinned") {
+		t.Fatal("an unpinned report did not say so")
+	}
+	other, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	if f := r.Form(&other.PublicKey, nil); f.CheckpointVerified || !f.Pinned {
+		t.Fatal("the checkpoint verified against another pinned key")
+	}
+
+	pdf := &bytes.Buffer{}
+	FailTest(t, f.PDF(pdf), "failed to render %s")
+	if !strings.HasPrefix(pdf.String(), "%PDF-1.4") || !strings.HasSuffix(pdf.String(), "%%EOF\n") {
+		t.Fatal("malformed pdf")
+	}
+}
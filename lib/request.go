@@ -1,5 +1,14 @@
 package custody
 
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
+)
+
 // RecordRequest: contains the information necessary to request a Clerk operation.
 // All operations use the same RecordRequest format, you only need to provide values for the necessary arguments.
 type RecordRequest struct {
@@ -7,4 +16,52 @@ type RecordRequest struct {
 	PublicKey []byte
 	Data      []byte
 	Hash      []byte
+	Case      string
+
+	Item        string
+	Description string
+	Digest      []byte
+	HashList    *piecewise.List
+	Ingest      *IngestRecord
+
+	Entry      int
+	Size       int
+	Checkpoint int
+
+	Records []*ImportRecord
+	DryRun  bool
+
+	Subject string
+	Role    string
+	State   string
+
+	Days  int
+	Hold  int
+	Nonce string
+
+	URL    string
+	Events []string
+
+	Requirement *Requirement
+
+	Type   string
+	Schema []byte
+	Fields map[string]string
+
+	// Time and Auth authenticate requests that carry no other signature of the user, see Authorize.
+	Time int64
+	Auth []byte
+}
+
+// RequestStatement: the bytes a user signs to authenticate a request for method.
+func RequestStatement(method string, req *RecordRequest) []byte {
+	return []byte(fmt.Sprintf("custody request v1\n%s\n%s\n%s\n%s\n%d\n%s\n%s\n%d\n",
+		method, req.Name, req.Case, req.Item, req.Entry, req.Subject, req.Role, req.Time))
+}
+
+// Authorize: sign the request for method with the key of the user req.Name.
+func (req *RecordRequest) Authorize(method string, key *ecdsa.PrivateKey) (err error) {
+	req.Time = time.Now().Unix()
+	req.Auth, err = cryptopasta.Sign(RequestStatement(method, req), key)
+	return
 }
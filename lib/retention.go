@@ -0,0 +1,409 @@
+package custody
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// Retention schedules, legal holds and disposition.
+// Each of them is a ledger entry signed by the user who made the decision, so the ledger shows
+// who set a retention period, who placed and released a hold and who disposed of an item.
+// An item may be disposed of once the retention period of the item, or else of its case,
+// has passed since it was registered, unless a legal hold on the item or its case is active.
+// Items without a retention period are kept.
+
+// scope: how a case or item is named in messages, an item takes precedence.
+func scope(caseID, item string) string {
+	if item != "" {
+		return "item " + item
+	}
+	return "case " + caseID
+}
+
+// RetentionMessage: the message a user signs to set the retention period of a case or item.
+func RetentionMessage(caseID, item string, days int, basis string) string {
+	return fmt.Sprintf("retain %s for %d days: %s", scope(caseID, item), days, basis)
+}
+
+// HoldMessage: the message a user signs to place a legal hold on a case or item.
+// nonce is chosen anew for every hold, so that the signature of a hold that was released cannot place it again.
+func HoldMessage(caseID, item, reason, nonce string) string {
+	return fmt.Sprintf("place legal hold %s on %s: %s", nonce, scope(caseID, item), reason)
+}
+
+// ReleaseMessage: the message a user signs to release the legal hold with id.
+func ReleaseMessage(id int, reason string) string {
+	return fmt.Sprintf("release legal hold %d: %s", id, reason)
+}
+
+// DisposeMessage: the message a user signs to dispose of an evidence item, the tombstone of the item.
+// It covers the digest of the contents, if the item has one.
+func DisposeMessage(tag, reason string, digest []byte) string {
+	if digest == nil {
+		return fmt.Sprintf("dispose of item %s: %s", tag, reason)
+	}
+	return fmt.Sprintf("dispose of item %s: %s: sha256 %x", tag, reason, digest)
+}
+
+// IsDisposeMessage: true if message disposes of an item.
+func IsDisposeMessage(message string) bool {
+	return strings.HasPrefix(message, "dispose of item ")
+}
+
+// disposalReason: the reason of message, ok false if it is not the DisposeMessage of item.
+func disposalReason(message string, item *models.Item) (reason string, ok bool) {
+	prefix, suffix := fmt.Sprintf("dispose of item %s: ", item.Tag), ""
+	if item.Digest != nil {
+		suffix = fmt.Sprintf(": sha256 %x", item.Digest)
+	}
+	if !strings.HasPrefix(message, prefix) || !strings.HasSuffix(message, suffix) || len(message) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+	return message[len(prefix) : len(message)-len(suffix)], true
+}
+
+// scoped: fill in the case and item of entry for a decision about caseID or item.
+// Exactly one of them must be given, and the item must exist.
+func (db *DB) scoped(caseID, tag string, entry *models.Ledger) error {
+	switch {
+	case (caseID == "") == (tag == ""):
+		return fmt.Errorf("name either a case or an item")
+	case tag != "":
+		item, err := models.ItemByTag(db, tag)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no item %s", tag)
+		}
+		if err != nil {
+			return err
+		}
+		entry.Item, entry.CaseID = item.Tag, item.CaseID
+	default:
+		entry.CaseID = caseID
+	}
+	return nil
+}
+
+// SetRetention: set the retention period of a case or item, replacing any period it had.
+// entry must hold the signed RetentionMessage.
+func (db *DB) SetRetention(identity *models.Identity, r models.Retention, entry models.Ledger) (*models.Retention, error) {
+	if r.Days <= 0 {
+		return nil, fmt.Errorf("a retention period is a positive number of days")
+	}
+	if r.Basis == "" {
+		return nil, fmt.Errorf("a retention period needs the statute or rule it is based on")
+	}
+	if msg := RetentionMessage(r.CaseID, r.Item, r.Days, r.Basis); entry.Message != msg {
+		return nil, fmt.Errorf("retention must sign %q", msg)
+	}
+	if err := db.scoped(r.CaseID, r.Item, &entry); err != nil {
+		return nil, err
+	}
+	var policy *models.Retention
+	err := db.atomic(func(tdb *DB) error {
+		entry, err := tdb.Append(identity, entry)
+		if err != nil {
+			return err
+		}
+		policy, err = models.RetentionByCaseIDItem(tdb, r.CaseID, r.Item)
+		switch {
+		case err == sql.ErrNoRows:
+			policy = &models.Retention{CaseID: r.CaseID, Item: r.Item}
+		case err != nil:
+			return err
+		}
+		policy.Days, policy.Basis, policy.Ledger, policy.CreatedAt = r.Days, r.Basis, entry.ID, XONow()
+		return policy.Save(tdb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// PlaceHold: place a legal hold on a case or item. entry must hold the signed HoldMessage with nonce,
+// and no hold may have been placed with the same message before.
+func (db *DB) PlaceHold(identity *models.Identity, h models.Hold, nonce string, entry models.Ledger) (*models.Hold, error) {
+	if h.Reason == "" {
+		return nil, fmt.Errorf("a legal hold needs a reason, such as the order or case that requires it")
+	}
+	if nonce == "" {
+		return nil, fmt.Errorf("a legal hold needs a nonce")
+	}
+	if msg := HoldMessage(h.CaseID, h.Item, h.Reason, nonce); entry.Message != msg {
+		return nil, fmt.Errorf("the hold must sign %q", msg)
+	}
+	if err := db.scoped(h.CaseID, h.Item, &entry); err != nil {
+		return nil, err
+	}
+	err := db.atomic(func(tdb *DB) error {
+		var n int
+		if err := tdb.QueryRow(`select count(*) from ledger where message = ?`, entry.Message).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("this hold was placed before, a new hold needs a new nonce")
+		}
+		entry, err := tdb.Append(identity, entry)
+		if err != nil {
+			return err
+		}
+		h.Ledger, h.Released, h.CreatedAt = entry.ID, 0, XONow()
+		return h.Insert(tdb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// ReleaseHold: release the legal hold with id. entry must hold the signed ReleaseMessage.
+func (db *DB) ReleaseHold(identity *models.Identity, id int, reason string, entry models.Ledger) (*models.Hold, error) {
+	h, err := models.HoldByID(db, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no legal hold %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.Released != 0 {
+		return nil, fmt.Errorf("legal hold %d was already released by entry %d", id, h.Released)
+	}
+	if msg := ReleaseMessage(id, reason); entry.Message != msg {
+		return nil, fmt.Errorf("the release must sign %q", msg)
+	}
+	if err = db.scoped(h.CaseID, h.Item, &entry); err != nil {
+		return nil, err
+	}
+	err = db.atomic(func(tdb *DB) error {
+		entry, err := tdb.Append(identity, entry)
+		if err != nil {
+			return err
+		}
+		h.Released = entry.ID
+		return h.Update(tdb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Holds: the legal holds on a case or item, all of them if both are empty.
+// The holds of an item include the holds of its case.
+func (db *DB) Holds(caseID, tag string) ([]*models.Hold, error) {
+	if tag != "" {
+		item, err := models.ItemByTag(db, tag)
+		if err != nil {
+			return nil, err
+		}
+		hs, err := models.HoldsByItem(db, tag)
+		if err != nil || item.CaseID == "" {
+			return hs, err
+		}
+		chs, err := models.HoldsByCaseID(db, item.CaseID)
+		return append(chs, hs...), err
+	}
+	if caseID != "" {
+		return models.HoldsByCaseID(db, caseID)
+	}
+	return models.AllHolds(db)
+}
+
+// Disposal: whether an evidence item may be disposed of, and when.
+type Disposal struct {
+	Item *models.Item
+	// Policy is the retention period of the item, or of its case, nil if it has none.
+	Policy *models.Retention
+	// Due is when the retention period ends.
+	Due time.Time
+	// Holds are the active legal holds on the item and its case.
+	Holds []*models.Hold
+	// Disposition is set if the item has been disposed of.
+	Disposition *models.Disposition
+}
+
+// Check: nil if the item may be disposed of at now, otherwise why not.
+func (d *Disposal) Check(now time.Time) error {
+	switch {
+	case d.Disposition != nil:
+		return fmt.Errorf("item %s was disposed of by entry %d", d.Item.Tag, d.Disposition.Ledger)
+	case len(d.Holds) > 0:
+		return fmt.Errorf("item %s is under legal hold %d: %s", d.Item.Tag, d.Holds[0].ID, d.Holds[0].Reason)
+	case d.Policy == nil:
+		return fmt.Errorf("item %s has no retention period, it is kept", d.Item.Tag)
+	case now.Before(d.Due):
+		return fmt.Errorf("item %s must be kept until %s", d.Item.Tag, d.Due.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Disposal: the retention status of the item with tag.
+func (db *DB) Disposal(tag string) (*Disposal, error) {
+	item, err := models.ItemByTag(db, tag)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no item %s", tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.disposal(item)
+}
+
+func (db *DB) disposal(item *models.Item) (*Disposal, error) {
+	d := &Disposal{Item: item}
+	dp, err := models.DispositionByItem(db, item.Tag)
+	switch {
+	case err == nil:
+		d.Disposition = dp
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+	d.Policy, err = models.RetentionByCaseIDItem(db, "", item.Tag)
+	if err == sql.ErrNoRows && item.CaseID != "" {
+		d.Policy, err = models.RetentionByCaseIDItem(db, item.CaseID, "")
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		d.Policy = nil
+	case err != nil:
+		return nil, err
+	default:
+		d.Due = item.CreatedAt.Time.AddDate(0, 0, d.Policy.Days)
+	}
+	holds, err := db.Holds("", item.Tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range holds {
+		if h.Released == 0 {
+			d.Holds = append(d.Holds, h)
+		}
+	}
+	return d, nil
+}
+
+// Disposals: the retention status of every item that has not been disposed of.
+func (db *DB) Disposals() ([]*Disposal, error) {
+	items, err := models.AllItems(db)
+	if err != nil {
+		return nil, err
+	}
+	var ds []*Disposal
+	for _, item := range items {
+		d, err := db.disposal(item)
+		if err != nil {
+			return nil, err
+		}
+		if d.Disposition == nil {
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+// Dispose: dispose of an evidence item whose retention period is over and that is not under a legal hold.
+// entry must hold the signed DisposeMessage, which stays in the ledger as the tombstone of the item.
+// If evidence is not nil the contents of the item are deleted from it, unless another item that has
+// not been disposed of has the same contents.
+func (db *DB) Dispose(identity *models.Identity, tag, reason string, entry models.Ledger, evidence *store.Store) (*models.Disposition, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("a disposition needs a reason, such as how the item was destroyed or returned")
+	}
+	var dp *models.Disposition
+	err := db.atomic(func(tdb *DB) error {
+		d, err := tdb.Disposal(tag)
+		if err != nil {
+			return err
+		}
+		if msg := DisposeMessage(tag, reason, d.Item.Digest); entry.Message != msg {
+			return fmt.Errorf("the disposition must sign %q", msg)
+		}
+		dp, err = tdb.dispose(identity, d, entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dp, db.removeContents(dp, evidence)
+}
+
+// dispose: append entry, the tombstone of the item of d signed by identity, record the disposition
+// and move the item to destroyed, which it must be able to move to.
+// The holds are checked in the transaction that records the disposition, so a hold placed meanwhile is not missed.
+func (db *DB) dispose(identity *models.Identity, d *Disposal, entry models.Ledger) (*models.Disposition, error) {
+	if err := d.Check(time.Now()); err != nil {
+		return nil, err
+	}
+	var dp *models.Disposition
+	err := db.atomic(func(tdb *DB) error {
+		s, err := tdb.State(d.Item.Tag)
+		if err != nil {
+			return err
+		}
+		if err = CanMove(s.State, StateDestroyed); err != nil {
+			return fmt.Errorf("item %s cannot be disposed of: %s", d.Item.Tag, err)
+		}
+		entry.Item, entry.CaseID = d.Item.Tag, d.Item.CaseID
+		if entry, err = tdb.Append(identity, entry); err != nil {
+			return err
+		}
+		dp = &models.Disposition{Item: d.Item.Tag, Ledger: entry.ID, Digest: d.Item.Digest, CreatedAt: XONow()}
+		if err = dp.Insert(tdb); err != nil {
+			return err
+		}
+		s.State, s.Ledger, s.UpdatedAt = StateDestroyed, entry.ID, entry.CreatedAt
+		return s.Update(tdb)
+	})
+	return dp, err
+}
+
+// removeContents: delete the contents of the disposed item of dp from evidence, if it is not nil,
+// unless another item that has not been disposed of has the same contents.
+func (db *DB) removeContents(dp *models.Disposition, evidence *store.Store) error {
+	if evidence == nil || dp.Digest == nil {
+		return nil
+	}
+	item, err := models.ItemByTag(db, dp.Item)
+	if err != nil {
+		return err
+	}
+	shared, err := db.sharedContents(item)
+	if err != nil || shared != "" {
+		if shared != "" {
+			log.Printf("the contents of disposed item %s are kept for item %s", dp.Item, shared)
+		}
+		return err
+	}
+	if dp.BlobRemoved, err = evidence.Remove(dp.Digest); err != nil {
+		return fmt.Errorf("item %s was disposed of but its file could not be deleted: %s", dp.Item, err)
+	}
+	return dp.Update(db)
+}
+
+// sharedContents: the tag of another item with the same contents as item that has not been disposed of.
+func (db *DB) sharedContents(item *models.Item) (string, error) {
+	items, err := models.AllItems(db)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range items {
+		if other.Tag == item.Tag || !bytes.Equal(other.Digest, item.Digest) {
+			continue
+		}
+		_, err := models.DispositionByItem(db, other.Tag)
+		if err == sql.ErrNoRows {
+			return other.Tag, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,95 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// entry: message in caseID about item signed with key, as the entry of a request.
+func entry(t *testing.T, key *ecdsa.PrivateKey, message, caseID, item string) models.Ledger {
+	hash, err := SignEntry(key, message, caseID, item)
+	FailTest(t, err, "failed to sign %s")
+	return models.Ledger{Message: message, Hash: hash}
+}
+
+func TestDispose(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	evidence, err := store.Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+	staged, err := evidence.Stage(strings.NewReader("disk image"))
+	FailTest(t, err, "could not stage %s")
+	_, err = staged.Commit()
+	FailTest(t, err, "could not commit %s")
+	item := models.Item{Tag: "E-1", CaseID: "C1", Description: "laptop image", Digest: staged.Digest}
+	_, err = cdb.UploadItem(alice, item, entry(t, akey, UploadMessage(item.Tag, item.Description, item.Digest), item.CaseID, item.Tag), nil)
+	FailTest(t, err, "failed to register upload %s")
+	dispose := func() error {
+		_, err := cdb.Dispose(alice, "E-1", "destroyed", entry(t, akey, DisposeMessage("E-1", "destroyed", item.Digest), "C1", "E-1"), evidence)
+		return err
+	}
+
+	if dispose() == nil {
+		t.Fatal("disposed of an item without a retention period")
+	}
+	_, err = cdb.SetRetention(alice, models.Retention{CaseID: "C1", Days: 30, Basis: "statute 1"},
+		entry(t, akey, RetentionMessage("C1", "", 30, "statute 1"), "C1", ""))
+	FailTest(t, err, "failed to set retention %s")
+	if dispose() == nil {
+		t.Fatal("disposed of an item within its retention period")
+	}
+
+	// once the period has passed, only a legal hold keeps the item
+	_, err = cdb.Exec("UPDATE items SET created_at = ? WHERE tag = 'E-1'", time.Now().AddDate(0, 0, -31))
+	FailTest(t, err, "failed to age item %s")
+	place := func(nonce string) (*models.Hold, error) {
+		return cdb.PlaceHold(alice, models.Hold{CaseID: "C1", Reason: "appeal"}, nonce, entry(t, akey, HoldMessage("C1", "", "appeal", nonce), "C1", ""))
+	}
+	hold, err := place("n1")
+	FailTest(t, err, "failed to place hold %s")
+	if err = dispose(); err == nil || !strings.Contains(err.Error(), "legal hold") {
+		t.Fatalf("disposed of an item under a legal hold: %v", err)
+	}
+	_, err = cdb.ReleaseHold(alice, hold.ID, "appeal denied", entry(t, akey, ReleaseMessage(hold.ID, "appeal denied"), "C1", ""))
+	FailTest(t, err, "failed to release hold %s")
+	// a released hold cannot be placed again by replaying its message
+	if _, err = place("n1"); err == nil {
+		t.Fatal("a released hold was placed again with its nonce")
+	}
+
+	// only an item in storage, or returned to it, can be destroyed
+	if err = dispose(); err == nil || !strings.Contains(err.Error(), "collected") {
+		t.Fatalf("disposed of an item that was never stored: %v", err)
+	}
+	s, err := cdb.State("E-1")
+	FailTest(t, err, "%s")
+	msg := StateMessage("E-1", s.State, s.Ledger, StateInStorage, "shelf 4")
+	_, err = cdb.Move(alice, "E-1", StateInStorage, "shelf 4", entry(t, akey, msg, "C1", "E-1"))
+	FailTest(t, err, "failed to store item %s")
+
+	FailTest(t, dispose(), "failed to dispose of item %s")
+	if s, err = cdb.State("E-1"); err != nil || s.State != StateDestroyed {
+		t.Fatalf("a disposed item is %+v: %v", s, err)
+	}
+	report, err := cdb.Fsck(nil, nil)
+	FailTest(t, err, "fsck failed %s")
+	if !report.OK() {
+		t.Fatalf("fsck found %v %v", report.Audit.Failures, report.Findings)
+	}
+	if evidence.Has(item.Digest) {
+		t.Fatal("the file of a disposed item is still in the store")
+	}
+	ls, err := models.LedgersByItem(cdb, "E-1")
+	FailTest(t, err, "failed to list entries %s")
+	if last := ls[len(ls)-1]; last.Message != DisposeMessage("E-1", "destroyed", item.Digest) {
+		t.Fatalf("the last entry of the item is %q, not its tombstone", last.Message)
+	}
+	if dispose() == nil {
+		t.Fatal("disposed of an item twice")
+	}
+}
@@ -0,0 +1,192 @@
+package custody
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// The roles a user can hold. A user without a role can only read their own entries.
+const (
+	RoleOfficer    = "officer"
+	RoleExaminer   = "examiner"
+	RoleCustodian  = "custodian"
+	RoleProsecutor = "prosecutor"
+	RoleAuditor    = "auditor"
+	RoleAdmin      = "admin"
+)
+
+// Roles: every role, in the order they are listed to users.
+var Roles = []string{RoleOfficer, RoleExaminer, RoleCustodian, RoleProsecutor, RoleAuditor, RoleAdmin}
+
+// Permission: an operation that only some roles may perform.
+type Permission string
+
+// The permissions checked by the Clerk and the web server.
+const (
+	// PermManageUsers: grant roles and sign up web users.
+	PermManageUsers Permission = "manage users"
+	// PermSign: sign ledger entries about evidence.
+	PermSign Permission = "sign entries"
+	// PermRegisterItem: register evidence items.
+	PermRegisterItem Permission = "register items"
+	// PermReadAll: read every case. Without it a user reads only the cases an admin made them a member of.
+	PermReadAll Permission = "read all cases"
+	// PermExport: export evidence bundles of the cases the user can read.
+	PermExport Permission = "export cases"
+	// PermImport: import legacy custody logs.
+	PermImport Permission = "import"
+	// PermAudit: read the log of denied requests and of policy violations.
+	PermAudit Permission = "audit"
+	// PermRetain: set the retention period of cases and items.
+	PermRetain Permission = "set retention"
+	// PermHold: place and release legal holds.
+	PermHold Permission = "place legal holds"
+	// PermDispose: dispose of evidence whose retention period is over.
+	PermDispose Permission = "dispose of evidence"
+	// PermWebhooks: add, list and test webhooks.
+	PermWebhooks Permission = "manage webhooks"
+	// PermEntryTypes: register the types of structured entries.
+	PermEntryTypes Permission = "register entry types"
+)
+
+// permissions: the permission matrix.
+var permissions = map[string][]Permission{
+	RoleOfficer:    {PermSign, PermRegisterItem},
+	RoleExaminer:   {PermSign},
+	RoleCustodian:  {PermSign, PermRegisterItem, PermReadAll, PermExport, PermRetain, PermHold, PermDispose},
+	RoleProsecutor: {PermReadAll, PermExport, PermHold},
+	RoleAuditor:    {PermReadAll, PermExport, PermAudit},
+	RoleAdmin: {PermManageUsers, PermSign, PermRegisterItem, PermReadAll, PermExport, PermImport, PermAudit,
+		PermRetain, PermHold, PermDispose, PermWebhooks, PermEntryTypes},
+}
+
+// ValidRole: true if role is one of Roles.
+func ValidRole(role string) bool {
+	_, ok := permissions[role]
+	return ok
+}
+
+// Can: true if role has permission p.
+func Can(role string, p Permission) bool {
+	for _, q := range permissions[role] {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessDenied: the error for a request refused by access control.
+type AccessDenied struct {
+	Name   string
+	Action string
+	Target string
+	Reason string
+}
+
+func (e AccessDenied) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf("access denied: %s called %s: %s", e.Name, e.Action, e.Reason)
+	}
+	return fmt.Sprintf("access denied: %s called %s on %s: %s", e.Name, e.Action, e.Target, e.Reason)
+}
+
+// caseTarget: how a case is named in denials.
+func caseTarget(caseID string) string {
+	if caseID == "" {
+		return ""
+	}
+	return "case " + caseID
+}
+
+// RoleOf: the role of the user name, empty if they have none.
+func (db *DB) RoleOf(name string) (string, error) {
+	r, err := models.RoleByName(db, name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.Role, nil
+}
+
+// Grant: give the user name role, replacing any role they had. admin is recorded as the grantor.
+func (db *DB) Grant(admin *models.Identity, name, role string) (*models.Role, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	r, err := models.RoleByName(db, name)
+	switch {
+	case err == sql.ErrNoRows:
+		r = &models.Role{Name: name}
+	case err != nil:
+		return nil, err
+	}
+	r.Role, r.GrantedBy, r.CreatedAt = role, admin.ID, XONow()
+	return r, r.Save(db)
+}
+
+// CanRead: true if a user with role may read the ledger entries of caseID.
+// Without PermReadAll a user can read a case only if an admin made them a member of it,
+// signing entries in a case does not give access to it.
+func (db *DB) CanRead(name, role, caseID string) (bool, error) {
+	if Can(role, PermReadAll) {
+		return true, nil
+	}
+	if caseID == "" {
+		return false, nil
+	}
+	_, err := models.CaseMemberByCaseIDName(db, caseID, name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AddMember: give the user name access to the case caseID. admin is recorded as the grantor.
+func (db *DB) AddMember(admin *models.Identity, caseID, name string) (*models.CaseMember, error) {
+	if caseID == "" {
+		return nil, fmt.Errorf("no case given")
+	}
+	m, err := models.CaseMemberByCaseIDName(db, caseID, name)
+	switch {
+	case err == sql.ErrNoRows:
+		m = &models.CaseMember{CaseID: caseID, Name: name}
+	case err != nil:
+		return nil, err
+	}
+	m.GrantedBy, m.CreatedAt = admin.ID, XONow()
+	return m, m.Save(db)
+}
+
+// RemoveMember: take away the access of the user name to the case caseID.
+func (db *DB) RemoveMember(caseID, name string) (*models.CaseMember, error) {
+	m, err := models.CaseMemberByCaseIDName(db, caseID, name)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%s is not a member of case %s", name, caseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, m.Delete(db)
+}
+
+// Deny: record a refused request and return the error for it.
+func (db *DB) Deny(name, action, target, reason string) error {
+	denied := AccessDenied{Name: name, Action: action, Target: target, Reason: reason}
+	log.Println(denied)
+	db.recordDenial(denied)
+	return denied
+}
+
+// recordDenial: store the refused request in the denials.
+func (db *DB) recordDenial(denied AccessDenied) {
+	d := models.Denial{CreatedAt: XONow(), Name: denied.Name, Action: denied.Action, Target: denied.Target, Reason: denied.Reason}
+	if err := d.Insert(db); err != nil {
+		log.Printf("could not record denial: %s", err)
+	}
+}
@@ -0,0 +1,112 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// enroll: enroll a new user through the clerk and return their private key.
+func enroll(t *testing.T, ck *Clerk, name string) *ecdsa.PrivateKey {
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	FailTest(t, err, "failed to encode key %s")
+	var i models.Identity
+	FailTest(t, ck.Create(&RecordRequest{Name: name, PublicKey: pub}, &i), "failed to enroll user %s")
+	return key
+}
+
+// signed: a request by name for method, authenticated with key.
+func signed(t *testing.T, method, name string, key *ecdsa.PrivateKey, req RecordRequest) *RecordRequest {
+	req.Name = name
+	FailTest(t, req.Authorize(method, key), "failed to sign request %s")
+	return &req
+}
+
+func TestRoles(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	var err error
+	ck.Key, err = cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate server key %s")
+	admin := enroll(t, ck, "admin")
+	officer := enroll(t, ck, "officer")
+	prosecutor := enroll(t, ck, "prosecutor")
+
+	if role, err := ck.DB.RoleOf("admin"); err != nil || role != RoleAdmin {
+		t.Fatalf("the first user is %q, not admin: %v", role, err)
+	}
+	pub, _ := x509.MarshalPKIXPublicKey(officer.Public())
+	if err := ck.Create(&RecordRequest{Name: "admin", PublicKey: pub}, &models.Identity{}); err == nil {
+		t.Fatal("an enrolled name was enrolled again")
+	}
+
+	msg := []byte("collected from scene")
+	sig, _ := SignEntry(officer, string(msg), "C1", "")
+	var rc Receipt
+	if err := ck.Validate(&RecordRequest{Name: "officer", Data: msg, Hash: sig, Case: "C1"}, &rc); err == nil {
+		t.Fatal("a user without a role signed an entry")
+	}
+	var r models.Role
+	if err := ck.Grant(signed(t, "Clerk.Grant", "officer", officer, RecordRequest{Subject: "officer", Role: RoleAdmin}), &r); err == nil {
+		t.Fatal("a user without a role granted a role")
+	}
+	for name, role := range map[string]string{"officer": RoleOfficer, "prosecutor": RoleProsecutor} {
+		FailTest(t, ck.Grant(signed(t, "Clerk.Grant", "admin", admin, RecordRequest{Subject: name, Role: role}), &r), "admin could not grant a role %s")
+	}
+	if err := ck.Validate(&RecordRequest{Name: "officer", Data: msg, Hash: sig, Case: "C2"}, &rc); err == nil {
+		t.Fatal("an entry signed for one case was appended to another")
+	}
+	FailTest(t, ck.Validate(&RecordRequest{Name: "officer", Data: msg, Hash: sig, Case: "C1"}, &rc), "officer could not sign %s")
+	if err := ck.Validate(&RecordRequest{Name: "officer", Data: msg, Hash: sig, Case: "C1"}, &rc); err == nil {
+		t.Fatal("a signed entry was appended twice")
+	}
+
+	var bundle []byte
+	if err := ck.Export(signed(t, "Clerk.Export", "officer", officer, RecordRequest{Case: "C1"}), &bundle); err == nil {
+		t.Fatal("an officer exported a case")
+	}
+	FailTest(t, ck.Export(signed(t, "Clerk.Export", "prosecutor", prosecutor, RecordRequest{Case: "C1"}), &bundle), "prosecutor could not export %s")
+
+	// an authentication for one method is not valid for another
+	req := signed(t, "Clerk.List", "prosecutor", prosecutor, RecordRequest{Case: "C1"})
+	if err := ck.Export(req, &bundle); err == nil {
+		t.Fatal("a request signed for List was accepted by Export")
+	}
+
+	// signing entries in a case does not give access to it, an admin has to make the user a member
+	var states []*models.ItemState
+	if err := ck.ItemStates(signed(t, "Clerk.ItemStates", "officer", officer, RecordRequest{Case: "C1"}), &states); err == nil {
+		t.Fatal("an officer read a case they are not a member of")
+	}
+	var m models.CaseMember
+	if err := ck.AddMember(signed(t, "Clerk.AddMember", "officer", officer, RecordRequest{Subject: "officer", Case: "C1"}), &m); err == nil {
+		t.Fatal("an officer made themselves a member of a case")
+	}
+	FailTest(t, ck.AddMember(signed(t, "Clerk.AddMember", "admin", admin, RecordRequest{Subject: "officer", Case: "C1"}), &m), "admin could not add a member %s")
+	FailTest(t, ck.ItemStates(signed(t, "Clerk.ItemStates", "officer", officer, RecordRequest{Case: "C1"}), &states), "a member could not read the case %s")
+	FailTest(t, ck.RemoveMember(signed(t, "Clerk.RemoveMember", "admin", admin, RecordRequest{Subject: "officer", Case: "C1"}), &m), "admin could not remove a member %s")
+	if err := ck.ItemStates(signed(t, "Clerk.ItemStates", "officer", officer, RecordRequest{Case: "C1"}), &states); err == nil {
+		t.Fatal("a removed member read the case")
+	}
+
+	var denials []*models.Denial
+	if err := ck.Denials(signed(t, "Clerk.Denials", "officer", officer, RecordRequest{}), &denials); err == nil {
+		t.Fatal("an officer read the denials")
+	}
+	FailTest(t, ck.Denials(signed(t, "Clerk.Denials", "admin", admin, RecordRequest{}), &denials), "admin could not read the denials %s")
+	var actions []string
+	for _, d := range denials {
+		actions = append(actions, d.Name+" "+d.Action)
+	}
+	want := "admin Clerk.Create,officer Clerk.Validate,officer Clerk.Grant,officer Clerk.Export,prosecutor Clerk.Export," +
+		"officer Clerk.ItemStates,officer Clerk.AddMember,officer Clerk.ItemStates,officer Clerk.Denials"
+	if got := strings.Join(actions, ","); got != want {
+		t.Fatalf("recorded denials %s, expected %s", got, want)
+	}
+}
@@ -0,0 +1,260 @@
+package custody
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// Evidence lifecycle. Every item is in one of the States, starting with collected when it is registered.
+// An item moves to another state only by a ledger entry signed by a user, whose StateMessage names the state
+// it leaves, the entry that put it there and the state it enters, and only along the Transitions, so that
+// an old transition cannot be replayed when the item is back in the same state. Disposing of an item moves it
+// to destroyed. Released and destroyed are final.
+// The ledger is the record of the states, the item_states table caches the current state of each item
+// and custody fsck checks the cache against the ledger.
+
+// The lifecycle states of an evidence item.
+const (
+	StateCollected  = "collected"
+	StateInTransit  = "in-transit"
+	StateInStorage  = "in-storage"
+	StateCheckedOut = "checked-out"
+	StateReturned   = "returned"
+	StateReleased   = "released"
+	StateDestroyed  = "destroyed"
+)
+
+// States: the lifecycle states in the order an item usually goes through them.
+var States = []string{StateCollected, StateInTransit, StateInStorage, StateCheckedOut, StateReturned, StateReleased, StateDestroyed}
+
+// Transitions: the states an item in each state may move to.
+var Transitions = map[string][]string{
+	StateCollected:  {StateInTransit, StateInStorage},
+	StateInTransit:  {StateInStorage},
+	StateInStorage:  {StateInTransit, StateCheckedOut, StateReleased, StateDestroyed},
+	StateCheckedOut: {StateReturned},
+	StateReturned:   {StateInTransit, StateInStorage, StateCheckedOut, StateReleased, StateDestroyed},
+	StateReleased:   {},
+	StateDestroyed:  {},
+}
+
+// ValidState: true if state is a lifecycle state.
+func ValidState(state string) bool {
+	_, ok := Transitions[state]
+	return ok
+}
+
+// CanMove: nil if an item may move from one state to the other, else why not.
+func CanMove(from, to string) error {
+	if !ValidState(to) {
+		return fmt.Errorf("unknown state %s, the states are %s", to, strings.Join(States, ", "))
+	}
+	next := Transitions[from]
+	if len(next) == 0 {
+		return fmt.Errorf("an item that was %s cannot move", from)
+	}
+	if !contains(next, to) {
+		return fmt.Errorf("an item %s can only move to %s, not to %s", from, strings.Join(next, " or "), to)
+	}
+	return nil
+}
+
+// StateMessage: the message a user signs to move the item tag from the state from, set by the entry since,
+// to the state to.
+func StateMessage(tag, from string, since int, to, note string) string {
+	return fmt.Sprintf("move item %s from %s set by entry %d to %s: %s", tag, from, since, to, note)
+}
+
+var stateMessage = regexp.MustCompile(`^move item (\S+) from (\S+) set by entry (\d+) to (\S+): `)
+
+// parseStateMessage: the item, states and entry of a StateMessage, ok false if message is not one.
+func parseStateMessage(message string) (tag, from string, since int, to string, ok bool) {
+	m := stateMessage.FindStringSubmatch(message)
+	if m == nil {
+		return "", "", 0, "", false
+	}
+	since, err := strconv.Atoi(m[3])
+	if err != nil {
+		return "", "", 0, "", false
+	}
+	return m[1], m[2], since, m[4], true
+}
+
+// IsStateMessage: true if message moves an item, such an entry can only be appended by a transition.
+func IsStateMessage(message string) bool {
+	_, _, _, _, ok := parseStateMessage(message)
+	return ok
+}
+
+// ItemStatus: the current state of an item and the entries that moved it there.
+type ItemStatus struct {
+	Item  *models.Item      `json:"item"`
+	State *models.ItemState `json:"state"`
+	// History are the registration and the transitions of the item, in ledger order.
+	History []*models.Ledger `json:"history"`
+	// Disposed is the tombstone entry of the item, 0 if it was not disposed of.
+	Disposed int `json:"disposed,omitempty"`
+}
+
+// replayState: the state of item according to the ledger, and the entries that set it.
+func (db *DB) replayState(item *models.Item) (*models.ItemState, []*models.Ledger, error) {
+	ls, err := models.LedgersByItem(db, item.Tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].ID < ls[j].ID })
+	if len(ls) == 0 {
+		return nil, nil, fmt.Errorf("item %s has no registration entry", item.Tag)
+	}
+	disposed := 0
+	dp, err := models.DispositionByItem(db, item.Tag)
+	switch {
+	case err == nil:
+		disposed = dp.Ledger
+	case err != sql.ErrNoRows:
+		return nil, nil, err
+	}
+	s := &models.ItemState{Item: item.Tag, State: StateCollected, Ledger: ls[0].ID, UpdatedAt: ls[0].CreatedAt}
+	history := ls[:1]
+	for _, l := range ls[1:] {
+		if l.ID == disposed {
+			if err := CanMove(s.State, StateDestroyed); err != nil {
+				return nil, nil, fmt.Errorf("entry %d disposes of item %s: %s", l.ID, item.Tag, err)
+			}
+			s.State, s.Ledger, s.UpdatedAt = StateDestroyed, l.ID, l.CreatedAt
+			history = append(history, l)
+			continue
+		}
+		tag, from, since, to, ok := parseStateMessage(l.Message)
+		if !ok || tag != item.Tag {
+			continue
+		}
+		if from != s.State || since != s.Ledger {
+			return nil, nil, fmt.Errorf("entry %d moves item %s from %s set by entry %d, but it was %s by entry %d", l.ID, tag, from, since, s.State, s.Ledger)
+		}
+		if err := CanMove(from, to); err != nil {
+			return nil, nil, fmt.Errorf("entry %d: %s", l.ID, err)
+		}
+		s.State, s.Ledger, s.UpdatedAt = to, l.ID, l.CreatedAt
+		history = append(history, l)
+	}
+	return s, history, nil
+}
+
+// State: the current state of the item tag, from the cache if it holds the item.
+func (db *DB) State(tag string) (*models.ItemState, error) {
+	s, err := models.ItemStateByItem(db, tag)
+	if err != sql.ErrNoRows {
+		return s, err
+	}
+	// items registered before states were tracked, or imported, are cached on first use
+	item, err := models.ItemByTag(db, tag)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no item %s", tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s, _, err = db.replayState(item); err != nil {
+		return nil, err
+	}
+	return s, s.Insert(db)
+}
+
+// ItemStatus: the state of the item tag and how it got there.
+func (db *DB) ItemStatus(tag string) (*ItemStatus, error) {
+	item, err := models.ItemByTag(db, tag)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no item %s", tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &ItemStatus{Item: item}
+	if st.State, err = db.State(tag); err != nil {
+		return nil, err
+	}
+	if _, st.History, err = db.replayState(item); err != nil {
+		return nil, err
+	}
+	d, err := models.DispositionByItem(db, tag)
+	switch {
+	case err == nil:
+		st.Disposed = d.Ledger
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+	return st, nil
+}
+
+// Move: move the item tag to the state to, recorded by entry signed by identity.
+// entry must hold the signed StateMessage from the current state of the item and the entry that set it.
+// Items that were disposed of do not move. The entry and the state are written together or not at all.
+func (db *DB) Move(identity *models.Identity, tag, to, note string, entry models.Ledger) (*models.ItemState, error) {
+	var s *models.ItemState
+	err := db.atomic(func(tdb *DB) error {
+		var err error
+		if s, err = tdb.State(tag); err != nil {
+			return err
+		}
+		if err = CanMove(s.State, to); err != nil {
+			return fmt.Errorf("item %s: %s", tag, err)
+		}
+		if _, err = models.DispositionByItem(tdb, tag); err != sql.ErrNoRows {
+			if err == nil {
+				err = fmt.Errorf("item %s was disposed of", tag)
+			}
+			return err
+		}
+		if msg := StateMessage(tag, s.State, s.Ledger, to, note); entry.Message != msg {
+			return fmt.Errorf("the transition must sign %q", msg)
+		}
+		if err = tdb.scoped("", tag, &entry); err != nil {
+			return err
+		}
+		if entry, err = tdb.Append(identity, entry); err != nil {
+			return err
+		}
+		s.State, s.Ledger, s.UpdatedAt = to, entry.ID, entry.CreatedAt
+		return s.Update(tdb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ItemStates: the states of the items of caseID, or of every item if it is empty, that are in state,
+// or in any state if it is empty.
+func (db *DB) ItemStates(caseID, state string) ([]*models.ItemState, error) {
+	if state != "" && !ValidState(state) {
+		return nil, fmt.Errorf("unknown state %s, the states are %s", state, strings.Join(States, ", "))
+	}
+	var items []*models.Item
+	var err error
+	if caseID == "" {
+		items, err = models.AllItems(db)
+	} else {
+		items, err = models.ItemsByCaseID(db, caseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ss []*models.ItemState
+	for _, item := range items {
+		s, err := db.State(item.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if state == "" || s.State == state {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
@@ -0,0 +1,94 @@
+package custody
+
+import (
+	"testing"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestItemStates(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	item := models.Item{Tag: "E-1", CaseID: "C1", Description: "laptop"}
+	msg := ItemMessage(item.Tag, item.Description)
+	hash, err := SignEntry(akey, msg, item.CaseID, item.Tag)
+	FailTest(t, err, "failed to sign %s")
+	_, err = cdb.NewItem(alice, item, models.Ledger{Message: msg, Hash: hash}, nil)
+	FailTest(t, err, "failed to register item %s")
+	s, err := cdb.State("E-1")
+	FailTest(t, err, "%s")
+	if s.State != StateCollected {
+		t.Fatalf("a registered item is %s", s.State)
+	}
+
+	move := func(from string, since int, to string) error {
+		msg := StateMessage("E-1", from, since, to, "note")
+		hash, err := SignEntry(akey, msg, item.CaseID, item.Tag)
+		FailTest(t, err, "failed to sign %s")
+		_, err = cdb.Move(alice, "E-1", to, "note", models.Ledger{Message: msg, Hash: hash})
+		return err
+	}
+	if move(StateCollected, s.Ledger, StateCheckedOut) == nil {
+		t.Fatal("a collected item was checked out before it was stored")
+	}
+	if move(StateInStorage, s.Ledger, StateInTransit) == nil {
+		t.Fatal("the transition did not have to sign the current state")
+	}
+	// a move whose state cannot be written leaves no entry
+	_, err = cdb.Exec(`create trigger fail_state before update on item_states begin select raise(abort, 'disk full'); end`)
+	FailTest(t, err, "could not create trigger %s")
+	if move(StateCollected, s.Ledger, StateInStorage) == nil {
+		t.Fatal("a move succeeded without its state")
+	}
+	if ls, _ := models.LedgersByItem(cdb, "E-1"); len(ls) != 1 {
+		t.Fatalf("a failed move left its entry in the ledger %+v", ls)
+	}
+	_, err = cdb.Exec(`drop trigger fail_state`)
+	FailTest(t, err, "%s")
+	var stored int
+	for _, to := range []string{StateInStorage, StateInTransit, StateInStorage, StateCheckedOut, StateReturned, StateReleased} {
+		s, err := cdb.State("E-1")
+		FailTest(t, err, "%s")
+		if s.State == StateInStorage && stored == 0 {
+			stored = s.Ledger
+		}
+		if s.State == StateInStorage && s.Ledger != stored && move(StateInStorage, stored, to) == nil {
+			t.Fatal("a transition from an earlier stay in the same state was accepted")
+		}
+		FailTest(t, move(s.State, s.Ledger, to), "could not move the item %s")
+	}
+	s, err = cdb.State("E-1")
+	FailTest(t, err, "%s")
+	if move(StateReleased, s.Ledger, StateInStorage) == nil {
+		t.Fatal("a released item moved")
+	}
+	st, err := cdb.ItemStatus("E-1")
+	FailTest(t, err, "%s")
+	if st.State.State != StateReleased || len(st.History) != 7 || st.State.Ledger != st.History[6].ID {
+		t.Fatalf("wrong status %+v", st)
+	}
+	if !IsStateMessage(st.History[6].Message) || IsStateMessage(st.History[0].Message) {
+		t.Fatal("state messages are not recognized")
+	}
+	ss, err := cdb.ItemStates("C1", StateReleased)
+	FailTest(t, err, "%s")
+	if len(ss) != 1 || ss[0].Item != "E-1" {
+		t.Fatalf("the released item is not listed %+v", ss)
+	}
+	if ss, _ = cdb.ItemStates("C1", StateInStorage); len(ss) != 0 {
+		t.Fatalf("the released item is listed in storage %+v", ss)
+	}
+
+	// fsck compares the cache with the ledger
+	_, err = cdb.Exec("UPDATE item_states SET state = ? WHERE item = ?", StateInStorage, "E-1")
+	FailTest(t, err, "%s")
+	r, err := cdb.Fsck(nil, nil)
+	FailTest(t, err, "%s")
+	found := false
+	for _, f := range r.Findings {
+		found = found || f.Check == "state"
+	}
+	if !found {
+		t.Fatalf("fsck did not find the wrong cached state %+v", r.Findings)
+	}
+}
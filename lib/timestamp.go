@@ -0,0 +1,87 @@
+package custody
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+
+	"github.com/xo/xoutil"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/tsa"
+)
+
+// TimestampDigest: the digest submitted to the time stamping authority for a ledger entry.
+// It is the Merkle leaf hash of the entry so the token also binds the entry's place in the checkpoints.
+func TimestampDigest(l *models.Ledger) []byte {
+	return merkle.LeafHash(LeafData(l))
+}
+
+// Stamp: obtain a timestamp token for a ledger entry from s and store it.
+func (db *DB) Stamp(s tsa.Stamper, l *models.Ledger) (*models.Timestamp, error) {
+	digest := TimestampDigest(l)
+	token, err := s.Stamp(digest)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := tsa.Verify(token, digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	ts := &models.Timestamp{
+		Ledger:    l.ID,
+		CreatedAt: XONow(),
+		Token:     token,
+		GenTime:   xoutil.SqTime{Time: tok.Time},
+		Authority: tok.Authority,
+	}
+	err = ts.Insert(db)
+	return ts, err
+}
+
+// StampPending: obtain timestamp tokens for every ledger entry that does not have one yet.
+// It stops at the first failure so that entries are stamped in order, and returns how many were stamped.
+func (db *DB) StampPending(s tsa.Stamper) (int, error) {
+	ls, err := models.UnstampedLedgers(db)
+	if err != nil {
+		return 0, err
+	}
+	for i, l := range ls {
+		if _, err = db.Stamp(s, l); err != nil {
+			return i, fmt.Errorf("could not timestamp entry %d: %s", l.ID, err)
+		}
+	}
+	return len(ls), nil
+}
+
+// Timestamps: the timestamp tokens of a list of ledger entries, entries without a token are skipped.
+func (db *DB) Timestamps(ls []*models.Ledger) ([]*models.Timestamp, error) {
+	var res []*models.Timestamp
+	for _, l := range ls {
+		ts, err := models.TimestampByLedger(db, l.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ts)
+	}
+	return res, nil
+}
+
+// VerifyTimestamp: check that ts is a valid timestamp token over the ledger entry l.
+// If trusted is not nil the token must be issued by that authority.
+func VerifyTimestamp(ts *models.Timestamp, l *models.Ledger, trusted *x509.Certificate) (*tsa.Token, error) {
+	if ts.Ledger != l.ID {
+		return nil, fmt.Errorf("timestamp is for entry %d, not entry %d", ts.Ledger, l.ID)
+	}
+	tok, err := tsa.Verify(ts.Token, TimestampDigest(l), trusted)
+	if err != nil {
+		return nil, err
+	}
+	if tok.Time.Unix() != ts.GenTime.Unix() {
+		return nil, fmt.Errorf("timestamp of entry %d records %s but the token says %s", l.ID, ts.GenTime.Time, tok.Time)
+	}
+	return tok, nil
+}
@@ -0,0 +1,125 @@
+package custody
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/tsa"
+)
+
+// authority: a local time stamping authority so that tests do not need the network.
+func authority(t *testing.T, name string) *tsa.Server {
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	s, err := tsa.NewServer(key, name)
+	FailTest(t, err, "failed to create authority %s")
+	return s
+}
+
+func TestTimestamps(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	s := authority(t, "test authority")
+	alice, akey := signer(t, cdb, "alice")
+	first := record(t, cdb, alice, akey, "C1", "seize laptop")
+	second := record(t, cdb, alice, akey, "C1", "image laptop")
+
+	n, err := cdb.StampPending(s)
+	FailTest(t, err, "stamping failed %s")
+	if n != 2 {
+		t.Fatalf("stamped %d entries, want 2", n)
+	}
+	if n, _ = cdb.StampPending(s); n != 0 {
+		t.Fatalf("stamped %d entries twice", n)
+	}
+
+	ts, err := models.TimestampByLedger(cdb, first.ID)
+	FailTest(t, err, "no timestamp stored %s")
+	if ts.Authority != "test authority" {
+		t.Fatalf("wrong authority %s", ts.Authority)
+	}
+	_, err = VerifyTimestamp(ts, &first, s.Cert)
+	FailTest(t, err, "timestamp did not verify %s")
+	ts.Ledger = second.ID
+	if _, err = VerifyTimestamp(ts, &second, nil); err == nil {
+		t.Fatal("timestamp of one entry verified for another")
+	}
+	if _, err = VerifyTimestamp(ts, &first, nil); err == nil {
+		t.Fatal("timestamp verified for the wrong entry id")
+	}
+
+	b, err := cdb.Export(serverkey, "C1")
+	FailTest(t, err, "export failed %s")
+	data, err := b.Bytes()
+	FailTest(t, err, "could not write bundle %s")
+	read, err := ReadBundle(data)
+	FailTest(t, err, "could not read bundle %s")
+	r := read.Verify(&serverkey.PublicKey, s.Cert)
+	if !r.OK() || r.Timestamps != 2 {
+		t.Fatalf("bundle timestamps did not verify: %d %v", r.Timestamps, r.Failures)
+	}
+	if read.Verify(&serverkey.PublicKey, authority(t, "impostor").Cert).OK() {
+		t.Fatal("bundle timestamps verified against the wrong authority")
+	}
+}
+
+// slowStamper: an authority that answers once released, counting the tokens it issued.
+type slowStamper struct {
+	*tsa.Server
+	release chan struct{}
+	mu      sync.Mutex
+	stamped int
+}
+
+func (s *slowStamper) Stamp(digest []byte) ([]byte, error) {
+	<-s.release
+	s.mu.Lock()
+	s.stamped++
+	s.mu.Unlock()
+	return s.Server.Stamp(digest)
+}
+
+func TestClerkStamp(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	s := &slowStamper{Server: authority(t, "test authority"), release: make(chan struct{})}
+	ck.Stamper = s
+	alice, akey := signer(t, &ck.DB, "alice")
+	first := record(t, &ck.DB, alice, akey, "C1", "seize laptop")
+	record(t, &ck.DB, alice, akey, "C1", "image laptop")
+
+	// requests do not wait for the authority, and stamp from one goroutine however many ask at once
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() { defer wg.Done(); ck.Stamp() }()
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stamp waited for the authority")
+	}
+	close(s.release)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ls, err := models.UnstampedLedgers(&ck.DB); err == nil && len(ls) == 0 {
+			break
+		}
+	}
+	if _, err := models.TimestampByLedger(&ck.DB, first.ID); err != nil {
+		t.Fatalf("the entry was not stamped: %s", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stamped != 2 {
+		t.Fatalf("the authority issued %d tokens for 2 entries", s.stamped)
+	}
+}
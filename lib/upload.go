@@ -0,0 +1,203 @@
+package custody
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+	"github.gatech.edu/NIJ-Grant/custody/store"
+)
+
+// The headers of the resumable upload protocol, named as in tus.
+const (
+	UploadOffsetHeader   = "Upload-Offset"
+	UploadLengthHeader   = "Upload-Length"
+	UploadChecksumHeader = "Upload-Checksum"
+)
+
+// UploadStart: the request that starts a resumable upload.
+type UploadStart struct {
+	Item        string
+	Case        string
+	Description string
+	Size        int64
+}
+
+// UploadFinish: the request that finishes a resumable upload, like the fields of an UploadHandler form.
+type UploadFinish struct {
+	SHA256    string
+	Signature string
+	BlockSize int64
+}
+
+// ResumableHandler: resumable uploads for files too large for a single request.
+//
+//	POST   /uploads                 an UploadStart starts an upload, the reply holds its id
+//	HEAD   /uploads/<id>            the Upload-Offset header says how much has arrived
+//	PATCH  /uploads/<id>            a chunk at Upload-Offset, optionally with Upload-Checksum: sha256 <base64>
+//	POST   /uploads/<id>/finalize   an UploadFinish registers the file as an evidence item, it can be retried if it fails
+//	DELETE /uploads/<id>            abandons the upload
+//
+// An interrupted chunk is dropped, the client asks for the offset and sends the rest again.
+// The data stays outside the evidence store until finalize has checked it against the signed digest.
+func ResumableHandler(db *sql.DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		s := SessionFrom(req)
+		evidence, err := openEvidence()
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/uploads"), "/")
+		if path == "" {
+			if req.Method != "POST" {
+				res.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			startUpload(db, evidence, res, req)
+			return
+		}
+
+		id := strings.TrimSuffix(path, "/finalize")
+		var owner string
+		var item models.Item
+		err = db.QueryRow("SELECT email, item, case_id, description from partial_uploads where id = ?", id).Scan(
+			&owner, &item.Tag, &item.CaseID, &item.Description)
+		if err == sql.ErrNoRows {
+			http.NotFound(res, req)
+			return
+		}
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+		if owner != s.Email {
+			Deny(db, res, req, s, "users can only continue their own uploads")
+			return
+		}
+		p, err := evidence.OpenPartial(id)
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+
+		switch {
+		case path != id && req.Method == "POST":
+			var f UploadFinish
+			if err = json.NewDecoder(req.Body).Decode(&f); err != nil {
+				SendResponse(res, false, err.Error())
+				return
+			}
+			staged, err := p.Finish()
+			if err != nil {
+				res.WriteHeader(http.StatusConflict)
+				SendResponse(res, false, err.Error())
+				return
+			}
+			// the upload and its row stay until the registration commits, so that a failed finalize can be retried
+			defer staged.Discard()
+			if !registerUpload(db, res, req, staged, item, f.SHA256, f.Signature, f.BlockSize) {
+				return
+			}
+			if _, err = db.Exec("DELETE from partial_uploads where id = ?", id); err != nil {
+				log.Println(err)
+			}
+		case path != id:
+			res.WriteHeader(http.StatusMethodNotAllowed)
+		case req.Method == "HEAD":
+			res.Header().Set(UploadOffsetHeader, strconv.FormatInt(p.Offset(), 10))
+			res.Header().Set(UploadLengthHeader, strconv.FormatInt(p.Size(), 10))
+			res.Header().Set("Cache-Control", "no-store")
+		case req.Method == "PATCH":
+			appendChunk(p, res, req)
+		case req.Method == "DELETE":
+			if err = p.Abort(); err == nil {
+				_, err = db.Exec("DELETE from partial_uploads where id = ?", id)
+			}
+			if err != nil {
+				fivehundred(res, req, err)
+				return
+			}
+			log.Printf("%s abandoned upload %s", s.Email, id)
+			res.WriteHeader(http.StatusNoContent)
+		default:
+			res.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// startUpload: record a new resumable upload and make room for it in the store.
+func startUpload(db *sql.DB, evidence *store.Store, res http.ResponseWriter, req *http.Request) {
+	s := SessionFrom(req)
+	var start UploadStart
+	if err := json.NewDecoder(req.Body).Decode(&start); err != nil {
+		SendResponse(res, false, err.Error())
+		return
+	}
+	if start.Item == "" {
+		SendResponse(res, false, "Item not provided.")
+		return
+	}
+	p, err := evidence.NewPartial(start.Size)
+	if err != nil {
+		SendResponse(res, false, err.Error())
+		return
+	}
+	_, err = db.Exec("INSERT into partial_uploads (id, email, item, case_id, description, size, created_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		p.ID, s.Email, start.Item, start.Case, start.Description, start.Size, time.Now().UTC())
+	if err != nil {
+		p.Abort()
+		fivehundred(res, req, err)
+		return
+	}
+	log.Printf("%s started upload %s of %d bytes for item %s", s.Email, p.ID, start.Size, start.Item)
+	res.Header().Set("Location", "/uploads/"+p.ID)
+	res.Header().Set(UploadOffsetHeader, "0")
+	res.WriteHeader(http.StatusCreated)
+	SendResponse(res, true, p.ID)
+}
+
+// appendChunk: add the body of a PATCH request to the upload at its Upload-Offset.
+func appendChunk(p *store.Partial, res http.ResponseWriter, req *http.Request) {
+	offset, err := strconv.ParseInt(req.Header.Get(UploadOffsetHeader), 10, 64)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		SendResponse(res, false, "Upload-Offset not provided.")
+		return
+	}
+	var digest []byte
+	if c := req.Header.Get(UploadChecksumHeader); c != "" {
+		fields := strings.Fields(c)
+		if len(fields) != 2 || fields[0] != "sha256" {
+			res.WriteHeader(http.StatusBadRequest)
+			SendResponse(res, false, "Upload-Checksum must be sha256 <base64>.")
+			return
+		}
+		if digest, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			SendResponse(res, false, "Upload-Checksum must be sha256 <base64>.")
+			return
+		}
+	}
+	next, err := p.Append(offset, req.Body, digest)
+	res.Header().Set(UploadOffsetHeader, strconv.FormatInt(next, 10))
+	if _, ok := err.(store.ErrOffset); ok {
+		res.WriteHeader(http.StatusConflict)
+		SendResponse(res, false, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("chunk of upload %s failed: %s", p.ID, err)
+		res.WriteHeader(http.StatusBadRequest)
+		SendResponse(res, false, fmt.Sprintf("chunk dropped: %s", err))
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
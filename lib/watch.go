@@ -0,0 +1,200 @@
+package custody
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// WatchPoll: how often a watch looks for new entries.
+var WatchPoll = time.Second
+
+// WatchHeartbeat: how often a watch with no new entries sends a comment, so that clients and proxies
+// notice a dead connection.
+var WatchHeartbeat = 15 * time.Second
+
+// WatchFilter: the entries a watcher receives, the entries of a case, of an item or signed by a user.
+// The empty filter matches every entry.
+type WatchFilter struct {
+	CaseID string
+	Item   string
+	Signer string
+}
+
+// Matches: true if the entry l signed by signer passes the filter.
+func (f WatchFilter) Matches(l *models.Ledger, signer string) bool {
+	return (f.CaseID == "" || f.CaseID == l.CaseID) && (f.Item == "" || f.Item == l.Item) && (f.Signer == "" || f.Signer == signer)
+}
+
+// Watch: the entries appended after the entry with id after that pass the filter,
+// and the id of the last entry it looked at, the cursor to resume from.
+func (db *DB) Watch(f WatchFilter, after int) ([]PublishedEntry, int, error) {
+	ls, err := models.LedgersAfter(db, after)
+	if err != nil {
+		return nil, after, err
+	}
+	names := map[int]string{}
+	var es []PublishedEntry
+	for _, l := range ls {
+		name, ok := names[l.Identity]
+		if !ok {
+			ident, err := models.IdentityByID(db, l.Identity)
+			if err != nil {
+				return es, after, err
+			}
+			name, names[l.Identity] = ident.Name, ident.Name
+		}
+		if f.Matches(l, name) {
+			es = append(es, PublishEntry(l, name))
+		}
+		after = l.ID
+	}
+	return es, after, nil
+}
+
+// WatchAuthHeader: the header that carries the signature of a watch request. It is kept out of the URL,
+// which proxies and servers write to their logs.
+const WatchAuthHeader = "X-Custody-Auth"
+
+// WatchQuery: the query string of a watch request, req.Case, req.Item and req.Subject are the filter
+// and req.Entry the cursor, -1 for the latest entry. The signature goes in WatchAuthHeader, see NewWatchRequest.
+func WatchQuery(req *RecordRequest) url.Values {
+	return url.Values{
+		"name":  {req.Name},
+		"case":  {req.Case},
+		"item":  {req.Item},
+		"user":  {req.Subject},
+		"after": {strconv.Itoa(req.Entry)},
+		"time":  {strconv.FormatInt(req.Time, 10)},
+	}
+}
+
+// NewWatchRequest: the request to watch at the address watch, such as http://localhost:4911/watch.
+// req must be authorized for Clerk.Watch.
+func NewWatchRequest(watch string, req *RecordRequest) (*http.Request, error) {
+	r, err := http.NewRequest(http.MethodGet, watch+"?"+WatchQuery(req).Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set(WatchAuthHeader, base64.StdEncoding.EncodeToString(req.Auth))
+	return r, nil
+}
+
+// watchRequest: the request of a watch, from its query and WatchAuthHeader.
+func watchRequest(r *http.Request) (*RecordRequest, error) {
+	q := r.URL.Query()
+	if _, ok := q["auth"]; ok {
+		return nil, fmt.Errorf("the signature goes in the %s header, not the URL", WatchAuthHeader)
+	}
+	req := &RecordRequest{Name: q.Get("name"), Case: q.Get("case"), Item: q.Get("item"), Subject: q.Get("user")}
+	var err error
+	if req.Entry, err = strconv.Atoi(q.Get("after")); err != nil {
+		return nil, fmt.Errorf("after must be an entry number")
+	}
+	if req.Time, err = strconv.ParseInt(q.Get("time"), 10, 64); err != nil {
+		return nil, fmt.Errorf("time must be a unix time")
+	}
+	if req.Auth, err = base64.StdEncoding.DecodeString(r.Header.Get(WatchAuthHeader)); err != nil {
+		return nil, fmt.Errorf("%s must be base64", WatchAuthHeader)
+	}
+	return req, nil
+}
+
+// Watch: stream the ledger entries appended after the cursor as Server-Sent Events, see NewWatchRequest.
+// The filters are those of listing: the entries of a case or item the user can read, the user's own entries,
+// or with none of them every entry for users who read every case. Each entry is an event named entry
+// whose id is the entry number and whose data is the PublishedEntry as JSON.
+// The stream starts with an event named ready whose id is the cursor, and a client that reconnects
+// with the id of the last event it received, in the query or the Last-Event-ID header, misses no entries.
+func (c *Clerk) Watch(w http.ResponseWriter, r *http.Request) {
+	req, err := watchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := c.watchFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	after := req.Entry
+	if id, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && id > after {
+		after = id
+	}
+	if after < 0 {
+		if err = c.DB.QueryRow(`select coalesce(max(id), 0) from ledger`).Scan(&after); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "event: ready\nid: %d\ndata: %d\n\n", after, after)
+	flusher.Flush()
+
+	poll := time.NewTicker(WatchPoll)
+	defer poll.Stop()
+	quiet := time.Now()
+	for {
+		es, cursor, err := c.DB.Watch(f, after)
+		for _, e := range es {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: entry\nid: %d\ndata: %s\n\n", e.ID, data)
+			quiet = time.Now()
+		}
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+			flusher.Flush()
+			return
+		}
+		after = cursor
+		if time.Since(quiet) >= WatchHeartbeat {
+			fmt.Fprintf(w, ": heartbeat\n\n")
+			quiet = time.Now()
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// watchFilter: authenticate a watch request and check that the user may read what it asks for.
+func (c *Clerk) watchFilter(req *RecordRequest) (WatchFilter, error) {
+	f := WatchFilter{CaseID: req.Case, Item: req.Item, Signer: req.Subject}
+	i, role, err := c.caller("Clerk.Watch", req)
+	if err != nil {
+		return f, err
+	}
+	caseID := req.Case
+	if req.Item != "" {
+		item, err := models.ItemByTag(c.DB, req.Item)
+		if err != nil {
+			return f, fmt.Errorf("no item %s", req.Item)
+		}
+		if caseID != "" && caseID != item.CaseID {
+			return f, fmt.Errorf("item %s is not in case %s", req.Item, caseID)
+		}
+		caseID = item.CaseID
+	}
+	switch {
+	case caseID != "":
+		err = c.permitRead(i.Name, role, "Clerk.Watch", caseID)
+	case req.Subject != i.Name:
+		err = c.permit(i.Name, role, PermReadAll, "Clerk.Watch", "")
+	}
+	return f, err
+}
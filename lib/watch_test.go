@@ -0,0 +1,129 @@
+package custody
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// stream: the events of a watch, the event name and its data, read as they arrive.
+func stream(t *testing.T, url string, req *RecordRequest) (<-chan [2]string, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := NewWatchRequest(url+"/watch", req)
+	FailTest(t, err, "%s")
+	res, err := http.DefaultClient.Do(r.WithContext(ctx))
+	FailTest(t, err, "watch failed %s")
+	if res.StatusCode != http.StatusOK {
+		cancel()
+		res.Body.Close()
+		return nil, nil
+	}
+	events := make(chan [2]string, 16)
+	go func() {
+		defer close(events)
+		defer res.Body.Close()
+		var event, data string
+		lines := bufio.NewScanner(res.Body)
+		for lines.Scan() {
+			switch line := lines.Text(); {
+			case strings.HasPrefix(line, "event: "):
+				event = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				data = line[6:]
+			case line == "" && event != "":
+				events <- [2]string{event, data}
+				event, data = "", ""
+			}
+		}
+	}()
+	return events, cancel
+}
+
+// next: the next entry streamed, failing if none arrives in time.
+func next(t *testing.T, events <-chan [2]string) PublishedEntry {
+	select {
+	case ev := <-events:
+		var e PublishedEntry
+		if ev[0] != "entry" {
+			t.Fatalf("expected an entry, got %v", ev)
+		}
+		FailTest(t, json.Unmarshal([]byte(ev[1]), &e), "bad entry %s")
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no entry streamed")
+	}
+	return PublishedEntry{}
+}
+
+func TestWatch(t *testing.T) {
+	WatchPoll = 10 * time.Millisecond
+	defer func() { WatchPoll = time.Second }()
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	admin := enroll(t, ck, "admin")
+	officer := enroll(t, ck, "officer")
+	ids, err := models.IdentitiesByName(ck.DB, "admin")
+	FailTest(t, err, "%s")
+	srv := httptest.NewServer(http.HandlerFunc(ck.Watch))
+	defer srv.Close()
+
+	if events, _ := stream(t, srv.URL, signed(t, "Clerk.Watch", "officer", officer, RecordRequest{Case: "C1"})); events != nil {
+		t.Fatal("a user watched a case they cannot read")
+	}
+	forged := signed(t, "Clerk.Watch", "admin", admin, RecordRequest{Case: "C1"})
+	forged.Case = "C2"
+	if events, _ := stream(t, srv.URL, forged); events != nil {
+		t.Fatal("a watch with a bad signature was accepted")
+	}
+	// the signature is only taken from the header, a URL with it would leave it in access logs
+	inURL := signed(t, "Clerk.Watch", "admin", admin, RecordRequest{Case: "C1"})
+	q := WatchQuery(inURL)
+	q.Set("auth", base64.URLEncoding.EncodeToString(inURL.Auth))
+	res, err := http.Get(srv.URL + "/watch?" + q.Encode())
+	FailTest(t, err, "%s")
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("a watch signed in the URL got %d", res.StatusCode)
+	}
+
+	seized := record(t, &ck.DB, ids[0], admin, "C1", "seized")
+	record(t, &ck.DB, ids[0], admin, "C2", "seized elsewhere")
+	events, cancel := stream(t, srv.URL, signed(t, "Clerk.Watch", "admin", admin, RecordRequest{Case: "C1", Entry: 0}))
+	if ev := <-events; ev != [2]string{"ready", "0"} {
+		t.Fatalf("the stream did not start at the cursor: %v", ev)
+	}
+	if e := next(t, events); e.ID != seized.ID || e.Signer != "admin" || e.Message != "seized" {
+		t.Fatalf("wrong entry %+v", e)
+	}
+	bagged := record(t, &ck.DB, ids[0], admin, "C1", "bagged")
+	if e := next(t, events); e.ID != bagged.ID {
+		t.Fatalf("the new entry was not streamed, got %+v", e)
+	}
+	cancel()
+
+	// entries committed while disconnected are streamed on resume
+	record(t, &ck.DB, ids[0], admin, "C2", "returned")
+	sent := record(t, &ck.DB, ids[0], admin, "C1", "sent to lab")
+	events, cancel = stream(t, srv.URL, signed(t, "Clerk.Watch", "admin", admin, RecordRequest{Case: "C1", Entry: bagged.ID}))
+	defer cancel()
+	<-events
+	if e := next(t, events); e.ID != sent.ID {
+		t.Fatalf("resumed at %+v, not entry %d", e, sent.ID)
+	}
+
+	// a watch from the latest entry starts there, and users can watch their own entries
+	latest, stop := stream(t, srv.URL, signed(t, "Clerk.Watch", "officer", officer, RecordRequest{Subject: "officer", Entry: -1}))
+	defer stop()
+	if ev := <-latest; ev[0] != "ready" || ev[1] != strconv.Itoa(sent.ID) {
+		t.Fatalf("the watch did not start at the latest entry: %v", ev)
+	}
+}
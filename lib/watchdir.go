@@ -0,0 +1,481 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Directory watching. custody watch-dir records what happens to the files of a case directory on a forensic
+// workstation: every file created, modified, renamed or deleted becomes an entry signed with the key of the examiner,
+// stating the size and digests of the file. A burst of events on a file becomes one entry once the file is quiet,
+// files matching an ignore pattern are skipped, and signed entries wait in a local queue, in order, until the server
+// accepts them.
+
+// RenameMessage: the message a user signs to record that the file from was renamed to the file to with digests d.
+func RenameMessage(from, to string, d *FileDigests) string {
+	return fmt.Sprintf("rename file %s to %s: %s", from, to, d)
+}
+
+// DeleteMessage: the message a user signs to record that the file named name was deleted,
+// with its digests when they were known.
+func DeleteMessage(name string, d *FileDigests) string {
+	if d == nil {
+		return fmt.Sprintf("delete file %s", name)
+	}
+	return fmt.Sprintf("delete file %s: %s", name, d)
+}
+
+// observed: msg with the time the change was seen, which a queued entry would lose otherwise.
+func observed(msg string, t time.Time) string {
+	return fmt.Sprintf("%s, observed %s", msg, t.UTC().Format(time.RFC3339))
+}
+
+// DefaultAttempts: how many times an entry the server fails on is sent before it is set aside.
+const DefaultAttempts = 10
+
+// EntryQueue: signed entries waiting for the server, one file each in Dir, sent oldest first.
+// Entries the server refuses for good, or fails on Attempts times, are moved to rejected/ in Dir
+// so that they do not hold up the rest.
+type EntryQueue struct {
+	Dir      string
+	Attempts int // 0 for DefaultAttempts
+
+	failed map[string]int // how many times the server failed on each entry
+}
+
+// Push: add req to the end of the queue.
+func (q *EntryQueue) Push(req *RecordRequest) error {
+	if err := os.MkdirAll(q.Dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.Dir, fmt.Sprintf("%020d.json", time.Now().UnixNano()))
+	for {
+		if _, err = os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = strings.TrimSuffix(path, ".json") + "_.json"
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Pending: the paths of the queued entries, oldest first.
+func (q *EntryQueue) Pending() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(q.Dir, "*.json"))
+	sort.Strings(paths)
+	return paths, err
+}
+
+// Flush: send the queued entries in order, and the number sent. It stops at the first entry that cannot be
+// delivered, such as when the server is down or busy, and returns that error so the entry is tried again later.
+func (q *EntryQueue) Flush(send func(req *RecordRequest) error) (int, error) {
+	paths, err := q.Pending()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return sent, err
+		}
+		req := &RecordRequest{}
+		if err = json.Unmarshal(data, req); err != nil {
+			return sent, fmt.Errorf("corrupt queue entry %s: %s", path, err)
+		}
+		err = send(req)
+		if q.setAside(path, err) {
+			log.Printf("set aside queued entry %q: %s", req.Data, err)
+			rejected := filepath.Join(q.Dir, "rejected")
+			if err = os.MkdirAll(rejected, 0700); err != nil {
+				return sent, err
+			}
+			if err = os.Rename(path, filepath.Join(rejected, filepath.Base(path))); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+		if err = os.Remove(path); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// setAside: true if the entry at path should be moved to rejected/ now that sending it returned err,
+// because the server refused it or failed on it Attempts times. A server that cannot be reached does not count.
+func (q *EntryQueue) setAside(path string, err error) bool {
+	if _, answered := err.(rpc.ServerError); !answered {
+		delete(q.failed, path)
+		return false
+	}
+	if Refused(err) {
+		delete(q.failed, path)
+		return true
+	}
+	if q.failed == nil {
+		q.failed = map[string]int{}
+	}
+	q.failed[path]++
+	attempts := q.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+	if q.failed[path] < attempts {
+		return false
+	}
+	delete(q.failed, path)
+	return true
+}
+
+// RefusedPrefix: how the clerk starts the error of an entry it refuses for good, for its signature, its contents,
+// the policy or the permissions of the signer. Sending such an entry again cannot succeed.
+const RefusedPrefix = "refused: "
+
+// Refused: true if err is the server refusing an entry for good. Other errors, such as a server that cannot be
+// reached or a database that is locked, may pass and the entry should be sent again.
+func Refused(err error) bool {
+	refused, ok := err.(rpc.ServerError)
+	return ok && strings.HasPrefix(string(refused), RefusedPrefix)
+}
+
+// refusal: err marked with RefusedPrefix, unless it is the database failing to do the work, which may pass.
+func refusal(err error) error {
+	if err == nil || transient(err) {
+		return err
+	}
+	return fmt.Errorf("%s%w", RefusedPrefix, err)
+}
+
+// transient: true if err is the database being busy, unreachable or out of resources rather than refusing the work.
+func transient(err error) bool {
+	var serr sqlite3.Error
+	if errors.As(err, &serr) {
+		switch serr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrIoErr, sqlite3.ErrFull, sqlite3.ErrCantOpen, sqlite3.ErrNomem, sqlite3.ErrInterrupt:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone)
+}
+
+// DirWatcher: records the changes to the files under Dir as entries signed by Name with Key for a case and
+// optionally an item. Files are named by their path relative to Dir.
+type DirWatcher struct {
+	Dir      string
+	Name     string
+	Key      *ecdsa.PrivateKey
+	CaseID   string
+	Item     string
+	Ignore   []string      // patterns matched against the base name and the relative path of a file
+	Debounce time.Duration // how long a file must be quiet before its entry is signed
+	Legacy   []string      // legacy digests to record next to SHA-256
+	Retry    time.Duration // how long to wait before trying the server again
+	Queue    *EntryQueue
+	Send     func(req *RecordRequest) error
+
+	watcher   *fsnotify.Watcher
+	known     map[string]*FileDigests // the files present, with their digests once hashed
+	pending   map[string]*fileChange
+	waiting   []hashedFile      // settled files not yet hashed, in the order they last changed
+	hashing   bool              // true while a batch of files is being hashed
+	hashed    chan []hashedFile // the batches hashed
+	renamed   string            // the last file renamed, paired with the create that follows
+	renamedAt time.Time
+	retryAt   time.Time // when to try the server again, zero while it is up
+}
+
+// fileChange: the events on a file not yet recorded.
+type fileChange struct {
+	last time.Time
+	from string // the file this one was renamed from
+	to   string // the file this one was renamed to
+}
+
+// hashedFile: a settled file, with what hashing it found.
+type hashedFile struct {
+	rel  string
+	c    *fileChange
+	d    *FileDigests
+	gone bool // the file was deleted or is not a regular file any more
+	err  error
+}
+
+// Ignored: true if the file at the relative path rel matches an ignore pattern.
+func (w *DirWatcher) Ignored(rel string) bool {
+	for _, pattern := range w.Ignore {
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Run: watch Dir until stop is closed. The files present when it starts are taken as they are, only later
+// changes are recorded. Whatever is queued is sent first.
+func (w *DirWatcher) Run(stop <-chan struct{}) error {
+	if w.Queue == nil || w.Send == nil {
+		return fmt.Errorf("a directory watcher needs a queue and a way to send entries")
+	}
+	var err error
+	if w.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return err
+	}
+	defer w.watcher.Close()
+	w.known, w.pending = map[string]*FileDigests{}, map[string]*fileChange{}
+	w.waiting, w.hashing, w.hashed = nil, false, make(chan []hashedFile, 1)
+	if err = w.add(w.Dir, false); err != nil {
+		return err
+	}
+	tick := w.Debounce / 4
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			w.settle(time.Now(), true)
+			for w.hashing {
+				w.recordHashed(<-w.hashed)
+			}
+			w.flush(time.Now())
+			return nil
+		case batch := <-w.hashed:
+			w.recordHashed(batch)
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			w.event(ev, time.Now())
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("watching %s: %s", w.Dir, err)
+		case now := <-ticker.C:
+			w.settle(now, false)
+			w.flush(now)
+		}
+	}
+}
+
+// add: watch the directory dir and those under it. The files in a directory that appears while watching
+// were created in it, the files present at the start were not.
+func (w *DirWatcher) add(dir string, created bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(w.Dir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && w.Ignored(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case info.IsDir():
+			return w.watcher.Add(path)
+		case !info.Mode().IsRegular():
+		case created:
+			w.pending[rel] = &fileChange{last: time.Now()}
+		default:
+			w.known[rel] = nil
+		}
+		return nil
+	})
+}
+
+// event: note the event ev on a file, seen at now.
+func (w *DirWatcher) event(ev fsnotify.Event, now time.Time) {
+	rel, err := filepath.Rel(w.Dir, ev.Name)
+	if err != nil || w.Ignored(rel) || ev.Op == fsnotify.Chmod {
+		return
+	}
+	c := w.pending[rel]
+	if c == nil {
+		c = &fileChange{}
+		w.pending[rel] = c
+	}
+	c.last = now
+	switch {
+	case ev.Has(fsnotify.Create):
+		if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+			delete(w.pending, rel)
+			if err = w.add(ev.Name, true); err != nil {
+				log.Printf("could not watch %s: %s", ev.Name, err)
+			}
+			return
+		}
+		// A rename is reported as the rename of the old name followed by the create of the new one.
+		if w.renamed != "" && w.renamed != rel && now.Sub(w.renamedAt) < time.Second {
+			c.from = w.renamed
+			if old := w.pending[w.renamed]; old != nil {
+				old.to = rel
+			}
+			w.renamed = ""
+		}
+	case ev.Has(fsnotify.Rename):
+		w.renamed, w.renamedAt = rel, now
+	}
+}
+
+// settle: hash the files that have been quiet for the debounce interval, or all of them if all is true,
+// in the order they last changed.
+func (w *DirWatcher) settle(now time.Time, all bool) {
+	var ready []string
+	for rel, c := range w.pending {
+		if all || now.Sub(c.last) >= w.Debounce {
+			ready = append(ready, rel)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return w.pending[ready[i]].last.Before(w.pending[ready[j]].last) })
+	for _, rel := range ready {
+		w.waiting = append(w.waiting, hashedFile{rel: rel, c: w.pending[rel]})
+		delete(w.pending, rel)
+	}
+	w.hash()
+}
+
+// hash: hash the waiting files on another goroutine, so that events keep being read while a large file is hashed.
+// One batch is hashed at a time and batches are recorded in order, so the entries follow the order of the changes.
+func (w *DirWatcher) hash() {
+	if w.hashing || len(w.waiting) == 0 {
+		return
+	}
+	batch := w.waiting
+	w.waiting, w.hashing = nil, true
+	go func() {
+		for i := range batch {
+			f := &batch[i]
+			path := filepath.Join(w.Dir, f.rel)
+			info, err := os.Stat(path)
+			switch {
+			case os.IsNotExist(err):
+				f.gone = true
+			case err != nil:
+				f.err = err
+			case !info.Mode().IsRegular():
+				f.gone = true
+			default:
+				f.d, f.err = DigestFile(path, w.Legacy)
+			}
+		}
+		w.hashed <- batch
+	}()
+}
+
+// recordHashed: record the changes to the files of batch, and hash the files that settled meanwhile.
+func (w *DirWatcher) recordHashed(batch []hashedFile) {
+	w.hashing = false
+	for i := range batch {
+		f := &batch[i]
+		if f.err != nil {
+			log.Printf("could not hash %s: %s", f.rel, f.err)
+			continue
+		}
+		if msg := w.change(f); msg != "" {
+			if err := w.record(observed(msg, f.c.last)); err != nil {
+				log.Printf("could not record %q: %s", msg, err)
+			}
+		}
+	}
+	w.hash()
+}
+
+// change: the message recording the change to the hashed file f, empty if there is nothing to record.
+func (w *DirWatcher) change(f *hashedFile) string {
+	rel, c, d := f.rel, f.c, f.d
+	if f.gone {
+		d, known := w.known[rel]
+		delete(w.known, rel)
+		if !known || c.to != "" {
+			// Created and gone before it settled, or renamed, which the new name records.
+			return ""
+		}
+		return DeleteMessage(rel, d)
+	}
+	old, known := w.known[rel]
+	w.known[rel] = d
+	switch {
+	case c.from != "":
+		delete(w.known, c.from)
+		return RenameMessage(c.from, rel, d)
+	case !known:
+		msg, _ := FileMessage("create", rel, d)
+		return msg
+	case old != nil && old.String() == d.String():
+		return ""
+	}
+	msg, _ := FileMessage("modify", rel, d)
+	return msg
+}
+
+// record: sign msg and queue the entry.
+func (w *DirWatcher) record(msg string) error {
+	log.Printf("signing statement: %s", msg)
+	data := []byte(msg)
+	hash, err := SignEntry(w.Key, msg, w.CaseID, w.Item)
+	if err != nil {
+		return err
+	}
+	return w.Queue.Push(&RecordRequest{Name: w.Name, Data: data, Hash: hash, Case: w.CaseID, Item: w.Item})
+}
+
+// flush: send the queued entries, keeping them queued and waiting Retry if the server cannot be reached.
+func (w *DirWatcher) flush(now time.Time) {
+	if now.Before(w.retryAt) {
+		return
+	}
+	n, err := w.Queue.Flush(w.Send)
+	if n > 0 {
+		log.Printf("sent %d entries", n)
+	}
+	if err != nil {
+		if w.retryAt.IsZero() {
+			paths, _ := w.Queue.Pending()
+			log.Printf("could not send, %d entries queued: %s", len(paths), err)
+		}
+		w.retryAt = now.Add(w.Retry)
+		return
+	}
+	w.retryAt = time.Time{}
+}
@@ -0,0 +1,218 @@
+package custody
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestDirWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "custody")
+	FailTest(t, err, "could not make tempdir %s")
+	defer os.RemoveAll(dir)
+	cases, queue := filepath.Join(dir, "cases"), filepath.Join(dir, "queue")
+	FailTest(t, os.MkdirAll(filepath.Join(cases, "photos"), 0700), "%s")
+	FailTest(t, ioutil.WriteFile(filepath.Join(cases, "notes.txt"), []byte("seized"), 0600), "%s")
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "%s")
+
+	var mu sync.Mutex
+	var sent []string
+	down := false
+	w := &DirWatcher{Dir: cases, Name: "examiner", Key: key, CaseID: "C1", Ignore: []string{"*.tmp"},
+		Debounce: 50 * time.Millisecond, Retry: 50 * time.Millisecond, Queue: &EntryQueue{Dir: queue}}
+	w.Send = func(req *RecordRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			return fmt.Errorf("connection refused")
+		}
+		if !cryptopasta.Verify(EntryStatement(string(req.Data), req.Case, req.Item), req.Hash, &key.PublicKey) || req.Case != "C1" {
+			return rpc.ServerError(RefusedPrefix + "CryptoError: op:InvalidSignature, id:examiner")
+		}
+		sent = append(sent, strings.SplitN(string(req.Data), ":", 2)[0])
+		return nil
+	}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- w.Run(stop) }()
+	time.Sleep(100 * time.Millisecond)
+
+	wait := func(want ...string) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			mu.Lock()
+			n := len(sent)
+			mu.Unlock()
+			if n >= len(want) {
+				break
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Join(sent, "; ") != strings.Join(want, "; ") {
+			t.Fatalf("expected entries %q, got %q", want, sent)
+		}
+	}
+	write := func(name, data string) {
+		FailTest(t, ioutil.WriteFile(filepath.Join(cases, name), []byte(data), 0600), "%s")
+	}
+
+	f, err := os.Create(filepath.Join(cases, "photos", "1.jpg"))
+	FailTest(t, err, "%s")
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(f, "chunk %d\n", i)
+	}
+	f.Close()
+	write("scratch.tmp", "ignored")
+	wait("create file photos/1.jpg")
+
+	write("notes.txt", "seized and imaged")
+	wait("create file photos/1.jpg", "modify file notes.txt")
+	FailTest(t, os.Rename(filepath.Join(cases, "notes.txt"), filepath.Join(cases, "report.txt")), "%s")
+	wait("create file photos/1.jpg", "modify file notes.txt", "rename file notes.txt to report.txt")
+	FailTest(t, os.Remove(filepath.Join(cases, "photos", "1.jpg")), "%s")
+	wait("create file photos/1.jpg", "modify file notes.txt", "rename file notes.txt to report.txt", "delete file photos/1.jpg")
+
+	mu.Lock()
+	down, sent = true, nil
+	mu.Unlock()
+	write("a.txt", "a")
+	time.Sleep(300 * time.Millisecond)
+	write("b.txt", "b")
+	time.Sleep(300 * time.Millisecond)
+	if paths, _ := w.Queue.Pending(); len(paths) != 2 {
+		t.Fatalf("expected 2 queued entries while the server is down, got %d", len(paths))
+	}
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	wait("create file a.txt", "create file b.txt")
+	close(stop)
+	FailTest(t, <-done, "%s")
+}
+
+func TestEntryQueueRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "custody")
+	FailTest(t, err, "could not make tempdir %s")
+	defer os.RemoveAll(dir)
+	q := &EntryQueue{Dir: dir}
+	for _, msg := range []string{"first", "refused", "last"} {
+		FailTest(t, q.Push(&RecordRequest{Name: "examiner", Data: []byte(msg)}), "%s")
+	}
+	var sent []string
+	locked := true
+	send := func(req *RecordRequest) error {
+		switch {
+		case string(req.Data) == "refused":
+			return rpc.ServerError(RefusedPrefix + "access denied: examiner called DB.Append on case C1: policy register.roles: officer")
+		case string(req.Data) == "last" && locked:
+			return rpc.ServerError("database is locked")
+		}
+		sent = append(sent, string(req.Data))
+		return nil
+	}
+	n, err := q.Flush(send)
+	if n != 1 || err == nil || strings.Join(sent, " ") != "first" {
+		t.Fatalf("a busy server should keep the entry queued, sent %d %q: %v", n, sent, err)
+	}
+	if pending, _ := q.Pending(); len(pending) != 1 {
+		t.Fatalf("expected the entry to stay queued, got %q", pending)
+	}
+	locked = false
+	n, err = q.Flush(send)
+	FailTest(t, err, "%s")
+	if n != 1 || strings.Join(sent, " ") != "first last" {
+		t.Fatalf("wrong entries sent %d %q", n, sent)
+	}
+	if rejected, _ := filepath.Glob(filepath.Join(dir, "rejected", "*.json")); len(rejected) != 1 {
+		t.Fatalf("the refused entry was not set aside %q", rejected)
+	}
+}
+
+func TestEntryQueueAttempts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "custody")
+	FailTest(t, err, "could not make tempdir %s")
+	defer os.RemoveAll(dir)
+	q := &EntryQueue{Dir: dir, Attempts: 3}
+	for _, msg := range []string{"failing", "last"} {
+		FailTest(t, q.Push(&RecordRequest{Name: "examiner", Data: []byte(msg)}), "%s")
+	}
+	var sent []string
+	down := true
+	send := func(req *RecordRequest) error {
+		switch {
+		case down:
+			return fmt.Errorf("connection refused")
+		case string(req.Data) == "failing":
+			return rpc.ServerError("no item E9")
+		}
+		sent = append(sent, string(req.Data))
+		return nil
+	}
+	// an unreachable server is no attempt
+	for i := 0; i < 5; i++ {
+		if n, err := q.Flush(send); n != 0 || err == nil {
+			t.Fatalf("sent %d to a server that is down: %v", n, err)
+		}
+	}
+	down = false
+	for i := 0; i < 2; i++ {
+		if n, err := q.Flush(send); n != 0 || err == nil {
+			t.Fatalf("attempt %d: an entry the server failed on was passed by, sent %d: %v", i+1, n, err)
+		}
+	}
+	n, err := q.Flush(send)
+	FailTest(t, err, "%s")
+	if n != 1 || strings.Join(sent, " ") != "last" {
+		t.Fatalf("wrong entries sent %d %q", n, sent)
+	}
+	if rejected, _ := filepath.Glob(filepath.Join(dir, "rejected", "*.json")); len(rejected) != 1 {
+		t.Fatalf("the entry was not set aside after 3 attempts %q", rejected)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	for _, tc := range []struct {
+		err     error
+		refused bool
+	}{
+		{rpc.ServerError(RefusedPrefix + "CryptoError: op:RevokedKey, id:examiner"), true},
+		{rpc.ServerError(RefusedPrefix + "no item E9"), true},
+		{rpc.ServerError("database is locked"), false},
+		{fmt.Errorf(RefusedPrefix + "not from the server"), false},
+		{nil, false},
+	} {
+		if Refused(tc.err) != tc.refused {
+			t.Errorf("Refused(%v) should be %v", tc.err, tc.refused)
+		}
+	}
+
+	// the clerk marks what it refuses, whatever the reason, and not a database that may pass
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	admin := enroll(t, ck, "admin")
+	sig, _ := SignEntry(admin, "collected from scene", "C1", "")
+	FailTest(t, ck.Validate(&RecordRequest{Name: "admin", Data: []byte("collected from scene"), Hash: sig, Case: "C1"}, &Receipt{}), "%s")
+	for _, req := range []RecordRequest{
+		{Name: "admin", Data: []byte("collected from scene"), Hash: sig, Case: "C1"},
+		{Name: "admin", Data: []byte("collected elsewhere"), Hash: sig, Case: "C1"},
+		{Name: "nobody", Data: []byte("collected from scene"), Hash: sig, Case: "C1"},
+	} {
+		err := ck.Validate(&req, &Receipt{})
+		if err == nil || !Refused(rpc.ServerError(err.Error())) {
+			t.Errorf("entry %q of %s is not refused for good: %v", req.Data, req.Name, err)
+		}
+	}
+	if err := refusal(sqlite3.Error{Code: sqlite3.ErrBusy}); Refused(rpc.ServerError(err.Error())) {
+		t.Errorf("a busy database refused an entry: %s", err)
+	}
+}
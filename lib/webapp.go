@@ -1,22 +1,30 @@
 package custody
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/gtank/cryptopasta"
 	"github.gatech.edu/NIJ-Grant/custody/client"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/piecewise"
 	"github.gatech.edu/NIJ-Grant/custody/models"
-	"github.gatech.edu/NIJ-Grant/nij-backend/util"
-	"golang.org/x/crypto/bcrypt"
+	"github.gatech.edu/NIJ-Grant/custody/store"
 	"html/template"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/rpc"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Response struct {
@@ -36,124 +44,254 @@ type Submission struct {
 var versionInfo string = "v0.0.0"
 var templates *template.Template
 
-var state util.ErrorHandler = util.ErrorHandler{versionInfo, templates}
-
+// fivehundred: write the 500 error page for err.
+// The templates are looked up when the error happens since LoadTemplates runs after package load.
 func fivehundred(w http.ResponseWriter, r *http.Request, err error) {
-	state.HtmlErrorPage(w, r, err, http.StatusInternalServerError)
+	log.Printf("error serving %s: %s", r.URL.Path, err)
+	if templates == nil || templates.Lookup("500.html") == nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	d := map[string]interface{}{"Version": versionInfo,
+		"StatusText": http.StatusText(http.StatusInternalServerError),
+		"Msg":        err.Error(),
+	}
+	if err = templates.ExecuteTemplate(w, "500.html", d); err != nil {
+		log.Printf("could not write the error page: %s", err)
+	}
+}
+
+// templateFuncs: the functions the templates can call, for custody forms.
+var templateFuncs = map[string]interface{}{
+	"status": func(ok bool) string {
+		if ok {
+			return "verified"
+		}
+		return "FAILED"
+	},
+	"inc": func(i int) int { return i + 1 },
 }
 
 // LoadTemplates loades the html templates into cache
 func LoadTemplates(templateFiles []string) {
 	// load the templates into a template cache panic on error.
-	templates = template.Must(template.ParseFiles(templateFiles...))
+	templates = template.Must(template.New("").Funcs(templateFuncs).ParseFiles(templateFiles...))
 	//log.WithFields(log.Fields{"Templates": templates.DefinedTemplates()}).Info("Read Templates")
 }
 
-func IndexHandler() http.HandlerFunc {
+// IndexHandler: the public landing page, it shows who is logged in.
+func IndexHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data := map[string]interface{}{"Version": versionInfo} //"CASUser": map[bool]string{true: cas.Username(r), false: ""}[cas.IsAuthenticated(r)]
+		data := map[string]interface{}{"Version": versionInfo, "CSRFField": CSRFField}
+		s, err := currentSession(db, r)
+		if err != nil {
+			fivehundred(w, r, err)
+			return
+		}
+		if s != nil {
+			data["User"] = s.Email
+			data["CSRF"] = s.CSRF
+		}
 
-		err := templates.ExecuteTemplate(w, "index.html", data)
+		err = templates.ExecuteTemplate(w, "index.html", data)
 		if err != nil {
 			fivehundred(w, r, err)
 		}
 	}
 }
 
-// SubmitValidate: Validates user record request based on hash signed
-// with user private key.
-func SubmitValidate(username string, hash []byte, file io.Reader) error {
-	// Reads file into memory
-	var data []byte
-	_, err := io.ReadFull(file, data)
+// StoreDir: the directory of the content addressed store for uploaded evidence.
+var StoreDir = "evidence"
+
+// StoreKeys: the master keys that encrypt the evidence store, without them blobs are stored in plaintext.
+var StoreKeys *store.Keyring
+
+// Ledger: the custody database of the custody server, which holds the case memberships that decide
+// who may read the evidence of a case, as they do for the clerk.
+var Ledger *DB
+
+// openEvidence: the evidence store in StoreDir, encrypted with StoreKeys.
+func openEvidence() (*store.Store, error) {
+	evidence, err := store.Open(StoreDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	evidence.Keys = StoreKeys
+	return evidence, nil
+}
 
+// SubmitUpload: ask the custody server to register an uploaded file as an evidence item.
+// signature must sign the UploadMessage of the item with the key of username,
+// or its HashListMessage if list is not nil.
+func SubmitUpload(username string, item models.Item, signature []byte, list *piecewise.List) (models.Item, error) {
+	var reply models.Item
 	clnt, err := rpc.DialHTTP("tcp", "localhost:4911")
 	if err != nil {
 		log.Println("Issues connecting to custody server.")
-		return err
+		return reply, err
 	}
+	defer clnt.Close()
 
-	req := RecordRequest{Name: username, Data: data, Hash: hash}
-	var reply models.Ledger
-	err = clnt.Call("Clerk.Validate", &req, &reply)
-	if err != nil {
-		log.Println(err)
-		return err
+	message := UploadMessage(item.Tag, item.Description, item.Digest)
+	if list != nil {
+		message = HashListMessage(message, list)
 	}
-	return nil
+	req := RecordRequest{Name: username, Data: []byte(message), Hash: signature,
+		Case: item.CaseID, Item: item.Tag, Description: item.Description, Digest: item.Digest, HashList: list}
+	err = clnt.Call("Clerk.Upload", &req, &reply)
+	return reply, err
 }
 
-// UploadHandler: Handles upload requests.
-func UploadHandler() http.HandlerFunc {
+// UploadHandler: Handles upload requests. Users can only upload under their own name.
+// The multipart form holds the fields item, case and description, sha256 with the hex digest of the file,
+// signature with the base64 signature of the UploadMessage for them, and the file itself.
+// With the optional field block_size the server computes the hash list of the file in blocks of that many bytes,
+// and the signature must cover its HashListMessage instead.
+// The file streams into the evidence store while it is hashed, and is only added to the store
+// and registered as an evidence item if the computed digest is the signed one.
+func UploadHandler(db *sql.DB) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		if req.Method == "POST" {
-			req.ParseMultipartForm(32 << 20)
+		if req.Method != "POST" {
+			res.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s := SessionFrom(req)
+		evidence, err := openEvidence()
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+		mr, err := req.MultipartReader()
+		if err != nil {
+			SendResponse(res, false, err.Error())
+			return
+		}
 
-			username := req.FormValue("username")
-			if username == "" {
-				log.Println("Username not provided.")
-				SendResponse(res, false, "Username not provided.")
-				return
+		fields := map[string]string{}
+		var staged *store.Staged
+		defer func() {
+			if staged != nil {
+				staged.Discard()
 			}
-			path := "./uploads/" + username + "/"
-
-			_, err := os.Stat(path)
-			if os.IsNotExist(err) {
-				os.MkdirAll(path, 0700)
-				log.Printf("Creating directory %s", path)
+		}()
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
 			}
-
-			file, handler, err := req.FormFile("file")
 			if err != nil {
 				log.Println(err)
 				SendResponse(res, false, err.Error())
 				return
 			}
-			defer file.Close()
-
-			log.Printf("Saving to %s\n", path)
-
-			f, err := os.OpenFile(path+handler.Filename, os.O_WRONLY|os.O_CREATE, 0700)
-			if err != nil {
-				log.Println(err)
-				SendResponse(res, false, err.Error())
+			if part.FormName() != "file" {
+				v, err := ioutil.ReadAll(io.LimitReader(part, 1<<16))
+				if err != nil {
+					SendResponse(res, false, err.Error())
+					return
+				}
+				fields[part.FormName()] = string(v)
+				continue
+			}
+			if staged != nil {
+				SendResponse(res, false, "Only one file can be uploaded at a time.")
 				return
 			}
-			defer f.Close()
-
-			// Writes file to the file system.
-			_, err = io.Copy(f, file)
-			if err != nil {
+			if staged, err = evidence.Stage(part); err != nil {
+				log.Println(err)
 				SendResponse(res, false, err.Error())
 				return
 			}
+		}
 
-			hash := []byte(req.FormValue("hash"))
-			if len(hash) == 0 {
-				log.Println("Hash not provided")
-				SendResponse(res, false, "Hash not provided")
+		if username := fields["username"]; username != "" && username != s.Email {
+			Deny(db, res, req, s, "users can only upload as themselves")
+			return
+		}
+		if staged == nil {
+			SendResponse(res, false, "File not provided.")
+			return
+		}
+		var blockSize int64
+		if b := fields["block_size"]; b != "" {
+			if blockSize, err = strconv.ParseInt(b, 10, 64); err != nil || blockSize <= 0 {
+				SendResponse(res, false, "Block size must be a positive number of bytes.")
 				return
 			}
+		}
+		item := models.Item{Tag: fields["item"], CaseID: fields["case"], Description: fields["description"]}
+		registerUpload(db, res, req, staged, item, fields["sha256"], fields["signature"], blockSize)
+	}
+}
 
-			err = SubmitValidate(username, hash, file)
-			if err != nil {
-				log.Println(err)
-				SendResponse(res, false, err.Error())
-				return
-			}
+// registerUpload: check a staged upload against the digest signed by the uploader,
+// have the custody server register it as an evidence item and only then add it to the evidence store.
+// digest is hex and signature base64, as the client sends them. A positive blockSize registers the hash list of the file.
+// It returns true once the file is in the evidence store.
+func registerUpload(db *sql.DB, res http.ResponseWriter, req *http.Request, staged *store.Staged, item models.Item, digest, signature string, blockSize int64) bool {
+	s := SessionFrom(req)
+	signed, err := hex.DecodeString(digest)
+	if err != nil || !bytes.Equal(signed, staged.Digest) {
+		log.Printf("upload by %s does not match its signed digest %q", s.Email, digest)
+		SendResponse(res, false, fmt.Sprintf("The file hashes to %x, not to the signed digest.", staged.Digest))
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		SendResponse(res, false, "Signature must be base64.")
+		return false
+	}
 
-			SendResponse(res, true, "")
+	var list *piecewise.List
+	if blockSize > 0 {
+		if list, err = hashStaged(staged, blockSize); err != nil {
+			fivehundred(res, req, err)
+			return false
 		}
 	}
+
+	item.Digest = staged.Digest
+	if item, err = SubmitUpload(s.Email, item, sig, list); err != nil {
+		log.Println(err)
+		SendResponse(res, false, err.Error())
+		return false
+	}
+	path, err := staged.Commit()
+	if err != nil {
+		fivehundred(res, req, err)
+		return false
+	}
+	_, err = db.Exec("INSERT into uploads (digest, email, item, created_at) VALUES(?, ?, ?, ?)",
+		hex.EncodeToString(item.Digest), s.Email, item.Tag, time.Now().UTC())
+	if err != nil {
+		log.Println(err)
+	}
+	log.Printf("%s uploaded item %s to %s", s.Email, item.Tag, path)
+	SendResponse(res, true, hex.EncodeToString(item.Digest))
+	return true
+}
+
+// hashStaged: the hash list of a staged upload.
+func hashStaged(staged *store.Staged, blockSize int64) (*piecewise.List, error) {
+	f, err := staged.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return piecewise.Hash(f, staged.Size, blockSize)
 }
 
 // SubmissionHandler handles submission GET/POST requests.
+// Submitting needs PermSign. Users without PermReadAll only see their own submissions.
 func SubmissionHandler(db *sql.DB) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
+		s := SessionFrom(req)
 		if req.Method == "POST" {
+			if !Can(s.Role, PermSign) {
+				Deny(db, res, req, s, fmt.Sprintf("%s does not have the %s permission", s.Role, PermSign))
+				return
+			}
 			decoder := json.NewDecoder(req.Body)
 			var submission Submission
 			err := decoder.Decode(&submission)
@@ -178,7 +316,13 @@ func SubmissionHandler(db *sql.DB) http.HandlerFunc {
 			log.Printf("Successfully inserted submission record.")
 			SendResponse(res, true, "")
 		} else if req.Method == "GET" {
-			rows, err := db.Query("SELECT firstname, lastname, email, location, filetype from submissions")
+			query := "SELECT firstname, lastname, email, location, filetype from submissions"
+			var args []interface{}
+			if !Can(s.Role, PermReadAll) {
+				query += " where email = ?"
+				args = append(args, s.Email)
+			}
+			rows, err := db.Query(query, args...)
 			if err != nil {
 				log.Println(err)
 				SendResponse(res, false, err.Error())
@@ -197,6 +341,83 @@ func SubmissionHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// EvidenceHandler: serves files from the evidence store by their hex digest.
+// Users without PermReadAll only get the files of items in the cases they are members of, as DB.CanRead decides.
+// Encrypted blobs are decrypted as they are sent, only after the request is authorized.
+func EvidenceHandler(db *sql.DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		s := SessionFrom(req)
+		name := strings.TrimPrefix(req.URL.Path, "/evidence/")
+		digest, err := hex.DecodeString(name)
+		if err != nil || len(digest) != sha256.Size {
+			http.NotFound(res, req)
+			return
+		}
+		ok, err := canReadEvidence(s, digest)
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+		if !ok {
+			Deny(db, res, req, s, "the user is not a member of the case of the file")
+			return
+		}
+		evidence, err := openEvidence()
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+		blob, err := evidence.Get(digest)
+		if os.IsNotExist(err) {
+			http.NotFound(res, req)
+			return
+		}
+		if err != nil {
+			fivehundred(res, req, err)
+			return
+		}
+		defer blob.Close()
+		// blobs never change, the digest is their version
+		res.Header().Set("ETag", `"`+name+`"`)
+		res.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(res, req, name, time.Time{}, blob)
+	}
+}
+
+// canReadEvidence: true if the user of s may read a case of an item whose contents hash to digest.
+func canReadEvidence(s *Session, digest []byte) (bool, error) {
+	if Can(s.Role, PermReadAll) {
+		return true, nil
+	}
+	if Ledger == nil {
+		return false, fmt.Errorf("the web server has no custody database to check case membership in")
+	}
+	rows, err := Ledger.Query(`select distinct case_id from items where digest = ?`, digest)
+	if err != nil {
+		return false, err
+	}
+	var cases []string
+	for rows.Next() {
+		var caseID string
+		if err = rows.Scan(&caseID); err != nil {
+			rows.Close()
+			return false, err
+		}
+		cases = append(cases, caseID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+	for _, caseID := range cases {
+		ok, err := Ledger.CanRead(s.Email, s.Role, caseID)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
 type User struct {
 	Email, Firstname, Lastname, Directory, UserType, Password string
 	Pubkey, signature                                         []byte
@@ -263,21 +484,7 @@ func SignUpHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
-			stmt, err := db.Prepare("INSERT into users (email, firstname, lastname, usertype, password) VALUES(?, ?, ?, ?, ?)")
-			if err != nil {
-				log.Println(err)
-				SendResponse(w, false, err.Error())
-				return
-			}
-
-			hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-			if err != nil {
-				log.Println(err)
-				SendResponse(w, false, err.Error())
-				return
-			}
-
-			_, err = stmt.Exec(user.Email, user.Firstname, user.Lastname, user.UserType, hash)
+			err = InsertUser(db, &user)
 			if err != nil {
 				log.Println(err)
 				SendResponse(w, false, err.Error())
@@ -288,10 +495,11 @@ func SignUpHandler(db *sql.DB) http.HandlerFunc {
 			if err != nil {
 				log.Println(err)
 				SendResponse(w, false, err.Error())
+				return
 			}
 
 			log.Printf("Successfully inserted user record.")
-			SendResponse(w, false, err.Error())
+			SendResponse(w, true, "")
 		}
 	}
 }
@@ -315,17 +523,29 @@ func InitializeHTTPServer() (*http.Server, error) {
 		return nil, err
 	}
 	// defer db.Close()
+	if err = InitWebDB(db); err != nil {
+		log.Println(err)
+		return nil, err
+	}
 
-	LoadTemplates([]string{"static/index.html", "static/500.html"})
+	LoadTemplates([]string{"static/index.html", "static/login.html", "static/500.html", "static/report.html"})
 
 	m := http.NewServeMux()
 
-	// TODO: Wrap authentication middleware around these handlers.
-	m.Handle("/submission", SubmissionHandler(db))
-	m.Handle("/upload", UploadHandler())
-	m.Handle("/signup", SignUpHandler(db))
-	m.Handle("/index", IndexHandler())
-	m.Handle("/uploads", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads/"))))
+	// public pages
+	m.Handle("/index", IndexHandler(db))
+	m.Handle("/login", LoginHandler(db))
+
+	// everything else requires a session
+	m.Handle("/logout", RequireSession(db, LogoutHandler(db)))
+	// and the permission of the route, see role.go
+	m.Handle("/submission", RequireSession(db, SubmissionHandler(db)))
+	m.Handle("/upload", RequireSession(db, RequirePermission(db, PermSign, UploadHandler(db))))
+	m.Handle("/signup", RequireSession(db, RequirePermission(db, PermManageUsers, SignUpHandler(db))))
+	m.Handle("/uploads", RequireSession(db, RequirePermission(db, PermSign, ResumableHandler(db))))
+	m.Handle("/uploads/", RequireSession(db, RequirePermission(db, PermSign, ResumableHandler(db))))
+	m.Handle("/session", RequireSession(db, SessionHandler()))
+	m.Handle("/evidence/", RequireSession(db, EvidenceHandler(db)))
 
 	server := &http.Server{
 		Addr:    "0.0.0.0:3000",
@@ -0,0 +1,49 @@
+package custody
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestEvidenceAccess(t *testing.T) {
+	Ledger = tempdb(t)
+	defer func() { Ledger = nil }()
+	admin, _ := signer(t, Ledger, "admin")
+	digest := sha256.Sum256([]byte("photo of the scene"))
+	item := models.Item{Tag: "E1", CaseID: "C1", Description: "photo", Digest: digest[:], CreatedAt: XONow(), Identity: admin.ID}
+	FailTest(t, item.Insert(Ledger), "could not add item %s")
+
+	can := func(s *Session) bool {
+		ok, err := canReadEvidence(s, digest[:])
+		FailTest(t, err, "could not check access %s")
+		return ok
+	}
+	member := &Session{Email: "officer", Role: RoleOfficer}
+	if can(member) {
+		t.Fatal("a user who is not a member of the case read its evidence")
+	}
+	_, err := Ledger.AddMember(admin, "C1", "officer")
+	FailTest(t, err, "could not add member %s")
+	if !can(member) {
+		t.Fatal("a member of the case could not read its evidence")
+	}
+	_, err = Ledger.AddMember(admin, "C2", "examiner")
+	FailTest(t, err, "could not add member %s")
+	if can(&Session{Email: "examiner", Role: RoleExaminer}) {
+		t.Fatal("a user who is a member of another case read the evidence")
+	}
+	if !can(&Session{Email: "prosecutor", Role: RoleProsecutor}) {
+		t.Fatal("a role that reads every case could not read the evidence")
+	}
+	_, err = Ledger.RemoveMember("C1", "officer")
+	FailTest(t, err, "could not remove member %s")
+	if can(member) {
+		t.Fatal("a user removed from the case still read its evidence")
+	}
+	other := sha256.Sum256([]byte("not an item"))
+	if ok, _ := canReadEvidence(member, other[:]); ok {
+		t.Fatal("a file that is not an item was readable")
+	}
+}
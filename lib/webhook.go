@@ -0,0 +1,483 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// Outbound webhooks. A webhook subscribes a URL to the events of the ledger, optionally only some event types
+// and only the events of one case. The dispatcher in custody serve queues every new entry's events for each
+// webhook they match and posts them as JSON. Deliveries are at least once: a delivery is retried with backoff
+// until the receiver answers with a 2xx status, and moved to the dead letters after WebhookAttempts attempts.
+// Receivers should use the X-Custody-Delivery header, see DeliveryID, to ignore repeats.
+
+// The event types of the ledger.
+const (
+	// EventSigned: any ledger entry.
+	EventSigned = "signed"
+	// EventRegistered: an evidence item was registered, uploaded or ingested.
+	EventRegistered = "registered"
+	// EventTransferred: an entry about an item signed by someone other than the signer of its previous entry,
+	// the change of custodian shown in custody reports.
+	EventTransferred = "transferred"
+	// EventHeld: a legal hold was placed.
+	EventHeld = "held"
+	// EventReleased: a legal hold was released.
+	EventReleased = "released"
+	// EventDisposed: an item was disposed of.
+	EventDisposed = "disposed"
+	// EventTainted: a fixity audit found that the stored contents of an item no longer match its digest.
+	EventTainted = "tainted"
+	// EventTest: sent by custody webhook test, never queued.
+	EventTest = "test"
+)
+
+// EventTypes: the event types a webhook can subscribe to.
+var EventTypes = []string{EventSigned, EventRegistered, EventTransferred, EventHeld, EventReleased, EventDisposed, EventTainted}
+
+// WebhookWorkers: how many webhooks the dispatcher posts to at once.
+var WebhookWorkers = 8
+
+// WebhookAttempts: how many times a delivery is attempted before it is moved to the dead letters.
+var WebhookAttempts = 10
+
+// WebhookBackoff: the wait after the failed attempt number n, doubling from 30 seconds up to an hour.
+func WebhookBackoff(n int) time.Duration {
+	if n > 7 {
+		return time.Hour
+	}
+	return 30 * time.Second << uint(n-1)
+}
+
+// Event: an event of the ledger, about a case and an item if the entry has them.
+type Event struct {
+	Type   string `json:"type"`
+	CaseID string `json:"case_id"`
+	Item   string `json:"item"`
+}
+
+// PublishedEntry: a ledger entry as posted to webhooks and streamed to watchers.
+type PublishedEntry struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	Signer    string    `json:"signer"`
+	Message   string    `json:"message"`
+	Signature []byte    `json:"signature"`
+	CaseID    string    `json:"case_id"`
+	Item      string    `json:"item"`
+	// Type and Payload are the entry type and JSON payload of a typed entry.
+	Type    string          `json:"type,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// WebhookPayload: the body posted to a webhook.
+type WebhookPayload struct {
+	Event  string         `json:"event"`
+	CaseID string         `json:"case_id"`
+	Item   string         `json:"item"`
+	Entry  PublishedEntry `json:"entry"`
+}
+
+// WebhookMessage: the message an admin signs to add a webhook.
+func WebhookMessage(url string, events []string, caseID string) string {
+	types, cases := "every event", "every case"
+	if len(events) > 0 {
+		types = strings.Join(events, ", ") + " events"
+	}
+	if caseID != "" {
+		cases = "case " + caseID
+	}
+	return fmt.Sprintf("add webhook %s for %s of %s", url, types, cases)
+}
+
+// WebhookEvents: the event types a webhook subscribes to, nil for every type.
+func WebhookEvents(w *models.Webhook) []string {
+	if w.Events == "" {
+		return nil
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Matches: true if the webhook subscribes to the event.
+func (e Event) Matches(w *models.Webhook) bool {
+	if w.CaseID != "" && w.CaseID != e.CaseID {
+		return false
+	}
+	types := WebhookEvents(w)
+	for _, t := range types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return types == nil
+}
+
+// AddWebhook: subscribe w.URL to the events w.Events, all of them if it is empty, of w.CaseID, every case if it is empty.
+// entry must hold the signed WebhookMessage. The webhook gets a random secret that signs its payloads,
+// and receives the events of the entries appended after entry.
+func (db *DB) AddWebhook(identity *models.Identity, w models.Webhook, entry models.Ledger) (*models.Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("a webhook needs an http or https URL, not %q", w.URL)
+	}
+	events := WebhookEvents(&w)
+	for _, t := range events {
+		if !validEvent(t) {
+			return nil, fmt.Errorf("no event type %q, the types are %s", t, strings.Join(EventTypes, ", "))
+		}
+	}
+	if msg := WebhookMessage(w.URL, events, w.CaseID); entry.Message != msg {
+		return nil, fmt.Errorf("the webhook must sign %q", msg)
+	}
+	secret := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, err
+	}
+	entry.CaseID = w.CaseID
+	if entry, err = db.Append(identity, entry); err != nil {
+		return nil, err
+	}
+	w.Secret, w.Ledger, w.Cursor, w.CreatedAt = hex.EncodeToString(secret), entry.ID, entry.ID, XONow()
+	return &w, w.Insert(db)
+}
+
+func validEvent(t string) bool {
+	for _, e := range EventTypes {
+		if t == e {
+			return true
+		}
+	}
+	return false
+}
+
+// rowEvents: the event types of an entry recorded by the rows that refer to it, so that they follow
+// what the entry did rather than what its message says.
+var rowEvents = []struct{ query, event string }{
+	{`select count(*) from items where ledger = ?`, EventRegistered},
+	{`select count(*) from legal_holds where ledger = ?`, EventHeld},
+	{`select count(*) from legal_holds where released = ?`, EventReleased},
+	{`select count(*) from dispositions where ledger = ?`, EventDisposed},
+}
+
+// taintedBlob: a blob that failed in a fixity audit message.
+var taintedBlob = regexp.MustCompile(`blob ([0-9a-f]{64}): `)
+
+// Events: the events of the ledger entry l. Every entry is signed, and may also be one of the other types.
+func (db *DB) Events(l *models.Ledger) ([]Event, error) {
+	events := []Event{{Type: EventSigned, CaseID: l.CaseID, Item: l.Item}}
+	for _, r := range rowEvents {
+		var n int
+		if err := db.QueryRow(r.query, l.ID).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			events = append(events, Event{Type: r.event, CaseID: l.CaseID, Item: l.Item})
+		}
+	}
+	if l.Item != "" {
+		ls, err := models.LedgersByItem(db, l.Item)
+		if err != nil {
+			return nil, err
+		}
+		var prev *models.Ledger
+		for _, p := range ls {
+			if p.ID < l.ID && (prev == nil || p.ID > prev.ID) {
+				prev = p
+			}
+		}
+		if prev != nil && prev.Identity != l.Identity {
+			events = append(events, Event{Type: EventTransferred, CaseID: l.CaseID, Item: l.Item})
+		}
+	}
+	// only the audits recorded by the server have a fixity run
+	var runs int
+	if err := db.QueryRow(`select count(*) from fixity_runs where ledger = ?`, l.ID).Scan(&runs); err != nil || runs == 0 {
+		return events, err
+	}
+	tainted := map[string]bool{}
+	for _, m := range taintedBlob.FindAllStringSubmatch(l.Message, -1) {
+		tainted[m[1]] = true
+	}
+	if len(tainted) == 0 {
+		return events, nil
+	}
+	items, err := models.AllItems(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if tainted[hex.EncodeToString(item.Digest)] {
+			events = append(events, Event{Type: EventTainted, CaseID: item.CaseID, Item: item.Tag})
+		}
+	}
+	return events, nil
+}
+
+// PublishEntry: the entry l signed by signer as it is published.
+func PublishEntry(l *models.Ledger, signer string) PublishedEntry {
+	e := PublishedEntry{ID: l.ID, Time: l.CreatedAt.Time.UTC(), Signer: signer, Message: l.Message, Signature: l.Hash,
+		CaseID: l.CaseID, Item: l.Item}
+	e.Type, e.Payload, _ = ParsePayload(l.Message)
+	return e
+}
+
+// webhookPayload: the payload of event e of the entry l.
+func (db *DB) webhookPayload(e Event, l *models.Ledger) ([]byte, error) {
+	ident, err := models.IdentityByID(db, l.Identity)
+	if err != nil {
+		return nil, err
+	}
+	p := WebhookPayload{Event: e.Type, CaseID: e.CaseID, Item: e.Item, Entry: PublishEntry(l, ident.Name)}
+	return json.Marshal(p)
+}
+
+// QueueWebhook: queue the events of the entries appended since the webhook's cursor that it subscribes to,
+// and advance the cursor. It returns how many deliveries were queued.
+func (db *DB) QueueWebhook(w *models.Webhook) (int, error) {
+	ls, err := models.LedgersAfter(db, w.Cursor)
+	if err != nil || len(ls) == 0 {
+		return 0, err
+	}
+	n := 0
+	for _, l := range ls {
+		events, err := db.Events(l)
+		if err != nil {
+			return n, err
+		}
+		for _, e := range events {
+			if !e.Matches(w) {
+				continue
+			}
+			payload, err := db.webhookPayload(e, l)
+			if err != nil {
+				return n, err
+			}
+			d := models.WebhookDelivery{Webhook: w.ID, Ledger: l.ID, Event: e.Type, Payload: payload, CreatedAt: XONow()}
+			if err = d.Insert(db); err != nil {
+				return n, err
+			}
+			n++
+		}
+		w.Cursor = l.ID
+	}
+	return n, w.Update(db)
+}
+
+// DeliveryID: the X-Custody-Delivery header of event of the entry ledger posted to webhook,
+// the same for every attempt to deliver it.
+func DeliveryID(webhook, ledger int, event string) string {
+	return fmt.Sprintf("%d-%d-%s", webhook, ledger, event)
+}
+
+// WebhookSignature: the value of the X-Custody-Signature header of body posted with secret.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook: true if signature is the X-Custody-Signature of body posted with secret.
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(WebhookSignature(secret, body)), []byte(signature))
+}
+
+// WebhookSender: posts payloads to webhooks. Every payload carries the HMAC of the webhook's secret
+// in X-Custody-Signature and, if Key is set, the server's ECDSA signature in X-Custody-Server-Signature.
+type WebhookSender struct {
+	Client *http.Client
+	Key    *ecdsa.PrivateKey
+}
+
+// Send: post the payload of event of the entry ledger to the webhook, an error unless the receiver answered with a 2xx status.
+func (s *WebhookSender) Send(w *models.Webhook, ledger int, event string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "custody-webhook")
+	req.Header.Set("X-Custody-Event", event)
+	req.Header.Set("X-Custody-Delivery", DeliveryID(w.ID, ledger, event))
+	req.Header.Set("X-Custody-Signature", WebhookSignature(w.Secret, payload))
+	if s.Key != nil {
+		sig, err := cryptopasta.Sign(payload, s.Key)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Custody-Server-Signature", base64.StdEncoding.EncodeToString(sig))
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", w.URL, res.Status)
+	}
+	return nil
+}
+
+// TestWebhook: post a test event to the webhook right away, with the entry that added it.
+func (db *DB) TestWebhook(s *WebhookSender, w *models.Webhook) error {
+	l, err := models.LedgerByID(db, w.Ledger)
+	if err != nil {
+		return err
+	}
+	payload, err := db.webhookPayload(Event{Type: EventTest, CaseID: w.CaseID}, l)
+	if err != nil {
+		return err
+	}
+	return s.Send(w, l.ID, EventTest, payload)
+}
+
+// WebhookStatus: a webhook, without its secret, and the state of its deliveries.
+type WebhookStatus struct {
+	Webhook *models.Webhook
+	Pending int
+	Dead    int
+}
+
+// WebhookStatuses: every webhook and the state of its deliveries.
+func (db *DB) WebhookStatuses() ([]WebhookStatus, error) {
+	ws, err := models.AllWebhooks(db)
+	if err != nil {
+		return nil, err
+	}
+	var ss []WebhookStatus
+	for _, w := range ws {
+		s := WebhookStatus{Webhook: w}
+		w.Secret = ""
+		if s.Pending, err = models.CountWebhookRows(db, "webhook_deliveries", w.ID); err != nil {
+			return nil, err
+		}
+		if s.Dead, err = models.CountWebhookRows(db, "webhook_dead_letters", w.ID); err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// WebhookDispatcher: queues and delivers the events of the ledger in custody serve, every Interval.
+type WebhookDispatcher struct {
+	DB       *DB
+	Sender   *WebhookSender
+	Interval time.Duration
+}
+
+// Start: dispatch now and then every Interval until stop is closed.
+func (d *WebhookDispatcher) Start(stop <-chan struct{}) {
+	go func() {
+		tick := time.NewTicker(d.Interval)
+		defer tick.Stop()
+		for {
+			if err := d.Run(); err != nil {
+				log.Printf("webhook dispatch failed: %s", err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+}
+
+// Run: queue the events of every webhook and attempt every delivery that is due.
+// The deliveries of a webhook are posted in order, and up to WebhookWorkers webhooks are posted to at once
+// so that a slow receiver does not hold up the others.
+func (d *WebhookDispatcher) Run() error {
+	ws, err := models.AllWebhooks(d.DB)
+	if err != nil {
+		return err
+	}
+	hooks := map[int]*models.Webhook{}
+	for _, w := range ws {
+		hooks[w.ID] = w
+		if _, err = d.DB.QueueWebhook(w); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	due, err := models.DueWebhookDeliveries(d.DB, now.Unix())
+	if err != nil {
+		return err
+	}
+	queues := map[int][]*models.WebhookDelivery{}
+	for _, wd := range due {
+		if hooks[wd.Webhook] != nil {
+			queues[wd.Webhook] = append(queues[wd.Webhook], wd)
+		}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[*models.WebhookDelivery]error{}
+	workers := make(chan struct{}, WebhookWorkers)
+	for id, q := range queues {
+		wg.Add(1)
+		go func(w *models.Webhook, q []*models.WebhookDelivery) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			for _, wd := range q {
+				err := d.Sender.Send(w, wd.Ledger, wd.Event, wd.Payload)
+				mu.Lock()
+				results[wd] = err
+				mu.Unlock()
+			}
+		}(hooks[id], q)
+	}
+	wg.Wait()
+	for _, wd := range due {
+		if err, sent := results[wd]; sent {
+			if err = d.settle(wd, err, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// settle: record the outcome sendErr of an attempt at the delivery wd made at now.
+func (d *WebhookDispatcher) settle(wd *models.WebhookDelivery, sendErr error, now time.Time) error {
+	if sendErr == nil {
+		return wd.Delete(d.DB)
+	}
+	wd.Attempts++
+	wd.LastError = sendErr.Error()
+	if wd.Attempts < WebhookAttempts {
+		wd.NextAttempt = now.Add(WebhookBackoff(wd.Attempts)).Unix()
+		return wd.Update(d.DB)
+	}
+	log.Printf("giving up on delivery %d of entry %d to webhook %d: %s", wd.ID, wd.Ledger, wd.Webhook, wd.LastError)
+	dead := models.WebhookDeadLetter{Webhook: wd.Webhook, Ledger: wd.Ledger, Event: wd.Event, Payload: wd.Payload,
+		Attempts: wd.Attempts, LastError: wd.LastError, CreatedAt: XONow()}
+	if err := dead.Insert(d.DB); err != nil {
+		return err
+	}
+	return wd.Delete(d.DB)
+}
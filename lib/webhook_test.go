@@ -0,0 +1,130 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestWebhooks(t *testing.T) {
+	cdb := tempdb(t)
+	alice, akey := signer(t, cdb, "alice")
+	bob, bkey := signer(t, cdb, "bob")
+
+	var mu sync.Mutex
+	var got []WebhookPayload
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !VerifyWebhook(secret, body, r.Header.Get("X-Custody-Signature")) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var p WebhookPayload
+		FailTest(t, json.Unmarshal(body, &p), "bad payload %s")
+		mu.Lock()
+		got = append(got, p)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	events := []string{EventRegistered, EventTransferred}
+	w := models.Webhook{URL: receiver.URL, Events: EventRegistered + "," + EventTransferred, CaseID: "C1"}
+	hook, err := cdb.AddWebhook(alice, w, entry(t, akey, WebhookMessage(receiver.URL, events, "C1"), "C1", ""))
+	FailTest(t, err, "could not add webhook %s")
+	secret = hook.Secret
+	w = models.Webhook{URL: broken.URL}
+	dead, err := cdb.AddWebhook(alice, w, entry(t, akey, WebhookMessage(broken.URL, nil, ""), "", ""))
+	FailTest(t, err, "could not add webhook %s")
+	if _, err = cdb.AddWebhook(alice, models.Webhook{URL: receiver.URL, Events: "signed,stolen"}, entry(t, akey, "x", "", "")); err == nil {
+		t.Fatal("added a webhook for an unknown event type")
+	}
+
+	laptop := models.Item{Tag: "E-1", CaseID: "C1", Description: "laptop"}
+	_, err = cdb.NewItem(alice, laptop, entry(t, akey, ItemMessage("E-1", "laptop"), "C1", "E-1"), nil)
+	FailTest(t, err, "could not register item %s")
+	recordEntry(t, cdb, alice, akey, models.Ledger{Message: "bagged", CaseID: "C1", Item: "E-1"})
+	handoff := recordEntry(t, cdb, bob, bkey, models.Ledger{Message: "received", CaseID: "C1", Item: "E-1"})
+	phone := models.Item{Tag: "E-2", CaseID: "C2", Description: "phone"}
+	_, err = cdb.NewItem(bob, phone, entry(t, bkey, ItemMessage("E-2", "phone"), "C2", "E-2"), nil)
+	FailTest(t, err, "could not register item %s")
+
+	WebhookAttempts = 2
+	defer func() { WebhookAttempts = 10 }()
+	d := &WebhookDispatcher{DB: cdb, Sender: &WebhookSender{}}
+	FailTest(t, d.Run(), "dispatch failed %s")
+	if len(got) != 2 || got[0].Event != EventRegistered || got[1].Event != EventTransferred || got[1].Entry.ID != handoff.ID || got[1].Entry.Signer != "bob" {
+		t.Fatalf("wrong events delivered %+v", got)
+	}
+
+	// the broken receiver gets every event after it was added, each retried once and then dead lettered
+	ss, err := cdb.WebhookStatuses()
+	FailTest(t, err, "%s")
+	if ss[0].Pending != 0 || ss[1].Pending != 7 || ss[1].Dead != 0 || ss[1].Webhook.Secret != "" {
+		t.Fatalf("wrong delivery state after the first attempt %+v", ss[1])
+	}
+	_, err = cdb.Exec("UPDATE webhook_deliveries SET next_attempt = 0")
+	FailTest(t, err, "%s")
+	FailTest(t, d.Run(), "dispatch failed %s")
+	ss, err = cdb.WebhookStatuses()
+	FailTest(t, err, "%s")
+	if ss[1].Pending != 0 || ss[1].Dead != 7 || len(got) != 2 {
+		t.Fatalf("wrong delivery state after the last attempt %+v, delivered %+v", ss[1], got)
+	}
+
+	FailTest(t, cdb.TestWebhook(&WebhookSender{}, hook), "test event failed %s")
+	if got[2].Event != EventTest || got[2].Entry.ID != hook.Ledger {
+		t.Fatalf("wrong test event %+v", got[2])
+	}
+	if cdb.TestWebhook(&WebhookSender{}, dead) == nil {
+		t.Fatal("a test event to a broken receiver succeeded")
+	}
+
+	// a fixity audit that finds the contents of an item changed taints it, but only the server records audits
+	digest := sha256.Sum256([]byte("disk image"))
+	item := models.Item{Tag: "E-3", CaseID: "C1", Description: "disk", Digest: digest[:]}
+	_, err = cdb.UploadItem(alice, item, entry(t, akey, UploadMessage(item.Tag, item.Description, item.Digest), item.CaseID, item.Tag), nil)
+	FailTest(t, err, "failed to register upload %s")
+	msg := fmt.Sprintf("fixity audit: 1 of 1 blobs rehashed: 1 problems: blob %x: changed", digest)
+	server, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "%s")
+	system, err := cdb.SystemIdentity(server)
+	FailTest(t, err, "%s")
+	for _, c := range []struct {
+		i       *models.Identity
+		key     *ecdsa.PrivateKey
+		tainted bool
+	}{{system, server, true}, {alice, akey, false}} {
+		l := record(t, cdb, c.i, c.key, "", msg)
+		if c.i == system {
+			run := models.FixityRun{Ledger: l.ID, CreatedAt: l.CreatedAt, Failures: 1}
+			FailTest(t, run.Insert(cdb), "%s")
+		}
+		es, err := cdb.Events(&l)
+		FailTest(t, err, "%s")
+		if tainted := len(es) == 2 && es[1] == (Event{Type: EventTainted, CaseID: "C1", Item: "E-3"}); tainted != c.tainted {
+			t.Fatalf("events of an audit by %s: %+v", c.i.Name, es)
+		}
+	}
+
+	// events follow what an entry did, not what its message says
+	spoof := recordEntry(t, cdb, alice, akey, models.Ledger{Message: "dispose of item E-3: shredded", CaseID: "C1", Item: "E-3"})
+	es, err := cdb.Events(&spoof)
+	FailTest(t, err, "%s")
+	if len(es) != 1 || es[0].Type != EventSigned {
+		t.Fatalf("events of an entry that only claims a disposal: %+v", es)
+	}
+}
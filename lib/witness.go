@@ -0,0 +1,264 @@
+package custody
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/crypto"
+	"github.gatech.edu/NIJ-Grant/custody/crypto/merkle"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+// ConsistencyProof: the latest signed checkpoint of a server with the proof that it extends
+// the ledger of an earlier size, and the witness cosignatures it has collected so far.
+type ConsistencyProof struct {
+	Checkpoint   *models.Checkpoint
+	Cosignatures []*models.Cosignature
+	ServerKey    []byte
+	Size         int
+	Proof        [][]byte
+}
+
+// ConsistencyProof: checkpoint the ledger and prove that it extends the ledger of the first size entries.
+// A checkpoint signed less than interval ago is proven instead of signing a new one.
+func (db *DB) ConsistencyProof(key *ecdsa.PrivateKey, size int, interval time.Duration) (*ConsistencyProof, error) {
+	if key == nil {
+		return nil, fmt.Errorf("the server has no signing key")
+	}
+	ls, err := models.AllLedgers(db)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := db.recentCheckpoint(key, ls, interval)
+	if err != nil {
+		return nil, err
+	}
+	if size > cp.Size {
+		return nil, fmt.Errorf("size %d is beyond the latest checkpoint of size %d", size, cp.Size)
+	}
+	p := &ConsistencyProof{Checkpoint: cp, Size: size}
+	if p.ServerKey, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return nil, err
+	}
+	if p.Proof, err = merkle.ConsistencyProof(Leaves(ls[:cp.Size]), size); err != nil {
+		return nil, err
+	}
+	p.Cosignatures, err = models.CosignaturesByCheckpoint(db, cp.ID)
+	return p, err
+}
+
+// Witnessed: the latest checkpoint that witnesses have cosigned, their cosignatures, and the proof that a later
+// checkpoint extends it. Checkpoints are signed on demand, so the newest one usually has no cosignatures yet,
+// and the entries it covers are witnessed up to the size of this one.
+type Witnessed struct {
+	Checkpoint   *models.Checkpoint
+	Cosignatures []*models.Cosignature
+	Proof        [][]byte
+}
+
+// witnessed: the latest cosigned checkpoint and the proof that the checkpoint of the tree with leaves extends it,
+// nil if no witness has cosigned a checkpoint yet.
+func (db *DB) witnessed(leaves [][]byte) (*Witnessed, error) {
+	cp, err := models.LatestCosignedCheckpoint(db)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := &Witnessed{Checkpoint: cp}
+	if w.Proof, err = merkle.ConsistencyProof(leaves, cp.Size); err != nil {
+		return nil, err
+	}
+	w.Cosignatures, err = models.CosignaturesByCheckpoint(db, cp.ID)
+	return w, err
+}
+
+// Verify: check the server signature on the witnessed checkpoint and that cp extends it.
+func (w *Witnessed) Verify(cp *models.Checkpoint, server *ecdsa.PublicKey) error {
+	if w.Checkpoint == nil || !VerifyCheckpoint(w.Checkpoint, server) {
+		return fmt.Errorf("the signature of the witnessed checkpoint is invalid")
+	}
+	if !merkle.VerifyConsistency(w.Checkpoint.Size, cp.Size, w.Checkpoint.Root, cp.Root, w.Proof) {
+		return fmt.Errorf("the checkpoint of size %d does not extend the witnessed checkpoint of size %d", cp.Size, w.Checkpoint.Size)
+	}
+	return nil
+}
+
+// Cosigned: the checkpoint to check witness cosignatures on, cp if cosigs has any, else the witnessed checkpoint
+// of w if there is one, and the cosignatures of that checkpoint.
+func Cosigned(cp *models.Checkpoint, cosigs []*models.Cosignature, w *Witnessed) (*models.Checkpoint, []*models.Cosignature) {
+	if len(cosigs) == 0 && w != nil {
+		return w.Checkpoint, w.Cosignatures
+	}
+	return cp, cosigs
+}
+
+// CosignStatement: the bytes a witness signs to cosign a checkpoint.
+// It differs from the server statement so that a witness signature can never pass as a server signature.
+func CosignStatement(cp *models.Checkpoint) []byte {
+	return append([]byte("custody cosignature v1\n"), CheckpointStatement(cp)...)
+}
+
+// VerifyCosignature: check the signature of a witness on a checkpoint.
+func VerifyCosignature(cp *models.Checkpoint, cs *models.Cosignature) error {
+	if cs.Checkpoint != cp.ID {
+		return fmt.Errorf("cosignature is for checkpoint %d, not checkpoint %d", cs.Checkpoint, cp.ID)
+	}
+	witness, err := crypto.ParseECDSAPublicKey(cs.Witness)
+	if err != nil {
+		return fmt.Errorf("could not parse witness key: %s", err)
+	}
+	if !crypto.Verify(CosignStatement(cp), cs.Signature, witness) {
+		return fmt.Errorf("cosignature by witness %s is invalid", crypto.Fingerprint(cs.Witness))
+	}
+	return nil
+}
+
+// AddCosignature: store the cosignature of a witness after checking it, each witness cosigns a checkpoint once.
+func (db *DB) AddCosignature(cs *models.Cosignature) error {
+	cp, err := models.CheckpointByID(db, cs.Checkpoint)
+	if err != nil {
+		return fmt.Errorf("no checkpoint %d: %s", cs.Checkpoint, err)
+	}
+	if err = VerifyCosignature(cp, cs); err != nil {
+		return err
+	}
+	existing, err := models.CosignaturesByCheckpoint(db, cp.ID)
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		if bytes.Equal(e.Witness, cs.Witness) {
+			return fmt.Errorf("witness %s has already cosigned checkpoint %d", crypto.Fingerprint(cs.Witness), cp.ID)
+		}
+	}
+	cs.CreatedAt = XONow()
+	return cs.Insert(db)
+}
+
+// KnownWitness: true if pub is the PKIX encoding of one of the keys of witnesses.
+func KnownWitness(pub []byte, witnesses []*ecdsa.PublicKey) bool {
+	for _, w := range witnesses {
+		known, err := x509.MarshalPKIXPublicKey(w)
+		if err == nil && bytes.Equal(known, pub) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCosignatures: count the trusted witnesses that validly cosigned cp.
+// It fails if fewer than n of them did. Cosignatures by keys not in witnesses are ignored.
+func VerifyCosignatures(cp *models.Checkpoint, cosigs []*models.Cosignature, witnesses []*ecdsa.PublicKey, n int) (int, error) {
+	trusted := map[string]bool{}
+	for _, w := range witnesses {
+		pub, err := x509.MarshalPKIXPublicKey(w)
+		if err != nil {
+			return 0, err
+		}
+		trusted[string(pub)] = true
+	}
+	count := 0
+	for _, cs := range cosigs {
+		if !trusted[string(cs.Witness)] || VerifyCosignature(cp, cs) != nil {
+			continue
+		}
+		// count each witness once
+		delete(trusted, string(cs.Witness))
+		count++
+	}
+	if count < n {
+		return count, fmt.Errorf("checkpoint of size %d has %d of the %d required witness cosignatures", cp.Size, count, n)
+	}
+	return count, nil
+}
+
+// WitnessState: what a witness remembers about the server it follows.
+// Size and Root describe the last checkpoint it cosigned, ServerKey is pinned on first contact.
+type WitnessState struct {
+	ServerKey []byte `json:"server_key"`
+	Size      int    `json:"size"`
+	Root      []byte `json:"root"`
+}
+
+// LoadWitnessState: read the witness state from path, a missing file is a witness that has seen nothing yet.
+func LoadWitnessState(path string) (*WitnessState, error) {
+	s := &WitnessState{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, s)
+	return s, err
+}
+
+// Save: write the witness state to path.
+func (s *WitnessState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Witness: an independent server that cosigns the checkpoints of a custody server
+// only if they extend the ledger it saw last, so that history cannot be rewritten unnoticed.
+type Witness struct {
+	Key   *ecdsa.PrivateKey
+	State *WitnessState
+}
+
+// Observe: check a consistency proof from the server against the witness state.
+// If the ledger only grew the state advances and the checkpoint is cosigned.
+// The returned cosignature is nil if the witness has already cosigned this checkpoint.
+func (w *Witness) Observe(p *ConsistencyProof) (*models.Cosignature, error) {
+	s := w.State
+	if s.ServerKey != nil && !bytes.Equal(s.ServerKey, p.ServerKey) {
+		return nil, fmt.Errorf("server key changed from %s to %s", crypto.Fingerprint(s.ServerKey), crypto.Fingerprint(p.ServerKey))
+	}
+	server, err := crypto.ParseECDSAPublicKey(p.ServerKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse server key: %s", err)
+	}
+	cp := p.Checkpoint
+	if cp == nil || !VerifyCheckpoint(cp, server) {
+		return nil, fmt.Errorf("checkpoint signature is invalid")
+	}
+	if p.Size != s.Size {
+		return nil, fmt.Errorf("proof starts at size %d, the witness is at size %d", p.Size, s.Size)
+	}
+	if cp.Size < s.Size {
+		return nil, fmt.Errorf("ledger shrank from %d to %d entries", s.Size, cp.Size)
+	}
+	if s.Size > 0 && !merkle.VerifyConsistency(s.Size, cp.Size, s.Root, cp.Root, p.Proof) {
+		return nil, fmt.Errorf("ledger of size %d does not extend the ledger of size %d, history was rewritten", cp.Size, s.Size)
+	}
+	s.ServerKey, s.Size, s.Root = p.ServerKey, cp.Size, cp.Root
+
+	pub, err := x509.MarshalPKIXPublicKey(w.Key.Public())
+	if err != nil {
+		return nil, err
+	}
+	for _, cs := range p.Cosignatures {
+		if bytes.Equal(cs.Witness, pub) {
+			return nil, nil
+		}
+	}
+	sig, err := cryptopasta.Sign(CosignStatement(cp), w.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Cosignature{Checkpoint: cp.ID, Witness: pub, Signature: sig}, nil
+}
@@ -0,0 +1,161 @@
+package custody
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/gtank/cryptopasta"
+	"github.gatech.edu/NIJ-Grant/custody/models"
+)
+
+func TestWitness(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	wkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	w := &Witness{Key: wkey, State: &WitnessState{}}
+	alice, akey := signer(t, cdb, "alice")
+	first := record(t, cdb, alice, akey, "C1", "seize laptop")
+	record(t, cdb, alice, akey, "C1", "image laptop")
+
+	observe := func() (*ConsistencyProof, *models.Cosignature, error) {
+		p, err := cdb.ConsistencyProof(serverkey, w.State.Size, 0)
+		FailTest(t, err, "could not get consistency proof %s")
+		cs, err := w.Observe(p)
+		return p, cs, err
+	}
+	p, cs, err := observe()
+	FailTest(t, err, "witness refused an append-only ledger %s")
+	FailTest(t, cdb.AddCosignature(cs), "could not store cosignature %s")
+	if cdb.AddCosignature(cs) == nil {
+		t.Fatal("stored a second cosignature by the same witness")
+	}
+	cosigs, err := models.CosignaturesByCheckpoint(cdb, p.Checkpoint.ID)
+	FailTest(t, err, "could not load cosignatures %s")
+	_, err = VerifyCosignatures(p.Checkpoint, cosigs, []*ecdsa.PublicKey{&wkey.PublicKey}, 1)
+	FailTest(t, err, "cosignature did not verify %s")
+	if _, err = VerifyCosignatures(p.Checkpoint, cosigs, []*ecdsa.PublicKey{&serverkey.PublicKey}, 1); err == nil {
+		t.Fatal("cosignature counted for an untrusted witness")
+	}
+	if _, err = VerifyCosignatures(p.Checkpoint, append(cosigs, cosigs...), []*ecdsa.PublicKey{&wkey.PublicKey}, 2); err == nil {
+		t.Fatal("one witness counted twice")
+	}
+	if _, cs, _ = observe(); cs != nil {
+		t.Fatal("witness cosigned the same checkpoint twice")
+	}
+
+	record(t, cdb, alice, akey, "C1", "return laptop")
+	_, cs, err = observe()
+	FailTest(t, err, "witness refused a grown ledger %s")
+	if cs == nil || w.State.Size != 3 {
+		t.Fatalf("witness did not advance to size 3, at %d", w.State.Size)
+	}
+
+	// rewrite the first entry, the next checkpoint no longer extends the cosigned one
+	entry, err := models.LedgerByID(cdb, first.ID)
+	FailTest(t, err, "could not load entry %s")
+	entry.Message = "seize desktop"
+	FailTest(t, entry.Update(cdb), "could not alter entry %s")
+	record(t, cdb, alice, akey, "C1", "destroy laptop")
+	if _, _, err = observe(); err == nil {
+		t.Fatal("witness cosigned a rewritten ledger")
+	}
+	if w.State.Size != 3 {
+		t.Fatalf("witness state advanced past a rewrite to %d", w.State.Size)
+	}
+}
+
+func TestWitnessedBundle(t *testing.T) {
+	cdb := tempdb(t)
+	serverkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	wkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	w := &Witness{Key: wkey, State: &WitnessState{}}
+	alice, akey := signer(t, cdb, "alice")
+	record(t, cdb, alice, akey, "C1", "seize laptop")
+	record(t, cdb, alice, akey, "C1", "image laptop")
+	p, err := cdb.ConsistencyProof(serverkey, 0, 0)
+	FailTest(t, err, "%s")
+	cs, err := w.Observe(p)
+	FailTest(t, err, "%s")
+	FailTest(t, cdb.AddCosignature(cs), "could not store cosignature %s")
+	l := record(t, cdb, alice, akey, "C1", "return laptop")
+
+	// the bundle checkpoint is new, the witnesses vouch for the first two entries through the cosigned one
+	b, err := cdb.Export(serverkey, "C1")
+	FailTest(t, err, "export failed %s")
+	if len(b.Cosigs) != 0 || b.Witnessed == nil || b.Witnessed.Checkpoint.Size != 2 || len(b.Witnessed.Cosignatures) != 1 {
+		t.Fatalf("the bundle does not carry the cosigned checkpoint %+v", b.Witnessed)
+	}
+	r := b.Verify(&serverkey.PublicKey, nil)
+	if !r.OK() || r.Entries != 3 || r.Witnessed != 2 {
+		t.Fatalf("bundle did not verify: %+v", r)
+	}
+	cp, cosigs := Cosigned(b.Checkpoint, b.Cosigs, b.Witnessed)
+	_, err = VerifyCosignatures(cp, cosigs, []*ecdsa.PublicKey{&wkey.PublicKey}, 1)
+	FailTest(t, err, "%s")
+	b.Witnessed.Proof = nil
+	if b.Verify(&serverkey.PublicKey, nil).OK() {
+		t.Fatal("a witnessed checkpoint without a consistency proof verified")
+	}
+
+	rp, err := cdb.ReceiptProof(serverkey, l.ID, 3)
+	FailTest(t, err, "%s")
+	rc, err := cdb.Receipt(serverkey, l.ID)
+	FailTest(t, err, "%s")
+	FailTest(t, rc.Check(rp), "receipt did not check %s")
+	if rp.Witnessed == nil || rp.Witnessed.Checkpoint.Size != 2 {
+		t.Fatalf("the receipt proof does not carry the cosigned checkpoint %+v", rp.Witnessed)
+	}
+}
+
+func TestClerkWitness(t *testing.T) {
+	ck := NewClerk()
+	ck.DB = *tempdb(t)
+	var err error
+	ck.Key, err = cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	wkey, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	stranger, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "failed to generate key %s")
+	ck.Witnesses = []*ecdsa.PublicKey{&wkey.PublicKey}
+	alice, akey := signer(t, &ck.DB, "alice")
+	record(t, &ck.DB, alice, akey, "C1", "seize laptop")
+
+	var p ConsistencyProof
+	FailTest(t, ck.Consistency(&RecordRequest{}, &p), "%s")
+	// a grown ledger does not get a new checkpoint until the interval has passed
+	record(t, &ck.DB, alice, akey, "C1", "image laptop")
+	var again ConsistencyProof
+	FailTest(t, ck.Consistency(&RecordRequest{}, &again), "%s")
+	if again.Checkpoint.ID != p.Checkpoint.ID {
+		t.Fatalf("checkpoint %d signed right after checkpoint %d", again.Checkpoint.ID, p.Checkpoint.ID)
+	}
+	cps, err := models.AllCheckpoints(&ck.DB)
+	FailTest(t, err, "%s")
+	if len(cps) != 1 {
+		t.Fatalf("%d checkpoints signed within the interval", len(cps))
+	}
+	ck.CheckpointInterval = 0
+	FailTest(t, ck.Consistency(&RecordRequest{Size: 1}, &again), "%s")
+	if again.Checkpoint.Size != 2 {
+		t.Fatalf("no new checkpoint once the interval passed, size %d", again.Checkpoint.Size)
+	}
+
+	for _, key := range []*ecdsa.PrivateKey{stranger, wkey} {
+		cs, err := (&Witness{Key: key, State: &WitnessState{}}).Observe(&p)
+		FailTest(t, err, "%s")
+		err = ck.Cosign(&RecordRequest{Checkpoint: cs.Checkpoint, PublicKey: cs.Witness, Hash: cs.Signature}, &models.Cosignature{})
+		if (err == nil) != (key == wkey) {
+			t.Fatalf("cosignature of a witness known %v got %v", key == wkey, err)
+		}
+	}
+	cosigs, err := models.CosignaturesByCheckpoint(&ck.DB, p.Checkpoint.ID)
+	FailTest(t, err, "%s")
+	if len(cosigs) != 1 {
+		t.Fatalf("stored %d cosignatures, only one witness is known", len(cosigs))
+	}
+}
@@ -16,6 +16,9 @@ type Ledger struct {
 	Identity  int           `json:"identity"`   // identity
 	Message   string        `json:"message"`    // message
 	Hash      []byte        `json:"hash"`       // hash
+	CaseID    string        `json:"case_id"`    // case_id
+	Item      string        `json:"item"`       // item
+	Imported  string        `json:"imported"`   // imported
 
 	// xo fields
 	_exists, _deleted bool
@@ -42,14 +45,14 @@ func (l *Ledger) Insert(db XODB) error {
 
 	// sql insert query, primary key provided by autoincrement
 	const sqlstr = `INSERT INTO ledger (` +
-		`created_at, identity, message, hash` +
+		`created_at, identity, message, hash, case_id, item, imported` +
 		`) VALUES (` +
-		`?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?` +
 		`)`
 
 	// run query
-	XOLog(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash)
-	res, err := db.Exec(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash)
+	XOLog(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash, l.CaseID, l.Item, l.Imported)
+	res, err := db.Exec(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash, l.CaseID, l.Item, l.Imported)
 	if err != nil {
 		return err
 	}
@@ -83,12 +86,12 @@ func (l *Ledger) Update(db XODB) error {
 
 	// sql query
 	const sqlstr = `UPDATE ledger SET ` +
-		`created_at = ?, identity = ?, message = ?, hash = ?` +
+		`created_at = ?, identity = ?, message = ?, hash = ?, case_id = ?, item = ?, imported = ?` +
 		` WHERE id = ?`
 
 	// run query
-	XOLog(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash, l.ID)
-	_, err = db.Exec(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash, l.ID)
+	XOLog(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash, l.CaseID, l.Item, l.Imported, l.ID)
+	_, err = db.Exec(sqlstr, l.CreatedAt, l.Identity, l.Message, l.Hash, l.CaseID, l.Item, l.Imported, l.ID)
 	return err
 }
 
@@ -138,6 +141,45 @@ func (l *Ledger) IdentityByIdentity(db XODB) (*Identity, error) {
 	return IdentityByID(db, l.Identity)
 }
 
+// LedgersByCaseID retrieves a row from 'ledger' as a Ledger.
+//
+// Generated from index 'ledger_caseid_idx'.
+func LedgersByCaseID(db XODB, caseID string) ([]*Ledger, error) {
+	var err error
+
+	// sql query
+	const sqlstr = `SELECT ` +
+		`id, created_at, identity, message, hash, case_id, item, imported ` +
+		`FROM ledger ` +
+		`WHERE case_id = ?`
+
+	// run query
+	XOLog(sqlstr, caseID)
+	q, err := db.Query(sqlstr, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	// load results
+	res := []*Ledger{}
+	for q.Next() {
+		l := Ledger{
+			_exists: true,
+		}
+
+		// scan
+		err = q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash, &l.CaseID, &l.Item, &l.Imported)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, &l)
+	}
+
+	return res, nil
+}
+
 // LedgersByCreatedAt retrieves a row from 'ledger' as a Ledger.
 //
 // Generated from index 'ledger_createdat_idx'.
@@ -146,7 +188,7 @@ func LedgersByCreatedAt(db XODB, createdAt xoutil.SqTime) ([]*Ledger, error) {
 
 	// sql query
 	const sqlstr = `SELECT ` +
-		`id, created_at, identity, message, hash ` +
+		`id, created_at, identity, message, hash, case_id, item, imported ` +
 		`FROM ledger ` +
 		`WHERE created_at = ?`
 
@@ -166,7 +208,7 @@ func LedgersByCreatedAt(db XODB, createdAt xoutil.SqTime) ([]*Ledger, error) {
 		}
 
 		// scan
-		err = q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash)
+		err = q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash, &l.CaseID, &l.Item, &l.Imported)
 		if err != nil {
 			return nil, err
 		}
@@ -185,7 +227,7 @@ func LedgerByID(db XODB, id int) (*Ledger, error) {
 
 	// sql query
 	const sqlstr = `SELECT ` +
-		`id, created_at, identity, message, hash ` +
+		`id, created_at, identity, message, hash, case_id, item, imported ` +
 		`FROM ledger ` +
 		`WHERE id = ?`
 
@@ -195,7 +237,7 @@ func LedgerByID(db XODB, id int) (*Ledger, error) {
 		_exists: true,
 	}
 
-	err = db.QueryRow(sqlstr, id).Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash)
+	err = db.QueryRow(sqlstr, id).Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash, &l.CaseID, &l.Item, &l.Imported)
 	if err != nil {
 		return nil, err
 	}
@@ -211,7 +253,7 @@ func LedgersByIdentity(db XODB, identity int) ([]*Ledger, error) {
 
 	// sql query
 	const sqlstr = `SELECT ` +
-		`id, created_at, identity, message, hash ` +
+		`id, created_at, identity, message, hash, case_id, item, imported ` +
 		`FROM ledger ` +
 		`WHERE identity = ?`
 
@@ -231,7 +273,46 @@ func LedgersByIdentity(db XODB, identity int) ([]*Ledger, error) {
 		}
 
 		// scan
-		err = q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash)
+		err = q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash, &l.CaseID, &l.Item, &l.Imported)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, &l)
+	}
+
+	return res, nil
+}
+
+// LedgersByItem retrieves a row from 'ledger' as a Ledger.
+//
+// Generated from index 'ledger_item_idx'.
+func LedgersByItem(db XODB, item string) ([]*Ledger, error) {
+	var err error
+
+	// sql query
+	const sqlstr = `SELECT ` +
+		`id, created_at, identity, message, hash, case_id, item, imported ` +
+		`FROM ledger ` +
+		`WHERE item = ?`
+
+	// run query
+	XOLog(sqlstr, item)
+	q, err := db.Query(sqlstr, item)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	// load results
+	res := []*Ledger{}
+	for q.Next() {
+		l := Ledger{
+			_exists: true,
+		}
+
+		// scan
+		err = q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash, &l.CaseID, &l.Item, &l.Imported)
 		if err != nil {
 			return nil, err
 		}
@@ -2,7 +2,9 @@ package models
 
 import (
 	"crypto/ecdsa"
+	"database/sql"
 	"fmt"
+	"sort"
 
 	"github.gatech.edu/NIJ-Grant/custody/crypto"
 )
@@ -26,3 +28,463 @@ func LedgersByName(db XODB, name string) (ls []*Ledger, err error) {
 	ls, err = LedgersByIdentity(db, id.ID)
 	return
 }
+
+// ledgerColumns: the columns of the ledger table in the order scanned by scanLedgers.
+const ledgerColumns = `id, created_at, identity, message, hash, case_id, item, imported `
+
+// scanLedgers: load the rows of a query selecting ledgerColumns.
+func scanLedgers(q *sql.Rows) ([]*Ledger, error) {
+	defer q.Close()
+	res := []*Ledger{}
+	for q.Next() {
+		l := Ledger{_exists: true}
+		err := q.Scan(&l.ID, &l.CreatedAt, &l.Identity, &l.Message, &l.Hash, &l.CaseID, &l.Item, &l.Imported)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &l)
+	}
+	return res, q.Err()
+}
+
+// AllLedgers: list every ledger entry in insertion order.
+// This order defines the leaf positions of the ledger Merkle tree.
+func AllLedgers(db XODB) ([]*Ledger, error) {
+	const sqlstr = `SELECT ` + ledgerColumns +
+		`FROM ledger ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	return scanLedgers(q)
+}
+
+// LatestCheckpoint: return the most recently signed checkpoint.
+func LatestCheckpoint(db XODB) (*Checkpoint, error) {
+	const sqlstr = `SELECT ` +
+		`id, created_at, size, root, signature ` +
+		`FROM checkpoints ` +
+		`ORDER BY id DESC LIMIT 1`
+
+	XOLog(sqlstr)
+	c := Checkpoint{_exists: true}
+	err := db.QueryRow(sqlstr).Scan(&c.ID, &c.CreatedAt, &c.Size, &c.Root, &c.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// LatestCosignedCheckpoint: return the most recently signed checkpoint that a witness has cosigned.
+func LatestCosignedCheckpoint(db XODB) (*Checkpoint, error) {
+	const sqlstr = `SELECT ` +
+		`id, created_at, size, root, signature ` +
+		`FROM checkpoints ` +
+		`WHERE id IN (SELECT checkpoint FROM cosignatures) ` +
+		`ORDER BY id DESC LIMIT 1`
+
+	XOLog(sqlstr)
+	c := Checkpoint{_exists: true}
+	err := db.QueryRow(sqlstr).Scan(&c.ID, &c.CreatedAt, &c.Size, &c.Root, &c.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UnstampedLedgers: list the ledger entries that have no timestamp token yet, in insertion order.
+func UnstampedLedgers(db XODB) ([]*Ledger, error) {
+	const sqlstr = `SELECT ` + ledgerColumns +
+		`FROM ledger ` +
+		`WHERE id NOT IN (SELECT ledger FROM timestamps) ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	return scanLedgers(q)
+}
+
+// AllCheckpoints: list every checkpoint in the order they were signed.
+func AllCheckpoints(db XODB) ([]*Checkpoint, error) {
+	const sqlstr = `SELECT ` +
+		`id, created_at, size, root, signature ` +
+		`FROM checkpoints ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Checkpoint{}
+	for q.Next() {
+		c := Checkpoint{_exists: true}
+		if err = q.Scan(&c.ID, &c.CreatedAt, &c.Size, &c.Root, &c.Signature); err != nil {
+			return nil, err
+		}
+		res = append(res, &c)
+	}
+	return res, q.Err()
+}
+
+// AllTimestamps: list every timestamp token.
+func AllTimestamps(db XODB) ([]*Timestamp, error) {
+	const sqlstr = `SELECT ` +
+		`id, ledger, created_at, token, gen_time, authority ` +
+		`FROM timestamps ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Timestamp{}
+	for q.Next() {
+		t := Timestamp{_exists: true}
+		if err = q.Scan(&t.ID, &t.Ledger, &t.CreatedAt, &t.Token, &t.GenTime, &t.Authority); err != nil {
+			return nil, err
+		}
+		res = append(res, &t)
+	}
+	return res, q.Err()
+}
+
+// AllCosignatures: list every witness cosignature.
+func AllCosignatures(db XODB) ([]*Cosignature, error) {
+	const sqlstr = `SELECT ` +
+		`id, checkpoint, created_at, witness, signature ` +
+		`FROM cosignatures ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Cosignature{}
+	for q.Next() {
+		c := Cosignature{_exists: true}
+		if err = q.Scan(&c.ID, &c.Checkpoint, &c.CreatedAt, &c.Witness, &c.Signature); err != nil {
+			return nil, err
+		}
+		res = append(res, &c)
+	}
+	return res, q.Err()
+}
+
+// AllIdentities: list every identity.
+func AllIdentities(db XODB) ([]*Identity, error) {
+	const sqlstr = `SELECT ` +
+		`id, name, created_at, public_key ` +
+		`FROM identities ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Identity{}
+	for q.Next() {
+		i := Identity{_exists: true}
+		if err = q.Scan(&i.ID, &i.Name, &i.CreatedAt, &i.PublicKey); err != nil {
+			return nil, err
+		}
+		res = append(res, &i)
+	}
+	return res, q.Err()
+}
+
+// AllDenials: list every denied request.
+func AllDenials(db XODB) ([]*Denial, error) {
+	const sqlstr = `SELECT ` +
+		`id, created_at, name, action, target, reason ` +
+		`FROM denials ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Denial{}
+	for q.Next() {
+		d := Denial{_exists: true}
+		if err = q.Scan(&d.ID, &d.CreatedAt, &d.Name, &d.Action, &d.Target, &d.Reason); err != nil {
+			return nil, err
+		}
+		res = append(res, &d)
+	}
+	return res, q.Err()
+}
+
+// AllItems: list every evidence item.
+func AllItems(db XODB) ([]*Item, error) {
+	const sqlstr = `SELECT ` +
+		`id, tag, case_id, description, digest, created_at, identity ` +
+		`FROM items ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Item{}
+	for q.Next() {
+		i := Item{_exists: true}
+		if err = q.Scan(&i.ID, &i.Tag, &i.CaseID, &i.Description, &i.Digest, &i.CreatedAt, &i.Identity); err != nil {
+			return nil, err
+		}
+		res = append(res, &i)
+	}
+	return res, q.Err()
+}
+
+// AllHolds: list every legal hold, active or released.
+func AllHolds(db XODB) ([]*Hold, error) {
+	const sqlstr = `SELECT ` +
+		`id, case_id, item, reason, ledger, released, created_at ` +
+		`FROM legal_holds ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Hold{}
+	for q.Next() {
+		h := Hold{_exists: true}
+		if err = q.Scan(&h.ID, &h.CaseID, &h.Item, &h.Reason, &h.Ledger, &h.Released, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &h)
+	}
+	return res, q.Err()
+}
+
+// LatestFixityRun: return the most recent fixity audit.
+func LatestFixityRun(db XODB) (*FixityRun, error) {
+	const sqlstr = `SELECT ` +
+		`id, ledger, created_at, blobs, through, entries_to, failures ` +
+		`FROM fixity_runs ` +
+		`ORDER BY id DESC LIMIT 1`
+
+	XOLog(sqlstr)
+	f := FixityRun{_exists: true}
+	err := db.QueryRow(sqlstr).Scan(&f.ID, &f.Ledger, &f.CreatedAt, &f.Blobs, &f.Through, &f.EntriesTo, &f.Failures)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// LedgersAfter: list the ledger entries appended after the entry with id, in insertion order.
+func LedgersAfter(db XODB, id int) ([]*Ledger, error) {
+	const sqlstr = `SELECT ` + ledgerColumns +
+		`FROM ledger ` +
+		`WHERE id > ? ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr, id)
+	q, err := db.Query(sqlstr, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanLedgers(q)
+}
+
+// AllWebhooks: list every webhook.
+func AllWebhooks(db XODB) ([]*Webhook, error) {
+	const sqlstr = `SELECT ` +
+		`id, url, events, case_id, secret, ledger, cursor, created_at ` +
+		`FROM webhooks ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Webhook{}
+	for q.Next() {
+		w := Webhook{_exists: true}
+		if err = q.Scan(&w.ID, &w.URL, &w.Events, &w.CaseID, &w.Secret, &w.Ledger, &w.Cursor, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &w)
+	}
+	return res, q.Err()
+}
+
+// DueWebhookDeliveries: list the deliveries whose next attempt is at or before the unix time now, oldest first.
+func DueWebhookDeliveries(db XODB, now int64) ([]*WebhookDelivery, error) {
+	const sqlstr = `SELECT ` +
+		`id, webhook, ledger, event, payload, attempts, next_attempt, last_error, created_at ` +
+		`FROM webhook_deliveries ` +
+		`WHERE next_attempt <= ? ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr, now)
+	q, err := db.Query(sqlstr, now)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*WebhookDelivery{}
+	for q.Next() {
+		wd := WebhookDelivery{_exists: true}
+		if err = q.Scan(&wd.ID, &wd.Webhook, &wd.Ledger, &wd.Event, &wd.Payload, &wd.Attempts, &wd.NextAttempt, &wd.LastError, &wd.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &wd)
+	}
+	return res, q.Err()
+}
+
+// CountWebhookRows: count the rows of table, webhook_deliveries or webhook_dead_letters, that belong to webhook.
+func CountWebhookRows(db XODB, table string, webhook int) (n int, err error) {
+	sqlstr := `SELECT count(*) FROM ` + table + ` WHERE webhook = ?`
+
+	XOLog(sqlstr, webhook)
+	err = db.QueryRow(sqlstr, webhook).Scan(&n)
+	return
+}
+
+// AllPendingEntries: list every entry proposed for approval, pending, expired or appended.
+func AllPendingEntries(db XODB) ([]*PendingEntry, error) {
+	const sqlstr = `SELECT ` +
+		`id, identity, message, hash, case_id, item, threshold, approvers, roles, deadline, ledger, created_at ` +
+		`FROM pending_entries ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*PendingEntry{}
+	for q.Next() {
+		pe := PendingEntry{_exists: true}
+		if err = q.Scan(&pe.ID, &pe.Identity, &pe.Message, &pe.Hash, &pe.CaseID, &pe.Item, &pe.Threshold, &pe.Approvers, &pe.Roles, &pe.Deadline, &pe.Ledger, &pe.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &pe)
+	}
+	return res, q.Err()
+}
+
+// ApprovalsByPending: list the approvals of a pending entry in the order they were given.
+func ApprovalsByPending(db XODB, pending int) ([]*Approval, error) {
+	const sqlstr = `SELECT ` +
+		`id, pending, identity, ledger, created_at ` +
+		`FROM approvals ` +
+		`WHERE pending = ? ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr, pending)
+	q, err := db.Query(sqlstr, pending)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*Approval{}
+	for q.Next() {
+		a := Approval{_exists: true}
+		if err = q.Scan(&a.ID, &a.Pending, &a.Identity, &a.Ledger, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &a)
+	}
+	return res, q.Err()
+}
+
+// AllPolicyViolations: list every recorded policy violation.
+func AllPolicyViolations(db XODB) ([]*PolicyViolation, error) {
+	const sqlstr = `SELECT ` +
+		`id, ledger, rule, reason, created_at ` +
+		`FROM policy_violations ` +
+		`ORDER BY id`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*PolicyViolation{}
+	for q.Next() {
+		pv := PolicyViolation{_exists: true}
+		if err = q.Scan(&pv.ID, &pv.Ledger, &pv.Rule, &pv.Reason, &pv.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &pv)
+	}
+	return res, q.Err()
+}
+
+// AllEntryTypes: list every entry type.
+func AllEntryTypes(db XODB) ([]*EntryType, error) {
+	const sqlstr = `SELECT ` +
+		`id, name, schema, ledger, created_at ` +
+		`FROM entry_types ` +
+		`ORDER BY name`
+
+	XOLog(sqlstr)
+	q, err := db.Query(sqlstr)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := []*EntryType{}
+	for q.Next() {
+		et := EntryType{_exists: true}
+		if err = q.Scan(&et.ID, &et.Name, &et.Schema, &et.Ledger, &et.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, &et)
+	}
+	return res, q.Err()
+}
+
+// LedgersByFields: list the ledger entries of type entryType whose payload fields have the given values, in ledger order.
+func LedgersByFields(db XODB, entryType string, fields map[string]string) ([]*Ledger, error) {
+	sqlstr := `SELECT ` + ledgerColumns +
+		`FROM ledger ` +
+		`WHERE id IN (SELECT ledger FROM entry_fields WHERE entry_type = ?) `
+	args := []interface{}{entryType}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sqlstr += `AND id IN (SELECT ledger FROM entry_fields WHERE entry_type = ? AND name = ? AND value = ?) `
+		args = append(args, entryType, name, fields[name])
+	}
+	sqlstr += `ORDER BY id`
+
+	XOLog(sqlstr, args...)
+	q, err := db.Query(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanLedgers(q)
+}
@@ -20,6 +20,9 @@ create table if not exists ledger (
   message text not null,
   parent blob not null, -- signature of previous message
   signature blob not null, -- ecdsa signature of the message and parent fields
+  case_id text not null default '', -- the case this entry belongs to, empty if none
+  item text not null default '', -- the tag of the evidence item this entry is about, empty if none
+  imported text not null default '', -- where an imported entry came from, empty if it was signed at the time
 
   foreign key (identity) references identities(id)
 );
@@ -31,3 +34,360 @@ CREATE INDEX ledger_identity_idx
 -- so we can sort all messages by timestamp
 CREATE INDEX ledger_createdat_idx
   ON ledger (created_at);
+
+-- so we can export every entry of a case
+CREATE INDEX ledger_caseid_idx
+  ON ledger (case_id);
+
+-- so we can find the history of an evidence item
+CREATE INDEX ledger_item_idx
+  ON ledger (item);
+
+-- evidence items, each registered by a signed ledger entry
+create table if not exists items (
+  id integer not null primary key,
+  tag text not null unique, -- the evidence number written on the item
+  case_id text not null default '',
+  description text not null,
+  digest blob, -- sha256 of the item contents if it is a file
+  created_at timestamp not null,
+  identity integer not null, -- who registered the item
+  ledger integer not null default 0, -- the entry that registered it, 0 for items from before registrations were linked
+
+  foreign key (identity) references identities(id)
+);
+
+CREATE UNIQUE INDEX item_tag_idx
+  ON items (tag);
+
+CREATE INDEX item_caseid_idx
+  ON items (case_id);
+
+-- signed tree heads over the ledger in id order
+create table if not exists checkpoints (
+  id integer not null primary key,
+  created_at timestamp not null,
+  size integer not null, -- number of ledger entries covered
+  root blob not null, -- RFC 6962 Merkle tree hash of the entries
+  signature blob not null -- ecdsa signature of the server key over the checkpoint
+);
+
+CREATE INDEX checkpoint_size_idx
+  ON checkpoints (size);
+
+-- RFC 3161 timestamp tokens over the Merkle leaf hash of each ledger entry
+create table if not exists timestamps (
+  id integer not null primary key,
+  ledger integer not null unique, -- the entry the token covers
+  created_at timestamp not null,
+  token blob not null, -- DER encoded RFC 3161 TimeStampToken
+  gen_time timestamp not null, -- the time asserted by the authority
+  authority text not null, -- common name of the authority certificate
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX timestamp_ledger_idx
+  ON timestamps (ledger);
+
+-- checkpoint cosignatures by independent witness servers
+create table if not exists cosignatures (
+  id integer not null primary key,
+  checkpoint integer not null,
+  created_at timestamp not null,
+  witness blob not null, -- x509 public key of the witness
+  signature blob not null, -- ecdsa signature of the witness over the checkpoint
+
+  foreign key (checkpoint) references checkpoints(id)
+);
+
+CREATE INDEX cosignature_checkpoint_idx
+  ON cosignatures (checkpoint);
+
+-- the role of each user name, see lib/role.go for the permissions of each role
+create table if not exists roles (
+  id integer not null primary key,
+  name text not null unique,
+  role text not null,
+  granted_by integer not null, -- identity of the admin who granted the role
+  created_at timestamp not null
+);
+
+-- requests refused by access control
+create table if not exists denials (
+  id integer not null primary key,
+  created_at timestamp not null,
+  name text not null,
+  action text not null,
+  target text not null default '', -- the case, item or user the request was about
+  reason text not null
+);
+
+CREATE INDEX denial_name_idx
+  ON denials (name);
+
+-- piecewise hash lists of evidence items, see crypto/piecewise
+create table if not exists hash_lists (
+  id integer not null primary key,
+  item text not null unique,
+  ledger integer not null, -- the registration entry whose message commits to the merkle root
+  size integer not null, -- bytes in the file
+  block_size integer not null,
+  root blob not null, -- merkle root over the block hashes
+  blocks blob not null, -- the SHA-256 of every block, one after another
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX hash_list_item_idx
+  ON hash_lists (item);
+
+-- retention periods of cases and items, an item policy overrides the policy of its case
+create table if not exists retention_policies (
+  id integer not null primary key,
+  case_id text not null default '', -- set for a case policy
+  item text not null default '', -- set for an item policy
+  days integer not null, -- how long after registration the item must be kept
+  basis text not null, -- the statute or rule that sets the period
+  ledger integer not null, -- the signed entry that set the policy
+  created_at timestamp not null,
+
+  unique (case_id, item),
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX retention_case_item_idx
+  ON retention_policies (case_id, item);
+
+-- legal holds, nothing in a case or item under an active hold may be disposed
+create table if not exists legal_holds (
+  id integer not null primary key,
+  case_id text not null default '', -- set for a hold on a case
+  item text not null default '', -- set for a hold on an item
+  reason text not null,
+  ledger integer not null, -- the signed entry that placed the hold
+  released integer not null default 0, -- the signed entry that released it, 0 while active
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE INDEX legal_hold_case_idx
+  ON legal_holds (case_id);
+
+CREATE INDEX legal_hold_item_idx
+  ON legal_holds (item);
+
+-- disposed items, the signed entry is the tombstone of the item
+create table if not exists dispositions (
+  id integer not null primary key,
+  item text not null unique,
+  ledger integer not null, -- the signed disposition entry
+  digest blob, -- the SHA-256 of the contents that were disposed of
+  blob_removed boolean not null default 0, -- whether the file was deleted from the evidence store
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX disposition_item_idx
+  ON dispositions (item);
+
+-- background fixity audits of the evidence store and the ledger, see lib/fixity.go
+create table if not exists fixity_runs (
+  id integer not null primary key,
+  ledger integer not null, -- the system entry that records the run
+  created_at timestamp not null,
+  blobs integer not null, -- blobs rehashed in this run
+  through text not null, -- hex digest of the last blob rehashed, the next run continues after it
+  entries_to integer not null, -- the last ledger entry verified
+  failures integer not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+-- outbound webhooks for ledger events, see lib/webhook.go
+create table if not exists webhooks (
+  id integer not null primary key,
+  url text not null,
+  events text not null, -- comma separated event types, empty for every event
+  case_id text not null, -- only events of this case, empty for every case
+  secret text not null, -- HMAC key of the payload signatures
+  ledger integer not null, -- the entry that added the webhook
+  cursor integer not null, -- the last ledger entry queued for delivery
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+-- events waiting to be delivered, retried with backoff
+create table if not exists webhook_deliveries (
+  id integer not null primary key,
+  webhook integer not null,
+  ledger integer not null,
+  event text not null,
+  payload blob not null,
+  attempts integer not null,
+  next_attempt integer not null, -- unix time
+  last_error text not null,
+  created_at timestamp not null,
+
+  foreign key (webhook) references webhooks(id),
+  foreign key (ledger) references ledger(id)
+);
+
+create index if not exists webhook_delivery_next_idx on webhook_deliveries (next_attempt);
+
+-- events that could not be delivered after every retry
+create table if not exists webhook_dead_letters (
+  id integer not null primary key,
+  webhook integer not null,
+  ledger integer not null,
+  event text not null,
+  payload blob not null,
+  attempts integer not null,
+  last_error text not null,
+  created_at timestamp not null,
+
+  foreign key (webhook) references webhooks(id),
+  foreign key (ledger) references ledger(id)
+);
+
+-- entries that need the approval of other users before they are appended, see lib/approval.go
+create table if not exists pending_entries (
+  id integer not null primary key,
+  identity integer not null, -- the proposer, whose signature the entry carries
+  message text not null, -- the ProposalMessage, which states the requirement
+  hash blob not null,
+  case_id text not null,
+  item text not null,
+  threshold integer not null, -- how many approvals it needs
+  approvers text not null, -- comma separated names who may approve
+  roles text not null, -- comma separated roles whose holders may approve
+  deadline timestamp not null, -- the proposal expires unapproved after this
+  ledger integer not null, -- the entry once appended, 0 while pending
+  created_at timestamp not null,
+
+  foreign key (identity) references identities(id)
+);
+
+create table if not exists approvals (
+  id integer not null primary key,
+  pending integer not null,
+  identity integer not null,
+  ledger integer not null, -- the approval entry signed by the approver
+  created_at timestamp not null,
+
+  foreign key (pending) references pending_entries(id),
+  foreign key (identity) references identities(id),
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX approval_pending_identity_idx
+  ON approvals (pending, identity);
+
+-- entries appended in audit mode that break a rule of the policy, see lib/policy.go
+create table if not exists policy_violations (
+  id integer not null primary key,
+  ledger integer not null,
+  rule text not null, -- operation.rule, such as analyze.after
+  reason text not null,
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+-- the current lifecycle state of each item, a cache of its state entries in the ledger, see lib/state.go
+create table if not exists item_states (
+  id integer not null primary key,
+  item text not null unique,
+  state text not null, -- collected, in-transit, in-storage, checked-out, returned, released or destroyed
+  ledger integer not null, -- the entry that moved the item to the state, its registration for collected
+  updated_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX item_state_item_idx
+  ON item_states (item);
+
+-- entry types, JSON Schemas that the payloads of typed entries must follow, see lib/payload.go
+create table if not exists entry_types (
+  id integer not null primary key,
+  name text not null unique,
+  schema text not null, -- the JSON Schema
+  ledger integer not null, -- the entry by which an admin registered the type
+  created_at timestamp not null,
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX entry_type_name_idx
+  ON entry_types (name);
+
+-- the top level fields of the payloads of typed entries, for queries
+create table if not exists entry_fields (
+  id integer not null primary key,
+  ledger integer not null,
+  entry_type text not null,
+  name text not null,
+  value text not null, -- strings as they are, other values as JSON
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE INDEX entry_field_ledger_idx
+  ON entry_fields (ledger);
+
+CREATE INDEX entry_field_idx
+  ON entry_fields (entry_type, name, value);
+
+-- a signature is never accepted twice, see DB.Append
+CREATE INDEX ledger_hash_idx
+  ON ledger (hash);
+
+-- key rotations and revocations, see lib/keys.go
+create table if not exists key_records (
+  id integer not null primary key,
+  identity integer not null, -- the new key of a rotation, the revoked key of a revocation
+  event text not null, -- rotate or revoke
+  ledger integer not null, -- the signed entry that records the event
+  created_at timestamp not null,
+
+  foreign key (identity) references identities(id),
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE INDEX key_record_identity_idx
+  ON key_records (identity);
+
+-- the frontier of the ledger tree after each entry, see the frontier functions in lib/checkpoint.go
+create table if not exists tree_frontiers (
+  id integer not null primary key,
+  ledger integer not null, -- the last entry of the tree
+  size integer not null, -- the number of entries in the tree
+  nodes blob not null, -- the roots of its perfect subtrees, largest first, 32 bytes each
+
+  foreign key (ledger) references ledger(id)
+);
+
+CREATE UNIQUE INDEX tree_frontier_ledger_idx
+  ON tree_frontiers (ledger);
+
+-- the users who may read a case without the read all cases permission, granted by an admin
+create table if not exists case_members (
+  id integer not null primary key,
+  case_id text not null,
+  name text not null, -- the user name of the member
+  granted_by integer not null, -- identity of the admin who granted access
+  created_at timestamp not null,
+
+  foreign key (granted_by) references identities(id)
+);
+
+CREATE UNIQUE INDEX case_member_case_name_idx
+  ON case_members (case_id, name);
+
+CREATE INDEX case_member_name_idx
+  ON case_members (name);
@@ -1,18 +1,57 @@
 create table if not exists users (
-	id int primary key,
+	id integer primary key,
 	username varchar(256) not null,	
 	email varchar(256) not null unique,
 	firstname varchar(256) not null,
 	lastname varchar(256) not null,
 	usertype varchar(256) not null,
-	password varchar(256) not null,
+	password varchar(256) not null
 );
 
 create table if not exists submissions (
-	id int primary key,
+	id integer primary key,
 	filetype varchar(256) not null,
 	location varchar(256) not null,
 	email varchar(256) not null,
 	firstname varchar(256) not null,
 	lastname varchar(256) not null
 );
+
+-- only a hash of the session token is stored
+create table if not exists sessions (
+	token varchar(64) primary key,
+	email varchar(256) not null,
+	csrf varchar(64) not null,
+	created_at timestamp not null,
+	expires_at timestamp not null
+);
+
+-- uploads in progress, their data is in the evidence store
+create table if not exists partial_uploads (
+	id varchar(32) primary key,
+	email varchar(256) not null,
+	item varchar(256) not null,
+	case_id varchar(256) not null,
+	description varchar(256) not null,
+	size integer not null,
+	created_at timestamp not null
+);
+
+-- who uploaded which file of the evidence store
+create table if not exists uploads (
+	id integer primary key,
+	digest varchar(64) not null,
+	email varchar(256) not null,
+	item varchar(256) not null,
+	created_at timestamp not null
+);
+
+-- requests refused by access control
+create table if not exists denials (
+	id integer primary key,
+	created_at timestamp not null,
+	email varchar(256) not null,
+	action varchar(256) not null,
+	target varchar(256) not null,
+	reason varchar(256) not null
+);
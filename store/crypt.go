@@ -0,0 +1,511 @@
+package store
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Envelope encryption of the blobs at rest.
+// Every blob is encrypted with its own random data key under AES-256-GCM, and the data key is kept next to
+// the blob in <blob>.key, wrapped by a master key of the Keyring. Rotating the master key only rewraps
+// the small key files, the blobs themselves are never rewritten.
+// Blobs are still named by the SHA-256 of their plaintext, so deduplication and Verify work as before.
+//
+// An encrypted blob is a header followed by segments of SegmentSize bytes of plaintext, each sealed on its own,
+// so that it can be decrypted as a stream and read at any offset without decrypting what comes before.
+// The nonce of a segment is its index, which is safe because no data key encrypts more than one blob,
+// and the last segment is sealed with different additional data so that a truncated blob does not open.
+
+// SegmentSize: the plaintext bytes sealed together in an encrypted blob.
+const SegmentSize = 64 << 10
+
+// EnvKey: the environment variable that can hold the master keys instead of a key file.
+const EnvKey = "CUSTODY_STORE_KEY"
+
+// blobMagic: the first bytes of an encrypted blob, followed by the plaintext size.
+var blobMagic = []byte("custody-blob-v1\n")
+
+const headerSize = 16 + 8
+
+// Keyring: the master keys that wrap data keys, the first one wraps new keys and the rest are only used to unwrap.
+type Keyring struct {
+	keys []masterKey
+}
+
+type masterKey struct {
+	ID  string
+	key []byte
+}
+
+// KeyID: the identifier of a master key, recorded with every data key it wraps.
+func KeyID(key []byte) string {
+	h := sha256.Sum256(append([]byte("custody master key\n"), key...))
+	return hex.EncodeToString(h[:8])
+}
+
+// NewMasterKey: a random master key, in the hex form that ParseKeyring reads.
+func NewMasterKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// ParseKeyring: master keys of 32 bytes in hex or base64, separated by newlines or commas.
+// Blank lines and lines starting with # are skipped. The first key is the current one.
+func ParseKeyring(text string) (*Keyring, error) {
+	kr := &Keyring{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.Split(line, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			key, err := hex.DecodeString(field)
+			if err != nil {
+				key, err = base64.StdEncoding.DecodeString(field)
+			}
+			if err != nil || len(key) != 32 {
+				return nil, fmt.Errorf("a master key is 32 bytes in hex or base64")
+			}
+			kr.keys = append(kr.keys, masterKey{ID: KeyID(key), key: key})
+		}
+	}
+	if len(kr.keys) == 0 {
+		return nil, fmt.Errorf("no master key")
+	}
+	return kr, nil
+}
+
+// LoadKeyring: the master keys in the file at path, or if path is empty in the environment variable EnvKey.
+// Returns nil without an error if neither is set.
+func LoadKeyring(path string) (*Keyring, error) {
+	if path == "" {
+		if text := os.Getenv(EnvKey); text != "" {
+			return ParseKeyring(text)
+		}
+		return nil, nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("master key file %s can be read by other users, chmod 600 it", path)
+	}
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(text))
+}
+
+// Current: the identifier of the master key that wraps new data keys.
+func (kr *Keyring) Current() string {
+	return kr.keys[0].ID
+}
+
+// wrappedKey: the contents of a <blob>.key file.
+type wrappedKey struct {
+	Master string `json:"master"`
+	Key    []byte `json:"key"`
+}
+
+func gcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrap: seal the data key of the blob digest under the current master key.
+func (kr *Keyring) wrap(digest, dataKey []byte) (*wrappedKey, error) {
+	aead, err := gcm(kr.keys[0].key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &wrappedKey{Master: kr.keys[0].ID, Key: aead.Seal(nonce, nonce, dataKey, digest)}, nil
+}
+
+// unwrap: open the data key of the blob digest with the master key that wrapped it.
+func (kr *Keyring) unwrap(digest []byte, w *wrappedKey) ([]byte, error) {
+	for _, k := range kr.keys {
+		if k.ID != w.Master {
+			continue
+		}
+		aead, err := gcm(k.key)
+		if err != nil {
+			return nil, err
+		}
+		if len(w.Key) < aead.NonceSize() {
+			return nil, fmt.Errorf("the data key of blob %x is truncated", digest)
+		}
+		n := aead.NonceSize()
+		dataKey, err := aead.Open(nil, w.Key[:n], w.Key[n:], digest)
+		if err != nil {
+			return nil, fmt.Errorf("the data key of blob %x does not open with master key %s", digest, k.ID)
+		}
+		return dataKey, nil
+	}
+	return nil, fmt.Errorf("blob %x is wrapped by master key %s, which is not in the keyring", digest, w.Master)
+}
+
+// keyPath: where the wrapped data key of the blob with digest is kept.
+func (s *Store) keyPath(digest []byte) string {
+	return s.Path(digest) + ".key"
+}
+
+// readKey: the wrapped data key of the blob with digest, nil if the blob is stored in plaintext.
+func (s *Store) readKey(digest []byte) (*wrappedKey, error) {
+	data, err := ioutil.ReadFile(s.keyPath(digest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := &wrappedKey{}
+	if err = json.Unmarshal(data, w); err != nil {
+		return nil, fmt.Errorf("the key file of blob %x is corrupt: %s", digest, err)
+	}
+	return w, nil
+}
+
+// writeKey: replace the wrapped data key of the blob with digest in one rename.
+func (s *Store) writeKey(digest []byte, w *wrappedKey) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.Dir, "tmp"), "key-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.keyPath(digest))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// segmentAD: the additional data of segment i, which binds it to its position and marks the last segment.
+func segmentAD(i uint64, last bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, i)
+	if last {
+		ad[8] = 1
+	}
+	return ad
+}
+
+func segmentNonce(aead cipher.AEAD, i uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], i)
+	return nonce
+}
+
+// segments: how many segments hold size bytes, an empty blob still has one empty segment.
+func segments(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + SegmentSize - 1) / SegmentSize
+}
+
+// encrypt: write the size bytes of r to w as an encrypted blob under dataKey.
+func encrypt(w io.Writer, r io.Reader, size int64, dataKey []byte) error {
+	aead, err := gcm(dataKey)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, headerSize)
+	copy(header, blobMagic)
+	binary.BigEndian.PutUint64(header[16:], uint64(size))
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	buf := make([]byte, SegmentSize)
+	sealed := make([]byte, 0, SegmentSize+aead.Overhead())
+	n := segments(size)
+	for i := int64(0); i < n; i++ {
+		length := int64(SegmentSize)
+		if i == n-1 {
+			length = size - i*SegmentSize
+		}
+		if _, err = io.ReadFull(r, buf[:length]); err != nil {
+			return fmt.Errorf("blob is shorter than %d bytes: %s", size, err)
+		}
+		sealed = aead.Seal(sealed[:0], segmentNonce(aead, uint64(i)), buf[:length], segmentAD(uint64(i), i == n-1))
+		if _, err = w.Write(sealed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptFile: encrypt the size bytes of the file src, the contents of the blob digest, under a new data key.
+// Returns a temporary file with the encrypted blob and the wrapped data key to write next to it.
+func (s *Store) encryptFile(src string, digest []byte, size int64) (string, *wrappedKey, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", nil, err
+	}
+	w, err := s.Keys.wrap(digest, dataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", nil, err
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile(filepath.Join(s.Dir, "tmp"), "seal-")
+	if err != nil {
+		return "", nil, err
+	}
+	err = encrypt(out, in, size, dataKey)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0400)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", nil, err
+	}
+	return out.Name(), w, nil
+}
+
+// place: move the encrypted blob in tmp into place with its key.
+// The key file is written first, a key file next to a plaintext blob does no harm since open
+// takes a blob without the header as plaintext, while an encrypted blob without its key is lost.
+func (s *Store) place(tmp string, digest []byte, w *wrappedKey) error {
+	if err := s.writeKey(digest, w); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.Path(digest)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Blob: the contents of a blob, decrypted as they are read.
+// It is an io.ReadSeeker and io.ReaderAt over the plaintext, so it can be served with http.ServeContent.
+// Size gives the size of the plaintext.
+type Blob struct {
+	*io.SectionReader
+	Encrypted bool
+	f         *os.File
+}
+
+// Close: close the underlying file.
+func (b *Blob) Close() error {
+	return b.f.Close()
+}
+
+// decrypter: reads the plaintext of an encrypted blob at any offset, a segment at a time.
+// It is safe for concurrent use, as the piecewise hashes read blocks in parallel.
+type decrypter struct {
+	mu      sync.Mutex
+	f       *os.File
+	aead    cipher.AEAD
+	size    int64
+	cached  int64
+	segment []byte
+}
+
+func (d *decrypter) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last := segments(d.size) - 1
+	for len(p) > 0 {
+		if off >= d.size {
+			return n, io.EOF
+		}
+		i := off / SegmentSize
+		if i != d.cached {
+			if err = d.load(i, i == last); err != nil {
+				return n, err
+			}
+		}
+		c := copy(p, d.segment[off-i*SegmentSize:])
+		n += c
+		off += int64(c)
+		p = p[c:]
+	}
+	return n, nil
+}
+
+// load: read and open segment i.
+func (d *decrypter) load(i int64, last bool) error {
+	length := int64(SegmentSize)
+	if last {
+		length = d.size - i*SegmentSize
+	}
+	sealed := make([]byte, length+int64(d.aead.Overhead()))
+	if _, err := d.f.ReadAt(sealed, headerSize+i*int64(SegmentSize+d.aead.Overhead())); err != nil {
+		return fmt.Errorf("encrypted blob is truncated at segment %d: %s", i, err)
+	}
+	plain, err := d.aead.Open(sealed[:0], segmentNonce(d.aead, uint64(i)), sealed, segmentAD(uint64(i), last))
+	if err != nil {
+		d.cached = -1
+		return fmt.Errorf("segment %d of the encrypted blob does not authenticate, it was changed", i)
+	}
+	d.segment, d.cached = plain, i
+	return nil
+}
+
+// open: the blob with digest for reading, decrypting it if it is encrypted.
+// A blob is encrypted if it has a key file and starts with the blob header,
+// a key file next to a plaintext blob is left by an interrupted seal.
+func (s *Store) open(digest []byte) (*Blob, error) {
+	f, err := os.Open(s.Path(digest))
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w, err := s.readKey(digest)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if w == nil || fi.Size() < headerSize {
+		return &Blob{SectionReader: io.NewSectionReader(f, 0, fi.Size()), f: f}, nil
+	}
+	if _, err = f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if string(header[:16]) != string(blobMagic) {
+		return &Blob{SectionReader: io.NewSectionReader(f, 0, fi.Size()), f: f}, nil
+	}
+	if s.Keys == nil {
+		f.Close()
+		return nil, fmt.Errorf("blob %x is encrypted and the store has no master key", digest)
+	}
+	dataKey, err := s.Keys.unwrap(digest, w)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	aead, err := gcm(dataKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint64(header[16:]))
+	if want := headerSize + size + segments(size)*int64(aead.Overhead()); fi.Size() != want {
+		f.Close()
+		return nil, fmt.Errorf("encrypted blob %x is %d bytes, a blob of %d bytes encrypts to %d", digest, fi.Size(), size, want)
+	}
+	d := &decrypter{f: f, aead: aead, size: size, cached: -1}
+	return &Blob{SectionReader: io.NewSectionReader(d, 0, size), Encrypted: true, f: f}, nil
+}
+
+// Rekey: wrap the data key of every encrypted blob under the current master key,
+// and encrypt the blobs that are still in plaintext. Blobs already wrapped by the current key are skipped,
+// so an interrupted Rekey can be run again. Returns how many blobs were rewrapped and how many encrypted.
+func (s *Store) Rekey() (rewrapped, sealed int, err error) {
+	if s.Keys == nil {
+		return 0, 0, fmt.Errorf("the store has no master key")
+	}
+	err = s.walk(func(digest []byte) error {
+		w, err := s.readKey(digest)
+		if err != nil {
+			return err
+		}
+		b, err := s.open(digest)
+		if err != nil {
+			return err
+		}
+		encrypted, size := b.Encrypted, b.Size()
+		b.Close()
+		if !encrypted {
+			sealed++
+			return s.seal(digest, size)
+		}
+		if w.Master == s.Keys.Current() {
+			return nil
+		}
+		dataKey, err := s.Keys.unwrap(digest, w)
+		if err != nil {
+			return err
+		}
+		if w, err = s.Keys.wrap(digest, dataKey); err != nil {
+			return err
+		}
+		rewrapped++
+		return s.writeKey(digest, w)
+	})
+	return
+}
+
+// seal: encrypt a blob stored in plaintext.
+func (s *Store) seal(digest []byte, size int64) error {
+	tmp, w, err := s.encryptFile(s.Path(digest), digest, size)
+	if err != nil {
+		return err
+	}
+	return s.place(tmp, digest, w)
+}
+
+// walk: call fn with the digest of every blob in the store.
+func (s *Store) walk(fn func(digest []byte) error) error {
+	return filepath.Walk(filepath.Join(s.Dir, "blobs"), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		digest, err := hex.DecodeString(fi.Name())
+		if err != nil || len(digest) != sha256.Size {
+			return nil
+		}
+		return fn(digest)
+	})
+}
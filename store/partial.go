@@ -0,0 +1,231 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// appending: a lock per partial upload, so that chunks of one upload are written one at a time.
+var appending sync.Map
+
+// ErrOffset: a chunk was sent for an offset other than the end of the data received so far.
+// The client should ask for the offset and resume from there.
+type ErrOffset struct {
+	Offset, Expected int64
+}
+
+func (e ErrOffset) Error() string {
+	return fmt.Sprintf("chunk starts at offset %d, the upload is at offset %d", e.Offset, e.Expected)
+}
+
+// Partial: an upload that arrives in chunks and can be resumed after an interruption.
+// The running SHA-256 state is saved with the data after every chunk,
+// so the digest of the whole file is known at the end without reading it again.
+// A partial upload is not part of the store until Finish stages it.
+type Partial struct {
+	ID    string
+	store *Store
+	state partialState
+}
+
+// partialState: what is saved after each chunk.
+type partialState struct {
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	Hash   []byte `json:"hash"`
+}
+
+// NewPartial: start a partial upload of size bytes.
+func (s *Store) NewPartial(size int64) (*Partial, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("upload size %d is negative", size)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	p := &Partial{ID: hex.EncodeToString(id), store: s, state: partialState{Size: size}}
+	f, err := os.OpenFile(p.path(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if err = p.save(sha256.New()); err != nil {
+		os.Remove(p.path())
+		return nil, err
+	}
+	return p, nil
+}
+
+// OpenPartial: resume the partial upload id.
+func (s *Store) OpenPartial(id string) (*Partial, error) {
+	if b, err := hex.DecodeString(id); err != nil || len(b) != 16 {
+		return nil, fmt.Errorf("no upload %q", id)
+	}
+	p := &Partial{ID: id, store: s}
+	return p, p.load()
+}
+
+// load: read the saved state.
+func (p *Partial) load() error {
+	data, err := ioutil.ReadFile(p.path() + ".state")
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no upload %s", p.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &p.state)
+}
+
+// lock: keep other requests from changing the upload until the returned function is called.
+// The state is read again, since another request may have changed it since the upload was opened.
+func (p *Partial) lock() (func(), error) {
+	l, _ := appending.LoadOrStore(p.ID, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	mu.Lock()
+	if err := p.load(); err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return mu.Unlock, nil
+}
+
+func (p *Partial) path() string {
+	return filepath.Join(p.store.Dir, "tmp", "partial-"+p.ID)
+}
+
+// Size: the size of the whole upload.
+func (p *Partial) Size() int64 {
+	return p.state.Size
+}
+
+// Offset: how many bytes have been received, the next chunk starts here.
+func (p *Partial) Offset() int64 {
+	return p.state.Offset
+}
+
+// save: write the state with the hash h, replacing the previous state in one rename.
+func (p *Partial) save(h hash.Hash) (err error) {
+	if p.state.Hash, err = h.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return
+	}
+	data, err := json.Marshal(p.state)
+	if err != nil {
+		return
+	}
+	tmp := p.path() + ".state.tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	return os.Rename(tmp, p.path()+".state")
+}
+
+// hasher: the running hash of the data received so far.
+func (p *Partial) hasher() (hash.Hash, error) {
+	h := sha256.New()
+	err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(p.state.Hash)
+	return h, err
+}
+
+// Append: write the chunk read from r at offset, which must be the current offset.
+// If digest is not nil it is the SHA-256 of the chunk, and a chunk that does not match it is dropped.
+// Bytes past the declared size are refused. Returns the new offset.
+func (p *Partial) Append(offset int64, r io.Reader, digest []byte) (int64, error) {
+	unlock, err := p.lock()
+	if err != nil {
+		return offset, err
+	}
+	defer unlock()
+	if offset != p.state.Offset {
+		return p.state.Offset, ErrOffset{Offset: offset, Expected: p.state.Offset}
+	}
+	h, err := p.hasher()
+	if err != nil {
+		return offset, err
+	}
+	f, err := os.OpenFile(p.path(), os.O_WRONLY, 0600)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	// drop anything written after the last saved state, for example by a chunk that was cut off
+	if err = f.Truncate(offset); err != nil {
+		return offset, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	chunk := sha256.New()
+	remaining := p.state.Size - offset
+	n, err := io.Copy(io.MultiWriter(f, h, chunk), io.LimitReader(r, remaining+1))
+	switch {
+	case err != nil:
+	case n > remaining:
+		err = fmt.Errorf("chunk runs past the upload size of %d bytes", p.state.Size)
+	case digest != nil && !bytes.Equal(chunk.Sum(nil), digest):
+		err = fmt.Errorf("chunk at offset %d does not match its digest", offset)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Truncate(offset)
+		return offset, err
+	}
+	p.state.Offset += n
+	if err = p.save(h); err != nil {
+		p.state.Offset = offset
+		f.Truncate(offset)
+		return offset, err
+	}
+	return p.state.Offset, nil
+}
+
+// Finish: stage the complete upload so that it can be checked and committed to the store.
+// The upload stays a partial upload until the staged contents are committed:
+// Discard leaves it in place, so that a registration that fails can be retried without sending the data again.
+func (p *Partial) Finish() (*Staged, error) {
+	unlock, err := p.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if p.state.Offset != p.state.Size {
+		return nil, fmt.Errorf("upload %s has %d of %d bytes", p.ID, p.state.Offset, p.state.Size)
+	}
+	h, err := p.hasher()
+	if err != nil {
+		return nil, err
+	}
+	return &Staged{Digest: h.Sum(nil), Size: p.state.Size, store: p.store, tmp: p.path(), partial: p}, nil
+}
+
+// Abort: remove the partial upload.
+func (p *Partial) Abort() error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer appending.Delete(p.ID)
+	os.Remove(p.path() + ".state")
+	err = os.Remove(p.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
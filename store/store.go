@@ -0,0 +1,208 @@
+// Package store: a content addressed store for evidence files.
+// Every blob is named by the SHA-256 of its contents, computed while the contents stream in,
+// so a blob can never be overwritten by different contents and the name is its own integrity check.
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store: blobs under Dir, at blobs/<first two hex digits>/<hex digest>.
+// Writes are staged under tmp and renamed into place, so a blob is either complete or absent.
+// If Keys is set, blobs are encrypted as they are committed, see crypt.go.
+// Staged and partial uploads stay in plaintext under tmp until they are committed or discarded.
+type Store struct {
+	Dir  string
+	Keys *Keyring
+}
+
+// Open: the store in dir, created if it does not exist.
+func Open(dir string) (*Store, error) {
+	for _, sub := range []string{"blobs", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Path: where the blob with digest is stored.
+func (s *Store) Path(digest []byte) string {
+	h := hex.EncodeToString(digest)
+	if len(h) < 2 {
+		return filepath.Join(s.Dir, "blobs", h)
+	}
+	return filepath.Join(s.Dir, "blobs", h[:2], h)
+}
+
+// Has: true if the store holds the blob with digest.
+func (s *Store) Has(digest []byte) bool {
+	_, err := os.Stat(s.Path(digest))
+	return err == nil
+}
+
+// Get: open the blob with digest for reading, encrypted blobs are decrypted as they are read.
+func (s *Store) Get(digest []byte) (*Blob, error) {
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("a blob digest is %d bytes, not %d", sha256.Size, len(digest))
+	}
+	return s.open(digest)
+}
+
+// Staged: contents written to the store but not yet part of it.
+// Commit adds them under their digest, Discard throws them away.
+// Contents staged from a partial upload stay part of it until they are committed.
+type Staged struct {
+	Digest  []byte
+	Size    int64
+	store   *Store
+	tmp     string
+	partial *Partial
+}
+
+// Stage: stream r into a temporary file of the store while hashing it.
+func (s *Store) Stage(r io.Reader) (*Staged, error) {
+	f, err := ioutil.TempFile(filepath.Join(s.Dir, "tmp"), "stage-")
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &Staged{Digest: h.Sum(nil), Size: n, store: s, tmp: f.Name()}, nil
+}
+
+// Commit: move the staged contents into the store, read only, and encrypted if the store has keys.
+// If the store already holds the same contents the staged copy is dropped.
+func (st *Staged) Commit() (string, error) {
+	path := st.store.Path(st.Digest)
+	if st.store.Has(st.Digest) {
+		return path, st.remove()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if st.store.Keys != nil {
+		tmp, w, err := st.store.encryptFile(st.tmp, st.Digest, st.Size)
+		if err != nil {
+			return "", err
+		}
+		if err = st.store.place(tmp, st.Digest, w); err != nil {
+			return "", err
+		}
+		return path, st.remove()
+	}
+	if err := os.Chmod(st.tmp, 0400); err != nil {
+		return "", err
+	}
+	if err := os.Rename(st.tmp, path); err != nil {
+		return "", err
+	}
+	if st.partial != nil {
+		return path, st.partial.Abort()
+	}
+	return path, nil
+}
+
+// Open: open the staged contents for reading, to check them before they are committed.
+func (st *Staged) Open() (*os.File, error) {
+	return os.Open(st.tmp)
+}
+
+// Discard: remove the staged contents, or leave them to the partial upload they were staged from.
+func (st *Staged) Discard() error {
+	if st.partial != nil {
+		return nil
+	}
+	return st.remove()
+}
+
+// remove: delete the staged contents, and the partial upload they were staged from.
+func (st *Staged) remove() error {
+	if st.partial != nil {
+		return st.partial.Abort()
+	}
+	err := os.Remove(st.tmp)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Remove: delete the blob with digest and its key, for evidence that has been disposed of.
+// Returns false if the store did not hold the blob.
+func (s *Store) Remove(digest []byte) (bool, error) {
+	if len(digest) != sha256.Size {
+		return false, fmt.Errorf("a blob digest is %d bytes, not %d", sha256.Size, len(digest))
+	}
+	err := os.Remove(s.Path(digest))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err = os.Remove(s.keyPath(digest)); err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	return true, nil
+}
+
+// List: the digest of every blob in the store, and the files under blobs that belong to no blob,
+// such as the key of a blob that was deleted.
+func (s *Store) List() (digests [][]byte, strays []string, err error) {
+	err = filepath.Walk(filepath.Join(s.Dir, "blobs"), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		name := strings.TrimSuffix(fi.Name(), ".key")
+		digest, derr := hex.DecodeString(name)
+		switch {
+		case derr != nil || len(digest) != sha256.Size || filepath.Base(filepath.Dir(path)) != name[:2]:
+			strays = append(strays, path)
+		case name != fi.Name():
+			if !s.Has(digest) {
+				strays = append(strays, path)
+			}
+		default:
+			digests = append(digests, digest)
+		}
+		return nil
+	})
+	return
+}
+
+// Verify: hash the stored blob again and check that it still matches its digest.
+// An encrypted blob is decrypted, so a blob changed on disk fails to authenticate.
+func (s *Store) Verify(digest []byte) error {
+	f, err := s.Get(digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, digest) {
+		return fmt.Errorf("blob %x has changed, its contents hash to %x", digest, sum)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func FailTest(t *testing.T, err error, fmtstring string) {
+	if err != nil {
+		t.Fatalf(fmtstring, err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+
+	st, err := s.Stage(strings.NewReader("disk image"))
+	FailTest(t, err, "could not stage %s")
+	sum := sha256.Sum256([]byte("disk image"))
+	if string(st.Digest) != string(sum[:]) || st.Size != 10 {
+		t.Fatalf("staged %x of %d bytes", st.Digest, st.Size)
+	}
+	if s.Has(st.Digest) {
+		t.Fatal("staged contents are in the store before commit")
+	}
+	path, err := st.Commit()
+	FailTest(t, err, "could not commit %s")
+	FailTest(t, s.Verify(st.Digest), "stored blob does not verify %s")
+
+	// the same contents again are deduplicated, the staged copy is removed
+	again, err := s.Stage(strings.NewReader("disk image"))
+	FailTest(t, err, "could not stage %s")
+	if p, err := again.Commit(); err != nil || p != path {
+		t.Fatalf("second commit went to %s: %v", p, err)
+	}
+	tmp, _ := ioutil.ReadDir(s.Dir + "/tmp")
+	if len(tmp) != 0 {
+		t.Fatalf("%d staged files left behind", len(tmp))
+	}
+
+	discarded, err := s.Stage(strings.NewReader("partial"))
+	FailTest(t, err, "could not stage %s")
+	FailTest(t, discarded.Discard(), "could not discard %s")
+	if s.Has(discarded.Digest) {
+		t.Fatal("discarded contents are in the store")
+	}
+
+	// a blob that changes on disk no longer verifies
+	FailTest(t, os.Chmod(path, 0600), "%s")
+	FailTest(t, ioutil.WriteFile(path, []byte("tampered"), 0600), "%s")
+	if s.Verify(st.Digest) == nil {
+		t.Fatal("a tampered blob verified")
+	}
+}
+
+func TestPartial(t *testing.T) {
+	s, err := Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+	data := []byte("a disk image that arrives in chunks")
+	p, err := s.NewPartial(int64(len(data)))
+	FailTest(t, err, "could not start upload %s")
+
+	first := sha256.Sum256(data[:10])
+	_, err = p.Append(0, strings.NewReader(string(data[:10])), first[:])
+	FailTest(t, err, "could not append %s")
+	if _, err = p.Append(0, strings.NewReader(string(data[:10])), nil); err == nil {
+		t.Fatal("accepted a chunk at an old offset")
+	}
+	if _, err = p.Append(10, strings.NewReader(string(data[10:20])), first[:]); err == nil {
+		t.Fatal("accepted a chunk that does not match its digest")
+	}
+
+	// the upload resumes from its saved state
+	p, err = s.OpenPartial(p.ID)
+	FailTest(t, err, "could not resume upload %s")
+	if p.Offset() != 10 {
+		t.Fatalf("resumed at offset %d, not 10", p.Offset())
+	}
+	if _, err = p.Finish(); err == nil {
+		t.Fatal("finished an incomplete upload")
+	}
+	_, err = p.Append(10, strings.NewReader(string(data[10:])), nil)
+	FailTest(t, err, "could not append %s")
+	if _, err = p.Append(p.Offset(), strings.NewReader("more"), nil); err == nil {
+		t.Fatal("accepted bytes past the upload size")
+	}
+
+	st, err := p.Finish()
+	FailTest(t, err, "could not finish upload %s")
+	sum := sha256.Sum256(data)
+	if string(st.Digest) != string(sum[:]) {
+		t.Fatalf("upload hashes to %x, not %x", st.Digest, sum)
+	}
+	// a discarded upload, such as one whose registration failed, can be finished again
+	FailTest(t, st.Discard(), "could not discard upload %s")
+	p, err = s.OpenPartial(p.ID)
+	FailTest(t, err, "a discarded upload cannot be resumed %s")
+	st, err = p.Finish()
+	FailTest(t, err, "could not finish upload again %s")
+	_, err = st.Commit()
+	FailTest(t, err, "could not commit upload %s")
+	FailTest(t, s.Verify(sum[:]), "committed upload does not verify %s")
+	if _, err = s.OpenPartial(p.ID); err == nil {
+		t.Fatal("a finished upload can still be resumed")
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	s, err := Open(t.TempDir())
+	FailTest(t, err, "could not open store %s")
+	old, err := NewMasterKey()
+	FailTest(t, err, "could not generate key %s")
+
+	// a blob stored before encryption was enabled
+	legacy, err := s.Stage(strings.NewReader("stored in plaintext"))
+	FailTest(t, err, "could not stage %s")
+	_, err = legacy.Commit()
+	FailTest(t, err, "could not commit %s")
+
+	s.Keys, err = ParseKeyring(old)
+	FailTest(t, err, "could not parse keyring %s")
+	data := []byte(strings.Repeat("sector ", 3*SegmentSize/7+100))
+	st, err := s.Stage(strings.NewReader(string(data)))
+	FailTest(t, err, "could not stage %s")
+	path, err := st.Commit()
+	FailTest(t, err, "could not commit %s")
+	raw, err := ioutil.ReadFile(path)
+	FailTest(t, err, "could not read blob %s")
+	if strings.Contains(string(raw), "sector") {
+		t.Fatal("the blob is stored in plaintext")
+	}
+	FailTest(t, s.Verify(st.Digest), "encrypted blob does not verify %s")
+
+	// reads at any offset decrypt only the segments they need
+	b, err := s.Get(st.Digest)
+	FailTest(t, err, "could not open blob %s")
+	buf := make([]byte, 20)
+	_, err = b.ReadAt(buf, SegmentSize-10)
+	FailTest(t, err, "could not read across a segment %s")
+	if string(buf) != string(data[SegmentSize-10:SegmentSize+10]) || b.Size() != int64(len(data)) {
+		t.Fatalf("read %q of a blob of %d bytes", buf, b.Size())
+	}
+	b.Close()
+
+	// rotation rewraps the data keys without rewriting the blob, and encrypts the legacy blob
+	current, err := NewMasterKey()
+	FailTest(t, err, "could not generate key %s")
+	s.Keys, err = ParseKeyring(current + "\n" + old)
+	FailTest(t, err, "could not parse keyring %s")
+	rewrapped, sealed, err := s.Rekey()
+	FailTest(t, err, "could not rekey %s")
+	if rewrapped != 1 || sealed != 1 {
+		t.Fatalf("rewrapped %d and sealed %d blobs", rewrapped, sealed)
+	}
+	if again, _ := ioutil.ReadFile(path); string(again) != string(raw) {
+		t.Fatal("rotation rewrote the blob")
+	}
+	s.Keys, _ = ParseKeyring(current)
+	FailTest(t, s.Verify(st.Digest), "blob does not verify under the new master key %s")
+	FailTest(t, s.Verify(legacy.Digest), "sealed legacy blob does not verify %s")
+	s.Keys, _ = ParseKeyring(old)
+	if _, err = s.Get(st.Digest); err == nil {
+		t.Fatal("the retired master key still opens the blob")
+	}
+
+	// a changed segment does not authenticate
+	s.Keys, _ = ParseKeyring(current)
+	raw[len(raw)-40] ^= 1
+	FailTest(t, os.Chmod(path, 0600), "%s")
+	FailTest(t, ioutil.WriteFile(path, raw, 0600), "%s")
+	if s.Verify(st.Digest) == nil {
+		t.Fatal("a tampered encrypted blob verified")
+	}
+}
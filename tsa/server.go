@@ -0,0 +1,167 @@
+package tsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/digitorus/timestamp"
+	"github.com/gtank/cryptopasta"
+)
+
+// LocalPolicy: the policy under which the built-in authority issues tokens.
+// It is an example arc OID, deployments that need a registered policy should use an external authority.
+var LocalPolicy = asn1.ObjectIdentifier{2, 999, 3161, 1}
+
+// oidExtKeyUsage: the extended key usage extension, RFC 3161 requires it to be critical.
+var oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// Server: a minimal RFC 3161 time stamping authority signing with a self-signed certificate.
+type Server struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewServer: create an authority with a fresh self-signed certificate for key.
+func NewServer(key *ecdsa.PrivateKey, name string) (*Server, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 8}})
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtraExtensions:       []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: eku}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Cert: cert, Key: key}, nil
+}
+
+// LoadServer: read the authority key and certificate from dir, generating them on first use.
+// The certificate is written to dir/tsa_cert.der so that it can be handed to verifiers.
+func LoadServer(dir string) (*Server, error) {
+	keypath := filepath.Join(dir, "tsa_ecdsa")
+	certpath := filepath.Join(dir, "tsa_cert.der")
+	keybytes, err := ioutil.ReadFile(keypath)
+	if err == nil {
+		key, err := x509.ParseECPrivateKey(keybytes)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := LoadCertificate(certpath)
+		if err != nil {
+			return nil, err
+		}
+		return &Server{Cert: cert, Key: key}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	log.Printf("generating new time stamping authority in %s", dir)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := cryptopasta.NewSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewServer(key, "custody local time stamping authority")
+	if err != nil {
+		return nil, err
+	}
+	keybytes, err = x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(keypath, keybytes, 0600); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(certpath, s.Cert.Raw, 0644); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// respond: build a granted timestamp response for the request.
+func (s *Server) respond(hash crypto.Hash, digest []byte, nonce *big.Int, certs bool) ([]byte, error) {
+	ts := timestamp.Timestamp{
+		HashAlgorithm:     hash,
+		HashedMessage:     digest,
+		Time:              time.Now().UTC(),
+		Accuracy:          time.Second,
+		Policy:            LocalPolicy,
+		Nonce:             nonce,
+		AddTSACertificate: certs,
+	}
+	return ts.CreateResponseWithOpts(s.Cert, s.Key, crypto.SHA256)
+}
+
+// Stamp: issue a timestamp token over digest directly, without going through HTTP.
+func (s *Server) Stamp(digest []byte) ([]byte, error) {
+	resp, err := s.respond(crypto.SHA256, digest, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := timestamp.ParseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return ts.RawToken, nil
+}
+
+// ServeHTTP: answer RFC 3161 timestamp queries posted over HTTP.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "timestamp queries must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxMessage))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var resp []byte
+	req, err := timestamp.ParseRequest(body)
+	switch {
+	case err != nil:
+		resp, err = timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.BadDataFormat)
+	case req.HashAlgorithm != crypto.SHA256 && req.HashAlgorithm != crypto.SHA384 && req.HashAlgorithm != crypto.SHA512:
+		resp, err = timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.BadAlgorithm)
+	default:
+		resp, err = s.respond(req.HashAlgorithm, req.HashedMessage, req.Nonce, req.Certificates)
+	}
+	if err != nil {
+		log.Printf("could not create timestamp response: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
@@ -0,0 +1,128 @@
+// Package tsa: RFC 3161 trusted timestamps for ledger entries.
+// A Client requests timestamp tokens from a time stamping authority over HTTP.
+// Server is a minimal authority for deployments without an external one, and for tests.
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+// maxMessage: the largest timestamp request or response we are willing to read.
+const maxMessage = 1 << 16
+
+// Stamper: anything that can produce an RFC 3161 timestamp token for a SHA-256 digest.
+type Stamper interface {
+	Stamp(digest []byte) ([]byte, error)
+}
+
+// DefaultTimeout: how long a Client waits for the authority when its Timeout is zero.
+const DefaultTimeout = 30 * time.Second
+
+// Client: requests timestamp tokens from the time stamping authority at URL.
+// A request that takes longer than Timeout fails, so that an authority that hangs does not hang its caller.
+type Client struct {
+	URL     string
+	Timeout time.Duration
+}
+
+// Stamp: ask the authority for a timestamp token over digest.
+// The response is checked against the request before the token is returned.
+func (c *Client) Stamp(digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req := timestamp.Request{HashAlgorithm: crypto.SHA256, HashedMessage: digest, Certificates: true, Nonce: nonce}
+	der, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(c.URL, "application/timestamp-query", bytes.NewReader(der))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("time stamping authority returned %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMessage))
+	if err != nil {
+		return nil, err
+	}
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(ts.HashedMessage, digest) || ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("timestamp response does not match the request")
+	}
+	return ts.RawToken, nil
+}
+
+// Token: the verified contents of a timestamp token.
+type Token struct {
+	Time        time.Time
+	Authority   string
+	Certificate *x509.Certificate
+}
+
+// Verify: check that token is a valid timestamp over the SHA-256 digest.
+// If trusted is not nil the token must be signed by that authority,
+// otherwise the certificate carried inside the token is used.
+func Verify(token, digest []byte, trusted *x509.Certificate) (*Token, error) {
+	ts, err := timestamp.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(ts.Certificates) == 0 {
+		return nil, fmt.Errorf("timestamp token carries no certificate")
+	}
+	if ts.HashAlgorithm != crypto.SHA256 || !bytes.Equal(ts.HashedMessage, digest) {
+		return nil, fmt.Errorf("timestamp token is not over this digest")
+	}
+	cert := ts.Certificates[0]
+	if trusted != nil {
+		p7, err := pkcs7.Parse(token)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(trusted)
+		opts := x509.VerifyOptions{Roots: roots, CurrentTime: ts.Time, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}}
+		if err = p7.VerifyWithOpts(opts); err != nil {
+			return nil, fmt.Errorf("timestamp token is not signed by the trusted authority: %s", err)
+		}
+		cert = trusted
+	}
+	return &Token{Time: ts.Time, Authority: cert.Subject.CommonName, Certificate: cert}, nil
+}
+
+// LoadCertificate: read an authority certificate in DER or PEM form.
+func LoadCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
@@ -0,0 +1,78 @@
+package tsa
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+)
+
+func FailTest(t *testing.T, err error, fmtstring string) {
+	if err != nil {
+		t.Fatalf(fmtstring, err)
+	}
+}
+
+func newServer(t *testing.T, name string) *Server {
+	key, err := cryptopasta.NewSigningKey()
+	FailTest(t, err, "could not generate key: %s")
+	s, err := NewServer(key, name)
+	FailTest(t, err, "could not create authority: %s")
+	return s
+}
+
+func TestStampVerify(t *testing.T) {
+	s := newServer(t, "test authority")
+	digest := sha256.Sum256([]byte("ledger entry"))
+	token, err := s.Stamp(digest[:])
+	FailTest(t, err, "could not stamp: %s")
+
+	tok, err := Verify(token, digest[:], nil)
+	FailTest(t, err, "token did not verify: %s")
+	if tok.Authority != "test authority" {
+		t.Fatalf("wrong authority %s", tok.Authority)
+	}
+	_, err = Verify(token, digest[:], s.Cert)
+	FailTest(t, err, "token did not verify against its authority: %s")
+
+	other := sha256.Sum256([]byte("another entry"))
+	if _, err = Verify(token, other[:], nil); err == nil {
+		t.Fatal("token verified for the wrong digest")
+	}
+	if _, err = Verify(token, digest[:], newServer(t, "impostor").Cert); err == nil {
+		t.Fatal("token verified against the wrong authority")
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	s := newServer(t, "test authority")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	digest := sha256.Sum256([]byte("checkpoint"))
+	c := &Client{URL: srv.URL}
+	token, err := c.Stamp(digest[:])
+	FailTest(t, err, "could not stamp over http: %s")
+	_, err = Verify(token, digest[:], s.Cert)
+	FailTest(t, err, "token did not verify: %s")
+}
+
+func TestClientTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hung }))
+	defer srv.Close()
+	defer close(hung)
+
+	digest := sha256.Sum256([]byte("checkpoint"))
+	c := &Client{URL: srv.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := c.Stamp(digest[:]); err == nil {
+		t.Fatal("a hung authority returned a token")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("the client did not give up on a hung authority")
+	}
+}